@@ -4,6 +4,7 @@ type AccessLogDetails struct {
 	Handler                       string            `json:"handler,omitempty"`
 	CarbonapiUUID                 string            `json:"carbonapi_uuid,omitempty"`
 	Username                      string            `json:"username,omitempty"`
+	Tenant                        string            `json:"tenant,omitempty"`
 	URL                           string            `json:"url,omitempty"`
 	PeerIP                        string            `json:"peer_ip,omitempty"`
 	PeerPort                      string            `json:"peer_port,omitempty"`
@@ -8,6 +8,9 @@ import (
 	"github.com/go-graphite/carbonapi/expr"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/auth"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	"github.com/go-graphite/carbonapi/pkg/tlsconfig"
 	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
 	zipper "github.com/go-graphite/carbonapi/zipper/interfaces"
@@ -54,6 +57,28 @@ type ExpvarConfig struct {
 	PProfEnabled bool   `mapstructure:"pprofEnabled"`
 }
 
+// StreamingConfig is a config of streaming render responses
+type StreamingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// CacheMaxSize is a max size of streamed response in bytes, that is stored to the response cache
+	CacheMaxSize int `mapstructure:"cacheMaxSize"`
+}
+
+// RemoteWriteExportConfig is a config of the job, that periodically evaluates targets and pushes results
+// to Prometheus remote write endpoint
+type RemoteWriteExportConfig struct {
+	URL      string            `mapstructure:"url"`
+	Targets  []string          `mapstructure:"targets"`
+	Interval time.Duration     `mapstructure:"interval"`
+	Timeout  time.Duration     `mapstructure:"timeout"`
+	From     string            `mapstructure:"from"`
+	Headers  map[string]string `mapstructure:"headers"`
+}
+
+type ExportConfig struct {
+	RemoteWrite RemoteWriteExportConfig `mapstructure:"remoteWrite"`
+}
+
 type Listener struct {
 	Address string `mapstructure:"address"`
 
@@ -74,10 +99,12 @@ type ConfigType struct {
 	Logger                     []zapwriter.Config `mapstructure:"logger"`
 	Listen                     string             `mapstructure:"listen"`
 	Listeners                  []Listener         `mapstructure:"listeners"`
+	GRPCListeners              []Listener         `mapstructure:"grpcListeners"`
 	Buckets                    int                `mapstructure:"buckets"`
 	Concurency                 int                `mapstructure:"concurency"`
 	ResponseCacheConfig        CacheConfig        `mapstructure:"cache"`
 	BackendCacheConfig         CacheConfig        `mapstructure:"backendCache"`
+	TagCacheConfig             CacheConfig        `mapstructure:"tagCache"`
 	Cpus                       int                `mapstructure:"cpus"`
 	TimezoneString             string             `mapstructure:"tz"`
 	UnicodeRangeTables         []string           `mapstructure:"unicodeRangeTables"`
@@ -102,6 +129,8 @@ type ConfigType struct {
 	Define                     []Define           `mapstructure:"define"`
 	Prefix                     string             `mapstructure:"prefix"`
 	Expvar                     ExpvarConfig       `mapstructure:"expvar"`
+	Auth                       auth.Config        `mapstructure:"auth"`
+	Tenancy                    tenant.Config      `mapstructure:"tenancy"`
 	NotFoundStatusCode         int                `mapstructure:"notFoundStatusCode"`
 	HTTPResponseStackTrace     bool               `mapstructure:"httpResponseStackTrace"`
 	UseCachingDNSResolver      bool               `mapstructure:"useCachingDNSResolver"`
@@ -112,9 +141,20 @@ type ConfigType struct {
 
 	MaxQueryLength              uint64 `mapstructure:"maxQueryLength"`
 	CombineMultipleTargetsInOne bool   `mapstructure:"combineMultipleTargetsInOne"`
+	// EvalParallelism limits goroutines used to evaluate independent targets and function arguments of one render request
+	EvalParallelism int `mapstructure:"evalParallelism"`
+	// Streaming writes JSON and CSV render responses series by series
+	Streaming StreamingConfig `mapstructure:"streaming"`
+	Export    ExportConfig    `mapstructure:"export"`
+	// RequestDeadline limits time of render, find and tag requests, the budget is shared by fetches and evaluation
+	RequestDeadline deadline.Config `mapstructure:"requestDeadline"`
 
 	ResponseCache cache.BytesCache `mapstructure:"-" json:"-"`
 	BackendCache  cache.BytesCache `mapstructure:"-" json:"-"`
+	TagCache      cache.BytesCache `mapstructure:"-" json:"-"`
+
+	// Tenants are resolved from tenancy config, nil if there are no tenants
+	Tenants *tenant.Tenants `mapstructure:"-" json:"-"`
 
 	DefaultTimeZone *time.Location `mapstructure:"-" json:"-"`
 
@@ -159,6 +199,22 @@ var Config = ConfigType{
 		DefaultTimeoutSec: 0,
 		ShortTimeoutSec:   0,
 	},
+	TagCacheConfig: CacheConfig{
+		Type:              "mem",
+		DefaultTimeoutSec: 60,
+	},
+	Streaming: StreamingConfig{
+		CacheMaxSize: 1 << 20,
+	},
+	RequestDeadline: deadline.DefaultConfig(),
+	Export: ExportConfig{
+		RemoteWrite: RemoteWriteExportConfig{
+			Interval: time.Minute,
+			Timeout:  30 * time.Second,
+			From:     "-5min",
+		},
+	},
+	Auth:           auth.DefaultConfig(),
 	TimezoneString: "",
 	Graphite: GraphiteConfig{
 		Pattern:  "{prefix}.{fqdn}",
@@ -172,6 +228,7 @@ var Config = ConfigType{
 
 	ResponseCache: cache.NullCache{},
 	BackendCache:  cache.NullCache{},
+	TagCache:      cache.NullCache{},
 
 	DefaultTimeZone: time.Local,
 	Logger:          []zapwriter.Config{DefaultLoggerConfig},
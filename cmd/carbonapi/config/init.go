@@ -28,6 +28,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/rewrite"
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 )
 
@@ -56,6 +57,7 @@ func truncateTimeSlice(m map[time.Duration]time.Duration) ([]DurationTruncate, e
 func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 	Config.ResponseCacheConfig.MemcachedServers = viper.GetStringSlice("cache.memcachedServers")
 	Config.BackendCacheConfig.MemcachedServers = viper.GetStringSlice("backendCache.memcachedServers")
+	Config.TagCacheConfig.MemcachedServers = viper.GetStringSlice("tagCache.memcachedServers")
 	if n := viper.GetString("logger.logger"); n != "" {
 		Config.Logger[0].Logger = n
 	}
@@ -181,8 +183,23 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 
 	Config.Limiter = limiter.NewSimpleLimiter(Config.Concurency)
 
+	if err := Config.RequestDeadline.Validate(); err != nil {
+		logger.Fatal("invalid requestDeadline config",
+			zap.Error(err),
+		)
+	}
+
 	Config.ResponseCache = createCache(logger, "cache", &Config.ResponseCacheConfig)
 	Config.BackendCache = createCache(logger, "backendCache", &Config.BackendCacheConfig)
+	Config.TagCache = createCache(logger, "tagCache", &Config.TagCacheConfig)
+
+	tenants, err := tenant.New(zapwriter.Logger("tenant"), &Config.Tenancy, Config.Prefix)
+	if err != nil {
+		logger.Fatal("failed to set up tenants",
+			zap.Error(err),
+		)
+	}
+	Config.Tenants = tenants
 
 	if Config.TimezoneString != "" {
 		fields := strings.Split(Config.TimezoneString, ",")
@@ -371,6 +388,10 @@ func SetUpViper(logger *zap.Logger, configPath *string, exactConfig bool, viperP
 	viper.SetDefault("cache.size_mb", 0)
 	viper.SetDefault("cache.defaultTimeoutSec", 60)
 	viper.SetDefault("cache.memcachedServers", []string{})
+	viper.SetDefault("tagCache.type", "mem")
+	viper.SetDefault("tagCache.size_mb", 0)
+	viper.SetDefault("tagCache.defaultTimeoutSec", 60)
+	viper.SetDefault("tagCache.memcachedServers", []string{})
 	viper.SetDefault("cpus", 0)
 	viper.SetDefault("tz", "")
 	viper.SetDefault("sendGlobsAsIs", nil)
@@ -401,6 +422,7 @@ func SetUpViper(logger *zap.Logger, configPath *string, exactConfig bool, viperP
 	viper.SetDefault("useCachingDNSResolver", false)
 	viper.SetDefault("logger", map[string]string{})
 	viper.SetDefault("combineMultipleTargetsInOne", false)
+	viper.SetDefault("evalParallelism", 1)
 	viper.AutomaticEnv()
 
 	var err error
@@ -419,6 +441,43 @@ func SetUpViper(logger *zap.Logger, configPath *string, exactConfig bool, viperP
 	fconfig.Config.ExtractTagsFromArgs = Config.ExtractTagsFromArgs
 }
 
+// tenantUpstreams returns upstreams of the tenant. Backends and index of their metrics are never inherited, other
+// options which are not set for the tenant are inherited from global upstreams.
+func tenantUpstreams(global, upstreams *zipperConfig.Config) zipperConfig.Config {
+	res := *global
+	res.Backends = upstreams.Backends
+	res.BackendsV2 = upstreams.BackendsV2
+	res.Index = upstreams.Index
+	if upstreams.Timeouts.Find != 0 {
+		res.Timeouts.Find = upstreams.Timeouts.Find
+	}
+	if upstreams.Timeouts.Render != 0 {
+		res.Timeouts.Render = upstreams.Timeouts.Render
+	}
+	if upstreams.Timeouts.Connect != 0 {
+		res.Timeouts.Connect = upstreams.Timeouts.Connect
+	}
+	if upstreams.ConcurrencyLimitPerServer != 0 {
+		res.ConcurrencyLimitPerServer = upstreams.ConcurrencyLimitPerServer
+	}
+	if upstreams.MaxIdleConnsPerHost != 0 {
+		res.MaxIdleConnsPerHost = upstreams.MaxIdleConnsPerHost
+	}
+	if upstreams.MaxBatchSize != nil {
+		res.MaxBatchSize = upstreams.MaxBatchSize
+	}
+	if upstreams.MaxTries != 0 {
+		res.MaxTries = upstreams.MaxTries
+	}
+	if upstreams.KeepAliveInterval != 0 {
+		res.KeepAliveInterval = upstreams.KeepAliveInterval
+	}
+	if upstreams.SlowLogThreshold != 0 {
+		res.SlowLogThreshold = upstreams.SlowLogThreshold
+	}
+	return res
+}
+
 func SetUpConfigUpstreams(logger *zap.Logger) {
 	if Config.Zipper != "" {
 		logger.Warn("found legacy 'zipper' option, will use it instead of any 'upstreams' specified. This will be removed in future versions!")
@@ -466,6 +525,17 @@ func SetUpConfigUpstreams(logger *zap.Logger) {
 		Config.Upstreams.FallbackMaxBatchSize = Config.MaxBatchSize
 	}
 
+	for name, t := range Config.Tenancy.Tenants {
+		upstreams := tenantUpstreams(&Config.Upstreams, &t.Upstreams)
+		if len(upstreams.Backends) == 0 && len(upstreams.BackendsV2.Backends) == 0 {
+			logger.Fatal("no backends specified for tenant upstreams!",
+				zap.String("tenant", name),
+			)
+		}
+		t.Upstreams = *zipperConfig.SanitizeConfig(logger, upstreams)
+		Config.Tenancy.Tenants[name] = t
+	}
+
 	Config.Upstreams = *zipperConfig.SanitizeConfig(logger, Config.Upstreams)
 
 	if Config.Buckets != 10 {
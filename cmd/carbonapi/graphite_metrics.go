@@ -7,6 +7,8 @@ import (
 
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/http"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 
 	"github.com/cactus/go-statsd-client/v5/statsd"
 	"github.com/msaf1980/go-metrics"
@@ -90,6 +92,11 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 
 		metrics.Register("find_requests", http.ApiMetrics.FindRequests)
 		metrics.Register("render_requests", http.ApiMetrics.RenderRequests)
+		metrics.Register("tag_requests", http.ApiMetrics.TagRequests)
+		metrics.Register("tag_cache_hits", http.ApiMetrics.TagCacheHits)
+		metrics.Register("tag_cache_misses", http.ApiMetrics.TagCacheMisses)
+		metrics.Register("export.remote_write_samples", http.ApiMetrics.RemoteWriteSamples)
+		metrics.Register("export.remote_write_errors", http.ApiMetrics.RemoteWriteErrors)
 
 		if http.ApiMetrics.MemcacheTimeouts != nil {
 			metrics.Register("memcache_timeouts", http.ApiMetrics.MemcacheTimeouts)
@@ -109,14 +116,81 @@ func setupGraphiteMetrics(logger *zap.Logger) {
 		metrics.Register("zipper.info_requests", http.ZipperMetrics.InfoRequests)
 		metrics.Register("zipper.info_errors", http.ZipperMetrics.InfoErrors)
 
+		metrics.Register("zipper.tag_requests", http.ZipperMetrics.TagRequests)
+		metrics.Register("zipper.tag_errors", http.ZipperMetrics.TagErrors)
+		metrics.Register("zipper.tag_timeouts", http.ZipperMetrics.TagTimeouts)
+
 		metrics.Register("zipper.timeouts", http.ZipperMetrics.Timeouts)
 
 		metrics.Register("zipper.cache_hits", http.ZipperMetrics.CacheHits)
 		metrics.Register("zipper.cache_misses", http.ZipperMetrics.CacheMisses)
 
+		metrics.Register("zipper.shadow_requests", http.ZipperMetrics.ShadowRequests)
+		metrics.Register("zipper.shadow_errors", http.ZipperMetrics.ShadowErrors)
+		metrics.Register("zipper.shadow_mismatches", http.ZipperMetrics.ShadowMismatches)
+		metrics.Register("zipper.shadow_dropped", http.ZipperMetrics.ShadowDropped)
+
+		metrics.Register("zipper.index_hits", http.ZipperMetrics.IndexHits)
+		metrics.Register("zipper.index_misses", http.ZipperMetrics.IndexMisses)
+
+		registerCompressionMetrics(config.Config.Upstreams.BackendsV2.Backends)
+		registerRetryMetrics(config.Config.Upstreams.BackendsV2.Backends)
+		if config.Config.Tenants != nil {
+			for _, name := range config.Config.Tenants.Names() {
+				registerCompressionMetrics(config.Config.Tenancy.Tenants[name].Upstreams.BackendsV2.Backends)
+				registerRetryMetrics(config.Config.Tenancy.Tenants[name].Upstreams.BackendsV2.Backends)
+				m := config.Config.Tenants.Get(name).Metrics
+				metrics.Register("tenant."+name+".requests", m.Requests)
+				metrics.Register("tenant."+name+".rejected_requests", m.RejectedRequests)
+				metrics.Register("tenant."+name+".failed_requests", m.FailedRequests)
+				metrics.Register("tenant."+name+".zipper.requests", m.ZipperRequests)
+				metrics.Register("tenant."+name+".zipper.errors", m.ZipperErrors)
+				metrics.Register("tenant."+name+".zipper.timeouts", m.ZipperTimeouts)
+			}
+		}
+
 		metrics.RegisterRuntimeMemStats(nil)
 		go metrics.CaptureRuntimeMemStats(config.Config.Graphite.Interval)
 
 		g.Start(nil)
 	}
 }
+
+// registerCompressionMetrics registers byte counters of servers of the groups with compression enabled
+func registerCompressionMetrics(backends []zipperTypes.BackendV2) {
+	for _, backend := range backends {
+		if backend.Compression == nil {
+			continue
+		}
+		for _, server := range backend.Servers {
+			name := serverMetricName(server)
+			m := helper.ServerCompressionMetrics(server)
+			metrics.Register("zipper.backend."+name+".compressed_bytes", m.CompressedBytes)
+			metrics.Register("zipper.backend."+name+".uncompressed_bytes", m.UncompressedBytes)
+		}
+	}
+}
+
+// registerRetryMetrics registers retry counters of the groups with retry policy
+func registerRetryMetrics(backends []zipperTypes.BackendV2) {
+	for _, backend := range backends {
+		if backend.Retry == nil {
+			continue
+		}
+		name := serverMetricName(backend.GroupName)
+		m := helper.GroupRetryMetrics(backend.GroupName)
+		metrics.Register("zipper.group."+name+".retries.timeout", m.Timeout)
+		metrics.Register("zipper.group."+name+".retries.connection", m.Connection)
+		metrics.Register("zipper.group."+name+".retries.body", m.Body)
+		metrics.Register("zipper.group."+name+".retries.status", m.Status)
+		metrics.Register("zipper.group."+name+".retries.budget_exhausted", m.BudgetExhausted)
+	}
+}
+
+// serverMetricName converts server address to metric name node, e.g. http://host:8080 to host_8080
+func serverMetricName(server string) string {
+	if i := strings.Index(server, "://"); i != -1 {
+		server = server[i+3:]
+	}
+	return strings.NewReplacer(".", "_", ":", "_", "/", "_").Replace(strings.TrimSuffix(server, "/"))
+}
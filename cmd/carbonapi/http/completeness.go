@@ -0,0 +1,61 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// Headers with completeness of render and find responses
+const (
+	headerComplete        = "X-Carbonapi-Complete"
+	headerFailedGroups    = "X-Carbonapi-Failed-Groups"
+	headerTimedOutServers = "X-Carbonapi-Timed-Out-Servers"
+	headerFailedServers   = "X-Carbonapi-Failed-Servers"
+	headerSeriesFraction  = "X-Carbonapi-Series-Fraction"
+)
+
+// requireComplete returns true if the client asked for 503 instead of partial data
+func requireComplete(r *http.Request) bool {
+	return parser.TruthyBool(r.FormValue("requireComplete"))
+}
+
+// setCompletenessHeaders describes completeness of the response in its headers
+func setCompletenessHeaders(w http.ResponseWriter, c zipperTypes.Completeness) {
+	w.Header().Set(headerComplete, strconv.FormatBool(c.Complete))
+	if c.Complete {
+		return
+	}
+	if len(c.FailedGroups) > 0 {
+		w.Header().Set(headerFailedGroups, strings.Join(c.FailedGroups, ","))
+	}
+	if len(c.TimedOutServers) > 0 {
+		w.Header().Set(headerTimedOutServers, strings.Join(c.TimedOutServers, ","))
+	}
+	if len(c.FailedServers) > 0 {
+		w.Header().Set(headerFailedServers, strings.Join(c.FailedServers, ","))
+	}
+	w.Header().Set(headerSeriesFraction, strconv.FormatFloat(c.SeriesFraction, 'f', 3, 64))
+}
+
+// incompleteMessage is error message of the incomplete response, which is rejected
+func incompleteMessage(c zipperTypes.Completeness) string {
+	var b strings.Builder
+	b.WriteString("response is incomplete")
+	if len(c.FailedGroups) > 0 {
+		b.WriteString(", failed backend groups: ")
+		b.WriteString(strings.Join(c.FailedGroups, ", "))
+	}
+	if len(c.TimedOutServers) > 0 {
+		b.WriteString(", timed out servers: ")
+		b.WriteString(strings.Join(c.TimedOutServers, ", "))
+	}
+	if len(c.FailedServers) > 0 {
+		b.WriteString(", failed servers: ")
+		b.WriteString(strings.Join(c.FailedServers, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+)
+
+// withDeadline sets deadline of the request by requestDeadline config. Timeout of the config could be overridden by
+// the client with timeout parameter of the query string or the header, up to maxTimeout. Context is returned as is,
+// if deadlines are disabled, except the header, which passes remaining time to backends.
+func withDeadline(ctx context.Context, r *http.Request) (context.Context, context.CancelFunc, error) {
+	cfg := &config.Config.RequestDeadline
+	ctx = deadline.WithHeader(ctx, cfg.Header)
+	if cfg.Timeout == 0 {
+		return ctx, func() {}, nil
+	}
+
+	timeout := cfg.Timeout
+	s := r.URL.Query().Get("timeout")
+	if s == "" {
+		s = r.Header.Get(cfg.Header)
+	}
+	if s != "" {
+		t, err := deadline.ParseTimeout(s)
+		if err != nil {
+			return ctx, func() {}, err
+		}
+		timeout = t
+		if timeout > cfg.MaxTimeout {
+			timeout = cfg.MaxTimeout
+		}
+	}
+
+	ctx, _, cancel := deadline.WithBudget(ctx, timeout, cfg.FetchShare)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	saved := config.Config.RequestDeadline
+	defer func() { config.Config.RequestDeadline = saved }()
+	config.Config.RequestDeadline = deadline.DefaultConfig()
+	config.Config.RequestDeadline.Timeout = time.Minute
+	require.NoError(t, config.Config.RequestDeadline.Validate())
+
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		url           string
+		header        string
+		code          int
+		errorContains string
+	}{
+		{
+			name:    "render in time",
+			handler: renderHandler,
+			url:     "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1",
+			code:    http.StatusOK,
+		},
+		{
+			name:          "render with invalid timeout",
+			handler:       renderHandler,
+			url:           "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1&timeout=-1",
+			code:          http.StatusBadRequest,
+			errorContains: "invalid timeout",
+		},
+		{
+			name:          "render expired",
+			handler:       renderHandler,
+			url:           "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1&timeout=1ns",
+			code:          http.StatusGatewayTimeout,
+			errorContains: "stage ran out of budget",
+		},
+		{
+			name:          "find expired by header",
+			handler:       findHandler,
+			url:           "/metrics/find/?query=foo.bar&format=json",
+			header:        "1ns",
+			code:          http.StatusGatewayTimeout,
+			errorContains: "stage ran out of budget",
+		},
+		{
+			name:          "expand expired",
+			handler:       expandHandler,
+			url:           "/metrics/expand/?query=foo.bar&format=json&timeout=1ns",
+			code:          http.StatusGatewayTimeout,
+			errorContains: "stage ran out of budget",
+		},
+		{
+			name:          "info with invalid timeout",
+			handler:       infoHandler,
+			url:           "/info/?target=foo.bar&timeout=abc",
+			code:          http.StatusBadRequest,
+			errorContains: "invalid timeout",
+		},
+		{
+			name:          "info expired",
+			handler:       infoHandler,
+			url:           "/info/?target=foo.bar&format=json&timeout=1ns",
+			code:          http.StatusGatewayTimeout,
+			errorContains: "stage ran out of budget",
+		},
+		{
+			name:          "tags with invalid timeout",
+			handler:       tagHandler,
+			url:           "/tags/?timeout=abc",
+			code:          http.StatusBadRequest,
+			errorContains: "invalid timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set(deadline.DefaultHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.errorContains != "" {
+				assert.Contains(t, rr.Body.String(), tt.errorContains)
+			}
+		})
+	}
+}
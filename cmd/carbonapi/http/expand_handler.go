@@ -15,6 +15,8 @@ import (
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 )
 
@@ -24,7 +26,7 @@ func expandHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO: Migrate to context.WithTimeout
 	// ctx, _ := context.WithTimeout(context.TODO(), config.Config.ZipperTimeout)
 	ctx := utilctx.SetUUID(r.Context(), uid.String())
-	username, _, _ := r.BasicAuth()
+	username := getUsername(r)
 	requestHeaders := utilctx.GetLogHeaders(ctx)
 
 	format, ok, formatRaw := getFormat(r, treejsonFormat)
@@ -44,6 +46,7 @@ func expandHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = carbonapipb.AccessLogDetails{
 		Handler:        "expand",
 		Username:       username,
+		Tenant:         tenant.Name(r.Context()),
 		CarbonapiUUID:  uid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
@@ -60,7 +63,15 @@ func expandHandler(w http.ResponseWriter, r *http.Request) {
 		deferredAccessLogging(accessLogger, &accessLogDetails, t0, logAsError)
 	}()
 
-	err := r.ParseForm()
+	ctx, cancel, err := withDeadline(ctx, r)
+	defer cancel()
+	if err != nil {
+		setError(w, &accessLogDetails, err.Error(), http.StatusBadRequest, uid.String())
+		logAsError = true
+		return
+	}
+
+	err = r.ParseForm()
 	if err != nil {
 		setError(w, &accessLogDetails, err.Error(), http.StatusBadRequest, uid.String())
 		logAsError = true
@@ -76,7 +87,7 @@ func expandHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if queryLengthLimitExceeded(query, config.Config.MaxQueryLength) {
+	if queryLengthLimitExceeded(query, maxQueryLength(ctx)) {
 		setError(w, &accessLogDetails, "query length limit exceeded", http.StatusBadRequest, uid.String())
 		logAsError = true
 		return
@@ -88,6 +99,11 @@ func expandHandler(w http.ResponseWriter, r *http.Request) {
 	pv3Request.StopTime = until64
 
 	multiGlobs, stats, err := config.Config.ZipperInstance.Find(ctx, pv3Request)
+	if e := deadline.FromContext(ctx).Err(); e != nil {
+		setError(w, &accessLogDetails, e.Error(), http.StatusGatewayTimeout, uid.String())
+		logAsError = true
+		return
+	}
 	if stats != nil {
 		accessLogDetails.ZipperRequests = stats.ZipperRequests
 		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
@@ -0,0 +1,249 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/auth"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
+)
+
+// remoteWriteStatus is a status of the remote write export job, returned by /export/remote_write
+type remoteWriteStatus struct {
+	URL          string    `json:"url"`
+	Targets      []string  `json:"targets"`
+	Runs         uint64    `json:"runs"`
+	Failures     uint64    `json:"failures"`
+	TotalSamples uint64    `json:"totalSamples"`
+	LastRun      time.Time `json:"lastRun,omitempty"`
+	LastDuration string    `json:"lastDuration,omitempty"`
+	LastSamples  int       `json:"lastSamples"`
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+// remoteWriteExporter periodically evaluates configured targets and pushes new points to Prometheus remote write endpoint
+type remoteWriteExporter struct {
+	cfg    *config.RemoteWriteExportConfig
+	client *http.Client
+	logger *zap.Logger
+
+	// runMu serializes runs of the job
+	runMu sync.Mutex
+	// since has timestamps (ms) of the last pushed points by series, so every point is pushed once
+	since map[string]int64
+
+	mu     sync.Mutex
+	status remoteWriteStatus
+}
+
+// remoteWriteExport is the export job, nil if it's not configured
+var remoteWriteExport *remoteWriteExporter
+
+func newRemoteWriteExporter(cfg *config.RemoteWriteExportConfig, logger *zap.Logger) *remoteWriteExporter {
+	return &remoteWriteExporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		logger: logger,
+		since:  make(map[string]int64),
+		status: remoteWriteStatus{URL: cfg.URL, Targets: cfg.Targets},
+	}
+}
+
+// StartRemoteWriteExport starts the remote write export job if it's configured. Job is stopped when ctx is done.
+func StartRemoteWriteExport(ctx context.Context) {
+	cfg := &config.Config.Export.RemoteWrite
+	if cfg.URL == "" || len(cfg.Targets) == 0 {
+		return
+	}
+	logger := zapwriter.Logger("export").With(zap.String("url", cfg.URL))
+	remoteWriteExport = newRemoteWriteExporter(cfg, logger)
+
+	logger.Info("remote write export is started",
+		zap.Strings("targets", cfg.Targets),
+		zap.Duration("interval", cfg.Interval),
+	)
+	go remoteWriteExport.loop(ctx)
+}
+
+func (e *remoteWriteExporter) loop(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		_ = e.run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run evaluates targets and pushes points, that were not pushed yet
+func (e *remoteWriteExporter) run(ctx context.Context) (err error) {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	t0 := time.Now()
+	samples := 0
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic during export: %v", r)
+		}
+		e.mu.Lock()
+		e.status.Runs++
+		e.status.LastRun = t0
+		e.status.LastDuration = time.Since(t0).String()
+		e.status.LastSamples = samples
+		e.status.TotalSamples += uint64(samples)
+		if err != nil {
+			e.status.Failures++
+			e.status.LastError = err.Error()
+		} else {
+			e.status.LastError = ""
+		}
+		e.mu.Unlock()
+
+		if err != nil {
+			ApiMetrics.RemoteWriteErrors.Add(1)
+			e.logger.Error("remote write export failed",
+				zap.Duration("runtime", time.Since(t0)),
+				zap.Error(err),
+			)
+		} else {
+			ApiMetrics.RemoteWriteSamples.Add(uint64(samples))
+			e.logger.Debug("remote write export is done",
+				zap.Duration("runtime", time.Since(t0)),
+				zap.Int("samples", samples),
+			)
+		}
+	}()
+
+	// run has the budget of a request, which is shared by fetches, evaluation and the push
+	ctx, _, cancel := deadline.WithBudget(ctx, e.cfg.Timeout, config.Config.RequestDeadline.FetchShare)
+	defer cancel()
+	ctx = deadline.WithHeader(ctx, config.Config.RequestDeadline.Header)
+	// job is not a request of some user, so it can read all metrics
+	ctx = auth.WithUser(ctx, &auth.User{Name: "export", Scope: auth.ScopeAll})
+
+	now := timeNow()
+	from := date.DateParamToEpoch(e.cfg.From, "", now.Add(-5*time.Minute).Unix(), config.Config.DefaultTimeZone)
+	until := now.Unix()
+
+	values := make(map[parser.MetricRequest][]*types.MetricData)
+	results, errs, err := renderTargets(ctx, e.cfg.Targets, from, until, values)
+	if err != nil {
+		return err
+	}
+	// expired or cancelled run isn't pushed
+	if err := deadline.Check(ctx); err != nil {
+		return err
+	}
+	for target, err := range errs {
+		e.logger.Warn("failed to evaluate target",
+			zap.String("target", target),
+			zap.Error(err),
+		)
+	}
+
+	body, last, n := types.MarshalRemoteWrite(results, e.since)
+	if n == 0 {
+		return nil
+	}
+	if err = e.push(ctx, body); err != nil {
+		return err
+	}
+
+	samples = n
+	for key, ts := range last {
+		e.since[key] = ts
+	}
+	// points older than evaluated range can't be pushed again
+	for key, ts := range e.since {
+		if ts < from*1000 {
+			delete(e.since, key)
+		}
+	}
+
+	return nil
+}
+
+func (e *remoteWriteExporter) push(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.URL, bytes.NewReader(snappy.Encode(nil, body)))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "carbonapi")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (e *remoteWriteExporter) getStatus() remoteWriteStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+// exportRemoteWriteHandler returns status of the remote write export job, POST runs the job immediately
+func exportRemoteWriteHandler(w http.ResponseWriter, r *http.Request) {
+	export := remoteWriteExport
+	if export == nil {
+		http.Error(w, "remote write export is not configured", http.StatusNotFound)
+		return
+	}
+
+	code := http.StatusOK
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		// run is cancelled with the request and passes its headers to backends, job is global, so it isn't run for
+		// the tenant of the request
+		if err := export.run(tenant.WithTenant(r.Context(), nil)); err != nil {
+			code = http.StatusBadGateway
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := json.Marshal(export.getStatus())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+)
+
+// countSamples returns count of samples in remote write WriteRequest
+func countSamples(t *testing.T, b []byte) int {
+	samples := 0
+	for len(b) > 0 {
+		_, _, n := protowire.ConsumeTag(b)
+		require.True(t, n > 0)
+		series, m := protowire.ConsumeBytes(b[n:])
+		require.True(t, m > 0)
+		b = b[n+m:]
+		for len(series) > 0 {
+			num, _, n := protowire.ConsumeTag(series)
+			require.True(t, n > 0)
+			_, m := protowire.ConsumeBytes(series[n:])
+			require.True(t, m > 0)
+			series = series[n+m:]
+			if num == 2 {
+				samples++
+			}
+		}
+	}
+	return samples
+}
+
+func TestRemoteWriteExport(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []int
+		fail     bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		b, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		requests = append(requests, countSamples(t, b))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg := &config.RemoteWriteExportConfig{
+		URL:     srv.URL,
+		Targets: []string{"foo.bar"},
+		Timeout: time.Second,
+		// mock zipper returns points of 2017
+		From:    "00:00_20171117",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}
+	remoteWriteExport = newRemoteWriteExporter(cfg, zap.NewNop())
+	defer func() { remoteWriteExport = nil }()
+
+	// failed push is retried by the next run
+	fail = true
+	require.Error(t, remoteWriteExport.run(context.Background()))
+	fail = false
+
+	require.NoError(t, remoteWriteExport.run(context.Background()))
+	// all points are already pushed
+	require.NoError(t, remoteWriteExport.run(context.Background()))
+	assert.Equal(t, []int{2}, requests)
+
+	req := httptest.NewRequest("GET", "/export/remote_write", nil)
+	rr := httptest.NewRecorder()
+	exportRemoteWriteHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var status remoteWriteStatus
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.Equal(t, uint64(3), status.Runs)
+	assert.Equal(t, uint64(1), status.Failures)
+	assert.Equal(t, uint64(2), status.TotalSamples)
+	assert.Equal(t, 0, status.LastSamples)
+	assert.Empty(t, status.LastError)
+
+	// run is cancelled with the request
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = httptest.NewRequest("POST", "/export/remote_write", nil).WithContext(ctx)
+	rr = httptest.NewRecorder()
+	exportRemoteWriteHandler(rr, req)
+	require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.Equal(t, uint64(4), status.Runs)
+	assert.Contains(t, status.LastError, "context canceled")
+}
+
+func TestRemoteWriteExportNotConfigured(t *testing.T) {
+	req := httptest.NewRequest("POST", "/export/remote_write", nil)
+	rr := httptest.NewRecorder()
+	exportRemoteWriteHandler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
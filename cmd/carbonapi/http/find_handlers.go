@@ -22,8 +22,11 @@ import (
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/intervalset"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/helper"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 )
 
 // Find handler and it's helper functions
@@ -176,10 +179,8 @@ func findList(multiGlobs *pbv3.MultiGlobResponse) ([]byte, error) {
 func findHandler(w http.ResponseWriter, r *http.Request) {
 	t0 := time.Now()
 	uid := uuid.NewV4()
-	// TODO: Migrate to context.WithTimeout
-	// ctx, _ := context.WithTimeout(context.TODO(), config.Config.ZipperTimeout)
 	ctx := utilctx.SetUUID(r.Context(), uid.String())
-	username, _, _ := r.BasicAuth()
+	username := getUsername(r)
 	requestHeaders := utilctx.GetLogHeaders(ctx)
 
 	format, ok, formatRaw := getFormat(r, treejsonFormat)
@@ -198,6 +199,7 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = carbonapipb.AccessLogDetails{
 		Handler:        "find",
 		Username:       username,
+		Tenant:         tenant.Name(r.Context()),
 		CarbonapiUUID:  uid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
@@ -214,13 +216,23 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 		deferredAccessLogging(accessLogger, &accessLogDetails, t0, logAsError)
 	}()
 
+	ctx, cancel, err := withDeadline(ctx, r)
+	defer cancel()
+	if err != nil {
+		setError(w, &accessLogDetails, err.Error(), http.StatusBadRequest, uid.String())
+		logAsError = true
+		return
+	}
+	// finds of all queries share retry budgets of the backend groups
+	ctx = helper.WithRetryBudget(ctx)
+
 	if !ok || !format.ValidFindFormat() {
 		setError(w, &accessLogDetails, "unsupported format: "+formatRaw, http.StatusBadRequest, uid.String())
 		logAsError = true
 		return
 	}
 
-	if queryLengthLimitExceeded(query, config.Config.MaxQueryLength) {
+	if queryLengthLimitExceeded(query, maxQueryLength(ctx)) {
 		setError(w, &accessLogDetails, "query length limit exceeded", http.StatusBadRequest, uid.String())
 		logAsError = true
 		return
@@ -269,9 +281,22 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 	accessLogDetails.Metrics = pv3Request.Metrics
 
 	multiGlobs, stats, err := config.Config.ZipperInstance.Find(ctx, pv3Request)
+	if e := deadline.FromContext(ctx).Err(); e != nil {
+		setError(w, &accessLogDetails, e.Error(), http.StatusGatewayTimeout, uid.String())
+		logAsError = true
+		return
+	}
+	complete := zipperTypes.Completeness{Complete: true, SeriesFraction: 1}
 	if stats != nil {
 		accessLogDetails.ZipperRequests = stats.ZipperRequests
 		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
+		complete = stats.Completeness()
+	}
+	setCompletenessHeaders(w, complete)
+	if !complete.Complete && requireComplete(r) {
+		setError(w, &accessLogDetails, incompleteMessage(complete), http.StatusServiceUnavailable, uid.String())
+		logAsError = true
+		return
 	}
 	if err != nil {
 		returnCode := merry.HTTPCode(err)
@@ -10,15 +10,18 @@ import (
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/expr/metadata"
 	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/lomik/zapwriter"
+	uuid "github.com/satori/go.uuid"
 	"go.uber.org/zap"
 )
 
 func functionsHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO: Implement helper for specific functions
 	t0 := time.Now()
-	username, _, _ := r.BasicAuth()
+	uid := uuid.NewV4()
+	username := getUsername(r)
 
 	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
 
@@ -26,6 +29,8 @@ func functionsHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = carbonapipb.AccessLogDetails{
 		Handler:        "functions",
 		Username:       username,
+		Tenant:         tenant.Name(r.Context()),
+		CarbonapiUUID:  uid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
 		PeerPort:       srcPort,
@@ -56,6 +61,7 @@ func functionsHandler(w http.ResponseWriter, r *http.Request) {
 	groupedStr := r.FormValue("grouped")
 	prettyStr := r.FormValue("pretty")
 	nativeOnlyStr := r.FormValue("nativeOnly")
+	jsonp := r.FormValue("jsonp")
 	var marshaler func(interface{}) ([]byte, error)
 
 	if groupedStr == "1" {
@@ -80,6 +86,20 @@ func functionsHandler(w http.ResponseWriter, r *http.Request) {
 		function = path[2]
 	}
 
+	if function != "" {
+		metadata.FunctionMD.RLock()
+		_, ok := metadata.FunctionMD.Descriptions[function]
+		metadata.FunctionMD.RUnlock()
+		if !ok {
+			// the same response as graphite-web returns
+			b, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("Function %q not found", function)})
+			writeResponse(w, http.StatusNotFound, b, jsonFormat, jsonp, uid.String())
+			accessLogDetails.HTTPCode = http.StatusNotFound
+			accessLogDetails.Reason = "function not found"
+			return
+		}
+	}
+
 	var b []byte
 	if !nativeOnly {
 		metadata.FunctionMD.RLock()
@@ -135,7 +155,7 @@ func functionsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, _ = w.Write(b)
+	writeResponse(w, http.StatusOK, b, jsonFormat, jsonp, uid.String())
 	accessLogDetails.Runtime = time.Since(t0).Seconds()
 	accessLogDetails.HTTPCode = http.StatusOK
 
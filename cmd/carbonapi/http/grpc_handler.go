@@ -0,0 +1,296 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	pbv3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/lomik/zapwriter"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// grpcCall is a gRPC call, which is served as HTTP/2 request
+type grpcCall struct {
+	logger           *zap.Logger
+	accessLogDetails *carbonapipb.AccessLogDetails
+	logAsError       bool
+	// err rejects the call, e.x. if its timeout is invalid
+	err error
+}
+
+type grpcCallKey struct{}
+
+func grpcCallFromContext(ctx context.Context) *grpcCall {
+	return ctx.Value(grpcCallKey{}).(*grpcCall)
+}
+
+// InitGRPCHandler returns handler of gRPC API. It serves carbonapi_v3_grpc.CarbonV1 service, the same one as
+// carbonapi_v3_grpc backends, so carbonapi could be a backend of another one. FetchMetrics evaluates PathExpression
+// of each request as a target. Calls are HTTP/2 requests, so auth and tenants middlewares apply to them.
+func InitGRPCHandler(headersToPass, headersToLog []string) http.HandlerFunc {
+	s := grpc.NewServer(
+		grpc.ForceServerCodec(v3grpc.Codec{}),
+		grpc.MaxRecvMsgSize(v3grpc.MaxMessageSize),
+		grpc.UnaryInterceptor(grpcInterceptor),
+	)
+	carbonapi_v3_grpc.RegisterCarbonV1Server(s, grpcServer{})
+
+	return enrichContextWithHeaders(headersToPass, headersToLog, utilctx.ParseCtx(func(w http.ResponseWriter, r *http.Request) {
+		grpcHandler(s, w, r)
+	}, utilctx.HeaderUUIDAPI))
+}
+
+func grpcHandler(s *grpc.Server, w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	uid := uuid.NewV4()
+
+	ctx := utilctx.SetUUID(r.Context(), uid.String())
+	username := getUsername(r)
+	requestHeaders := utilctx.GetLogHeaders(ctx)
+
+	call := &grpcCall{
+		logger: zapwriter.Logger("grpc").With(
+			zap.String("carbonapi_uuid", uid.String()),
+			zap.String("username", username),
+			zap.Any("request_headers", requestHeaders),
+		),
+	}
+
+	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
+
+	accessLogger := zapwriter.Logger("access")
+	call.accessLogDetails = &carbonapipb.AccessLogDetails{
+		Handler:        "grpc",
+		Username:       username,
+		Tenant:         tenant.Name(r.Context()),
+		CarbonapiUUID:  uid.String(),
+		URL:            r.URL.Path,
+		PeerIP:         srcIP,
+		PeerPort:       srcPort,
+		Host:           r.Host,
+		Format:         "carbonapi_v3_grpc",
+		URI:            r.RequestURI,
+		RequestHeaders: requestHeaders,
+	}
+
+	// grpc-timeout of the call, if it's set, cancels the call earlier
+	ctx, cancel, err := withDeadline(ctx, r)
+	defer cancel()
+	call.err = err
+	// requests of the call share retry budgets of the backend groups
+	ctx = helper.WithRetryBudget(ctx)
+	ctx = context.WithValue(ctx, grpcCallKey{}, call)
+
+	s.ServeHTTP(w, r.WithContext(ctx))
+
+	if call.accessLogDetails.HTTPCode == 0 {
+		// call is rejected before it's handled, e.x. the method is unknown
+		call.accessLogDetails.HTTPCode = http.StatusBadRequest
+		call.logAsError = true
+	}
+	deferredAccessLogging(accessLogger, call.accessLogDetails, t0, call.logAsError)
+}
+
+// grpcInterceptor rejects invalid calls and records status of the call to the access log
+func grpcInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	call := grpcCallFromContext(ctx)
+	if call.err != nil {
+		err = status.Error(codes.InvalidArgument, call.err.Error())
+	} else {
+		resp, err = handler(ctx, req)
+	}
+
+	s := status.Convert(err)
+	call.accessLogDetails.HTTPCode = int32(v3grpc.HTTPStatus(s.Code()))
+	if err != nil {
+		call.accessLogDetails.Reason = s.Message()
+	}
+	call.logAsError = s.Code() != codes.OK && s.Code() != codes.NotFound
+	return resp, err
+}
+
+// grpcStatus returns gRPC status, which corresponds to HTTP code of the error
+func grpcStatus(err merry.Error) error {
+	if merry.Is(err, zipperTypes.ErrNotFound) {
+		return status.Error(codes.NotFound, helper.MerryRootError(err))
+	}
+	if merry.Is(err, parser.ErrInvalidArg) {
+		return status.Error(codes.InvalidArgument, helper.MerryRootError(err))
+	}
+	code := v3grpc.StatusCode(merry.HTTPCode(err))
+	if code == codes.OK {
+		code = codes.Internal
+	}
+	return status.Error(code, helper.MerryRootError(err))
+}
+
+// grpcServer implements carbonapi_v3_grpc.CarbonV1 service
+type grpcServer struct{}
+
+func (grpcServer) GetVersion(ctx context.Context, _ *empty.Empty) (*carbonapi_v3_grpc.ProtocolVersionResponse, error) {
+	grpcCallFromContext(ctx).accessLogDetails.Handler = "grpc_version"
+	return &carbonapi_v3_grpc.ProtocolVersionResponse{Version: 3}, nil
+}
+
+// FetchMetrics evaluates targets. Requests of the call with the same MaxDataPoints share fetched metrics.
+func (grpcServer) FetchMetrics(ctx context.Context, req *pbv3.MultiFetchRequest) (res *pbv3.MultiFetchResponse, err error) {
+	call := grpcCallFromContext(ctx)
+	accessLogDetails := call.accessLogDetails
+
+	targets := make([]string, 0, len(req.Metrics))
+	for _, m := range req.Metrics {
+		target := m.PathExpression
+		if target == "" {
+			target = m.Name
+		}
+		targets = append(targets, target)
+	}
+	accessLogDetails.Handler = "grpc_render"
+	accessLogDetails.Targets = targets
+	if len(targets) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no targets specified")
+	}
+	if queryLengthLimitExceeded(targets, maxQueryLength(ctx)) {
+		return nil, status.Error(codes.InvalidArgument, "total target length limit exceeded")
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			call.logger.Error("panic during eval:",
+				zap.Strings("targets", targets),
+				zap.Any("reason", rec),
+				zap.Stack("stack"),
+			)
+			res, err = nil, status.Errorf(codes.Internal, "%v", rec)
+		}
+	}()
+
+	valuesByMaxDataPoints := make(map[int64]map[parser.MetricRequest][]*types.MetricData)
+	var targetErr merry.Error
+	res = &pbv3.MultiFetchResponse{}
+	for i, m := range req.Metrics {
+		if m.StartTime >= m.StopTime {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid or empty time range for target %s", targets[i])
+		}
+		values, ok := valuesByMaxDataPoints[m.MaxDataPoints]
+		if !ok {
+			values = make(map[parser.MetricRequest][]*types.MetricData)
+			valuesByMaxDataPoints[m.MaxDataPoints] = values
+		}
+		queryCtx := utilctx.SetMaxDatapoints(ctx, m.MaxDataPoints)
+		results, errs, err := renderTargets(queryCtx, targets[i:i+1], m.StartTime, m.StopTime, values)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		if e := deadline.FromContext(ctx).Err(); e != nil {
+			return nil, grpcStatus(e)
+		}
+		for _, e := range errs {
+			if targetErr == nil {
+				targetErr = e
+			}
+		}
+		for _, r := range results {
+			res.Metrics = append(res.Metrics, r.FetchResponse)
+		}
+	}
+
+	if len(res.Metrics) == 0 {
+		if targetErr != nil {
+			return nil, grpcStatus(targetErr)
+		}
+		return nil, status.Error(codes.NotFound, "no metrics found")
+	}
+	if targetErr != nil {
+		accessLogDetails.HaveNonFatalErrors = true
+	}
+	return res, nil
+}
+
+func (grpcServer) FindMetrics(ctx context.Context, req *pbv3.MultiGlobRequest) (*pbv3.MultiGlobResponse, error) {
+	accessLogDetails := grpcCallFromContext(ctx).accessLogDetails
+	accessLogDetails.Handler = "grpc_find"
+	accessLogDetails.Metrics = req.Metrics
+	if len(req.Metrics) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no query specified")
+	}
+	if queryLengthLimitExceeded(req.Metrics, maxQueryLength(ctx)) {
+		return nil, status.Error(codes.InvalidArgument, "query length limit exceeded")
+	}
+
+	multiGlobs, stats, err := config.Config.ZipperInstance.Find(ctx, *req)
+	if e := deadline.FromContext(ctx).Err(); e != nil {
+		return nil, grpcStatus(e)
+	}
+	if stats != nil {
+		accessLogDetails.ZipperRequests = stats.ZipperRequests
+		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
+	}
+	if err != nil && (merry.HTTPCode(err) != http.StatusOK || multiGlobs == nil) {
+		return nil, grpcStatus(err)
+	}
+	return multiGlobs, nil
+}
+
+// MetricsInfo returns info of the metrics from all backends
+func (grpcServer) MetricsInfo(ctx context.Context, req *pbv3.MultiMetricsInfoRequest) (*pbv3.MultiMetricsInfoResponse, error) {
+	accessLogDetails := grpcCallFromContext(ctx).accessLogDetails
+	accessLogDetails.Handler = "grpc_info"
+	accessLogDetails.Metrics = req.Names
+	if len(req.Names) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no target specified")
+	}
+
+	data, stats, err := config.Config.ZipperInstance.Info(ctx, req.Names)
+	if e := deadline.FromContext(ctx).Err(); e != nil {
+		return nil, grpcStatus(e)
+	}
+	if stats != nil {
+		accessLogDetails.ZipperRequests = stats.ZipperRequests
+		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
+	}
+	if err != nil {
+		return nil, grpcStatus(err)
+	}
+
+	servers := make([]string, 0, len(data.Info))
+	for server := range data.Info {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	res := &pbv3.MultiMetricsInfoResponse{}
+	for _, server := range servers {
+		res.Metrics = append(res.Metrics, data.Info[server].Metrics...)
+	}
+	return res, nil
+}
+
+func (grpcServer) ListMetrics(ctx context.Context, _ *empty.Empty) (*pbv3.ListMetricsResponse, error) {
+	grpcCallFromContext(ctx).accessLogDetails.Handler = "grpc_list"
+	return nil, status.Error(codes.Unimplemented, "list of metrics is not supported")
+}
+
+func (grpcServer) Stats(ctx context.Context, _ *empty.Empty) (*pbv3.MetricDetailsResponse, error) {
+	grpcCallFromContext(ctx).accessLogDetails.Handler = "grpc_stats"
+	return nil, status.Error(codes.Unimplemented, "stats are not supported")
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// newGRPCServer serves gRPC API in plain text HTTP/2, as grpcListeners without TLS do
+func newGRPCServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(h2c.NewHandler(InitGRPCHandler(nil, nil), &http2.Server{}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newGRPCClient(t *testing.T) carbonapi_v3_grpc.CarbonV1Client {
+	srv := newGRPCServer(t)
+	conn, err := grpc.NewClient(strings.TrimPrefix(srv.URL, "http://"),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(v3grpc.Codec{})),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return carbonapi_v3_grpc.NewCarbonV1Client(conn)
+}
+
+func TestGRPCFetch(t *testing.T) {
+	c := newGRPCClient(t)
+
+	res, err := c.FetchMetrics(context.Background(), &pb.MultiFetchRequest{Metrics: []pb.FetchRequest{
+		{PathExpression: "fallbackSeries(foo.bar,foo.baz)", StartTime: 1510913280, StopTime: 1510913880},
+	}})
+	require.NoError(t, err)
+	if assert.Len(t, res.Metrics, 1) {
+		assert.Equal(t, "foo.bar", res.Metrics[0].Name)
+		assert.Equal(t, int64(60), res.Metrics[0].StepTime)
+	}
+
+	_, err = c.FetchMetrics(context.Background(), &pb.MultiFetchRequest{Metrics: []pb.FetchRequest{
+		{PathExpression: "sum(foo.bar", StartTime: 1510913280, StopTime: 1510913880},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "invalid target should be rejected: %v", err)
+}
+
+func TestGRPCFindInfo(t *testing.T) {
+	c := newGRPCClient(t)
+
+	globs, err := c.FindMetrics(context.Background(), &pb.MultiGlobRequest{Metrics: []string{"foo.bar"}})
+	require.NoError(t, err)
+	assert.Equal(t, *getGlobResponse(), *globs)
+
+	info, err := c.MetricsInfo(context.Background(), &pb.MultiMetricsInfoRequest{Names: []string{"foo.bar"}})
+	require.NoError(t, err)
+	assert.Equal(t, getMockInfoResponse().Info["http://127.0.0.1:8080"].Metrics, info.Metrics)
+
+	version, err := c.GetVersion(context.Background(), &empty.Empty{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version.Version)
+
+	_, err = c.ListMetrics(context.Background(), &empty.Empty{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestGRPCDeadline(t *testing.T) {
+	saved := config.Config.RequestDeadline
+	defer func() { config.Config.RequestDeadline = saved }()
+	config.Config.RequestDeadline = deadline.DefaultConfig()
+	config.Config.RequestDeadline.Timeout = time.Minute
+	require.NoError(t, config.Config.RequestDeadline.Validate())
+
+	c := newGRPCClient(t)
+	withTimeout := func(timeout string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), deadline.DefaultHeader, timeout)
+	}
+
+	_, err := c.FindMetrics(withTimeout("1ns"), &pb.MultiGlobRequest{Metrics: []string{"foo.bar"}})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "expired request: %v", err)
+
+	_, err = c.FindMetrics(withTimeout("abc"), &pb.MultiGlobRequest{Metrics: []string{"foo.bar"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "invalid timeout: %v", err)
+
+	_, err = c.FetchMetrics(withTimeout("1ns"), &pb.MultiFetchRequest{Metrics: []pb.FetchRequest{
+		{PathExpression: "foo.bar", StartTime: 1510913280, StopTime: 1510913880},
+	}})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err), "expired render: %v", err)
+}
+
+func TestGRPCFetchMaxDataPoints(t *testing.T) {
+	c := newGRPCClient(t)
+
+	calls := mockRenderCalls.Load()
+	res, err := c.FetchMetrics(context.Background(), &pb.MultiFetchRequest{Metrics: []pb.FetchRequest{
+		{PathExpression: "foo.bar", StartTime: 1510913280, StopTime: 1510913880},
+		{PathExpression: "sumSeries(foo.bar)", StartTime: 1510913280, StopTime: 1510913880},
+		{PathExpression: "foo.bar", StartTime: 1510913280, StopTime: 1510913880, MaxDataPoints: 1},
+	}})
+	require.NoError(t, err)
+	assert.Len(t, res.Metrics, 3)
+	// requests with the same maxDataPoints share fetched metrics
+	assert.Equal(t, int64(2), mockRenderCalls.Load()-calls)
+}
+
+func TestGRPCBackend(t *testing.T) {
+	srv := newGRPCServer(t)
+
+	// carbonapi is a backend of another one
+	cfg := zipperTypes.BackendV2{GroupName: "carbonapi", Protocol: "carbonapi_v3_grpc", Servers: []string{srv.URL}}
+	cfg.FillDefaults()
+	limit, tries, batch, keepAlive := 10, 1, 100, time.Second
+	cfg.ConcurrencyLimit, cfg.MaxTries, cfg.MaxBatchSize, cfg.KeepAliveInterval = &limit, &tries, &batch, &keepAlive
+	backend, merr := v3grpc.New(zap.NewNop(), cfg, true, false)
+	require.NoError(t, merr)
+
+	res, _, merr := backend.Fetch(context.Background(), &pb.MultiFetchRequest{Metrics: []pb.FetchRequest{
+		{PathExpression: "sumSeries(foo.bar)", StartTime: 1510913280, StopTime: 1510913880},
+	}})
+	require.NoError(t, merr)
+	if assert.Len(t, res.Metrics, 1) {
+		assert.Equal(t, "sumSeries(foo.bar)", res.Metrics[0].Name)
+	}
+
+	globs, _, merr := backend.Find(context.Background(), &pb.MultiGlobRequest{Metrics: []string{"foo.bar"}})
+	require.NoError(t, merr)
+	assert.Equal(t, *getGlobResponse(), *globs)
+}
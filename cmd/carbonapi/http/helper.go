@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"net/http"
@@ -9,7 +10,9 @@ import (
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/auth"
 	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	"github.com/lomik/zapwriter"
 	"go.uber.org/zap"
 )
@@ -19,6 +22,35 @@ type responseFormat int
 // for testing
 var timeNow = time.Now
 
+// cacheKeySuffix returns suffix of the cache keys, which separates responses of the tenants and of the users with different scopes
+func cacheKeySuffix(ctx context.Context) string {
+	var suffix string
+	if ns := tenant.CacheKey(ctx); ns != "" {
+		suffix += " tenant:" + ns
+	}
+	if scope := auth.CacheKey(ctx); scope != "" {
+		suffix += " scope:" + scope
+	}
+	return suffix
+}
+
+// maxQueryLength returns query length limit of the request tenant
+func maxQueryLength(ctx context.Context) uint64 {
+	if t := tenant.FromContext(ctx); t != nil && t.MaxQueryLength > 0 {
+		return t.MaxQueryLength
+	}
+	return config.Config.MaxQueryLength
+}
+
+// getUsername returns name of the authenticated user or user from basic authentication header
+func getUsername(r *http.Request) string {
+	if user := auth.UserFromContext(r.Context()); user != nil {
+		return user.Name
+	}
+	username, _, _ := r.BasicAuth()
+	return username
+}
+
 const (
 	jsonFormat responseFormat = iota
 	treejsonFormat
@@ -30,6 +62,10 @@ const (
 	protoV3Format
 	pickleFormat
 	completerFormat
+	arrowFormat
+	parquetFormat
+	dataframeFormat
+	openmetricsFormat
 )
 
 const (
@@ -58,6 +94,14 @@ func (r responseFormat) String() string {
 		return "svg"
 	case completerFormat:
 		return "completer"
+	case arrowFormat:
+		return "arrow"
+	case parquetFormat:
+		return "parquet"
+	case dataframeFormat:
+		return "dataframe"
+	case openmetricsFormat:
+		return "openmetrics"
 	default:
 		return "unknown"
 	}
@@ -113,6 +157,14 @@ func (r responseFormat) ValidRenderFormat() bool {
 		return true
 	case rawFormat:
 		return true
+	case arrowFormat:
+		return true
+	case parquetFormat:
+		return true
+	case dataframeFormat:
+		return true
+	case openmetricsFormat:
+		return true
 	default:
 		return false
 	}
@@ -131,19 +183,51 @@ var knownFormats = map[string]responseFormat{
 	"raw":             rawFormat,
 	"svg":             svgFormat,
 	"completer":       completerFormat,
+	"arrow":           arrowFormat,
+	"parquet":         parquetFormat,
+	"dataframe":       dataframeFormat,
+	"openmetrics":     openmetricsFormat,
 }
 
 const (
-	contentTypeJSON       = "application/json"
-	contentTypeProtobuf   = "application/x-protobuf"
-	contentTypeJavaScript = "text/javascript"
-	contentTypeRaw        = "text/plain"
-	contentTypePickle     = "application/pickle"
-	contentTypePNG        = "image/png"
-	contentTypeCSV        = "text/csv"
-	contentTypeSVG        = "image/svg+xml"
+	contentTypeJSON        = "application/json"
+	contentTypeProtobuf    = "application/x-protobuf"
+	contentTypeJavaScript  = "text/javascript"
+	contentTypeRaw         = "text/plain"
+	contentTypePickle      = "application/pickle"
+	contentTypePNG         = "image/png"
+	contentTypeCSV         = "text/csv"
+	contentTypeSVG         = "image/svg+xml"
+	contentTypeArrow       = "application/vnd.apache.arrow.stream"
+	contentTypeParquet     = "application/vnd.apache.parquet"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
 )
 
+// maxFormMemory is a memory limit of multipart forms, rest of the form is stored in temporary files
+const maxFormMemory = 10 << 20
+
+// parseForm parses parameters of the query and of the POST body, either url-encoded or multipart
+func parseForm(r *http.Request) error {
+	if mediaType(r) == "multipart/form-data" {
+		err := r.ParseMultipartForm(maxFormMemory)
+		if r.MultipartForm != nil {
+			// only values of the form are used
+			_ = r.MultipartForm.RemoveAll()
+		}
+		return err
+	}
+	return r.ParseForm()
+}
+
+// mediaType returns media type of the request body without parameters
+func mediaType(r *http.Request) string {
+	ct := r.Header.Get("Content-Type")
+	if n := strings.IndexByte(ct, ';'); n >= 0 {
+		ct = ct[:n]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
 func getFormat(r *http.Request, defaultFormat responseFormat) (responseFormat, bool, string) {
 	format := r.FormValue("format")
 
@@ -176,6 +260,10 @@ func writeResponse(w http.ResponseWriter, returnCode int, b []byte, format respo
 			w.WriteHeader(returnCode)
 			_, _ = w.Write(b)
 		}
+	case dataframeFormat:
+		w.Header().Set("Content-Type", contentTypeJSON)
+		w.WriteHeader(returnCode)
+		_, _ = w.Write(b)
 	case protoV2Format, protoV3Format:
 		w.Header().Set("Content-Type", contentTypeProtobuf)
 		w.WriteHeader(returnCode)
@@ -199,6 +287,19 @@ func writeResponse(w http.ResponseWriter, returnCode int, b []byte, format respo
 		w.Header().Set("Content-Type", contentTypeSVG)
 		w.WriteHeader(returnCode)
 		_, _ = w.Write(b)
+	case arrowFormat:
+		w.Header().Set("Content-Type", contentTypeArrow)
+		w.WriteHeader(returnCode)
+		_, _ = w.Write(b)
+	case parquetFormat:
+		w.Header().Set("Content-Type", contentTypeParquet)
+		w.Header().Set("Content-Disposition", `attachment; filename="render.parquet"`)
+		w.WriteHeader(returnCode)
+		_, _ = w.Write(b)
+	case openmetricsFormat:
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+		w.WriteHeader(returnCode)
+		_, _ = w.Write(b)
 	}
 }
 
@@ -268,6 +369,11 @@ func deferredAccessLogging(accessLogger *zap.Logger, accessLogDetails *carbonapi
 	accessLogDetails.Runtime = time.Since(t).Seconds()
 	if logAsError {
 		accessLogger.Error("request failed", zap.Any("data", *accessLogDetails))
+		if accessLogDetails.Tenant != "" && config.Config.Tenants != nil {
+			if t := config.Config.Tenants.Get(accessLogDetails.Tenant); t != nil {
+				t.Metrics.FailedRequests.Add(1)
+			}
+		}
 		if config.Config.Upstreams.ExtendedStat {
 			switch accessLogDetails.HTTPCode {
 			case 400:
@@ -1,12 +1,15 @@
 package http
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/auth"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 )
 
 func Test_timestampTruncate(t *testing.T) {
@@ -121,3 +124,34 @@ func Test_queryLengthLimitExceeded(t *testing.T) {
 		})
 	}
 }
+
+func Test_cacheKeySuffix(t *testing.T) {
+	scope, err := auth.NewScope([]string{"team_a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantA := &tenant.Tenant{Name: "a", CacheNamespace: "ns_a", MaxQueryLength: 10}
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		want           string
+		maxQueryLength uint64
+	}{
+		{"global", context.Background(), "", config.Config.MaxQueryLength},
+		{"tenant", tenant.WithTenant(context.Background(), tenantA), " tenant:ns_a", 10},
+		{"scope", auth.WithUser(context.Background(), &auth.User{Name: "alice", Scope: scope}), " scope:team_a", config.Config.MaxQueryLength},
+		{"all", auth.WithUser(context.Background(), &auth.User{Name: "alice", Scope: auth.ScopeAll}), "", config.Config.MaxQueryLength},
+		{"tenant and scope", tenant.WithTenant(auth.WithUser(context.Background(), &auth.User{Name: "alice", Scope: scope}), tenantA), " tenant:ns_a scope:team_a", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheKeySuffix(tt.ctx); got != tt.want {
+				t.Errorf("cacheKeySuffix() = %q, want %q", got, tt.want)
+			}
+			if got := maxQueryLength(tt.ctx); got != tt.maxQueryLength {
+				t.Errorf("maxQueryLength() = %d, want %d", got, tt.maxQueryLength)
+			}
+		})
+	}
+}
@@ -11,6 +11,8 @@ import (
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 
 	"github.com/lomik/zapwriter"
@@ -22,7 +24,7 @@ func infoHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO: Migrate to context.WithTimeout
 	// ctx, _ := context.WithTimeout(context.TODO(), config.Config.ZipperTimeout)
 	ctx := utilctx.SetUUID(r.Context(), uuid.String())
-	username, _, _ := r.BasicAuth()
+	username := getUsername(r)
 	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
 	format, ok, formatRaw := getFormat(r, jsonFormat)
 
@@ -32,6 +34,7 @@ func infoHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = carbonapipb.AccessLogDetails{
 		Handler:        "info",
 		Username:       username,
+		Tenant:         tenant.Name(r.Context()),
 		CarbonapiUUID:  uuid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
@@ -48,6 +51,14 @@ func infoHandler(w http.ResponseWriter, r *http.Request) {
 		deferredAccessLogging(accessLogger, &accessLogDetails, t0, logAsError)
 	}()
 
+	ctx, cancel, err := withDeadline(ctx, r)
+	defer cancel()
+	if err != nil {
+		setError(w, &accessLogDetails, err.Error(), http.StatusBadRequest, uuid.String())
+		logAsError = true
+		return
+	}
+
 	if !ok || !format.ValidFindFormat() {
 		http.Error(w, "unsupported format: "+formatRaw, http.StatusBadRequest)
 		accessLogDetails.HTTPCode = http.StatusBadRequest
@@ -66,6 +77,11 @@ func infoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data, stats, err := config.Config.ZipperInstance.Info(ctx, query)
+	if e := deadline.FromContext(ctx).Err(); e != nil {
+		setError(w, &accessLogDetails, e.Error(), http.StatusGatewayTimeout, uuid.String())
+		logAsError = true
+		return
+	}
 	if stats != nil {
 		accessLogDetails.ZipperRequests = stats.ZipperRequests
 		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
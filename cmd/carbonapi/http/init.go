@@ -10,6 +10,20 @@ import (
 	"github.com/go-graphite/carbonapi/util/ctx"
 )
 
+// UntenantedPaths returns prefixes of the paths, which don't reach backends, so they are served without tenant
+func UntenantedPaths() []string {
+	prefix := config.Config.Prefix
+	return []string{
+		prefix + "/lb_check",
+		prefix + "/version",
+		prefix + "/functions",
+		prefix + "/_internal/capabilities",
+		prefix + "/debug/",
+		// export jobs are global
+		prefix + "/export/",
+	}
+}
+
 func InitHandlers(headersToPass, headersToLog []string) *http.ServeMux {
 	r := http.NewServeMux()
 	r.HandleFunc(config.Config.Prefix+"/render/", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(renderHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
@@ -38,6 +52,8 @@ func InitHandlers(headersToPass, headersToLog []string) *http.ServeMux {
 	r.HandleFunc(config.Config.Prefix+"/_internal/capabilities", enrichContextWithHeaders(headersToPass, headersToLog, capabilityHandler))
 	r.HandleFunc(config.Config.Prefix+"/_internal/capabilities/", enrichContextWithHeaders(headersToPass, headersToLog, capabilityHandler))
 
+	r.HandleFunc(config.Config.Prefix+"/export/remote_write", enrichContextWithHeaders(headersToPass, headersToLog, exportRemoteWriteHandler))
+
 	r.HandleFunc(config.Config.Prefix+"/", enrichContextWithHeaders(headersToPass, headersToLog, usageHandler))
 
 	if config.Config.Expvar.Enabled {
@@ -19,12 +19,15 @@ import (
 
 type mockCarbonZipper struct{}
 
+// mockStats are stats of Find and Render responses of mockCarbonZipper
+var mockStats *zipperTypes.Stats
+
 func newMockCarbonZipper() *mockCarbonZipper {
 	return new(mockCarbonZipper)
 }
 
 func (z mockCarbonZipper) Find(ctx context.Context, request pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
-	return getGlobResponse(), nil, nil
+	return getGlobResponse(), mockStats, nil
 }
 
 func (z mockCarbonZipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, merry.Error) {
@@ -34,6 +37,8 @@ func (z mockCarbonZipper) Info(ctx context.Context, metrics []string) (*pb.Zippe
 }
 
 func (z mockCarbonZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	mockRenderCalls.Add(1)
+	zipperTypes.CollectCompleteness(ctx, mockStats)
 	return z.RenderCompat(ctx, []string{""}, 0, 0)
 }
 
@@ -44,12 +49,36 @@ func (z mockCarbonZipper) RenderCompat(ctx context.Context, metrics []string, fr
 	return result, nil, nil
 }
 
-func (z mockCarbonZipper) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return []string{}, nil
+func (z mockCarbonZipper) TagNames(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	return []string{"name", "host", "dc"}, &zipperTypes.Stats{ZipperRequests: 1, TagRequests: 1}, nil
+}
+
+func (z mockCarbonZipper) TagValues(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	mockTagValuesCalls.Add(1)
+	if mockTagValuesWait != nil {
+		select {
+		case <-mockTagValuesWait:
+		case <-ctx.Done():
+			return nil, nil, merry.Wrap(ctx.Err())
+		}
+	}
+	return []string{"a", "b"}, &zipperTypes.Stats{ZipperRequests: 2, TagRequests: 2}, nil
+}
+
+func (z mockCarbonZipper) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return []string{"foo.bar;dc=a", "foo.bar;dc=b"}, nil
+}
+
+func (z mockCarbonZipper) TagDetails(ctx context.Context, tag, filter string) (*zipperTypes.TagDetails, merry.Error) {
+	return &zipperTypes.TagDetails{Tag: tag, Values: []zipperTypes.TagValue{{Count: 2, Value: "a"}, {Count: 1, Value: "b"}}}, nil
+}
+
+func (z mockCarbonZipper) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return paths, nil
 }
 
-func (z mockCarbonZipper) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return []string{}, nil
+func (z mockCarbonZipper) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return nil
 }
 
 func (z mockCarbonZipper) ScaleToCommonStep() bool {
@@ -29,6 +29,13 @@ var ApiMetrics = struct {
 
 	FindRequests metrics.Counter
 
+	TagRequests    metrics.Counter
+	TagCacheHits   metrics.Counter
+	TagCacheMisses metrics.Counter
+
+	RemoteWriteSamples metrics.Counter
+	RemoteWriteErrors  metrics.Counter
+
 	MemcacheTimeouts metrics.UGauge
 
 	CacheSize  metrics.UGauge
@@ -50,6 +57,13 @@ var ApiMetrics = struct {
 	Requests5xx: metrics.NewCounter(),
 
 	FindRequests: metrics.NewCounter(),
+
+	TagRequests:    metrics.NewCounter(),
+	TagCacheHits:   metrics.NewCounter(),
+	TagCacheMisses: metrics.NewCounter(),
+
+	RemoteWriteSamples: metrics.NewCounter(),
+	RemoteWriteErrors:  metrics.NewCounter(),
 }
 
 var ZipperMetrics = struct {
@@ -67,10 +81,22 @@ var ZipperMetrics = struct {
 	InfoTimeouts metrics.Counter
 	InfoErrors   metrics.Counter
 
+	TagRequests metrics.Counter
+	TagTimeouts metrics.Counter
+	TagErrors   metrics.Counter
+
 	Timeouts metrics.Counter
 
 	CacheMisses metrics.Counter
 	CacheHits   metrics.Counter
+
+	ShadowRequests   metrics.Counter
+	ShadowErrors     metrics.Counter
+	ShadowMismatches metrics.Counter
+	ShadowDropped    metrics.Counter
+
+	IndexHits   metrics.Counter
+	IndexMisses metrics.Counter
 }{
 	FindRequests: metrics.NewCounter(),
 	FindTimeouts: metrics.NewCounter(),
@@ -86,10 +112,22 @@ var ZipperMetrics = struct {
 	InfoTimeouts: metrics.NewCounter(),
 	InfoErrors:   metrics.NewCounter(),
 
+	TagRequests: metrics.NewCounter(),
+	TagTimeouts: metrics.NewCounter(),
+	TagErrors:   metrics.NewCounter(),
+
 	Timeouts: metrics.NewCounter(),
 
 	CacheHits:   metrics.NewCounter(),
 	CacheMisses: metrics.NewCounter(),
+
+	ShadowRequests:   metrics.NewCounter(),
+	ShadowErrors:     metrics.NewCounter(),
+	ShadowMismatches: metrics.NewCounter(),
+	ShadowDropped:    metrics.NewCounter(),
+
+	IndexHits:   metrics.NewCounter(),
+	IndexMisses: metrics.NewCounter(),
 }
 
 func ZipperStats(stats *zipperTypes.Stats) {
@@ -106,9 +144,18 @@ func ZipperStats(stats *zipperTypes.Stats) {
 	ZipperMetrics.InfoRequests.Add(stats.InfoRequests)
 	ZipperMetrics.InfoTimeouts.Add(stats.InfoTimeouts)
 	ZipperMetrics.InfoErrors.Add(stats.InfoErrors)
+	ZipperMetrics.TagRequests.Add(stats.TagRequests)
+	ZipperMetrics.TagTimeouts.Add(stats.TagTimeouts)
+	ZipperMetrics.TagErrors.Add(stats.TagErrors)
 	ZipperMetrics.SearchRequests.Add(stats.SearchRequests)
 	ZipperMetrics.CacheMisses.Add(stats.CacheMisses)
 	ZipperMetrics.CacheHits.Add(stats.CacheHits)
+	ZipperMetrics.ShadowRequests.Add(stats.ShadowRequests)
+	ZipperMetrics.ShadowErrors.Add(stats.ShadowErrors)
+	ZipperMetrics.ShadowMismatches.Add(stats.ShadowMismatches)
+	ZipperMetrics.ShadowDropped.Add(stats.ShadowDropped)
+	ZipperMetrics.IndexHits.Add(stats.IndexHits)
+	ZipperMetrics.IndexMisses.Add(stats.IndexMisses)
 }
 
 func SetupMetrics(logger *zap.Logger) {
@@ -0,0 +1,281 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ansel1/merry"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/date"
+	exprhelper "github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// renderQuery is a query of the batch render request, options have the same meaning as /render parameters
+type renderQuery struct {
+	ID              string   `json:"id"`
+	Targets         []string `json:"targets"`
+	From            string   `json:"from"`
+	Until           string   `json:"until"`
+	Tz              string   `json:"tz"`
+	MaxDataPoints   int64    `json:"maxDataPoints"`
+	Format          string   `json:"format"`
+	NoNullPoints    bool     `json:"noNullPoints"`
+	TimestampFormat string   `json:"timestampFormat"`
+	Heatmap         bool     `json:"heatmap"`
+}
+
+type renderBatchRequest struct {
+	Queries         []renderQuery `json:"queries"`
+	NoCache         bool          `json:"noCache"`
+	RequireComplete bool          `json:"requireComplete"`
+}
+
+// renderBatchResult is a result of the query, either series in format=json or error with HTTP code,
+// and completeness of the fetched series
+type renderBatchResult struct {
+	Series       json.RawMessage           `json:"series,omitempty"`
+	Error        string                    `json:"error,omitempty"`
+	Code         int                       `json:"code,omitempty"`
+	Completeness *zipperTypes.Completeness `json:"completeness,omitempty"`
+}
+
+// isBatchRequest checks if the request is a batch render request with JSON body
+func isBatchRequest(r *http.Request) bool {
+	return r.Method == http.MethodPost && mediaType(r) == contentTypeJSON
+}
+
+// parseRenderBatch decodes batch render request. Body is either an object with queries or an array of queries.
+func parseRenderBatch(r *http.Request, w http.ResponseWriter) (*renderBatchRequest, error) {
+	body := http.MaxBytesReader(w, r.Body, maxFormMemory)
+	var raw json.RawMessage
+	if err := json.NewDecoder(body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+
+	req := &renderBatchRequest{}
+	raw = bytes.TrimSpace(raw)
+	var err error
+	if len(raw) > 0 && raw[0] == '[' {
+		err = json.Unmarshal(raw, &req.Queries)
+	} else {
+		err = json.Unmarshal(raw, req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request body: %w", err)
+	}
+
+	if len(req.Queries) == 0 {
+		return nil, fmt.Errorf("no queries in the request")
+	}
+	ids := make(map[string]bool, len(req.Queries))
+	for i := range req.Queries {
+		q := &req.Queries[i]
+		if q.ID == "" {
+			return nil, fmt.Errorf("query %d has no id", i)
+		}
+		if ids[q.ID] {
+			return nil, fmt.Errorf("duplicate query id '%s'", q.ID)
+		}
+		ids[q.ID] = true
+		if q.Format != "" && q.Format != "json" {
+			return nil, fmt.Errorf("query %s: unsupported format specified: %s, only json is supported in batch requests", q.ID, q.Format)
+		}
+		if _, ok := getTimestampMultiplier(q.TimestampFormat); !ok {
+			return nil, fmt.Errorf("query %s: %s", q.ID, errUnsupportedTimestampFormat)
+		}
+	}
+
+	return req, nil
+}
+
+// renderBatch handles /render POST with JSON body. Queries are evaluated one by one and share fetched metrics,
+// so a metric requested by several queries for the same time range is fetched once. Backends could consolidate
+// fetched metrics by maxDataPoints, so only queries with the same maxDataPoints share them. Completeness of the query
+// covers metrics fetched for all queries, which share them with it.
+// Response is JSON object with results of the queries by their ids, completeness headers describe the whole batch.
+// Returns true if request is failed.
+func renderBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, logger *zap.Logger, accessLogDetails *carbonapipb.AccessLogDetails, carbonapiUUID string) (logAsError bool) {
+	req, err := parseRenderBatch(r, w)
+	if err != nil {
+		setError(w, accessLogDetails, err.Error(), http.StatusBadRequest, carbonapiUUID)
+		return true
+	}
+
+	var targets []string
+	for _, q := range req.Queries {
+		targets = append(targets, q.Targets...)
+	}
+	accessLogDetails.Format = "json"
+	accessLogDetails.Targets = targets
+	accessLogDetails.UseCache = !req.NoCache
+
+	if queryLengthLimitExceeded(targets, maxQueryLength(ctx)) {
+		setError(w, accessLogDetails, "total target length limit exceeded", http.StatusBadRequest, carbonapiUUID)
+		return true
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger.Error("panic during eval:",
+				zap.Strings("targets", targets),
+				zap.Any("reason", rec),
+				zap.Stack("stack"),
+			)
+			logAsError = true
+			var answer string
+			if config.Config.HTTPResponseStackTrace {
+				answer = fmt.Sprintf("%v\nStack trace: %v", rec, zap.Stack("").String)
+			} else {
+				answer = fmt.Sprint(rec)
+			}
+			setError(w, accessLogDetails, answer, http.StatusInternalServerError, carbonapiUUID)
+		}
+	}()
+
+	ctx, completeness := zipperTypes.WithCompletenessCollector(ctx)
+	now := timeNow()
+	cacheSuffix := cacheKeySuffix(ctx)
+	groups := make(map[int64]*renderBatchGroup)
+	response := make(map[string]renderBatchResult, len(req.Queries))
+	size := 0
+	haveErrors := false
+	for _, q := range req.Queries {
+		group, ok := groups[q.MaxDataPoints]
+		if !ok {
+			group = &renderBatchGroup{values: make(map[parser.MetricRequest][]*types.MetricData)}
+			group.ctx, group.completeness = zipperTypes.WithCompletenessCollector(utilctx.SetMaxDatapoints(ctx, q.MaxDataPoints))
+			groups[q.MaxDataPoints] = group
+		}
+		res, querySize, failed := renderBatchQuery(logger, r, &q, now, !req.NoCache, cacheSuffix, group, accessLogDetails)
+		size += querySize
+		if failed {
+			haveErrors = true
+		}
+		response[q.ID] = res
+	}
+	if err := deadline.FromContext(ctx).Err(); err != nil {
+		setError(w, accessLogDetails, err.Error(), http.StatusGatewayTimeout, carbonapiUUID)
+		return true
+	}
+
+	complete := completeness.Completeness()
+	setCompletenessHeaders(w, complete)
+	if !complete.Complete && (req.RequireComplete || requireComplete(r)) {
+		setError(w, accessLogDetails, incompleteMessage(complete), http.StatusServiceUnavailable, carbonapiUUID)
+		return true
+	}
+
+	body, e := json.Marshal(response)
+	if e != nil {
+		setError(w, accessLogDetails, e.Error(), http.StatusInternalServerError, carbonapiUUID)
+		return true
+	}
+
+	accessLogDetails.Metrics = targets
+	accessLogDetails.CarbonzipperResponseSizeBytes = int64(size)
+	accessLogDetails.CarbonapiResponseSizeBytes = int64(len(body))
+	accessLogDetails.HaveNonFatalErrors = haveErrors
+
+	writeResponse(w, http.StatusOK, body, jsonFormat, "", carbonapiUUID)
+	return false
+}
+
+// renderBatchGroup is a group of queries of the batch with the same maxDataPoints, which share fetched metrics
+type renderBatchGroup struct {
+	ctx          context.Context
+	completeness *zipperTypes.CompletenessCollector
+	values       map[parser.MetricRequest][]*types.MetricData
+}
+
+// renderBatchQuery evaluates query of the batch, it returns result of the query, size of the fetched metrics and true if query has errors
+func renderBatchQuery(logger *zap.Logger, r *http.Request, q *renderQuery, now time.Time, useCache bool, cacheSuffix string,
+	group *renderBatchGroup, accessLogDetails *carbonapipb.AccessLogDetails) (renderBatchResult, int, bool) {
+	from32 := date.DateParamToEpoch(q.From, q.Tz, now.Add(-24*time.Hour).Unix(), config.Config.DefaultTimeZone)
+	until32 := date.DateParamToEpoch(q.Until, q.Tz, now.Unix(), config.Config.DefaultTimeZone)
+
+	var backendCacheKey string
+	duration := time.Second * time.Duration(until32-from32)
+	if len(config.Config.TruncateTime) > 0 {
+		from32 = timestampTruncate(from32, duration, config.Config.TruncateTime)
+		until32 = timestampTruncate(until32, duration, config.Config.TruncateTime)
+		duration = time.Second * time.Duration(until32-from32)
+		backendCacheKey = backendCacheComputeKeyAbs(from32, until32, q.Targets, q.MaxDataPoints, q.NoNullPoints)
+	} else {
+		backendCacheKey = backendCacheComputeKey(q.From, q.Until, q.Targets, q.MaxDataPoints, q.NoNullPoints)
+	}
+	backendCacheKey += cacheSuffix
+
+	if from32 >= until32 {
+		return renderBatchResult{Error: "Invalid or empty time range", Code: http.StatusBadRequest}, 0, true
+	}
+
+	results, err := backendCacheFetchResults(logger, useCache, backendCacheKey, accessLogDetails)
+	errors := make(map[string]merry.Error)
+	// cached results are complete
+	complete := zipperTypes.Completeness{Complete: true, SeriesFraction: 1}
+	if err != nil {
+		ApiMetrics.BackendCacheMisses.Add(1)
+
+		results, errors, err = renderTargets(group.ctx, q.Targets, from32, until32, group.values)
+		if err != nil {
+			return renderBatchResult{Error: err.Error(), Code: http.StatusBadRequest}, 0, true
+		}
+		complete = group.completeness.Completeness()
+
+		// incomplete results are not cached
+		if len(errors) == 0 && useCache && complete.Complete {
+			backendCacheTimeout := getCacheTimeout(logger, r, now.Unix(), until32, duration, &config.Config.BackendCacheConfig)
+			if backendCacheTimeout > 0 {
+				backendCacheStoreResults(logger, backendCacheKey, results, backendCacheTimeout)
+			}
+		}
+	}
+
+	size := 0
+	for _, result := range results {
+		size += result.Size()
+	}
+
+	if len(results) == 0 || (len(errors) > 0 && config.Config.Upstreams.RequireSuccessAll) {
+		code, errMsgs := helper.MergeHttpErrorMap(errors)
+		if code == http.StatusNotFound {
+			code = config.Config.NotFoundStatusCode
+		}
+		if code == http.StatusBadRequest || code == http.StatusNotFound || code == http.StatusForbidden || code >= 500 {
+			msg, _ := joinErrors(errMsgs, "\n", code)
+			return renderBatchResult{Error: msg, Code: code, Completeness: &complete}, size, true
+		}
+	}
+
+	if q.Heatmap {
+		results = exprhelper.Heatmap(results)
+	}
+	if q.MaxDataPoints != 0 {
+		// fetched series are shared with other queries of the batch, so they are consolidated in copies
+		consolidated := make([]*types.MetricData, len(results))
+		for i := range results {
+			consolidated[i] = results[i].CopyLinkTags()
+		}
+		results = consolidated
+		types.ConsolidateJSON(q.MaxDataPoints, results)
+	}
+	timestampMultiplier, _ := getTimestampMultiplier(q.TimestampFormat)
+
+	return renderBatchResult{
+		Series:       types.MarshalJSON(results, timestampMultiplier, q.NoNullPoints),
+		Completeness: &complete,
+	}, size, len(errors) > 0
+}
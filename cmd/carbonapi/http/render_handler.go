@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -23,10 +24,14 @@ import (
 	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/expr"
 	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
+	exprhelper "github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
 	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/helper"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 )
 
 func cleanupParams(r *http.Request) {
@@ -40,6 +45,9 @@ func cleanupParams(r *http.Request) {
 	r.Form.Del("_salt")
 	r.Form.Del("_ts")
 	r.Form.Del("_t") // Used by jquery.graphite.js
+
+	// timeout limits the request, it doesn't change the response
+	r.Form.Del("timeout")
 }
 
 func getCacheTimeout(logger *zap.Logger, r *http.Request, now32, until32 int64, duration time.Duration, cacheConfig *config.CacheConfig) int32 {
@@ -68,10 +76,8 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	t0 := time.Now()
 	uid := uuid.NewV4()
 
-	// TODO: Migrate to context.WithTimeout
-	// ctx, _ := context.WithTimeout(context.TODO(), config.Config.ZipperTimeout)
 	ctx := utilctx.SetUUID(r.Context(), uid.String())
-	username, _, _ := r.BasicAuth()
+	username := getUsername(r)
 	requestHeaders := utilctx.GetLogHeaders(ctx)
 
 	logger := zapwriter.Logger("render").With(
@@ -86,6 +92,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = &carbonapipb.AccessLogDetails{
 		Handler:        "render",
 		Username:       username,
+		Tenant:         tenant.Name(r.Context()),
 		CarbonapiUUID:  uid.String(),
 		URL:            r.URL.RequestURI(),
 		PeerIP:         srcIP,
@@ -101,7 +108,22 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		deferredAccessLogging(accessLogger, accessLogDetails, t0, logAsError)
 	}()
 
-	err := r.ParseForm()
+	ctx, cancel, err := withDeadline(ctx, r)
+	defer cancel()
+	if err != nil {
+		setError(w, accessLogDetails, err.Error(), http.StatusBadRequest, uid.String())
+		logAsError = true
+		return
+	}
+	// fetches of all targets share retry budgets of the backend groups
+	ctx = helper.WithRetryBudget(ctx)
+
+	if isBatchRequest(r) {
+		logAsError = renderBatch(ctx, w, r, logger, accessLogDetails, uid.String())
+		return
+	}
+
+	err = parseForm(r)
 	if err != nil {
 		setError(w, accessLogDetails, err.Error(), http.StatusBadRequest, uid.String())
 		logAsError = true
@@ -116,8 +138,10 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	ctx = utilctx.SetMaxDatapoints(ctx, maxDataPoints)
 	useCache := !parser.TruthyBool(r.FormValue("noCache"))
 	noNullPoints := parser.TruthyBool(r.FormValue("noNullPoints"))
+	heatmap := parser.TruthyBool(r.FormValue("heatmap"))
+	align := parser.TruthyBool(r.FormValue("align"))
 	// status will be checked later after we'll setup everything else
-	format, ok, formatRaw := getFormat(r, pngFormat)
+	format, formatOk, formatRaw := getFormat(r, pngFormat)
 
 	var jsonp string
 
@@ -126,23 +150,25 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		jsonp = r.FormValue("jsonp")
 	}
 
-	timestampFormat := strings.ToLower(r.FormValue("timestampFormat"))
-	if timestampFormat == "" {
-		timestampFormat = "s"
+	timestampMultiplier, ok := getTimestampMultiplier(r.FormValue("timestampFormat"))
+	if !ok {
+		setError(w, accessLogDetails, errUnsupportedTimestampFormat, http.StatusBadRequest, uid.String())
+		logAsError = true
+		return
 	}
 
-	timestampMultiplier := int64(1)
-	switch timestampFormat {
-	case "s":
-		timestampMultiplier = 1
-	case "ms", "millisecond", "milliseconds":
-		timestampMultiplier = 1000
-	case "us", "microsecond", "microseconds":
-		timestampMultiplier = 1000000
-	case "ns", "nanosecond", "nanoseconds":
-		timestampMultiplier = 1000000000
-	default:
-		setError(w, accessLogDetails, "unsupported timestamp format, supported: 's', 'ms', 'us', 'ns'", http.StatusBadRequest, uid.String())
+	// layout of the columnar formats, long (row per point) or wide (column per series)
+	wideLayout, ok := getWideLayout(r.FormValue("layout"))
+	if !ok {
+		setError(w, accessLogDetails, errUnsupportedLayout, http.StatusBadRequest, uid.String())
+		logAsError = true
+		return
+	}
+
+	// points of the series written by openmetrics format, last value or all of them
+	allPoints, ok := getAllPoints(r.FormValue("points"))
+	if !ok {
+		setError(w, accessLogDetails, errUnsupportedPoints, http.StatusBadRequest, uid.String())
 		logAsError = true
 		return
 	}
@@ -170,6 +196,18 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		// recalc duration
 		duration = time.Second * time.Duration(until32-from32)
 		responseCacheKey = responseCacheComputeKey(from32, until32, targets, formatRaw, maxDataPoints, noNullPoints, template)
+		if heatmap {
+			responseCacheKey += " heatmap"
+		}
+		if wideLayout {
+			responseCacheKey += " layout:wide"
+		}
+		if align {
+			responseCacheKey += " align"
+		}
+		if allPoints {
+			responseCacheKey += " points:all"
+		}
 		if useCache {
 			responseCacheTimeout = getCacheTimeout(logger, r, now32, until32, duration, &config.Config.ResponseCacheConfig)
 			backendCacheTimeout = getCacheTimeout(logger, r, now32, until32, duration, &config.Config.BackendCacheConfig)
@@ -181,6 +219,9 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 			backendCacheTimeout = getCacheTimeout(logger, r, now32, until32, duration, &config.Config.BackendCacheConfig)
 		}
 	}
+	// tenants and users with different scopes get different metrics for the same targets
+	cacheSuffix := cacheKeySuffix(ctx)
+	responseCacheKey += cacheSuffix
 
 	accessLogDetails.UseCache = useCache
 	accessLogDetails.FromRaw = from
@@ -192,7 +233,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	accessLogDetails.Format = formatRaw
 	accessLogDetails.Targets = targets
 
-	if !ok || !format.ValidRenderFormat() {
+	if !formatOk || !format.ValidRenderFormat() {
 		setError(w, accessLogDetails, "unsupported format specified: "+formatRaw, http.StatusBadRequest, uid.String())
 		logAsError = true
 		return
@@ -221,7 +262,7 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if queryLengthLimitExceeded(targets, config.Config.MaxQueryLength) {
+	if queryLengthLimitExceeded(targets, maxQueryLength(ctx)) {
 		setError(w, accessLogDetails, "total target length limit exceeded", http.StatusBadRequest, uid.String())
 		logAsError = true
 		return
@@ -278,69 +319,43 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		backendCacheKey = backendCacheComputeKey(from, until, targets, maxDataPoints, noNullPoints)
 	}
+	backendCacheKey += cacheSuffix
 
 	results, err := backendCacheFetchResults(logger, useCache, backendCacheKey, accessLogDetails)
 
+	var completeness *zipperTypes.CompletenessCollector
 	if err != nil {
 		ApiMetrics.BackendCacheMisses.Add(1)
 
-		results = make([]*types.MetricData, 0)
 		values := make(map[parser.MetricRequest][]*types.MetricData)
-
-		if config.Config.CombineMultipleTargetsInOne && len(targets) > 0 {
-			exprs := make([]parser.Expr, 0, len(targets))
-			for _, target := range targets {
-				exp, e, err := parser.ParseExpr(target)
-				if err != nil || e != "" {
-					msg := buildParseErrorString(target, e, err)
-					setError(w, accessLogDetails, msg, http.StatusBadRequest, uid.String())
-					logAsError = true
-					return
-				}
-				exprs = append(exprs, exp)
-			}
-
-			ApiMetrics.RenderRequests.Add(1)
-
-			result, errs := expr.FetchAndEvalExprs(ctx, config.Config.Evaluator, exprs, from32, until32, values)
-			if errs != nil {
-				errors = errs
-			}
-
-			results = append(results, result...)
-		} else {
-			for _, target := range targets {
-				exp, e, err := parser.ParseExpr(target)
-				if err != nil || e != "" {
-					msg := buildParseErrorString(target, e, err)
-					setError(w, accessLogDetails, msg, http.StatusBadRequest, uid.String())
-					logAsError = true
-					return
-				}
-
-				ApiMetrics.RenderRequests.Add(1)
-
-				result, err := expr.FetchAndEvalExp(ctx, config.Config.Evaluator, exp, from32, until32, values)
-				if err != nil {
-					errors[target] = merry.Wrap(err)
-					if config.Config.Upstreams.RequireSuccessAll {
-						code := merry.HTTPCode(err)
-						if code != http.StatusOK && code != http.StatusNotFound {
-							break
-						}
-					}
-				}
-
-				results = append(results, result...)
-			}
+		var evalCtx context.Context
+		evalCtx, completeness = zipperTypes.WithCompletenessCollector(ctx)
+		results, errors, err = renderTargets(evalCtx, targets, from32, until32, values)
+		if err != nil {
+			setError(w, accessLogDetails, err.Error(), http.StatusBadRequest, uid.String())
+			logAsError = true
+			return
+		}
+		if err := deadline.FromContext(ctx).Err(); err != nil {
+			setError(w, accessLogDetails, err.Error(), http.StatusGatewayTimeout, uid.String())
+			logAsError = true
+			return
 		}
 
-		if len(errors) == 0 && backendCacheTimeout > 0 {
+		if len(errors) == 0 && completeness.Completeness().Complete && backendCacheTimeout > 0 {
 			w.Header().Set("X-Carbonapi-Backend-Cached", strconv.FormatInt(int64(backendCacheTimeout), 10))
 			backendCacheStoreResults(logger, backendCacheKey, results, backendCacheTimeout)
 		}
 	}
 
+	complete := completeness.Completeness()
+	setCompletenessHeaders(w, complete)
+	if !complete.Complete && requireComplete(r) {
+		setError(w, accessLogDetails, incompleteMessage(complete), http.StatusServiceUnavailable, uid.String())
+		logAsError = true
+		return
+	}
+
 	size := 0
 	for _, result := range results {
 		size += result.Size()
@@ -368,13 +383,43 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	switch format {
-	case jsonFormat:
+	if format == jsonFormat {
+		if heatmap {
+			results = exprhelper.Heatmap(results)
+		}
 		if maxDataPoints != 0 {
 			types.ConsolidateJSON(maxDataPoints, results)
 			accessLogDetails.MaxDataPoints = maxDataPoints
 		}
+	}
+
+	accessLogDetails.Metrics = targets
+	accessLogDetails.CarbonzipperResponseSizeBytes = int64(size)
+	accessLogDetails.HaveNonFatalErrors = len(errors) > 0
+
+	if config.Config.Streaming.Enabled && isStreamFormat(format) && len(results) > 0 {
+		body, written, err := streamResponse(ctx, w, returnCode, results, format, jsonp, timestampMultiplier, noNullPoints, uid.String())
+		accessLogDetails.CarbonapiResponseSizeBytes = int64(written)
+		if err != nil {
+			logger.Warn("render response is not completed",
+				zap.Int("written_bytes", written),
+				zap.Error(err),
+			)
+			accessLogDetails.Reason = err.Error()
+			logAsError = true
+			return
+		}
+		if body != nil && complete.Complete {
+			tc := time.Now()
+			config.Config.ResponseCache.Set(responseCacheKey, body, responseCacheTimeout)
+			td := time.Since(tc).Nanoseconds()
+			ApiMetrics.RequestsCacheOverheadNS.Add(uint64(td))
+		}
+		return
+	}
 
+	switch format {
+	case jsonFormat:
 		body = types.MarshalJSON(results, timestampMultiplier, noNullPoints)
 	case protoV2Format:
 		body, err = types.MarshalProtobufV2(results)
@@ -394,6 +439,22 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		body = types.MarshalRaw(results)
 	case csvFormat:
 		body = types.MarshalCSV(results)
+	case dataframeFormat:
+		if align && len(results) > 0 {
+			results = exprhelper.ScaleSeries(results)
+		}
+		if maxDataPoints != 0 {
+			types.ConsolidateJSON(maxDataPoints, results)
+			accessLogDetails.MaxDataPoints = maxDataPoints
+		}
+
+		body = types.MarshalDataFrame(results)
+	case arrowFormat:
+		body = types.MarshalArrow(results, wideLayout)
+	case parquetFormat:
+		body = types.MarshalParquet(results, wideLayout)
+	case openmetricsFormat:
+		body = types.MarshalOpenMetrics(results, allPoints)
 	case pickleFormat:
 		body = types.MarshalPickle(results)
 	case pngFormat:
@@ -402,21 +463,133 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		body = png.MarshalSVGRequest(r, results, template)
 	}
 
-	accessLogDetails.Metrics = targets
-	accessLogDetails.CarbonzipperResponseSizeBytes = int64(size)
 	accessLogDetails.CarbonapiResponseSizeBytes = int64(len(body))
 
 	writeResponse(w, returnCode, body, format, jsonp, uid.String())
 
-	if len(results) != 0 {
+	// incomplete responses are not cached, so they are not served after backends are recovered
+	if len(results) != 0 && complete.Complete {
 		tc := time.Now()
 		config.Config.ResponseCache.Set(responseCacheKey, body, responseCacheTimeout)
 		td := time.Since(tc).Nanoseconds()
 		ApiMetrics.RequestsCacheOverheadNS.Add(uint64(td))
 	}
+}
+
+const errUnsupportedTimestampFormat = "unsupported timestamp format, supported: 's', 'ms', 'us', 'ns'"
+
+// getTimestampMultiplier returns multiplier of unix timestamps in seconds for timestampFormat parameter
+func getTimestampMultiplier(timestampFormat string) (int64, bool) {
+	switch strings.ToLower(timestampFormat) {
+	case "", "s":
+		return 1, true
+	case "ms", "millisecond", "milliseconds":
+		return 1000, true
+	case "us", "microsecond", "microseconds":
+		return 1000000, true
+	case "ns", "nanosecond", "nanoseconds":
+		return 1000000000, true
+	}
+	return 0, false
+}
+
+const errUnsupportedLayout = "unsupported layout, supported: 'long', 'wide'"
+
+// getWideLayout returns true if layout parameter requests wide table (timestamp column and column per series)
+func getWideLayout(layout string) (bool, bool) {
+	switch strings.ToLower(layout) {
+	case "", "long":
+		return false, true
+	case "wide":
+		return true, true
+	}
+	return false, false
+}
+
+const errUnsupportedPoints = "unsupported points, supported: 'last', 'all'"
+
+// getAllPoints returns true if points parameter requests all points of the series instead of the last one
+func getAllPoints(points string) (bool, bool) {
+	switch strings.ToLower(points) {
+	case "", "last":
+		return false, true
+	case "all":
+		return true, true
+	}
+	return false, false
+}
+
+// renderTargets fetches and evaluates targets. Fetched metrics are stored in values, so they are reused by following calls.
+// Returned error is a parse error of the target, errors of the targets are returned by target.
+func renderTargets(ctx context.Context, targets []string, from32, until32 int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, map[string]merry.Error, error) {
+	exprs := make([]parser.Expr, 0, len(targets))
+	for _, target := range targets {
+		exp, e, err := parser.ParseExpr(target)
+		if err != nil || e != "" {
+			return nil, nil, errors.New(buildParseErrorString(target, e, err))
+		}
+		exprs = append(exprs, exp)
+	}
+
+	// the first failed target fails the whole request, if success of all of them is required
+	var stop func(merry.Error) bool
+	if config.Config.Upstreams.RequireSuccessAll {
+		stop = func(err merry.Error) bool {
+			code := merry.HTTPCode(err)
+			return code != http.StatusOK && code != http.StatusNotFound
+		}
+	}
+
+	results := make([]*types.MetricData, 0)
+	errs := make(map[string]merry.Error)
+
+	// targets are validated before fetching, so invalid ones aren't fetched and positions in errors point to the source
+	validTargets := make([]string, 0, len(targets))
+	validExprs := make([]parser.Expr, 0, len(exprs))
+	for i, target := range targets {
+		if err := expr.ValidateTarget(target, exprs[i]); err != nil {
+			errs[target] = merry.Wrap(err)
+			if stop != nil && stop(errs[target]) {
+				return results, errs, nil
+			}
+			continue
+		}
+		validTargets = append(validTargets, target)
+		validExprs = append(validExprs, exprs[i])
+	}
+	targets, exprs = validTargets, validExprs
+	if len(exprs) == 0 {
+		return results, errs, nil
+	}
+
+	evalCtx := expr.WithValidatedTargets(expr.WithEvalParallelism(ctx, config.Config.EvalParallelism))
+
+	if config.Config.CombineMultipleTargetsInOne && len(targets) > 0 {
+		ApiMetrics.RenderRequests.Add(1)
+
+		result, targetErrs := expr.FetchAndEvalExprs(evalCtx, config.Config.Evaluator, exprs, from32, until32, values)
+		for target, err := range targetErrs {
+			errs[target] = err
+		}
+
+		return append(results, result...), errs, nil
+	}
+
+	ApiMetrics.RenderRequests.Add(uint64(len(exprs)))
+
+	targetResults, targetErrs := expr.FetchAndEvalExps(evalCtx, config.Config.Evaluator, exprs, from32, until32, values, stop)
+	for i, target := range targets {
+		if err := targetErrs[i]; err != nil {
+			errs[target] = err
+			if stop != nil && stop(err) {
+				break
+			}
+		}
+
+		results = append(results, targetResults[i]...)
+	}
 
-	gotErrors := len(errors) > 0
-	accessLogDetails.HaveNonFatalErrors = gotErrors
+	return results, errs, nil
 }
 
 func responseCacheComputeKey(from, until int64, targets []string, format string, maxDataPoints int64, noNullPoints bool, template string) string {
@@ -1,14 +1,28 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-graphite/carbonapi/cache"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	"github.com/lomik/zapwriter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// mockRenderCalls counts Render calls of mockCarbonZipper
+var mockRenderCalls atomic.Int64
+
 func BenchmarkResponseCacheComputeKey(b *testing.B) {
 	var from int64 = 1628876560
 	var until int64 = 1628876620
@@ -123,3 +137,374 @@ func Test_getCacheTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderBatch(t *testing.T) {
+	body := `{"noCache": true, "queries": [
+		{"id": "B", "targets": ["foo.bar", "sumSeries(foo.bar)"], "from": "-10minutes", "maxDataPoints": 1, "timestampFormat": "ms"},
+		{"id": "A", "targets": ["foo.bar"], "from": "-10minutes"},
+		{"id": "C", "targets": ["foo.bar("], "from": "-10minutes"},
+		{"id": "D", "targets": ["sumSeries(foo.bar)"], "from": "-10minutes"}
+	]}`
+	req := httptest.NewRequest("POST", "/render", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rr := httptest.NewRecorder()
+
+	calls := mockRenderCalls.Load()
+	renderHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	// foo.bar is fetched once for A and D, B has another maxDataPoints, so it's fetched separately
+	assert.Equal(t, int64(2), mockRenderCalls.Load()-calls)
+
+	var res map[string]renderBatchResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	require.Len(t, res, 4)
+	assert.JSONEq(t, `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`, string(res["A"].Series))
+	assert.JSONEq(t, `[
+		{"target":"foo.bar","datapoints":[[1510913788.5,1510913280000]],"tags":{}},
+		{"target":"sumSeries(foo.bar)","datapoints":[[1510913788.5,1510913280000]],"tags":{"aggregatedBy":"sum","name":"foo.bar"}}
+	]`, string(res["B"].Series))
+	assert.Equal(t, http.StatusBadRequest, res["C"].Code)
+	assert.Contains(t, res["C"].Error, "foo.bar(")
+	assert.JSONEq(t, `[{"target":"sumSeries(foo.bar)","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{"aggregatedBy":"sum","name":"foo.bar"}}]`, string(res["D"].Series))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"malformed", `{"queries": [`},
+		{"no queries", `{"queries": []}`},
+		{"no id", `[{"targets": ["foo.bar"]}]`},
+		{"duplicate id", `[{"id": "A", "targets": ["foo.bar"]}, {"id": "A", "targets": ["foo.bar"]}]`},
+		{"format", `[{"id": "A", "targets": ["foo.bar"], "format": "png"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/render", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			renderHandler(rr, req)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+		})
+	}
+}
+
+func TestRenderInvalidArgs(t *testing.T) {
+	target := "sumSeries(foo.bar, scale(foo.baz, 'x'))"
+	req := httptest.NewRequest("GET", "/render?format=json&from=-10minutes&target="+url.QueryEscape(target), nil)
+	rr := httptest.NewRecorder()
+	calls := mockRenderCalls.Load()
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), "argument 2 (factor) at position 34")
+	assert.Equal(t, int64(0), mockRenderCalls.Load()-calls, "invalid target is fetched")
+}
+
+func TestRenderFormPost(t *testing.T) {
+	expected := `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`
+
+	form := url.Values{"target": {"foo.bar"}, "from": {"-10minutes"}, "format": {"json"}}
+	req := httptest.NewRequest("POST", "/render", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	renderHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, expected, rr.Body.String())
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range form {
+		require.NoError(t, mw.WriteField(k, v[0]))
+	}
+	require.NoError(t, mw.Close())
+	req = httptest.NewRequest("POST", "/render", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr = httptest.NewRecorder()
+	renderHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, expected, rr.Body.String())
+}
+
+func TestRenderColumnarFormats(t *testing.T) {
+	tests := []struct {
+		query       string
+		code        int
+		contentType string
+		magic       string
+	}{
+		{query: "format=arrow", code: http.StatusOK, contentType: contentTypeArrow, magic: "\xff\xff\xff\xff"},
+		{query: "format=arrow&layout=wide", code: http.StatusOK, contentType: contentTypeArrow, magic: "\xff\xff\xff\xff"},
+		{query: "format=parquet", code: http.StatusOK, contentType: contentTypeParquet, magic: "PAR1"},
+		{query: "format=parquet&layout=columns", code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/render/?target=foo.bar&from=-10minutes&"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			renderHandler(rr, req)
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.code != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			assert.True(t, strings.HasPrefix(rr.Body.String(), tt.magic))
+		})
+	}
+}
+
+func TestRenderDataFrame(t *testing.T) {
+	req := httptest.NewRequest("GET", "/render/?target=foo.bar&from=-10minutes&format=dataframe&align=1", nil)
+	rr := httptest.NewRecorder()
+	renderHandler(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, contentTypeJSON, rr.Header().Get("Content-Type"))
+
+	var frames []struct {
+		Schema struct {
+			Meta struct {
+				Custom struct {
+					Series []struct {
+						Name string `json:"name"`
+						Step int64  `json:"step"`
+					} `json:"series"`
+				} `json:"custom"`
+			} `json:"meta"`
+			Fields []struct {
+				Name string `json:"name"`
+				Type string `json:"type"`
+			} `json:"fields"`
+		} `json:"schema"`
+		Data struct {
+			Values [][]*float64 `json:"values"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &frames))
+	require.Len(t, frames, 1)
+	require.Len(t, frames[0].Schema.Fields, 2)
+	assert.Equal(t, "time", frames[0].Schema.Fields[0].Type)
+	assert.Equal(t, "foo.bar", frames[0].Schema.Fields[1].Name)
+	require.Len(t, frames[0].Schema.Meta.Custom.Series, 1)
+	assert.Equal(t, int64(60), frames[0].Schema.Meta.Custom.Series[0].Step)
+	require.Len(t, frames[0].Data.Values, 2)
+	assert.Equal(t, float64(1510913280000), *frames[0].Data.Values[0][0])
+	assert.Nil(t, frames[0].Data.Values[1][0])
+	assert.Equal(t, float64(1510913759), *frames[0].Data.Values[1][1])
+}
+
+func TestRenderOpenMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		code int
+		want string
+	}{
+		{
+			name: "last",
+			url:  "/render/?target=foo.bar&from=-10minutes&format=openmetrics",
+			code: http.StatusOK,
+			want: "# TYPE foo_bar gauge\nfoo_bar 1510913818 1510913400\n# EOF\n",
+		},
+		{
+			name: "all",
+			url:  "/render/?target=foo.bar&from=-10minutes&format=openmetrics&points=all",
+			code: http.StatusOK,
+			want: "# TYPE foo_bar gauge\nfoo_bar 1510913759 1510913340\nfoo_bar 1510913818 1510913400\n# EOF\n",
+		},
+		{
+			name: "unsupported points",
+			url:  "/render/?target=foo.bar&from=-10minutes&format=openmetrics&points=first",
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			rr := httptest.NewRecorder()
+			renderHandler(rr, req)
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.code != http.StatusOK {
+				return
+			}
+			assert.Equal(t, contentTypeOpenMetrics, rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want, rr.Body.String())
+		})
+	}
+}
+
+func TestCompleteness(t *testing.T) {
+	defer func() { mockStats = nil }()
+
+	tests := []struct {
+		name            string
+		handler         http.HandlerFunc
+		stats           *zipperTypes.Stats
+		url             string
+		code            int
+		complete        string
+		failedGroups    string
+		timedOutServers string
+		failedServers   string
+		seriesFraction  string
+		errorContains   string
+	}{
+		{
+			name:     "render complete",
+			stats:    &zipperTypes.Stats{QueriedGroups: 2},
+			url:      "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1&requireComplete=1",
+			code:     http.StatusOK,
+			complete: "true",
+			handler:  renderHandler,
+		},
+		{
+			name:            "render partial",
+			stats:           &zipperTypes.Stats{QueriedGroups: 4, FailedGroups: []string{"db", "archive"}, TimedOutServers: []string{"archive"}},
+			url:             "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1",
+			code:            http.StatusOK,
+			complete:        "false",
+			failedGroups:    "archive,db",
+			timedOutServers: "archive",
+			seriesFraction:  "0.500",
+			handler:         renderHandler,
+		},
+		{
+			name:           "render with failed server",
+			stats:          &zipperTypes.Stats{QueriedGroups: 2, FailedServers: []string{"server2"}, PartialGroups: 0.5},
+			url:            "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1",
+			code:           http.StatusOK,
+			complete:       "false",
+			failedServers:  "server2",
+			seriesFraction: "0.750",
+			handler:        renderHandler,
+		},
+		{
+			name:          "render partial with requireComplete",
+			stats:         &zipperTypes.Stats{QueriedGroups: 2, FailedGroups: []string{"db"}},
+			url:           "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1&requireComplete=1",
+			code:          http.StatusServiceUnavailable,
+			complete:      "false",
+			failedGroups:  "db",
+			errorContains: "failed backend groups: db",
+			handler:       renderHandler,
+		},
+		{
+			name:           "find partial",
+			stats:          &zipperTypes.Stats{QueriedGroups: 2, FailedGroups: []string{"db"}},
+			url:            "/metrics/find/?query=foo.bar&format=json",
+			code:           http.StatusOK,
+			complete:       "false",
+			failedGroups:   "db",
+			seriesFraction: "0.500",
+			handler:        findHandler,
+		},
+		{
+			name:          "find partial with requireComplete",
+			stats:         &zipperTypes.Stats{QueriedGroups: 2, FailedGroups: []string{"db"}},
+			url:           "/metrics/find/?query=foo.bar&format=json&requireComplete=1",
+			code:          http.StatusServiceUnavailable,
+			complete:      "false",
+			failedGroups:  "db",
+			errorContains: "failed backend groups: db",
+			handler:       findHandler,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStats = tt.stats
+			req := httptest.NewRequest("GET", tt.url, nil)
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+			require.Equal(t, tt.code, rr.Code, rr.Body.String())
+			assert.Equal(t, tt.complete, rr.Header().Get(headerComplete))
+			assert.Equal(t, tt.failedGroups, rr.Header().Get(headerFailedGroups))
+			assert.Equal(t, tt.timedOutServers, rr.Header().Get(headerTimedOutServers))
+			assert.Equal(t, tt.failedServers, rr.Header().Get(headerFailedServers))
+			if tt.seriesFraction != "" {
+				assert.Equal(t, tt.seriesFraction, rr.Header().Get(headerSeriesFraction))
+			}
+			if tt.errorContains != "" {
+				assert.Contains(t, rr.Body.String(), tt.errorContains)
+			}
+		})
+	}
+}
+
+func TestRenderBatchCompleteness(t *testing.T) {
+	defer func() { mockStats = nil }()
+
+	render := func(url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		renderHandler(rr, req)
+		return rr
+	}
+	queries := `[
+		{"id": "A", "targets": ["foo.bar"], "from": "-10minutes"},
+		{"id": "B", "targets": ["foo.bar"], "from": "-10minutes", "maxDataPoints": 1}
+	]`
+
+	mockStats = &zipperTypes.Stats{QueriedGroups: 2}
+	rr := render("/render", queries)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "true", rr.Header().Get(headerComplete))
+	var res map[string]renderBatchResult
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	require.NotNil(t, res["A"].Completeness)
+	assert.True(t, res["A"].Completeness.Complete)
+
+	mockStats = &zipperTypes.Stats{QueriedGroups: 2, FailedGroups: []string{"db"}}
+	rr = render("/render", queries)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "false", rr.Header().Get(headerComplete))
+	assert.Equal(t, "db", rr.Header().Get(headerFailedGroups))
+	res = nil
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	for _, id := range []string{"A", "B"} {
+		require.NotNil(t, res[id].Completeness, id)
+		assert.Equal(t, zipperTypes.Completeness{FailedGroups: []string{"db"}, SeriesFraction: 0.5}, *res[id].Completeness, id)
+	}
+
+	for _, tt := range []struct{ name, url, body string }{
+		{"parameter", "/render?requireComplete=1", queries},
+		{"body", "/render", `{"requireComplete": true, "queries": ` + queries + `}`},
+	} {
+		t.Run("requireComplete "+tt.name, func(t *testing.T) {
+			rr := render(tt.url, tt.body)
+			require.Equal(t, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+			assert.Equal(t, "false", rr.Header().Get(headerComplete))
+			assert.Equal(t, "db", rr.Header().Get(headerFailedGroups))
+			assert.Contains(t, rr.Body.String(), "failed backend groups: db")
+		})
+	}
+}
+
+func TestRenderBatchIncompleteNotCached(t *testing.T) {
+	defer func() { mockStats = nil }()
+	savedCache, savedConfig := config.Config.BackendCache, config.Config.BackendCacheConfig
+	defer func() { config.Config.BackendCache, config.Config.BackendCacheConfig = savedCache, savedConfig }()
+	config.Config.BackendCache = cache.NewExpireCache(1000)
+	config.Config.BackendCacheConfig.DefaultTimeoutSec = 60
+
+	render := func(id string) {
+		body := `[{"id": "` + id + `", "targets": ["foo.bar"], "from": "-10minutes"}]`
+		req := httptest.NewRequest("POST", "/render", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		renderHandler(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	mockStats = &zipperTypes.Stats{QueriedGroups: 2, FailedServers: []string{"server2"}, PartialGroups: 0.5}
+	calls := mockRenderCalls.Load()
+	render("A")
+	render("A")
+	assert.Equal(t, int64(2), mockRenderCalls.Load()-calls, "incomplete result is cached")
+
+	mockStats = &zipperTypes.Stats{QueriedGroups: 2}
+	calls = mockRenderCalls.Load()
+	render("A")
+	render("A")
+	assert.Equal(t, int64(1), mockRenderCalls.Load()-calls, "complete result isn't cached")
+}
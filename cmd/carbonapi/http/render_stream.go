@@ -0,0 +1,167 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+const (
+	// streamErrorTrailer is a trailer with the error discovered after the response was started
+	streamErrorTrailer = "X-Carbonapi-Stream-Error"
+	// streamChunkSize is a size of data written and flushed to the client at once
+	streamChunkSize = 64 << 10
+)
+
+// isStreamFormat checks if response in the format can be streamed
+func isStreamFormat(format responseFormat) bool {
+	return format == jsonFormat || format == csvFormat
+}
+
+// streamWriter writes response body by chunks. Copy of the body is kept for the response cache while it's under the limit.
+type streamWriter struct {
+	w        http.ResponseWriter
+	buf      []byte
+	cache    []byte
+	cacheMax int
+	written  int
+	err      error
+}
+
+func (s *streamWriter) maybeFlush() {
+	if len(s.buf) >= streamChunkSize {
+		s.flush()
+	}
+}
+
+func (s *streamWriter) flush() {
+	if s.err != nil || len(s.buf) == 0 {
+		return
+	}
+	if s.cache != nil {
+		if len(s.cache)+len(s.buf) <= s.cacheMax {
+			s.cache = append(s.cache, s.buf...)
+		} else {
+			s.cache = nil
+		}
+	}
+	var n int
+	n, s.err = s.w.Write(s.buf)
+	s.written += n
+	s.buf = s.buf[:0]
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// encode appends series to the body one by one, it stops when context is done or the client is gone
+func (s *streamWriter) encode(ctx context.Context, results []*types.MetricData, format responseFormat, timestampMultiplier int64, noNullPoints bool) (n int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic during marshaling: %v", r)
+		}
+	}()
+
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if s.err != nil {
+			return n, s.err
+		}
+		if format == jsonFormat {
+			if n > 0 {
+				s.buf = append(s.buf, ',')
+			}
+			s.buf = types.AppendJSONSeries(s.buf, r, timestampMultiplier, noNullPoints)
+		} else {
+			s.buf = types.AppendCSVSeries(s.buf, r)
+		}
+		n++
+		s.maybeFlush()
+	}
+	return n, s.err
+}
+
+// streamResponse writes results in json or csv format with chunked transfer encoding, series by series. Only encoding
+// is streamed, results are already evaluated. Status code is sent as is before the body.
+// Error discovered after the response is started is reported by the terminal marker at the end of the body
+// (`{"error":"..."}` as a last element of JSON array, `# error: ...` line of CSV) and by the trailer.
+// It returns the body for the response cache, nil if the body is larger than the cache limit or response is failed.
+func streamResponse(ctx context.Context, w http.ResponseWriter, returnCode int, results []*types.MetricData, format responseFormat, jsonp string,
+	timestampMultiplier int64, noNullPoints bool, carbonapiUUID string) (body []byte, written int, err error) {
+	s := &streamWriter{
+		w:        w,
+		buf:      make([]byte, 0, streamChunkSize+streamChunkSize/4),
+		cacheMax: config.Config.Streaming.CacheMaxSize,
+	}
+	if s.cacheMax > 0 {
+		s.cache = []byte{}
+	}
+
+	header := w.Header()
+	header.Set(ctxHeaderUUID, carbonapiUUID)
+	header.Set("Trailer", streamErrorTrailer)
+	switch {
+	case format == csvFormat:
+		header.Set("Content-Type", contentTypeCSV)
+	case jsonp != "":
+		header.Set("Content-Type", contentTypeJavaScript)
+	default:
+		header.Set("Content-Type", contentTypeJSON)
+	}
+	w.WriteHeader(returnCode)
+
+	if format == jsonFormat {
+		if jsonp != "" {
+			s.buf = append(s.buf, jsonp...)
+			s.buf = append(s.buf, '(')
+		}
+		s.buf = append(s.buf, '[')
+	}
+
+	var line string
+	n, err := s.encode(ctx, results, format, timestampMultiplier, noNullPoints)
+	if err != nil {
+		// response is already started, so error can't change status code
+		msg := err.Error()
+		line = strings.ReplaceAll(stripError(msg), "\n", " ")
+		if format == jsonFormat {
+			if n > 0 {
+				s.buf = append(s.buf, ',')
+			}
+			s.buf = append(s.buf, `{"error":`...)
+			s.buf = strconv.AppendQuoteToASCII(s.buf, msg)
+			s.buf = append(s.buf, '}')
+		} else {
+			s.buf = append(s.buf, "# error: "...)
+			s.buf = append(s.buf, line...)
+			s.buf = append(s.buf, '\n')
+		}
+	}
+
+	if format == jsonFormat {
+		s.buf = append(s.buf, ']')
+		if jsonp != "" {
+			s.buf = append(s.buf, ')')
+		}
+	}
+	s.flush()
+
+	if err != nil {
+		header.Set(streamErrorTrailer, line)
+		return nil, s.written, err
+	}
+	if s.err != nil {
+		return nil, s.written, s.err
+	}
+	return s.cache, s.written, nil
+}
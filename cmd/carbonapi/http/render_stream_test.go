@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+type recordingCache struct {
+	sync.Mutex
+	items map[string][]byte
+}
+
+func (c *recordingCache) Get(k string) ([]byte, error) {
+	return nil, cache.ErrNotFound
+}
+
+func (c *recordingCache) Set(k string, v []byte, _ int32) {
+	c.Lock()
+	c.items[k] = v
+	c.Unlock()
+}
+
+func TestRenderStreaming(t *testing.T) {
+	streaming, responseCache := config.Config.Streaming, config.Config.ResponseCache
+	defer func() {
+		config.Config.Streaming, config.Config.ResponseCache = streaming, responseCache
+	}()
+
+	tests := []struct {
+		name         string
+		format       string
+		cacheMaxSize int
+		body         string
+	}{
+		{
+			name:         "json",
+			format:       "json",
+			cacheMaxSize: 1 << 20,
+			body:         `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`,
+		},
+		{
+			name:         "csv",
+			format:       "csv",
+			cacheMaxSize: 1 << 20,
+			body:         "\"foo.bar\",2017-11-17 10:08:00,\n\"foo.bar\",2017-11-17 10:09:00,1510913759\n\"foo.bar\",2017-11-17 10:10:00,1510913818\n",
+		},
+		{
+			name:         "json over cache limit",
+			format:       "json",
+			cacheMaxSize: 10,
+			body:         `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &recordingCache{items: make(map[string][]byte)}
+			config.Config.ResponseCache = c
+			config.Config.Streaming = config.StreamingConfig{Enabled: true, CacheMaxSize: tt.cacheMaxSize}
+
+			req := httptest.NewRequest("GET", "/render/?target=foo.bar&from=-10minutes&format="+tt.format, nil)
+			rr := httptest.NewRecorder()
+			renderHandler(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			assert.Equal(t, tt.body, rr.Body.String())
+			assert.Empty(t, rr.Header().Get("Content-Length"))
+			assert.Empty(t, rr.Result().Trailer.Get(streamErrorTrailer))
+
+			if len(tt.body) <= tt.cacheMaxSize {
+				require.Len(t, c.items, 1)
+				for _, v := range c.items {
+					assert.Equal(t, tt.body, string(v))
+				}
+			} else {
+				assert.Empty(t, c.items)
+			}
+		})
+	}
+}
+
+func TestStreamResponseError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := []*types.MetricData{types.MakeMetricData("foo", []float64{1, 2}, 60, 60)}
+
+	tests := []struct {
+		format responseFormat
+		jsonp  string
+		body   string
+	}{
+		{format: jsonFormat, body: `[{"error":"context canceled"}]`},
+		{format: jsonFormat, jsonp: "cb", body: `cb([{"error":"context canceled"}])`},
+		{format: csvFormat, body: "# error: context canceled\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format.String()+tt.jsonp, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			body, written, err := streamResponse(ctx, rr, http.StatusOK, results, tt.format, tt.jsonp, 1, false, "uuid")
+			require.ErrorIs(t, err, context.Canceled)
+			assert.Nil(t, body)
+			assert.Equal(t, len(tt.body), written)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.body, rr.Body.String())
+			assert.Equal(t, "context canceled", rr.Result().Trailer.Get(streamErrorTrailer))
+		})
+	}
+}
+
+func TestStreamResponseCode(t *testing.T) {
+	results := []*types.MetricData{types.MakeMetricData("foo", []float64{1}, 1, 1)}
+
+	rr := httptest.NewRecorder()
+	_, _, err := streamResponse(context.Background(), rr, http.StatusTooManyRequests, results, jsonFormat, "", 1, false, "uuid")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, `[{"target":"foo","datapoints":[[1,1]],"tags":{"name":"foo"}}]`, rr.Body.String())
+}
@@ -1,17 +1,24 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ansel1/merry"
 	uuid "github.com/satori/go.uuid"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/helper"
 	"github.com/go-graphite/carbonapi/zipper/types"
@@ -19,15 +26,17 @@ import (
 	"go.uber.org/zap"
 )
 
+// tagQueries coalesces identical autocomplete requests in flight
+var tagQueries singleflight.Group
+
 func tagHandler(w http.ResponseWriter, r *http.Request) {
 	t0 := time.Now()
 	uuid := uuid.NewV4()
 	carbonapiUUID := uuid.String()
 
-	// TODO: Migrate to context.WithTimeout
 	ctx := utilctx.SetUUID(r.Context(), carbonapiUUID)
 	requestHeaders := utilctx.GetLogHeaders(ctx)
-	username, _, _ := r.BasicAuth()
+	username := getUsername(r)
 
 	logger := zapwriter.Logger("tag").With(
 		zap.String("carbonapi_uuid", uuid.String()),
@@ -41,6 +50,7 @@ func tagHandler(w http.ResponseWriter, r *http.Request) {
 	var accessLogDetails = &carbonapipb.AccessLogDetails{
 		Handler:        "tags",
 		Username:       username,
+		Tenant:         tenant.Name(r.Context()),
 		CarbonapiUUID:  carbonapiUUID,
 		URL:            r.URL.Path,
 		PeerIP:         srcIP,
@@ -56,7 +66,18 @@ func tagHandler(w http.ResponseWriter, r *http.Request) {
 		deferredAccessLogging(accessLogger, accessLogDetails, t0, logAsError)
 	}()
 
-	err := r.ParseForm()
+	ApiMetrics.TagRequests.Add(1)
+
+	ctx, cancel, err := withDeadline(ctx, r)
+	defer cancel()
+	if err != nil {
+		logAsError = true
+		setError(w, accessLogDetails, err.Error(), http.StatusBadRequest, carbonapiUUID)
+		return
+	}
+	ctx = helper.WithRetryBudget(ctx)
+
+	err = r.ParseForm()
 	if err != nil {
 		logAsError = true
 		setError(w, accessLogDetails, err.Error(), http.StatusBadRequest, carbonapiUUID)
@@ -79,27 +100,61 @@ func tagHandler(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	q.Del("pretty")
+	q.Del("timeout")
 	rawQuery := q.Encode()
 
-	if queryLengthLimitExceeded(r.Form["query"], config.Config.MaxQueryLength) {
+	if queryLengthLimitExceeded(r.Form["query"], maxQueryLength(ctx)) || queryLengthLimitExceeded(r.Form["expr"], maxQueryLength(ctx)) {
 		setError(w, accessLogDetails, "query length limit exceeded", http.StatusBadRequest, carbonapiUUID)
 		logAsError = true
 		return
 	}
 
-	// TODO(civil): Implement caching
-	var res []string
-	if strings.HasSuffix(r.URL.Path, "tags") || strings.HasSuffix(r.URL.Path, "tags/") {
-		res, err = config.Config.ZipperInstance.TagNames(ctx, rawQuery, limit)
-	} else if strings.HasSuffix(r.URL.Path, "values") || strings.HasSuffix(r.URL.Path, "values/") {
-		res, err = config.Config.ZipperInstance.TagValues(ctx, rawQuery, limit)
-	} else {
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-		accessLogDetails.HTTPCode = http.StatusNotFound
+	var res interface{}
+	switch path := strings.Trim(strings.TrimPrefix(r.URL.Path, config.Config.Prefix+"/tags"), "/"); path {
+	case "":
+		res, err = tagList(ctx, r.FormValue("filter"), limit, accessLogDetails)
+	case "autoComplete/tags":
+		res, err = tagAutoComplete(ctx, true, rawQuery, limit, accessLogDetails)
+	case "autoComplete/values":
+		res, err = tagAutoComplete(ctx, false, rawQuery, limit, accessLogDetails)
+	case "findSeries":
+		exprs := r.Form["expr"]
+		if len(exprs) == 0 {
+			setError(w, accessLogDetails, "no tag expressions specified", http.StatusBadRequest, carbonapiUUID)
+			logAsError = true
+			return
+		}
+		accessLogDetails.Metrics = exprs
+		res, err = config.Config.ZipperInstance.FindSeries(ctx, exprs)
+	case "tagSeries", "tagMultiSeries", "delSeries":
+		if r.Method != http.MethodPost {
+			setError(w, accessLogDetails, "only POST method is allowed", http.StatusMethodNotAllowed, carbonapiUUID)
+			logAsError = true
+			return
+		}
+		paths := r.PostForm["path"]
+		if len(paths) == 0 {
+			setError(w, accessLogDetails, "no path specified", http.StatusBadRequest, carbonapiUUID)
+			logAsError = true
+			return
+		}
+		accessLogDetails.Metrics = paths
+		res, err = tagWrite(ctx, path, paths)
+	default:
+		if strings.Contains(path, "/") {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			accessLogDetails.HTTPCode = http.StatusNotFound
+			return
+		}
+		res, err = config.Config.ZipperInstance.TagDetails(ctx, path, r.FormValue("filter"))
+	}
+
+	if e := deadline.FromContext(ctx).Err(); e != nil {
+		setError(w, accessLogDetails, e.Error(), http.StatusGatewayTimeout, carbonapiUUID)
+		logAsError = true
 		return
 	}
 
-	// TODO(civil): Implement stats
 	if err != nil && !merry.Is(err, types.ErrNoMetricsFetched) && (!merry.Is(err, types.ErrNonFatalErrors) || config.Config.Upstreams.RequireSuccessAll) {
 		code := merry.HTTPCode(err)
 		setError(w, accessLogDetails, helper.MerryRootError(err), code, carbonapiUUID)
@@ -126,3 +181,156 @@ func tagHandler(w http.ResponseWriter, r *http.Request) {
 	accessLogDetails.Runtime = time.Since(t0).Seconds()
 	accessLogDetails.HTTPCode = http.StatusOK
 }
+
+type tagListItem struct {
+	Tag string `json:"tag"`
+}
+
+// tagCacheKey returns tag cache key for autocomplete query. Query is normalized, so requests with the same parameters
+// in different order share the cache entry.
+func tagCacheKey(isTagName bool, query string, limit int64) string {
+	v, _ := url.ParseQuery(query)
+	v.Del("limit")
+	for k, values := range v {
+		n := 0
+		for _, value := range values {
+			if value != "" {
+				values[n] = value
+				n++
+			}
+		}
+		if n == 0 {
+			v.Del(k)
+			continue
+		}
+		sort.Strings(values[:n])
+		v[k] = values[:n]
+	}
+
+	var b strings.Builder
+	if isTagName {
+		b.WriteString("tags:")
+	} else {
+		b.WriteString("values:")
+	}
+	b.WriteString(v.Encode())
+	b.WriteString("&limit=")
+	b.WriteString(strconv.FormatInt(limit, 10))
+	return b.String()
+}
+
+// tagAutoComplete returns tag names (or values) for autocomplete query. Results are cached in tag cache,
+// identical requests in flight are coalesced into one zipper request.
+func tagAutoComplete(ctx context.Context, isTagName bool, query string, limit int64, accessLogDetails *carbonapipb.AccessLogDetails) ([]string, error) {
+	key := tagCacheKey(isTagName, query, limit) + cacheKeySuffix(ctx)
+	if res, ok := tagCacheGet(key); ok {
+		accessLogDetails.FromCache = true
+		return res, nil
+	}
+
+	var stats *types.Stats
+	v, err, _ := tagQueries.Do(key, func() (interface{}, error) {
+		// request could be finished and cached after cache miss, but before we got here
+		if res, ok := tagCacheGet(key); ok {
+			return res, nil
+		}
+		ApiMetrics.TagCacheMisses.Add(1)
+
+		// response is shared with other requests, so it shouldn't be canceled with this one, but it keeps values of
+		// the context (tenant, user, headers) and is limited by timeout of tag queries
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.Config.Upstreams.Timeouts.Find)
+		defer cancel()
+		var (
+			res []string
+			err merry.Error
+		)
+		if isTagName {
+			res, stats, err = config.Config.ZipperInstance.TagNames(ctx, query, limit)
+		} else {
+			res, stats, err = config.Config.ZipperInstance.TagValues(ctx, query, limit)
+		}
+		if err != nil {
+			return res, err
+		}
+		if b, err := json.Marshal(res); err == nil {
+			config.Config.TagCache.Set(key, b, config.Config.TagCacheConfig.DefaultTimeoutSec)
+		}
+		return res, nil
+	})
+	// stats are set only if the request was done by this call, not by concurrent one
+	if stats != nil {
+		accessLogDetails.ZipperRequests = stats.ZipperRequests
+	}
+
+	res, _ := v.([]string)
+	return res, err
+}
+
+func tagCacheGet(key string) ([]string, bool) {
+	b, err := config.Config.TagCache.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	var res []string
+	if err = json.Unmarshal(b, &res); err != nil {
+		return nil, false
+	}
+	ApiMetrics.TagCacheHits.Add(1)
+	return res, true
+}
+
+// tagList returns tags, which names match filter regular expression, in graphite-web /tags format
+func tagList(ctx context.Context, filter string, limit int64, accessLogDetails *carbonapipb.AccessLogDetails) ([]tagListItem, error) {
+	var re *regexp.Regexp
+	if filter != "" {
+		var err error
+		re, err = regexp.Compile(filter)
+		if err != nil {
+			return nil, merry.WithHTTPCode(err, http.StatusBadRequest)
+		}
+	}
+
+	names, err := tagAutoComplete(ctx, true, "", -1, accessLogDetails)
+	if err != nil && len(names) == 0 {
+		return nil, err
+	}
+
+	// names can be shared with concurrent requests, so they are not sorted in place
+	res := make([]tagListItem, 0, len(names))
+	for _, name := range names {
+		if re != nil && !re.MatchString(name) {
+			continue
+		}
+		res = append(res, tagListItem{Tag: name})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Tag < res[j].Tag })
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+
+	if err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// tagWrite proxies tagSeries, tagMultiSeries and delSeries requests, response has the same format as graphite-web one
+func tagWrite(ctx context.Context, op string, paths []string) (interface{}, error) {
+	switch op {
+	case "tagSeries":
+		res, err := config.Config.ZipperInstance.TagSeries(ctx, paths[:1])
+		if len(res) == 0 {
+			return nil, err
+		}
+		return res[0], err
+	case "tagMultiSeries":
+		res, err := config.Config.ZipperInstance.TagSeries(ctx, paths)
+		if res == nil {
+			res = []string{}
+		}
+		return res, err
+	default:
+		err := config.Config.ZipperInstance.DelSeries(ctx, paths)
+		return err == nil || merry.Is(err, types.ErrNonFatalErrors), err
+	}
+}
@@ -0,0 +1,158 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+)
+
+var (
+	// mockTagValuesCalls counts TagValues calls of mockCarbonZipper
+	mockTagValuesCalls atomic.Int64
+	// mockTagValuesWait blocks TagValues calls of mockCarbonZipper, if set
+	mockTagValuesWait chan struct{}
+)
+
+func TestTagHandler(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		form   url.Values
+		code   int
+		body   string
+	}{
+		{method: "GET", url: "/tags", code: http.StatusOK, body: `[{"tag":"dc"},{"tag":"host"},{"tag":"name"}]`},
+		{method: "GET", url: "/tags?filter=^(dc|host)$&limit=1", code: http.StatusOK, body: `[{"tag":"dc"}]`},
+		{method: "GET", url: "/tags?filter=(", code: http.StatusBadRequest},
+		{method: "GET", url: "/tags/autoComplete/tags?tagPrefix=h", code: http.StatusOK, body: `["name","host","dc"]`},
+		{method: "GET", url: "/tags/dc", code: http.StatusOK, body: `{"tag":"dc","values":[{"count":2,"value":"a"},{"count":1,"value":"b"}]}`},
+		{method: "GET", url: "/tags/dc/values", code: http.StatusNotFound},
+		{method: "GET", url: "/tags/findSeries?expr=dc=~.*&expr=name=foo.bar", code: http.StatusOK, body: `["foo.bar;dc=a","foo.bar;dc=b"]`},
+		{method: "GET", url: "/tags/findSeries", code: http.StatusBadRequest},
+		{method: "POST", url: "/tags/tagSeries", form: url.Values{"path": {"foo.bar;dc=a"}}, code: http.StatusOK, body: `"foo.bar;dc=a"`},
+		{method: "POST", url: "/tags/tagMultiSeries", form: url.Values{"path": {"foo.bar;dc=a", "foo.bar;dc=b"}}, code: http.StatusOK, body: `["foo.bar;dc=a","foo.bar;dc=b"]`},
+		{method: "POST", url: "/tags/delSeries", form: url.Values{"path": {"foo.bar;dc=a"}}, code: http.StatusOK, body: `true`},
+		{method: "POST", url: "/tags/delSeries", code: http.StatusBadRequest},
+		{method: "GET", url: "/tags/tagSeries?path=foo.bar%3Bdc%3Da", code: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.form.Encode()))
+			if tt.form != nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			rr := httptest.NewRecorder()
+			tagHandler(rr, req)
+
+			assert.Equal(t, tt.code, rr.Code, rr.Body.String())
+			if tt.body != "" {
+				assert.Equal(t, tt.body, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTagCacheKey(t *testing.T) {
+	assert.Equal(t,
+		tagCacheKey(false, "tag=dc&expr=b%3Dc&expr=a%3Db&valuePrefix=", 10),
+		tagCacheKey(false, "expr=a%3Db&tag=dc&expr=b%3Dc&limit=10", 10),
+	)
+	assert.NotEqual(t, tagCacheKey(false, "tag=dc", 10), tagCacheKey(false, "tag=dc", 20))
+	assert.NotEqual(t, tagCacheKey(false, "tag=dc", 10), tagCacheKey(true, "tag=dc", 10))
+	assert.NotEqual(t, tagCacheKey(false, "tag=dc", 10), tagCacheKey(false, "tag=dc&valuePrefix=a", 10))
+}
+
+func TestTagAutoCompleteCache(t *testing.T) {
+	tagCache := config.Config.TagCache
+	config.Config.TagCache = cache.NewExpireCache(0)
+	defer func() {
+		config.Config.TagCache = tagCache
+	}()
+	mockTagValuesCalls.Store(0)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		tagHandler(rr, req)
+		return rr
+	}
+
+	// concurrent requests are coalesced
+	mockTagValuesWait = make(chan struct{})
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 4)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = get("/tags/autoComplete/values?tag=dc&expr=name%3Dfoo")
+		}(i)
+	}
+	for mockTagValuesCalls.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(mockTagValuesWait)
+	wg.Wait()
+	mockTagValuesWait = nil
+
+	for _, rr := range responses {
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `["a","b"]`, rr.Body.String())
+	}
+	assert.Equal(t, int64(1), mockTagValuesCalls.Load())
+
+	// the same request with parameters in different order is cached
+	rr := get("/tags/autoComplete/values?expr=name%3Dfoo&tag=dc&pretty=1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "[\n\t\"a\",\n\t\"b\"\n]", rr.Body.String())
+	assert.Equal(t, int64(1), mockTagValuesCalls.Load())
+
+	// other limit is requested from zipper
+	rr = get("/tags/autoComplete/values?expr=name%3Dfoo&tag=dc&limit=1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(2), mockTagValuesCalls.Load())
+}
+
+func TestTagAutoCompleteTimeout(t *testing.T) {
+	tagCache := config.Config.TagCache
+	timeout := config.Config.Upstreams.Timeouts.Find
+	config.Config.TagCache = cache.NewExpireCache(0)
+	config.Config.Upstreams.Timeouts.Find = 10 * time.Millisecond
+	mockTagValuesWait = make(chan struct{})
+	defer func() {
+		config.Config.TagCache = tagCache
+		config.Config.Upstreams.Timeouts.Find = timeout
+		mockTagValuesWait = nil
+	}()
+
+	// coalesced request isn't canceled with the client, but isn't left running forever either
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/tags/autoComplete/values?tag=dc&expr=name%3Dtimeout", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		tagHandler(rr, req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tag request isn't limited by timeout")
+	}
+	assert.NotEqual(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), context.DeadlineExceeded.Error())
+}
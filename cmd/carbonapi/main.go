@@ -17,8 +17,13 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/lomik/zapwriter"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
+	"github.com/go-graphite/carbonapi/pkg/auth"
+	"github.com/go-graphite/carbonapi/pkg/tenant"
 	"github.com/go-graphite/carbonapi/pkg/tlsconfig"
+	"github.com/go-graphite/carbonapi/zipper/interfaces"
 
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/helper"
@@ -61,14 +66,37 @@ func main() {
 		dns.UseDNSCache(config.Config.CachingDNSRefreshTime)
 	}
 
-	if err := config.Config.SetZipper(newZipper(carbonapiHttp.ZipperStats, &config.Config.Upstreams, config.Config.IgnoreClientTimeout, zapwriter.Logger("zipper"))); err != nil {
+	authenticator, err := auth.New(zapwriter.Logger("auth"), &config.Config.Auth, config.Config.Prefix)
+	if err != nil {
+		logger.Fatal("failed to setup authentication",
+			zap.Error(err),
+		)
+	}
+
+	var zipperInstance interfaces.CarbonZipper = newZipper(carbonapiHttp.ZipperStats, &config.Config.Upstreams, config.Config.IgnoreClientTimeout, zapwriter.Logger("zipper"))
+	if config.Config.Tenants != nil {
+		tenantZippers := make(map[string]interfaces.CarbonZipper)
+		for _, name := range config.Config.Tenants.Names() {
+			upstreams := config.Config.Tenancy.Tenants[name].Upstreams
+			sender := config.Config.Tenants.Get(name).StatsSender(carbonapiHttp.ZipperStats)
+			tenantZippers[name] = newZipper(sender, &upstreams, config.Config.IgnoreClientTimeout, zapwriter.Logger("zipper").With(zap.String("tenant", name)))
+		}
+		zipperInstance = tenant.NewZipper(zipperInstance, tenantZippers)
+	}
+	if authenticator != nil {
+		zipperInstance = auth.NewZipper(zipperInstance)
+	}
+	if err := config.Config.SetZipper(zipperInstance); err != nil {
 		logger.Fatal("failed to setup zipper",
 			zap.Error(err),
 		)
 	}
 
+	carbonapiHttp.StartRemoteWriteExport(context.Background())
+
 	wg := sync.WaitGroup{}
-	serve := func(listen config.Listener, handler http.Handler) {
+	// grpc listeners serve HTTP/2 without TLS (h2c), if TLS isn't configured
+	serve := func(listen config.Listener, handler http.Handler, grpc bool) {
 		l := &net.ListenConfig{Control: helper.ReusePort}
 		h, p, err := net.SplitHostPort(listen.Address)
 		if err != nil {
@@ -138,6 +166,8 @@ func main() {
 				}
 				s.TLSConfig = tlsConfig
 				isTLS = true
+			} else if grpc {
+				s.Handler = h2c.NewHandler(handler, &http2.Server{})
 			}
 
 			listener, err := l.Listen(context.Background(), "tcp", address)
@@ -203,17 +233,38 @@ func main() {
 			listener := config.Listener{
 				Address: config.Config.Expvar.Listen,
 			}
-			serve(listener, handler)
+			serve(listener, handler, false)
 		}
 	}
 
-	r := carbonapiHttp.InitHandlers(config.Config.HeadersToPass, config.Config.HeadersToLog)
+	var r http.Handler = carbonapiHttp.InitHandlers(config.Config.HeadersToPass, config.Config.HeadersToLog)
+	if config.Config.Tenants != nil {
+		r = config.Config.Tenants.Middleware(r, carbonapiHttp.UntenantedPaths()...)
+	}
 	handler := handlers.CompressHandler(r)
 	handler = handlers.CORS()(handler)
 	handler = handlers.ProxyHeaders(handler)
+	if authenticator != nil {
+		// remote address of the request is checked before it's replaced by proxy headers
+		handler = authenticator.Middleware(handler)
+	}
 
 	for _, listener := range config.Config.Listeners {
-		serve(listener, handler)
+		serve(listener, handler, false)
+	}
+
+	if len(config.Config.GRPCListeners) > 0 {
+		// gRPC responses are not compressed and are not requested by browsers
+		var grpcHandler http.Handler = carbonapiHttp.InitGRPCHandler(config.Config.HeadersToPass, config.Config.HeadersToLog)
+		if config.Config.Tenants != nil {
+			grpcHandler = config.Config.Tenants.Middleware(grpcHandler)
+		}
+		if authenticator != nil {
+			grpcHandler = authenticator.Middleware(grpcHandler)
+		}
+		for _, listener := range config.Config.GRPCListeners {
+			serve(listener, grpcHandler, true)
+		}
 	}
 
 	wg.Wait()
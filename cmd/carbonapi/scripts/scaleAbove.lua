@@ -0,0 +1,35 @@
+-- scaleAbove(seriesList, threshold, factor)
+-- Multiplies all values greater than threshold by factor.
+description = {
+    description = "Multiplies all values greater than threshold by factor.",
+    group = "Transform",
+    params = {
+        { name = "seriesList", type = "seriesList", required = true },
+        { name = "threshold", type = "float", required = true },
+        { name = "factor", type = "float", default = 1 },
+    },
+}
+
+function process(series, params)
+    local result = {}
+    for _, s in ipairs(series) do
+        local values = {}
+        for i, v in ipairs(s.values) do
+            if not isnan(v) and v > params.threshold then
+                values[i] = v * params.factor
+            else
+                values[i] = v
+            end
+        end
+        local tags = s.tags
+        tags["scaleAbove"] = tostring(params.threshold)
+        table.insert(result, {
+            name = "scaleAbove(" .. s.name .. "," .. tostring(params.threshold) .. ")",
+            tags = tags,
+            start = s.start,
+            step = s.step,
+            values = values,
+        })
+    end
+    return result
+end
@@ -8,9 +8,11 @@ import (
 	"github.com/go-graphite/carbonapi/expr/helper"
 	tags2 "github.com/go-graphite/carbonapi/expr/tags"
 	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
 	util "github.com/go-graphite/carbonapi/util/ctx"
 	realZipper "github.com/go-graphite/carbonapi/zipper"
 	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
+	zipperHelper "github.com/go-graphite/carbonapi/zipper/helper"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"go.uber.org/zap"
@@ -43,29 +45,43 @@ func newZipper(sender func(*zipperTypes.Stats), config *zipperCfg.Config, ignore
 	return z
 }
 
-func (z zipper) Find(ctx context.Context, req pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
-	newCtx := ctx
-	if z.ignoreClientTimeout {
-		uuid := util.GetUUID(ctx)
-		hdrs := util.GetPassHeaders(ctx)
-		newCtx = util.SetUUID(context.Background(), uuid)
-		newCtx = util.SetPassHeaders(newCtx, hdrs)
+// fetchContext returns context of the fetch stage of the request. Context of the client is replaced if
+// ignoreClientTimeout is set, but deadline of the request is still respected.
+func (z zipper) fetchContext(ctx context.Context) (context.Context, func()) {
+	ctx, done := deadline.Fetch(ctx)
+	if !z.ignoreClientTimeout {
+		return ctx, done
+	}
+
+	newCtx := util.SetUUID(context.Background(), util.GetUUID(ctx))
+	newCtx = util.SetPassHeaders(newCtx, util.GetPassHeaders(ctx))
+	newCtx = zipperHelper.CopyRetryBudget(newCtx, ctx)
+	newCtx = deadline.WithHeader(newCtx, deadline.Header(ctx))
+	if d, ok := ctx.Deadline(); ok && deadline.FromContext(ctx) != nil {
+		var cancel context.CancelFunc
+		newCtx, cancel = context.WithDeadline(newCtx, d)
+		return newCtx, func() {
+			cancel()
+			done()
+		}
 	}
+	return newCtx, done
+}
+
+func (z zipper) Find(ctx context.Context, req pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
+	newCtx, done := z.fetchContext(ctx)
+	defer done()
 
 	res, stats, err := z.z.FindProtoV3(newCtx, &req)
 	z.statsSender(stats)
+	zipperTypes.CollectCompleteness(ctx, stats)
 
 	return res, stats, err
 }
 
 func (z zipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, merry.Error) {
-	newCtx := ctx
-	if z.ignoreClientTimeout {
-		uuid := util.GetUUID(ctx)
-		hdrs := util.GetPassHeaders(ctx)
-		newCtx = util.SetUUID(context.Background(), uuid)
-		newCtx = util.SetPassHeaders(newCtx, hdrs)
-	}
+	newCtx, done := z.fetchContext(ctx)
+	defer done()
 
 	req := pb.MultiGlobRequest{
 		Metrics: metrics,
@@ -79,16 +95,12 @@ func (z zipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoRespo
 
 func (z zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
 	var result []*types.MetricData
-	newCtx := ctx
-	if z.ignoreClientTimeout {
-		uuid := util.GetUUID(ctx)
-		hdrs := util.GetPassHeaders(ctx)
-		newCtx = util.SetUUID(context.Background(), uuid)
-		newCtx = util.SetPassHeaders(newCtx, hdrs)
-	}
+	newCtx, done := z.fetchContext(ctx)
+	defer done()
 
 	pbresp, stats, err := z.z.FetchProtoV3(newCtx, &request)
 	z.statsSender(stats)
+	zipperTypes.CollectCompleteness(ctx, stats)
 
 	if pbresp != nil {
 		for i := range pbresp.Metrics {
@@ -118,12 +130,34 @@ func (z zipper) RenderCompat(ctx context.Context, metrics []string, from, until
 	return z.Render(ctx, req)
 }
 
-func (z zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return z.z.TagNames(ctx, query, limit)
+func (z zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	res, stats, err := z.z.TagNames(ctx, query, limit)
+	z.statsSender(stats)
+
+	return res, stats, err
+}
+
+func (z zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	res, stats, err := z.z.TagValues(ctx, query, limit)
+	z.statsSender(stats)
+
+	return res, stats, err
+}
+
+func (z zipper) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return z.z.FindSeries(ctx, exprs)
+}
+
+func (z zipper) TagDetails(ctx context.Context, tag, filter string) (*zipperTypes.TagDetails, merry.Error) {
+	return z.z.TagDetails(ctx, tag, filter)
+}
+
+func (z zipper) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return z.z.TagSeries(ctx, paths)
 }
 
-func (z zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return z.z.TagValues(ctx, query, limit)
+func (z zipper) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return z.z.DelSeries(ctx, paths)
 }
 
 func (z zipper) ScaleToCommonStep() bool {
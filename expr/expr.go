@@ -13,6 +13,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/metadata"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	zipper "github.com/go-graphite/carbonapi/zipper/interfaces"
@@ -122,12 +123,21 @@ func (eval Evaluator) Fetch(ctx context.Context, exprs []parser.Expr, from, unti
 
 // Eval evaluates expressions.
 func (eval Evaluator) Eval(ctx context.Context, exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (results []*types.MetricData, err error) {
-	rewritten, targets, err := RewriteExpr(ctx, eval, exp, from, until, values)
+	targetCtx, err := validateTarget(ctx, exp)
+	if err != nil {
+		return nil, err
+	}
+	rewritten, targets, err := RewriteExpr(targetCtx, eval, exp, from, until, values)
 	if err != nil {
 		return nil, err
 	}
 	if rewritten {
+		// generated targets are validated on their own
+		ctx = context.WithValue(ctx, validatedKey, false)
 		for _, target := range targets {
+			if err := deadline.Check(ctx); err != nil {
+				return nil, err
+			}
 			exp, _, err = parser.ParseExpr(target)
 			if err != nil {
 				return nil, err
@@ -144,7 +154,31 @@ func (eval Evaluator) Eval(ctx context.Context, exp parser.Expr, from, until int
 		}
 		return results, nil
 	}
-	return EvalExpr(ctx, eval, exp, from, until, values)
+	return EvalExpr(targetCtx, eval, exp, from, until, values)
+}
+
+// WithValidatedTargets marks targets evaluated with the context as validated by ValidateTarget, so their function calls
+// aren't validated again during evaluation.
+func WithValidatedTargets(ctx context.Context) context.Context {
+	return context.WithValue(ctx, validatedKey, true)
+}
+
+// ValidateTarget checks arguments of all function calls of the target against declared parameters of the functions.
+// Positions in the error are offsets from the start of the target.
+func ValidateTarget(target string, e parser.Expr) error {
+	return helper.ValidateExpr(e, target)
+}
+
+// validateTarget validates the target, unless the context marks it as validated already. Returned context marks nested
+// calls of the target as validated.
+func validateTarget(ctx context.Context, e parser.Expr) (context.Context, error) {
+	if validated, _ := ctx.Value(validatedKey).(bool); validated || !e.IsFunc() {
+		return ctx, nil
+	}
+	if err := ValidateTarget(e.ToString(), e); err != nil {
+		return ctx, err
+	}
+	return WithValidatedTargets(ctx), nil
 }
 
 // NewEvaluator create evaluator with limiter and zipper
@@ -180,11 +214,20 @@ func EvalExpr(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, fro
 		return nil, merry.WithHTTPCode(err, 400)
 	}
 
+	// request, which is out of time, isn't evaluated further
+	if err := deadline.Check(ctx); err != nil {
+		return nil, err
+	}
+
 	metadata.FunctionMD.RLock()
 	f, ok := metadata.FunctionMD.Functions[e.Target()]
 	metadata.FunctionMD.RUnlock()
 	if ok {
-		v, err := f.Do(ctx, eval, e, from, until, values)
+		ctx, err := validateTarget(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		v, err := f.Do(ctx, prefetchArgs(ctx, eval, e, from, until, values), e, from, until, values)
 		if err != nil {
 			err = merry.WithMessagef(err, "function=%s: %s", e.Target(), err.Error())
 			if merry.Is(
@@ -220,6 +263,10 @@ func RewriteExpr(ctx context.Context, eval interfaces.Evaluator, e parser.Expr,
 		f, ok := metadata.FunctionMD.RewriteFunctions[e.Target()]
 		metadata.FunctionMD.RUnlock()
 		if ok {
+			ctx, err := validateTarget(ctx, e)
+			if err != nil {
+				return false, nil, err
+			}
 			return f.Do(ctx, eval, e, from, until, values)
 		}
 	}
@@ -245,23 +292,119 @@ func FetchAndEvalExp(ctx context.Context, eval interfaces.Evaluator, e parser.Ex
 	return res, nil
 }
 
+// FetchAndEvalExps fetch data and evaluates expressions one by one, like a sequence of FetchAndEvalExp calls.
+// Data is fetched sequentially, so requests are deduplicated in the same way, but if the context allows
+// parallel evaluation (see WithEvalParallelism), fetched targets are evaluated concurrently.
+// Results and errors are returned in the order of exprs. If stop returns true for an error, remaining targets are
+// not fetched and evaluated, their results and errors are nil. nil stop never stops. Targets are not evaluated after
+// the context is done, the first skipped one gets the error of deadline.Check.
+func FetchAndEvalExps(ctx context.Context, eval interfaces.Evaluator, exprs []parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData, stop func(merry.Error) bool) ([][]*types.MetricData, []merry.Error) {
+	if getEvalPool(ctx) == nil {
+		results := make([][]*types.MetricData, len(exprs))
+		errs := make([]merry.Error, len(exprs))
+		for i, exp := range exprs {
+			if errs[i] = deadline.Check(ctx); errs[i] != nil {
+				break
+			}
+			results[i], errs[i] = FetchAndEvalExp(ctx, eval, exp, from, until, values)
+			if errs[i] != nil && stop != nil && stop(errs[i]) {
+				break
+			}
+		}
+		return results, errs
+	}
+
+	targetValues := make([]map[parser.MetricRequest][]*types.MetricData, len(exprs))
+	fetchErrs := make([]merry.Error, len(exprs))
+	for i, exp := range exprs {
+		if fetchErrs[i] = deadline.Check(ctx); fetchErrs[i] != nil {
+			exprs = exprs[:i+1]
+			break
+		}
+		fetched := make(map[parser.MetricRequest]struct{}, len(values))
+		for mReq := range values {
+			fetched[mReq] = struct{}{}
+		}
+		tv, err := eval.Fetch(ctx, []parser.Expr{exp}, from, until, values)
+		if err != nil {
+			fetchErrs[i] = merry.Wrap(err)
+			if stop != nil && stop(fetchErrs[i]) {
+				// targets before the failed one are still evaluated, like in sequential evaluation
+				exprs = exprs[:i+1]
+				break
+			}
+			continue
+		}
+		// Sequential evaluation sorts values after each target, so targets that reuse already
+		// fetched data see it sorted. Sort a copy to not disturb targets evaluated concurrently.
+		for mReq, data := range tv {
+			if _, ok := fetched[mReq]; ok {
+				sorted := make([]*types.MetricData, len(data))
+				copy(sorted, data)
+				SortMetrics(sorted, mReq)
+				tv[mReq] = sorted
+			}
+		}
+		targetValues[i] = tv
+	}
+
+	evalExprs := make([]parser.Expr, 0, len(exprs))
+	evalValues := make([]map[parser.MetricRequest][]*types.MetricData, 0, len(exprs))
+	for i, exp := range exprs {
+		if fetchErrs[i] == nil {
+			evalExprs = append(evalExprs, exp)
+			evalValues = append(evalValues, targetValues[i])
+		}
+	}
+
+	evalResults, evalErrs := evalTargets(ctx, eval, evalExprs, from, until, evalValues, stop)
+
+	results := make([][]*types.MetricData, len(targetValues))
+	errs := make([]merry.Error, len(targetValues))
+	n := 0
+	for i := range exprs {
+		if fetchErrs[i] != nil {
+			errs[i] = fetchErrs[i]
+			continue
+		}
+		if evalErrs[n] == nil {
+			results[i] = evalResults[n]
+		} else {
+			errs[i] = evalErrs[n]
+		}
+		n++
+	}
+
+	for mReq := range values {
+		SortMetrics(values[mReq], mReq)
+	}
+
+	return results, errs
+}
+
 func FetchAndEvalExprs(ctx context.Context, eval interfaces.Evaluator, exprs []parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, map[string]merry.Error) {
 	targetValues, err := eval.Fetch(ctx, exprs, from, until, values)
 	if err != nil {
 		return nil, map[string]merry.Error{"*": merry.Wrap(err)}
 	}
 
+	exprValues := make([]map[parser.MetricRequest][]*types.MetricData, len(exprs))
+	for i := range exprs {
+		exprValues[i] = targetValues
+	}
+
+	evalResults, evalErrs := evalTargets(ctx, eval, exprs, from, until, exprValues, nil)
+
 	res := make([]*types.MetricData, 0, len(exprs))
 	var errors map[string]merry.Error
-	for _, exp := range exprs {
-		evaluationResult, err := eval.Eval(ctx, exp, from, until, targetValues)
-		if err != nil {
+	for i, exp := range exprs {
+		if evalErrs[i] != nil {
 			if errors == nil {
 				errors = make(map[string]merry.Error)
 			}
-			errors[exp.Target()] = merry.Wrap(err)
+			errors[exp.Target()] = evalErrs[i]
 		}
-		res = append(res, evaluationResult...)
+		res = append(res, evalResults[i]...)
 	}
 
 	for mReq := range values {
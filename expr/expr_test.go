@@ -217,6 +217,111 @@ func TestEvalExpr(t *testing.T) {
 	}
 }
 
+func TestEvalExprValidateArgs(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItemWithError{
+		{
+			Target: "scale(metric1,'x')",
+			M: map[parser.MetricRequest][]*types.MetricData{
+				{Metric: "metric1", From: 0, Until: 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+			},
+			Error: parser.ErrBadType,
+		},
+		{
+			Target: "sumSeries(scale(metric1))",
+			M: map[parser.MetricRequest][]*types.MetricData{
+				{Metric: "metric1", From: 0, Until: 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+			},
+			Error: parser.ErrMissingArgument,
+		},
+		{
+			Target: "scale(metric1,2,3,4)",
+			M: map[parser.MetricRequest][]*types.MetricData{
+				{Metric: "metric1", From: 0, Until: 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+			},
+			Error: parser.ErrInvalidArg,
+		},
+		{
+			Target: "scale(metric1,2,factr=3)",
+			M: map[parser.MetricRequest][]*types.MetricData{
+				{Metric: "metric1", From: 0, Until: 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+			},
+			Error: parser.ErrInvalidArg,
+		},
+		{
+			Target: "summarize(metric1,'1min','foo')",
+			M: map[parser.MetricRequest][]*types.MetricData{
+				{Metric: "metric1", From: 0, Until: 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+			},
+			Error: parser.ErrInvalidArg,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Target, func(t *testing.T) {
+			eval, err := NewEvaluator(nil, th.NewTestZipper(nil), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			th.TestEvalExprWithError(t, eval, &tt)
+		})
+	}
+}
+
+// targets, which are common in dashboards, must stay valid
+func TestValidateTargetDashboards(t *testing.T) {
+	targets := []string{
+		"aliasByNode(sumSeries(a.*.b),1)",
+		"aliasByNode(a.b.c, 1, 2)",
+		"aliasByTags(seriesByTag('name=a.b', 'dc=~(east|west)'), 'dc')",
+		"alias(a.b,'requests')",
+		"aliasSub(a.b.*,'^a\\.b\\.(.*)$','\\1')",
+		"summarize(a.b,'1h','sum',false)",
+		"summarize(a.b, '1d', 'p99')",
+		"movingAverage(a.b,'5min')",
+		"movingAverage(a.b,10)",
+		"groupByNode(a.*.b,1,'sum')",
+		"groupByNodes(a.*.b.*,'sum',1,3)",
+		"groupByTags(seriesByTag('name=a'),'max','dc')",
+		"timeShift(a.b,'1d')",
+		"perSecond(a.b)",
+		"nonNegativeDerivative(a.b, maxValue=100)",
+		"keepLastValue(a.b,3)",
+		"legendValue(a.b,'avg','last')",
+		"consolidateBy(a.b,'max')",
+		"hitcount(a.b,'1h',true)",
+		"transformNull(a.b,0)",
+		"divideSeries(sumSeries(a.*.ok),sumSeries(a.*.total))",
+		"asPercent(a.b,a.c)",
+		"asPercent(a.b,1500)",
+		"asPercent(a.*.b,None,0)",
+		"scale(offset(a.b,-1),0.5)",
+		"highestMax(a.*,5)",
+		"highest(a.*,'max')",
+		"lowest(a.*,3,'current')",
+		"sortByMaxima(a.*)",
+		"removeBelowValue(a.b,0)",
+		"constantLine(100)",
+		"threshold(1,'limit','red')",
+		"sumSeriesWithWildcards(a.*.b.*,1)",
+		"applyByNode(a.*.b,1,'sumSeries(%.c)')",
+		"a.b|scale(2)|alias('x')",
+	}
+
+	for _, target := range targets {
+		t.Run(target, func(t *testing.T) {
+			e, _, err := parser.ParseExpr(target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", target, err)
+			}
+			if err := helper.ValidateExpr(e, target); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestEvalExpression(t *testing.T) {
 
 	now32 := time.Now().Unix()
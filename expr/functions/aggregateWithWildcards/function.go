@@ -128,9 +128,9 @@ func (f *aggregateWithWildcards) Description() map[string]types.FunctionDescript
 					Options:  types.StringsToSuggestionList(consolidations.AvailableConsolidationFuncs()),
 				},
 				{
+					Multiple: true,
 					Name:     "positions",
 					Type:     types.Node,
-					Required: true,
 				},
 			},
 		},
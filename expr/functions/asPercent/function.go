@@ -445,7 +445,7 @@ func (f *asPercent) Description() map[string]types.FunctionDescription {
 				},
 				{
 					Name: "total",
-					Type: types.SeriesList,
+					Type: types.SeriesListOrFloat,
 				},
 				{
 					Multiple: true,
@@ -472,7 +472,7 @@ func (f *asPercent) Description() map[string]types.FunctionDescription {
 				},
 				{
 					Name: "total",
-					Type: types.SeriesList,
+					Type: types.SeriesListOrFloat,
 				},
 				{
 					Multiple: true,
@@ -158,11 +158,16 @@ func (f *exponentialMovingAverage) Description() map[string]types.FunctionDescri
 					Name:     "windowSize",
 					Required: true,
 					Suggestions: types.NewSuggestions(
-						0.1,
-						0.5,
-						0.7,
+						5,
+						7,
+						10,
+						"1min",
+						"5min",
+						"10min",
+						"30min",
+						"1hour",
 					),
-					Type: types.Float,
+					Type: types.IntOrInterval,
 				},
 			},
 		},
@@ -45,6 +45,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/groupByTags"
 	"github.com/go-graphite/carbonapi/expr/functions/heatMap"
 	"github.com/go-graphite/carbonapi/expr/functions/highestLowest"
+	"github.com/go-graphite/carbonapi/expr/functions/histogram"
 	"github.com/go-graphite/carbonapi/expr/functions/hitcount"
 	"github.com/go-graphite/carbonapi/expr/functions/holtWintersAberration"
 	"github.com/go-graphite/carbonapi/expr/functions/holtWintersConfidenceArea"
@@ -76,10 +77,12 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/nonNegativeDerivative"
 	"github.com/go-graphite/carbonapi/expr/functions/offset"
 	"github.com/go-graphite/carbonapi/expr/functions/offsetToZero"
+	"github.com/go-graphite/carbonapi/expr/functions/outliersByMAD"
 	"github.com/go-graphite/carbonapi/expr/functions/pearson"
 	"github.com/go-graphite/carbonapi/expr/functions/pearsonClosest"
 	"github.com/go-graphite/carbonapi/expr/functions/perSecond"
 	"github.com/go-graphite/carbonapi/expr/functions/percentileOfSeries"
+	"github.com/go-graphite/carbonapi/expr/functions/percentileRankSeries"
 	"github.com/go-graphite/carbonapi/expr/functions/polyfit"
 	"github.com/go-graphite/carbonapi/expr/functions/pow"
 	"github.com/go-graphite/carbonapi/expr/functions/powSeries"
@@ -92,6 +95,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/round"
 	"github.com/go-graphite/carbonapi/expr/functions/scale"
 	"github.com/go-graphite/carbonapi/expr/functions/scaleToSeconds"
+	"github.com/go-graphite/carbonapi/expr/functions/script"
 	"github.com/go-graphite/carbonapi/expr/functions/seriesByTag"
 	"github.com/go-graphite/carbonapi/expr/functions/seriesList"
 	"github.com/go-graphite/carbonapi/expr/functions/setXFilesFactor"
@@ -117,6 +121,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/functions/unique"
 	"github.com/go-graphite/carbonapi/expr/functions/verticalLine"
 	"github.com/go-graphite/carbonapi/expr/functions/weightedAverage"
+	"github.com/go-graphite/carbonapi/expr/functions/zScoreByGroup"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/metadata"
 )
@@ -171,6 +176,7 @@ func New(configs map[string]string) {
 		{name: "groupByTags", filename: "groupByTags", order: groupByTags.GetOrder(), f: groupByTags.New},
 		{name: "heatMap", filename: "heatMap", order: heatMap.GetOrder(), f: heatMap.New},
 		{name: "highestLowest", filename: "highestLowest", order: highestLowest.GetOrder(), f: highestLowest.New},
+		{name: "histogram", filename: "histogram", order: histogram.GetOrder(), f: histogram.New},
 		{name: "hitcount", filename: "hitcount", order: hitcount.GetOrder(), f: hitcount.New},
 		{name: "holtWintersAberration", filename: "holtWintersAberration", order: holtWintersAberration.GetOrder(), f: holtWintersAberration.New},
 		{name: "holtWintersConfidenceArea", filename: "holtWintersConfidenceArea", order: holtWintersConfidenceArea.GetOrder(), f: holtWintersConfidenceArea.New},
@@ -202,10 +208,12 @@ func New(configs map[string]string) {
 		{name: "nonNegativeDerivative", filename: "nonNegativeDerivative", order: nonNegativeDerivative.GetOrder(), f: nonNegativeDerivative.New},
 		{name: "offset", filename: "offset", order: offset.GetOrder(), f: offset.New},
 		{name: "offsetToZero", filename: "offsetToZero", order: offsetToZero.GetOrder(), f: offsetToZero.New},
+		{name: "outliersByMAD", filename: "outliersByMAD", order: outliersByMAD.GetOrder(), f: outliersByMAD.New},
 		{name: "pearson", filename: "pearson", order: pearson.GetOrder(), f: pearson.New},
 		{name: "pearsonClosest", filename: "pearsonClosest", order: pearsonClosest.GetOrder(), f: pearsonClosest.New},
 		{name: "perSecond", filename: "perSecond", order: perSecond.GetOrder(), f: perSecond.New},
 		{name: "percentileOfSeries", filename: "percentileOfSeries", order: percentileOfSeries.GetOrder(), f: percentileOfSeries.New},
+		{name: "percentileRankSeries", filename: "percentileRankSeries", order: percentileRankSeries.GetOrder(), f: percentileRankSeries.New},
 		{name: "polyfit", filename: "polyfit", order: polyfit.GetOrder(), f: polyfit.New},
 		{name: "pow", filename: "pow", order: pow.GetOrder(), f: pow.New},
 		{name: "powSeries", filename: "powSeries", order: powSeries.GetOrder(), f: powSeries.New},
@@ -218,6 +226,7 @@ func New(configs map[string]string) {
 		{name: "round", filename: "round", order: round.GetOrder(), f: round.New},
 		{name: "scale", filename: "scale", order: scale.GetOrder(), f: scale.New},
 		{name: "scaleToSeconds", filename: "scaleToSeconds", order: scaleToSeconds.GetOrder(), f: scaleToSeconds.New},
+		{name: "script", filename: "script", order: script.GetOrder(), f: script.New},
 		{name: "seriesByTag", filename: "seriesByTag", order: seriesByTag.GetOrder(), f: seriesByTag.New},
 		{name: "seriesList", filename: "seriesList", order: seriesList.GetOrder(), f: seriesList.New},
 		{name: "setXFilesFactor", filename: "setXFilesFactor", order: setXFilesFactor.GetOrder(), f: setXFilesFactor.New},
@@ -243,6 +252,7 @@ func New(configs map[string]string) {
 		{name: "unique", filename: "unique", order: unique.GetOrder(), f: unique.New},
 		{name: "verticalLine", filename: "verticalLine", order: verticalLine.GetOrder(), f: verticalLine.New},
 		{name: "weightedAverage", filename: "weightedAverage", order: weightedAverage.GetOrder(), f: weightedAverage.New},
+		{name: "zScoreByGroup", filename: "zScoreByGroup", order: zScoreByGroup.GetOrder(), f: zScoreByGroup.New},
 	}
 
 	sort.Slice(funcs, func(i, j int) bool {
@@ -150,7 +150,7 @@ func (f *groupByNode) Description() map[string]types.FunctionDescription {
 					Name:     "callback",
 					Options:  types.StringsToSuggestionList(consolidations.AvailableSummarizers),
 					Required: false,
-					Type:     types.AggFunc,
+					Type:     types.AggOrSeriesFunc,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -174,7 +174,7 @@ func (f *groupByNode) Description() map[string]types.FunctionDescription {
 					Name:     "callback",
 					Options:  types.StringsToSuggestionList(consolidations.AvailableSummarizers),
 					Required: false,
-					Type:     types.AggFunc,
+					Type:     types.AggOrSeriesFunc,
 				},
 				{
 					Multiple: true,
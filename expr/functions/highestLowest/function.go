@@ -159,9 +159,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Required: true,
 				},
 				{
-					Name:     "n",
-					Type:     types.Integer,
-					Required: true,
+					Default: types.NewSuggestion(1),
+					Name:    "n",
+					Type:    types.Integer,
 				},
 				{
 					Name: "func",
@@ -188,9 +188,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -208,9 +207,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -228,9 +226,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -248,9 +245,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -268,9 +264,9 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Required: true,
 				},
 				{
-					Name:     "n",
-					Type:     types.Integer,
-					Required: true,
+					Default: types.NewSuggestion(1),
+					Name:    "n",
+					Type:    types.Integer,
 				},
 				{
 					Name: "func",
@@ -297,9 +293,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -317,9 +312,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -337,9 +331,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -357,9 +350,8 @@ func (f *highest) Description() map[string]types.FunctionDescription {
 					Type:     types.SeriesList,
 				},
 				{
-					Name:     "n",
-					Required: true,
-					Type:     types.Integer,
+					Name: "n",
+					Type: types.Integer,
 				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
@@ -0,0 +1,190 @@
+package histogram
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type histogram struct{}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &histogram{}
+	functions := []string{"histogramQuantile", "histogramMean", "histogramCount"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// histogramQuantile(seriesList, q, bucket=None), histogramMean(seriesList, bucket=None), histogramCount(seriesList, bucket=None)
+func (f *histogram) Do(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(ctx, eval, e.Arg(0), from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	bucketArg := 1
+	var (
+		q    float64
+		qStr string
+	)
+	if e.Target() == "histogramQuantile" {
+		q, err = e.GetFloatArg(1)
+		if err != nil {
+			return nil, err
+		}
+		qStr = strconv.FormatFloat(q, 'g', -1, 64)
+		bucketArg = 2
+	}
+
+	var bucket *parser.NodeOrTag
+	if e.ArgsLen() > bucketArg {
+		nodeOrTag, err := e.GetNodeOrTagArgs(bucketArg, true)
+		if err != nil {
+			return nil, err
+		}
+		bucket = &nodeOrTag[0]
+	}
+
+	histograms := helper.GroupHistograms(args, bucket)
+	results := make([]*types.MetricData, 0, len(histograms))
+	for _, h := range histograms {
+		var (
+			name    string
+			tagName string
+			compute func(i int) float64
+		)
+		switch e.Target() {
+		case "histogramQuantile":
+			name = "histogramQuantile(" + h.Name + "," + qStr + ")"
+			tagName = qStr
+			compute = func(i int) float64 { return h.Quantile(q, i) }
+		case "histogramMean":
+			name = "histogramMean(" + h.Name + ")"
+			tagName = "1"
+			compute = h.Mean
+		case "histogramCount":
+			name = "histogramCount(" + h.Name + ")"
+			tagName = "1"
+			compute = h.Count
+		}
+
+		resultTags := make(map[string]string, len(h.Tags)+1)
+		for k, v := range h.Tags {
+			resultTags[k] = v
+		}
+		resultTags["name"] = name
+		resultTags[e.Target()] = tagName
+
+		first := h.Buckets[0]
+		r := first.CopyTag(name, resultTags)
+		r.Values = make([]float64, len(first.Values))
+		for i := range r.Values {
+			r.Values[i] = compute(i)
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+const bucketDescription = "Bucket bound is taken from the tag (specified by name) or the node (specified by index) passed as `bucket`.\n" +
+	"By default Prometheus-style `" + tags.BucketTag + "` tag is used, or the last graphite-style `" + tags.BucketNodePrefix + "*` node (where `_` is used instead of dot, e.x. `" +
+	tags.BucketNodePrefix + "0_25`, `" + tags.BucketNodePrefix + "inf`).\n" +
+	"Bucket series must be cumulative, like Prometheus ones: each bucket counts all observations less than or equal to its bound.\n" +
+	"Series with the same name (except of the bound) form a histogram, series without bound are ignored.\n" +
+	"Counters should be converted to rates with `perSecond` or `nonNegativeDerivative` before."
+
+func (f *histogram) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"histogramQuantile": {
+			Description: "Takes one metric or a wildcard seriesList with histogram buckets and estimates the q-quantile (0 <= q <= 1) of observations\n" +
+				"for each histogram, interpolating linearly within the bucket, like Prometheus `histogram_quantile` does. Histogram must have `+Inf` bucket.\n\n" +
+				bucketDescription + "\n\nExample:\n\n.. code-block:: none\n\n  &target=histogramQuantile(perSecond(seriesByTag('name=http_request_duration_seconds_bucket')), 0.99)\n" +
+				"  &target=histogramQuantile(perSecond(app.latency.bucket.le_*), 0.99)",
+			Function: "histogramQuantile(seriesList, q, bucket=None)",
+			Group:    "Combine",
+			Module:   "graphite.render.functions.custom",
+			Name:     "histogramQuantile",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "q",
+					Required: true,
+					Type:     types.Float,
+				},
+				{
+					Name: "bucket",
+					Type: types.NodeOrTag,
+				},
+			},
+			SeriesChange: true, // function aggregate metrics or change series items count
+			NameChange:   true, // name changed
+			TagsChange:   true, // name tag changed
+			ValuesChange: true, // values changed
+		},
+		"histogramMean": {
+			Description: "Takes one metric or a wildcard seriesList with histogram buckets and estimates the mean of observations for each histogram,\n" +
+				"assuming they are placed in the middle of their buckets. Observations of the `+Inf` bucket are counted as equal to the largest finite bound.\n\n" +
+				bucketDescription + "\n\nExample:\n\n.. code-block:: none\n\n  &target=histogramMean(perSecond(seriesByTag('name=http_request_duration_seconds_bucket')))",
+			Function: "histogramMean(seriesList, bucket=None)",
+			Group:    "Combine",
+			Module:   "graphite.render.functions.custom",
+			Name:     "histogramMean",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name: "bucket",
+					Type: types.NodeOrTag,
+				},
+			},
+			SeriesChange: true, // function aggregate metrics or change series items count
+			NameChange:   true, // name changed
+			TagsChange:   true, // name tag changed
+			ValuesChange: true, // values changed
+		},
+		"histogramCount": {
+			Description: "Takes one metric or a wildcard seriesList with histogram buckets and returns the amount of observations for each histogram\n" +
+				"(value of the largest bucket).\n\n" +
+				bucketDescription + "\n\nExample:\n\n.. code-block:: none\n\n  &target=histogramCount(perSecond(seriesByTag('name=http_request_duration_seconds_bucket')))",
+			Function: "histogramCount(seriesList, bucket=None)",
+			Group:    "Combine",
+			Module:   "graphite.render.functions.custom",
+			Name:     "histogramCount",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name: "bucket",
+					Type: types.NodeOrTag,
+				},
+			},
+			SeriesChange: true, // function aggregate metrics or change series items count
+			NameChange:   true, // name changed
+			TagsChange:   true, // name tag changed
+			ValuesChange: true, // values changed
+		},
+	}
+}
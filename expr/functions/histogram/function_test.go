@@ -0,0 +1,105 @@
+package histogram
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+var (
+	md []interfaces.FunctionMetadata = New("")
+)
+
+func init() {
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tagged := map[parser.MetricRequest][]*types.MetricData{
+		{"seriesByTag('name=latency_bucket')", "", 0, 1}: {
+			types.MakeMetricData("latency_bucket;host=a;le=0.1", []float64{10, 0, 1}, 1, now32),
+			types.MakeMetricData("latency_bucket;host=a;le=0.5", []float64{50, 0, math.NaN()}, 1, now32),
+			types.MakeMetricData("latency_bucket;host=a;le=1", []float64{90, 0, 1}, 1, now32),
+			types.MakeMetricData("latency_bucket;host=a;le=+Inf", []float64{100, 0, 1}, 1, now32),
+			types.MakeMetricData("latency_bucket;host=b;le=1", []float64{1, 2, 4}, 1, now32),
+			types.MakeMetricData("latency_bucket;host=b;le=+Inf", []float64{2, 2, 4}, 1, now32),
+		},
+	}
+
+	graphite := map[parser.MetricRequest][]*types.MetricData{
+		{"app.latency.*", "", 0, 1}: {
+			types.MakeMetricData("app.latency.le_0_1", []float64{10, 1}, 1, now32),
+			types.MakeMetricData("app.latency.le_0_5", []float64{50, 1}, 1, now32),
+			types.MakeMetricData("app.latency.le_1", []float64{90, 1}, 1, now32),
+			types.MakeMetricData("app.latency.le_inf", []float64{100, 2}, 1, now32),
+			types.MakeMetricData("app.latency.count", []float64{100, 2}, 1, now32),
+		},
+	}
+
+	tests := []th.EvalTestItem{
+		{
+			"histogramQuantile(seriesByTag('name=latency_bucket'), 0.5)",
+			tagged,
+			[]*types.MetricData{
+				types.MakeMetricData("histogramQuantile(latency_bucket;host=a,0.5)", []float64{0.5, math.NaN(), math.NaN()}, 1, now32).
+					SetTag("host", "a").SetTag("histogramQuantile", "0.5").SetNameTag("histogramQuantile(latency_bucket;host=a,0.5)"),
+				types.MakeMetricData("histogramQuantile(latency_bucket;host=b,0.5)", []float64{1, 0.5, 0.5}, 1, now32).
+					SetTag("host", "b").SetTag("histogramQuantile", "0.5").SetNameTag("histogramQuantile(latency_bucket;host=b,0.5)"),
+			},
+		},
+		{
+			"histogramMean(seriesByTag('name=latency_bucket'), 'le')",
+			tagged,
+			[]*types.MetricData{
+				types.MakeMetricData("histogramMean(latency_bucket;host=a)", []float64{0.525, math.NaN(), math.NaN()}, 1, now32).
+					SetTag("host", "a").SetTag("histogramMean", "1").SetNameTag("histogramMean(latency_bucket;host=a)"),
+				types.MakeMetricData("histogramMean(latency_bucket;host=b)", []float64{0.75, 0.5, 0.5}, 1, now32).
+					SetTag("host", "b").SetTag("histogramMean", "1").SetNameTag("histogramMean(latency_bucket;host=b)"),
+			},
+		},
+		{
+			"histogramCount(seriesByTag('name=latency_bucket'))",
+			tagged,
+			[]*types.MetricData{
+				types.MakeMetricData("histogramCount(latency_bucket;host=a)", []float64{100, 0, math.NaN()}, 1, now32).
+					SetTag("host", "a").SetTag("histogramCount", "1").SetNameTag("histogramCount(latency_bucket;host=a)"),
+				types.MakeMetricData("histogramCount(latency_bucket;host=b)", []float64{2, 2, 4}, 1, now32).
+					SetTag("host", "b").SetTag("histogramCount", "1").SetNameTag("histogramCount(latency_bucket;host=b)"),
+			},
+		},
+		{
+			"histogramQuantile(app.latency.*, 0.99)",
+			graphite,
+			[]*types.MetricData{
+				types.MakeMetricData("histogramQuantile(app.latency,0.99)", []float64{1, 1}, 1, now32).
+					SetTag("histogramQuantile", "0.99").SetNameTag("histogramQuantile(app.latency,0.99)"),
+			},
+		},
+		{
+			"histogramQuantile(app.latency.*, 0.25, 2)",
+			graphite,
+			[]*types.MetricData{
+				types.MakeMetricData("histogramQuantile(app.latency,0.25)", []float64{0.25, 0.05}, 1, now32).
+					SetTag("histogramQuantile", "0.25").SetNameTag("histogramQuantile(app.latency,0.25)"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			eval := th.EvaluatorFromFunc(md[0].F)
+			th.TestEvalExpr(t, eval, &tt)
+		})
+	}
+}
@@ -120,6 +120,15 @@ func (f *holtWintersConfidenceBands) Description() map[string]types.FunctionDesc
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Suggestions: types.NewSuggestions(
+						"1d",
+						"7d",
+					),
+					Type: types.Interval,
+				},
 			},
 			SeriesChange: true, // function aggregate metrics or change series items count
 			NameChange:   true, // name changed
@@ -101,6 +101,15 @@ func (f *holtWintersForecast) Description() map[string]types.FunctionDescription
 					),
 					Type: types.Interval,
 				},
+				{
+					Default: types.NewSuggestion("1d"),
+					Name:    "seasonality",
+					Suggestions: types.NewSuggestions(
+						"1d",
+						"7d",
+					),
+					Type: types.Interval,
+				},
 			},
 			NameChange:   true, // name changed
 			TagsChange:   true, // name tag changed
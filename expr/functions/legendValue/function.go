@@ -111,8 +111,8 @@ func (f *legendValue) Description() map[string]types.FunctionDescription {
 				{
 					Multiple: true,
 					Name:     "valuesTypes",
-					Options:  types.StringsToSuggestionList(consolidations.AvailableSummarizers),
-					Type:     types.String,
+					Options:  types.StringsToSuggestionList(append([]string{"si", "binary"}, consolidations.AvailableSummarizers...)),
+					Type:     types.AggFunc,
 				},
 			},
 			NameChange: true, // name changed
@@ -102,7 +102,8 @@ func (f *mostDeviant) Description() map[string]types.FunctionDescription {
 					Type:     types.Integer,
 				},
 			},
-			SeriesChange: true, // function aggregate metrics or change series items count
+			SkipArgsValidation: true, // legacy mostDeviant(n, seriesList) is also supported
+			SeriesChange:       true, // function aggregate metrics or change series items count
 		},
 	}
 }
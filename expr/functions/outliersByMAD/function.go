@@ -0,0 +1,137 @@
+package outliersByMAD
+
+import (
+	"context"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type outliersByMAD struct{}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &outliersByMAD{}
+	functions := []string{"outliersByMAD"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+const (
+	// madScale makes MAD a consistent estimator of standard deviation for normally distributed data
+	madScale = 1.4826
+	// meanADScale does the same for mean absolute deviation, used when more than half of the values are equal
+	meanADScale = 1.253314
+)
+
+// outliersByMAD(seriesList, threshold=3.5, *nodes)
+func (f *outliersByMAD) Do(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(ctx, eval, e.Arg(0), from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, err := e.GetFloatNamedOrPosArgDefault("threshold", 1, 3.5)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []parser.NodeOrTag
+	if e.ArgsLen() > 2 {
+		nodes, err = e.GetNodeOrTagArgs(2, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys, groups := helper.GroupByAggKey(args, nodes)
+	outliers := make(map[*types.MetricData]bool)
+	for _, k := range keys {
+		group := groups[k]
+
+		avgs := make([]float64, len(group))
+		for n, a := range group {
+			avgs[n] = consolidations.AvgValue(a.Values)
+		}
+
+		median := consolidations.Percentile(avgs, 50, true)
+		if math.IsNaN(median) {
+			continue
+		}
+
+		deviations := make([]float64, len(avgs))
+		var sumDeviation float64
+		var count int
+		for n, v := range avgs {
+			deviations[n] = math.Abs(v - median)
+			if !math.IsNaN(v) {
+				sumDeviation += deviations[n]
+				count++
+			}
+		}
+
+		scale := madScale * consolidations.Percentile(deviations, 50, true)
+		if scale == 0 {
+			scale = meanADScale * sumDeviation / float64(count)
+		}
+		if scale == 0 {
+			// all values in the group are the same
+			continue
+		}
+
+		for n, a := range group {
+			if deviations[n]/scale > threshold {
+				outliers[a] = true
+			}
+		}
+	}
+
+	results := make([]*types.MetricData, 0, len(outliers))
+	for _, a := range args {
+		if outliers[a] {
+			results = append(results, a)
+		}
+	}
+
+	return results, nil
+}
+
+func (f *outliersByMAD) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"outliersByMAD": {
+			Description: "Takes one metric or a wildcard seriesList, a threshold and zero or more nodes or tags.\nSeries are grouped by the given nodes (all series are in the same group if no nodes specified).\nReturns only series which average value is further than `threshold` robust standard deviations\nfrom the median of their group. Deviation is estimated with median absolute deviation (MAD), so a\nsingle outlier doesn't hide itself by inflating the deviation, as it happens with the standard one.\n\nExample:\n\n.. code-block:: none\n\n  &target=outliersByMAD(dc*.host*.cpu.usage, 3.5, 0)\n\nDraws hosts which CPU usage is unusual compared to other hosts of the same datacenter.",
+			Function:    "outliersByMAD(seriesList, threshold=3.5, *nodes)",
+			Group:       "Filter Series",
+			Module:      "graphite.render.functions.custom",
+			Name:        "outliersByMAD",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Default: types.NewSuggestion(3.5),
+					Name:    "threshold",
+					Type:    types.Float,
+				},
+				{
+					Multiple: true,
+					Name:     "nodes",
+					Type:     types.NodeOrTag,
+				},
+			},
+			SeriesChange: true, // function aggregate metrics or change series items count
+		},
+	}
+}
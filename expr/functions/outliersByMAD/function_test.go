@@ -0,0 +1,96 @@
+package outliersByMAD
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+var (
+	md []interfaces.FunctionMetadata = New("")
+)
+
+func init() {
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestOutliersByMAD(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"outliersByMAD(metric*)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", "", 0, 1}: {
+					types.MakeMetricData("metricA", []float64{10, 10, 10}, 1, now32),
+					types.MakeMetricData("metricB", []float64{11, 11, 11}, 1, now32),
+					types.MakeMetricData("metricC", []float64{9, 11, 10}, 1, now32),
+					types.MakeMetricData("metricD", []float64{12, 12, 12}, 1, now32),
+					types.MakeMetricData("metricE", []float64{50, 50, 50}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metricE", []float64{50, 50, 50}, 1, now32),
+			},
+		},
+		{
+			// MAD is 0, mean absolute deviation is used
+			"outliersByMAD(metric*, 3.5)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", "", 0, 1}: {
+					types.MakeMetricData("metricA", []float64{10, 10}, 1, now32),
+					types.MakeMetricData("metricB", []float64{20, 20}, 1, now32),
+					types.MakeMetricData("metricC", []float64{10, 10}, 1, now32),
+					types.MakeMetricData("metricD", []float64{10, 10}, 1, now32),
+					types.MakeMetricData("metricE", []float64{10, 10}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metricB", []float64{20, 20}, 1, now32),
+			},
+		},
+		{
+			"outliersByMAD(metric*, threshold=10)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", "", 0, 1}: {
+					types.MakeMetricData("metricA", []float64{10, 10, 10}, 1, now32),
+					types.MakeMetricData("metricB", []float64{11, 11, 11}, 1, now32),
+					types.MakeMetricData("metricC", []float64{12, 12, 12}, 1, now32),
+					types.MakeMetricData("metricD", []float64{15, 15, 15}, 1, now32),
+				},
+			},
+			[]*types.MetricData{},
+		},
+		{
+			"outliersByMAD(dc*.host*.cpu, 3.5, 0)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"dc*.host*.cpu", "", 0, 1}: {
+					types.MakeMetricData("dc1.host1.cpu", []float64{10, 10}, 1, now32),
+					types.MakeMetricData("dc1.host2.cpu", []float64{11, 11}, 1, now32),
+					types.MakeMetricData("dc1.host3.cpu", []float64{12, 12}, 1, now32),
+					types.MakeMetricData("dc2.host1.cpu", []float64{50, 50}, 1, now32),
+					types.MakeMetricData("dc2.host2.cpu", []float64{51, 51}, 1, now32),
+					types.MakeMetricData("dc2.host3.cpu", []float64{90, 90}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("dc2.host3.cpu", []float64{90, 90}, 1, now32),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			eval := th.EvaluatorFromFunc(md[0].F)
+			th.TestEvalExpr(t, eval, &tt)
+		})
+	}
+}
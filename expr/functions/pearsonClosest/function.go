@@ -171,8 +171,8 @@ and will manifest as if the entire window/series had missing values.`,
 					Type:     types.Integer,
 				},
 				{
-					Name:     "direction",
-					Required: true,
+					Default: types.NewSuggestion("abs"),
+					Name:    "direction",
 					Options: types.StringsToSuggestionList([]string{
 						"abs",
 						"pos",
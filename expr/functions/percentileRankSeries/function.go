@@ -0,0 +1,111 @@
+package percentileRankSeries
+
+import (
+	"context"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type percentileRankSeries struct{}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &percentileRankSeries{}
+	functions := []string{"percentileRankSeries"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// percentileRankSeries(seriesList, *nodes)
+func (f *percentileRankSeries) Do(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(ctx, eval, e.Arg(0), from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := e.GetNodeOrTagArgs(1, false)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, groups := helper.GroupByAggKey(args, nodes)
+	results := make([]*types.MetricData, 0, len(args))
+	for _, k := range keys {
+		// avoid overwriting, align copies
+		group := helper.ScaleSeries(types.CopyMetricDataSlice(groups[k]))
+
+		res := make([]*types.MetricData, len(group))
+		for n, a := range group {
+			r := a.CopyName("percentileRankSeries(" + a.Name + ")")
+			r.Values = make([]float64, len(a.Values))
+			r.Tags["percentileRankSeries"] = "1"
+			res[n] = r
+		}
+
+		for i := range group[0].Values {
+			for n, a := range group {
+				res[n].Values[i] = percentileRank(group, i, a.Values[i])
+			}
+		}
+
+		results = append(results, res...)
+	}
+
+	return results, nil
+}
+
+// percentileRank returns percentage of non-absent values of the group at index i, that are less than or equal to v
+func percentileRank(group []*types.MetricData, i int, v float64) float64 {
+	if math.IsNaN(v) {
+		return math.NaN()
+	}
+	var total, below int
+	for _, a := range group {
+		x := a.Values[i]
+		if math.IsNaN(x) {
+			continue
+		}
+		total++
+		if x <= v {
+			below++
+		}
+	}
+	return 100 * float64(below) / float64(total)
+}
+
+func (f *percentileRankSeries) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"percentileRankSeries": {
+			Description: "Takes one metric or a wildcard seriesList, followed by zero or more nodes or tags.\nSeries are grouped by the given nodes (all series are in the same group if no nodes specified)\nand each value is replaced by its percentile rank within the group at the same timestamp: the\npercentage of values of the group that are less than or equal to it. Absent values are ignored.\n\nExample:\n\n.. code-block:: none\n\n  &target=percentileRankSeries(dc*.host*.requests.latency, 0)\n\nShows 100 for the slowest host of each datacenter.",
+			Function:    "percentileRankSeries(seriesList, *nodes)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions.custom",
+			Name:        "percentileRankSeries",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Multiple: true,
+					Name:     "nodes",
+					Type:     types.NodeOrTag,
+				},
+			},
+			NameChange:   true, // name changed
+			TagsChange:   true, // name tag changed
+			ValuesChange: true, // values changed
+		},
+	}
+}
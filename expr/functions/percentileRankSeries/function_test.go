@@ -0,0 +1,70 @@
+package percentileRankSeries
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+var (
+	md []interfaces.FunctionMetadata = New("")
+)
+
+func init() {
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestPercentileRankSeries(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"percentileRankSeries(host*.latency)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"host*.latency", "", 0, 1}: {
+					types.MakeMetricData("host1.latency", []float64{1, 4, math.NaN(), 2}, 1, now32),
+					types.MakeMetricData("host2.latency", []float64{2, 3, 5, 2}, 1, now32),
+					types.MakeMetricData("host3.latency", []float64{3, 2, 1, 2}, 1, now32),
+					types.MakeMetricData("host4.latency", []float64{4, 1, math.NaN(), 2}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("percentileRankSeries(host1.latency)", []float64{25, 100, math.NaN(), 100}, 1, now32).SetTag("percentileRankSeries", "1").SetNameTag("percentileRankSeries(host1.latency)"),
+				types.MakeMetricData("percentileRankSeries(host2.latency)", []float64{50, 75, 100, 100}, 1, now32).SetTag("percentileRankSeries", "1").SetNameTag("percentileRankSeries(host2.latency)"),
+				types.MakeMetricData("percentileRankSeries(host3.latency)", []float64{75, 50, 50, 100}, 1, now32).SetTag("percentileRankSeries", "1").SetNameTag("percentileRankSeries(host3.latency)"),
+				types.MakeMetricData("percentileRankSeries(host4.latency)", []float64{100, 25, math.NaN(), 100}, 1, now32).SetTag("percentileRankSeries", "1").SetNameTag("percentileRankSeries(host4.latency)"),
+			},
+		},
+		{
+			"percentileRankSeries(seriesByTag('name=latency'), 'dc')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"seriesByTag('name=latency')", "", 0, 1}: {
+					types.MakeMetricData("latency;dc=dc1;host=host1", []float64{1, 2}, 1, now32),
+					types.MakeMetricData("latency;dc=dc2;host=host1", []float64{10, 20}, 1, now32),
+					types.MakeMetricData("latency;dc=dc1;host=host2", []float64{3, 1}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("percentileRankSeries(latency;dc=dc1;host=host1)", []float64{50, 100}, 1, now32).SetTag("percentileRankSeries", "1").SetNameTag("percentileRankSeries(latency;dc=dc1;host=host1)"),
+				types.MakeMetricData("percentileRankSeries(latency;dc=dc1;host=host2)", []float64{100, 50}, 1, now32).SetTag("percentileRankSeries", "1").SetNameTag("percentileRankSeries(latency;dc=dc1;host=host2)"),
+				types.MakeMetricData("percentileRankSeries(latency;dc=dc2;host=host1)", []float64{100, 100}, 1, now32).SetTag("percentileRankSeries", "1").SetNameTag("percentileRankSeries(latency;dc=dc2;host=host1)"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			eval := th.EvaluatorFromFunc(md[0].F)
+			th.TestEvalExpr(t, eval, &tt)
+		})
+	}
+}
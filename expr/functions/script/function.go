@@ -0,0 +1,426 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/lomik/zapwriter"
+	"github.com/spf13/viper"
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+var (
+	ErrScriptTimeout = merry.New("script execution timeout exceeded").WithHTTPCode(503)
+	ErrScriptFailed  = merry.New("script execution failed").WithHTTPCode(500)
+	ErrTooManyPoints = merry.New("script returned too many points").WithHTTPCode(500)
+	// ErrScriptMemoryLimit is returned, if values created by the script outgrow Limits.MaxMemory
+	ErrScriptMemoryLimit = merry.New("script memory limit exceeded").WithHTTPCode(500)
+	ErrUnsupportedType   = merry.New("unsupported parameter type")
+)
+
+// Limits restrict resources that one invocation of a script can use
+type Limits struct {
+	// Timeout for a single invocation, including conversion of the arguments
+	Timeout time.Duration
+	// CallStackSize is a maximum depth of nested Lua calls
+	CallStackSize int
+	// RegistrySize is a maximum amount of values on Lua stack
+	RegistrySize int
+	// MaxPoints is a maximum amount of points returned by one invocation
+	MaxPoints int
+	// MaxMemory is a maximum size of values, which are created by one invocation, in bytes. Arguments of the script
+	// are not counted.
+	MaxMemory int64
+}
+
+type scriptConfig struct {
+	Enabled   bool
+	Directory string
+	// Override allows scripts to replace built-in functions with the same name
+	Override bool
+	Limits   Limits
+}
+
+type script struct {
+	name   string
+	file   string
+	proto  *lua.FunctionProto
+	limits Limits
+
+	description types.FunctionDescription
+	seriesParam int
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Last
+}
+
+var defaultLimits = Limits{
+	Timeout:       5 * time.Second,
+	CallStackSize: 256,
+	RegistrySize:  1024 * 1024,
+	MaxPoints:     10 * 1000 * 1000,
+	MaxMemory:     128 * 1024 * 1024,
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	logger := zapwriter.Logger("functionInit").With(zap.String("function", "script"))
+	if configFile == "" {
+		logger.Debug("no config file specified",
+			zap.String("message", "this function requrires config file to work properly"),
+		)
+		return nil
+	}
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		logger.Fatal("failed to read config file",
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	cfg := scriptConfig{
+		Limits: defaultLimits,
+	}
+	err = v.Unmarshal(&cfg)
+	if err != nil {
+		logger.Fatal("failed to parse config",
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	if !cfg.Enabled {
+		logger.Warn("script config found but scripted functions are disabled")
+		return nil
+	}
+
+	scripts, errs := Load(cfg.Directory, cfg.Limits)
+	for _, err := range errs {
+		logger.Error("failed to load script, it will be ignored",
+			zap.Error(err),
+		)
+	}
+
+	res := make([]interfaces.FunctionMetadata, 0, len(scripts))
+	names := make([]string, 0, len(scripts))
+	metadata.FunctionMD.RLock()
+	for _, s := range scripts {
+		if _, ok := metadata.FunctionMD.Functions[s.name]; ok && !cfg.Override {
+			logger.Error("script has the same name as already registered function, it will be ignored",
+				zap.String("name", s.name),
+				zap.String("file", s.file),
+			)
+			continue
+		}
+		res = append(res, interfaces.FunctionMetadata{Name: s.name, F: s, Order: interfaces.Last})
+		names = append(names, s.name)
+	}
+	metadata.FunctionMD.RUnlock()
+
+	logger.Info("scripted functions loaded",
+		zap.String("directory", cfg.Directory),
+		zap.Strings("functions", names),
+	)
+
+	return res
+}
+
+// Load compiles every *.lua file in directory and reads function descriptions from them
+func Load(directory string, limits Limits) ([]*script, []error) {
+	if limits.Timeout <= 0 {
+		limits.Timeout = defaultLimits.Timeout
+	}
+	if limits.CallStackSize <= 0 {
+		limits.CallStackSize = defaultLimits.CallStackSize
+	}
+	if limits.RegistrySize <= 0 {
+		limits.RegistrySize = defaultLimits.RegistrySize
+	}
+	if limits.MaxMemory <= 0 {
+		limits.MaxMemory = defaultLimits.MaxMemory
+	}
+	if limits.MaxPoints <= 0 {
+		limits.MaxPoints = defaultLimits.MaxPoints
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "*.lua"))
+	if err != nil {
+		return nil, []error{err}
+	}
+	sort.Strings(files)
+
+	var (
+		scripts []*script
+		errs    []error
+	)
+	names := make(map[string]string)
+	for _, file := range files {
+		s, err := loadScript(file, limits)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+			continue
+		}
+		if prev, ok := names[s.name]; ok {
+			errs = append(errs, fmt.Errorf("%s: function %s is already defined in %s", file, s.name, prev))
+			continue
+		}
+		names[s.name] = file
+		scripts = append(scripts, s)
+	}
+
+	return scripts, errs
+}
+
+func loadScript(file string, limits Limits) (*script, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	proto, err := compile(f, file)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &script{
+		name:        strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		file:        file,
+		proto:       proto,
+		limits:      limits,
+		seriesParam: -1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), limits.Timeout)
+	defer cancel()
+	L, _, err := s.newState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer L.Close()
+
+	if L.GetGlobal("process").Type() != lua.LTFunction {
+		return nil, fmt.Errorf("script must define function process(series, params)")
+	}
+
+	s.description, err = parseDescription(L.GetGlobal("description"), s.name)
+	if err != nil {
+		return nil, err
+	}
+	s.name = s.description.Name
+
+	for i, p := range s.description.Params {
+		switch p.Type {
+		case types.SeriesList, types.SeriesLists:
+			if s.seriesParam == -1 {
+				s.seriesParam = i
+			}
+		case types.Boolean, types.Float, types.Integer, types.Node, types.String, types.AggFunc, types.Tag, types.Interval, types.IntOrInterval:
+		default:
+			return nil, merry.Errorf("parameter %s: %s", p.Name, types.FunctionTypeToStr[p.Type]).WithCause(ErrUnsupportedType)
+		}
+		if p.Multiple && i != len(s.description.Params)-1 {
+			return nil, merry.Errorf("parameter %s: only the last parameter can be multiple", p.Name).WithCause(ErrUnsupportedType)
+		}
+	}
+
+	return s, nil
+}
+
+// newState creates a sandboxed interpreter with the script loaded. Memory limit of the interpreter is its context.
+func (s *script) newState(ctx context.Context) (*lua.LState, *memoryLimit, error) {
+	L := newSandbox(s.limits)
+	mem := newMemoryLimit(ctx, L, s.limits.MaxMemory)
+	limitAllocations(L, mem)
+	L.SetContext(mem)
+	L.Push(L.NewFunctionFromProto(s.proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, nil, scriptError(mem, err)
+	}
+	return L, mem, nil
+}
+
+func scriptError(ctx context.Context, err error) merry.Error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if merry.Is(ctxErr, ErrScriptMemoryLimit) {
+			return merry.Wrap(ctxErr)
+		}
+		return ErrScriptTimeout.WithCause(err)
+	}
+	return ErrScriptFailed.WithMessage(err.Error())
+}
+
+func (s *script) getParams(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, map[string]interface{}, error) {
+	var series []*types.MetricData
+	params := make(map[string]interface{}, len(s.description.Params))
+	for i, p := range s.description.Params {
+		if p.Type == types.SeriesList || p.Type == types.SeriesLists {
+			if e.ArgsLen() <= i {
+				if p.Required {
+					return nil, nil, parser.ErrMissingTimeseries
+				}
+				continue
+			}
+			var (
+				arg []*types.MetricData
+				err error
+			)
+			if p.Multiple {
+				arg, err = helper.GetSeriesArgs(ctx, eval, e.Args()[i:], from, until, values)
+			} else {
+				arg, err = helper.GetSeriesArg(ctx, eval, e.Arg(i), from, until, values)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if i == s.seriesParam {
+				series = arg
+			} else {
+				params[p.Name] = arg
+			}
+			continue
+		}
+
+		if _, ok := e.NamedArg(p.Name); !ok && e.ArgsLen() <= i {
+			if p.Required {
+				return nil, nil, parser.ErrMissingArgument
+			}
+			if p.Default == nil || p.Default.Type == types.SNone {
+				continue
+			}
+		}
+
+		v, err := getParam(e, i, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		params[p.Name] = v
+	}
+
+	return series, params, nil
+}
+
+func getParam(e parser.Expr, n int, p types.FunctionParam) (interface{}, error) {
+	switch p.Type {
+	case types.Boolean:
+		d, _ := defaultValue(p).(bool)
+		return e.GetBoolNamedOrPosArgDefault(p.Name, n, d)
+	case types.Float:
+		d, _ := toFloat(defaultValue(p))
+		return e.GetFloatNamedOrPosArgDefault(p.Name, n, d)
+	case types.Integer, types.Node:
+		d, _ := toFloat(defaultValue(p))
+		return e.GetIntNamedOrPosArgDefault(p.Name, n, int(d))
+	case types.Interval, types.IntOrInterval:
+		var d int64
+		if v, ok := defaultValue(p).(string); ok {
+			i, err := parser.IntervalString(v, 1)
+			if err != nil {
+				return nil, err
+			}
+			d = int64(i)
+		} else if v, ok := toFloat(defaultValue(p)); ok {
+			d = int64(v)
+		}
+		return e.GetIntervalNamedOrPosArgDefault(p.Name, n, 1, d)
+	default:
+		d, _ := defaultValue(p).(string)
+		v, err := e.GetStringNamedOrPosArgDefault(p.Name, n, d)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Options) > 0 {
+			for _, o := range p.Options {
+				if o.Value == v {
+					return v, nil
+				}
+			}
+			return nil, merry.WithMessagef(parser.ErrInvalidArg, "%s: unsupported value %q", p.Name, v)
+		}
+		return v, nil
+	}
+}
+
+func defaultValue(p types.FunctionParam) interface{} {
+	if p.Default == nil {
+		return nil
+	}
+	return p.Default.Value
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func (s *script) Do(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	series, params, err := s.getParams(ctx, eval, e, from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.limits.Timeout)
+	defer cancel()
+
+	L, mem, err := s.newState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer L.Close()
+
+	luaSeries := seriesToLua(L, series)
+	luaParams := L.NewTable()
+	for k, v := range params {
+		luaParams.RawSetString(k, toLua(L, v))
+	}
+	// arguments are not counted
+	mem.reset(luaSeries, luaParams)
+
+	err = L.CallByParam(lua.P{
+		Fn:      L.GetGlobal("process"),
+		NRet:    1,
+		Protect: true,
+	}, luaSeries, luaParams)
+	if err != nil {
+		return nil, scriptError(mem, err)
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	var defaultStart, defaultStep int64 = from, until - from
+	if len(series) > 0 {
+		defaultStart, defaultStep = series[0].StartTime, series[0].StepTime
+	}
+
+	return seriesFromLua(ret, defaultStart, defaultStep, s.limits.MaxPoints)
+}
+
+func (s *script) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		s.name: s.description,
+	}
+}
@@ -0,0 +1,306 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+const sumAboveScript = `
+description = {
+	description = "Sums series and drops values below threshold",
+	group = "Combine",
+	params = {
+		{ name = "seriesList", type = "seriesList", required = true },
+		{ name = "threshold", type = "float", default = 0 },
+		{ name = "name", type = "string", default = "sumAbove" },
+	},
+}
+
+function process(series, params)
+	local values = {}
+	for _, s in ipairs(series) do
+		for i, v in ipairs(s.values) do
+			if not isnan(v) then
+				values[i] = (values[i] or 0) + v
+			end
+		end
+	end
+	local n = #series[1].values
+	for i = 1, n do
+		if values[i] ~= nil and values[i] < params.threshold then
+			values[i] = nil
+		end
+	end
+	values[n] = values[n] or nan
+	return { { name = params.name, tags = { kind = "sum" }, values = values } }
+end
+`
+
+const loopScript = `
+description = {
+	params = {
+		{ name = "seriesList", type = "seriesList", required = true },
+	},
+}
+
+function process(series, params)
+	while true do end
+end
+`
+
+const pointsScript = `
+description = {
+	params = {
+		{ name = "count", type = "integer", required = true },
+	},
+}
+
+function process(series, params)
+	local values = {}
+	for i = 1, params.count do
+		values[i] = i
+	end
+	return { { name = "points", start = 0, step = 1, values = values } }
+end
+`
+
+const sandboxScript = `
+description = {
+	params = {
+		{ name = "seriesList", type = "seriesList", required = true },
+	},
+}
+
+function process(series, params)
+	return dofile("/etc/passwd")
+end
+`
+
+const memoryScript = `
+description = {
+	params = {
+		{ name = "kind", type = "string", required = true },
+		{ name = "size", type = "integer", required = true },
+	},
+}
+
+function process(series, params)
+	local n = params.size
+	if params.kind == "rep" then
+		local s = string.rep("x", n)
+	elseif params.kind == "method" then
+		local s = ("x"):rep(n)
+	elseif params.kind == "concat" then
+		local s = "x"
+		while #s < n do
+			s = s .. s
+		end
+	elseif params.kind == "table" then
+		local t = {}
+		for i = 1, n do
+			t[i] = "value" .. i
+		end
+	elseif params.kind == "gsub" then
+		local s = string.rep("x", 1000)
+		local r = string.rep("y", n / 1000)
+		s = s:gsub("x", r)
+	elseif params.kind == "gsubFunction" then
+		local s = string.rep("x", 1000)
+		local r = string.rep("y", n / 1000)
+		s = s:gsub("x", function(m) return r end)
+	elseif params.kind == "format" then
+		local s = string.format("%0" .. n .. "d", 1)
+	elseif params.kind == "pcall" then
+		pcall(string.rep, "x", n)
+		while true do end
+	end
+	return {}
+end
+`
+
+func writeScripts(t *testing.T, scripts map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range scripts {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600))
+	}
+	return dir
+}
+
+func loadTestScripts(t *testing.T, scripts map[string]string, limits Limits) map[string]interfaces.Function {
+	dir := writeScripts(t, scripts)
+	loaded, errs := Load(dir, limits)
+	require.Empty(t, errs)
+
+	res := make(map[string]interfaces.Function)
+	for _, s := range loaded {
+		res[s.name] = s
+		metadata.RegisterFunction(s.name, s)
+	}
+	return res
+}
+
+func TestScript(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+	funcs := loadTestScripts(t, map[string]string{"sumAbove.lua": sumAboveScript}, Limits{})
+
+	tests := []th.EvalTestItem{
+		{
+			"sumAbove(metric*,3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", "", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, 2, math.NaN(), 4, 5}, 1, now32),
+					types.MakeMetricData("metric2", []float64{1, 2, 3, math.NaN(), 5}, 1, now32),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("sumAbove",
+				[]float64{math.NaN(), 4, 3, 4, 10}, 1, now32).SetTag("kind", "sum")},
+		},
+		{
+			"sumAbove(metric*,name='total')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", "", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32),
+					types.MakeMetricData("metric2", []float64{1, 2, math.NaN()}, 1, now32),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("total",
+				[]float64{2, 4, 3}, 1, now32).SetTag("kind", "sum")},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			eval := th.EvaluatorFromFuncWithMetadata(funcs)
+			th.TestEvalExpr(t, eval, &tt)
+		})
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+	funcs := loadTestScripts(t, map[string]string{
+		"loop.lua":    loopScript,
+		"points.lua":  pointsScript,
+		"sandbox.lua": sandboxScript,
+	}, Limits{Timeout: 100 * time.Millisecond, MaxPoints: 10})
+
+	m := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", "", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+	}
+
+	tests := []th.EvalTestItemWithError{
+		{
+			Target: "loop(metric1)",
+			M:      m,
+			Error:  ErrScriptTimeout,
+		},
+		{
+			Target: "points(11)",
+			M:      m,
+			Error:  ErrTooManyPoints,
+		},
+		{
+			Target: "sandbox(metric1)",
+			M:      m,
+			Error:  ErrScriptFailed,
+		},
+		{
+			Target: "points()",
+			M:      m,
+			Error:  parser.ErrMissingArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			eval := th.EvaluatorFromFuncWithMetadata(funcs)
+			th.TestEvalExprWithError(t, eval, &tt)
+		})
+	}
+}
+
+func TestScriptMemory(t *testing.T) {
+	funcs := loadTestScripts(t, map[string]string{"memory.lua": memoryScript}, Limits{Timeout: 10 * time.Second, MaxMemory: 1024 * 1024})
+
+	tests := []struct {
+		kind string
+		size int
+		err  error
+	}{
+		{"rep", 1000, nil},
+		{"rep", 1 << 40, ErrScriptMemoryLimit},
+		{"method", 1 << 40, ErrScriptMemoryLimit},
+		{"concat", 1000, nil},
+		{"concat", 1 << 40, ErrScriptMemoryLimit},
+		{"table", 1000, nil},
+		{"table", 1 << 40, ErrScriptMemoryLimit},
+		{"gsub", 100000, nil},
+		{"gsub", 100000000, ErrScriptMemoryLimit},
+		{"gsubFunction", 100000, nil},
+		{"gsubFunction", 100000000, ErrScriptMemoryLimit},
+		{"format", 99, nil},
+		{"format", 999999999, ErrScriptFailed},
+		// the error can't be caught by the script
+		{"pcall", 1 << 40, ErrScriptMemoryLimit},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s(%d)", tt.kind, tt.size), func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(fmt.Sprintf("memory('%s',%d)", tt.kind, tt.size))
+			require.NoError(t, err)
+			eval := th.EvaluatorFromFuncWithMetadata(funcs)
+			_, err = eval.Eval(context.Background(), exp, 0, 1, nil)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.True(t, merry.Is(err, tt.err), "unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeScripts(t, map[string]string{
+		"sumAbove.lua":      sumAboveScript,
+		"noProcess.lua":     `description = { params = {} }`,
+		"noDescription.lua": `function process(series, params) return series end`,
+		"badType.lua": `
+description = { params = { { name = "d", type = "date" } } }
+function process(series, params) return series end
+`,
+		"syntax.lua": `function process(`,
+		"notLua.txt": `not a script`,
+	})
+
+	scripts, errs := Load(dir, Limits{})
+	assert.Len(t, errs, 4)
+	require.Len(t, scripts, 1)
+
+	desc := scripts[0].Description()["sumAbove"]
+	assert.Equal(t, "sumAbove", desc.Name)
+	assert.Equal(t, "sumAbove(seriesList, threshold, name)", desc.Function)
+	assert.Equal(t, "Combine", desc.Group)
+	require.Len(t, desc.Params, 3)
+	assert.Equal(t, types.SeriesList, desc.Params[0].Type)
+	assert.True(t, desc.Params[0].Required)
+	assert.Equal(t, types.Float, desc.Params[1].Type)
+	assert.Equal(t, types.String, desc.Params[2].Type)
+	require.NotNil(t, desc.Params[2].Default)
+	assert.Equal(t, "sumAbove", desc.Params[2].Default.Value)
+}
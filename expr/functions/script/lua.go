@@ -0,0 +1,267 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+)
+
+// unsafeBaseFunctions are removed from the sandbox, scripts can't load other code or touch the filesystem
+var unsafeBaseFunctions = []string{
+	"collectgarbage",
+	"dofile",
+	"getfenv",
+	"load",
+	"loadfile",
+	"loadstring",
+	"module",
+	"print",
+	"require",
+	"setfenv",
+}
+
+func compile(r io.Reader, name string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(r, name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+// newSandbox returns interpreter with only base, table, string and math libraries available
+func newSandbox(limits Limits) *lua.LState {
+	L := lua.NewState(lua.Options{
+		CallStackSize:       limits.CallStackSize,
+		RegistrySize:        1024,
+		RegistryMaxSize:     limits.RegistrySize,
+		SkipOpenLibs:        true,
+		MinimizeStackMemory: true,
+	})
+
+	for _, lib := range []struct {
+		name string
+		f    lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.f))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	for _, name := range unsafeBaseFunctions {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("isnan", L.NewFunction(func(L *lua.LState) int {
+		v := L.CheckNumber(1)
+		L.Push(lua.LBool(math.IsNaN(float64(v))))
+		return 1
+	}))
+	L.SetGlobal("nan", lua.LNumber(math.NaN()))
+
+	return L
+}
+
+// parseDescription converts description table declared by script to the function description
+func parseDescription(v lua.LValue, name string) (types.FunctionDescription, error) {
+	desc := types.FunctionDescription{
+		Name: name,
+	}
+	if v.Type() == lua.LTNil {
+		return desc, fmt.Errorf("script must declare description table")
+	}
+	if v.Type() != lua.LTTable {
+		return desc, fmt.Errorf("description must be a table, got %s", v.Type())
+	}
+
+	data, err := json.Marshal(fromLua(v))
+	if err != nil {
+		return desc, err
+	}
+	err = json.Unmarshal(data, &desc)
+	if err != nil {
+		return desc, fmt.Errorf("invalid description: %w", err)
+	}
+
+	if desc.Name == "" {
+		desc.Name = name
+	}
+	if desc.Group == "" {
+		desc.Group = "Scripted"
+	}
+	if desc.Module == "" {
+		desc.Module = "carbonapi.script"
+	}
+	if desc.Function == "" {
+		desc.Function = desc.Name + "("
+		for i, p := range desc.Params {
+			if i > 0 {
+				desc.Function += ", "
+			}
+			desc.Function += p.Name
+		}
+		desc.Function += ")"
+	}
+	desc.Proxied = false
+
+	return desc, nil
+}
+
+// fromLua converts lua value to a Go one. Tables with only sequential integer keys are converted to slices.
+func fromLua(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		n := v.MaxN()
+		if n > 0 {
+			res := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				res = append(res, fromLua(v.RawGetInt(i)))
+			}
+			return res
+		}
+		res := make(map[string]interface{})
+		v.ForEach(func(k, val lua.LValue) {
+			res[k.String()] = fromLua(val)
+		})
+		if len(res) == 0 {
+			return nil
+		}
+		return res
+	}
+	return nil
+}
+
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case bool:
+		return lua.LBool(v)
+	case int:
+		return lua.LNumber(v)
+	case int32:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []*types.MetricData:
+		return seriesToLua(L, v)
+	}
+	return lua.LNil
+}
+
+// seriesToLua converts series to an array of tables {name, tags, start, stop, step, values}, absent values are NaN
+func seriesToLua(L *lua.LState, series []*types.MetricData) *lua.LTable {
+	res := L.CreateTable(len(series), 0)
+	for _, s := range series {
+		t := L.CreateTable(0, 6)
+		t.RawSetString("name", lua.LString(s.Name))
+		t.RawSetString("start", lua.LNumber(s.StartTime))
+		t.RawSetString("stop", lua.LNumber(s.StopTime))
+		t.RawSetString("step", lua.LNumber(s.StepTime))
+
+		tags := L.CreateTable(0, len(s.Tags))
+		for k, v := range s.Tags {
+			tags.RawSetString(k, lua.LString(v))
+		}
+		t.RawSetString("tags", tags)
+
+		values := L.CreateTable(len(s.Values), 0)
+		for _, v := range s.Values {
+			values.Append(lua.LNumber(v))
+		}
+		t.RawSetString("values", values)
+
+		res.Append(t)
+	}
+	return res
+}
+
+func getNumber(t *lua.LTable, key string, def int64) (int64, error) {
+	switch v := t.RawGetString(key).(type) {
+	case lua.LNumber:
+		return int64(v), nil
+	case *lua.LNilType:
+		return def, nil
+	default:
+		return 0, ErrScriptFailed.WithMessagef("field %s must be a number, got %s", key, v.Type())
+	}
+}
+
+// seriesFromLua converts value returned by the script back to series. Missing or nil values are NaN.
+func seriesFromLua(v lua.LValue, defaultStart, defaultStep int64, maxPoints int) ([]*types.MetricData, error) {
+	list, ok := v.(*lua.LTable)
+	if !ok {
+		return nil, ErrScriptFailed.WithMessagef("process must return a list of series, got %s", v.Type())
+	}
+
+	n := list.MaxN()
+	res := make([]*types.MetricData, 0, n)
+	points := 0
+	for i := 1; i <= n; i++ {
+		t, ok := list.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return nil, ErrScriptFailed.WithMessagef("series %d must be a table", i)
+		}
+
+		name, ok := t.RawGetString("name").(lua.LString)
+		if !ok || name == "" {
+			return nil, ErrScriptFailed.WithMessagef("series %d must have a name", i)
+		}
+		start, err := getNumber(t, "start", defaultStart)
+		if err != nil {
+			return nil, err
+		}
+		step, err := getNumber(t, "step", defaultStep)
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 {
+			return nil, ErrScriptFailed.WithMessagef("series %s: step must be positive", name)
+		}
+
+		luaValues, ok := t.RawGetString("values").(*lua.LTable)
+		if !ok {
+			return nil, ErrScriptFailed.WithMessagef("series %s: values must be a table", name)
+		}
+		count := luaValues.MaxN()
+		points += count
+		if points > maxPoints {
+			return nil, ErrTooManyPoints.WithMessagef("script returned more than %d points", maxPoints)
+		}
+		values := make([]float64, count)
+		for j := range values {
+			if num, ok := luaValues.RawGetInt(j + 1).(lua.LNumber); ok {
+				values[j] = float64(num)
+			} else {
+				values[j] = math.NaN()
+			}
+		}
+
+		r := types.MakeMetricData(string(name), values, step, start)
+		if tags, ok := t.RawGetString("tags").(*lua.LTable); ok {
+			tags.ForEach(func(k, v lua.LValue) {
+				r.Tags[k.String()] = v.String()
+			})
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
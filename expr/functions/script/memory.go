@@ -0,0 +1,355 @@
+package script
+
+import (
+	"context"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/pm"
+)
+
+// Estimated sizes of lua values in bytes, they are used to limit memory of scripts
+const (
+	valueSize    = 16
+	stringSize   = 16
+	tableSize    = 64
+	functionSize = 64
+)
+
+const (
+	// locals of the running function are checked for strings, which outgrow the limit, every checkInterval instructions
+	checkInterval = 16
+	// all values are measured at most every walkFactor instructions per value visited by the previous walk, so
+	// measurement takes a fixed share of the time
+	walkFactor      = 4
+	minWalkInterval = 1024
+)
+
+var closedChan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// memoryLimit restricts memory used by values, which are created by one invocation of a script. Interpreter calls
+// Done of its context before every instruction, so values reachable from globals and locals of the running functions
+// are measured there periodically. Library functions, which could allocate a lot at once, check the limit before the
+// allocation, see limitAllocations.
+type memoryLimit struct {
+	context.Context
+
+	L     *lua.LState
+	limit int64
+	// base is a size of values, which existed before the invocation, e.x. arguments of the script
+	base int64
+	// used is a size measured by the last walk
+	used int64
+	// allocated is a size of values created by library functions since the last walk
+	allocated int64
+
+	ticks    int
+	nextWalk int
+	err      error
+}
+
+func newMemoryLimit(ctx context.Context, L *lua.LState, limit int64) *memoryLimit {
+	m := &memoryLimit{
+		Context: ctx,
+		L:       L,
+		limit:   limit,
+	}
+	m.reset()
+	return m
+}
+
+// reset makes current values and extra ones the base, memory limit applies only to values created after that
+func (m *memoryLimit) reset(extra ...lua.LValue) {
+	visited := make(map[interface{}]struct{})
+	m.walk(visited, extra...)
+	m.base = m.used
+	m.allocated = 0
+}
+
+func (m *memoryLimit) Done() <-chan struct{} {
+	if m.err == nil {
+		m.ticks++
+		if m.ticks >= m.nextWalk {
+			m.walk(make(map[interface{}]struct{}))
+			m.exceeds(0)
+		} else if m.ticks%checkInterval == 0 {
+			m.checkLocals()
+		}
+	}
+	if m.err != nil {
+		return closedChan
+	}
+	return m.Context.Done()
+}
+
+func (m *memoryLimit) Err() error {
+	if m.err != nil {
+		return m.err
+	}
+	return m.Context.Err()
+}
+
+// exceeds returns true and stops the script if n more bytes don't fit in the limit, otherwise they are counted
+func (m *memoryLimit) exceeds(n int64) bool {
+	if m.err != nil {
+		return true
+	}
+	if n < 0 || m.used-m.base+m.allocated+n > m.limit {
+		m.err = ErrScriptMemoryLimit.WithMessagef("script used more than %d bytes of memory", m.limit)
+		return true
+	}
+	m.allocated += n
+	return false
+}
+
+// available returns amount of bytes, which could be allocated yet
+func (m *memoryLimit) available() int64 {
+	return m.limit - (m.used - m.base + m.allocated)
+}
+
+// checkLocals is a cheap check of strings in locals of the running function, e.x. the one, which is doubled in a loop
+func (m *memoryLimit) checkLocals() {
+	dbg, ok := m.L.GetStack(0)
+	if !ok {
+		return
+	}
+	var size int64
+	for i := 1; ; i++ {
+		name, v := m.L.GetLocal(dbg, i)
+		if name == "" {
+			break
+		}
+		if s, ok := v.(lua.LString); ok {
+			size += int64(len(s))
+		}
+	}
+	if size > m.available() {
+		m.exceeds(size)
+	}
+}
+
+// walk measures values reachable from globals, registry, locals of the running functions and extra ones
+func (m *memoryLimit) walk(visited map[interface{}]struct{}, extra ...lua.LValue) {
+	stack := append([]lua.LValue{m.L.G.Global, m.L.G.Registry}, extra...)
+	for level := 0; ; level++ {
+		dbg, ok := m.L.GetStack(level)
+		if !ok {
+			break
+		}
+		for i := 1; ; i++ {
+			name, v := m.L.GetLocal(dbg, i)
+			if name == "" {
+				break
+			}
+			stack = append(stack, v)
+		}
+	}
+
+	var size int64
+	values := 0
+	// scalars are counted at once, so the stack doesn't grow with size of tables
+	push := func(v lua.LValue) {
+		values++
+		switch v := v.(type) {
+		case lua.LString:
+			size += stringSize + int64(len(v))
+		case *lua.LTable, *lua.LFunction:
+			stack = append(stack, v)
+		default:
+			size += valueSize
+		}
+	}
+	roots := stack
+	stack = nil
+	for _, v := range roots {
+		push(v)
+	}
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if _, ok := visited[v]; ok {
+			continue
+		}
+		visited[v] = struct{}{}
+
+		switch v := v.(type) {
+		case *lua.LTable:
+			size += tableSize
+			v.ForEach(func(k, val lua.LValue) {
+				push(k)
+				push(val)
+			})
+			if mt := m.L.GetMetatable(v); mt != lua.LNil {
+				push(mt)
+			}
+		case *lua.LFunction:
+			size += functionSize
+			if v.Env != nil {
+				push(v.Env)
+			}
+			for _, uv := range v.Upvalues {
+				push(uv.Value())
+			}
+		}
+	}
+
+	m.used = size
+	m.allocated = 0
+	m.ticks = 0
+	m.nextWalk = walkFactor * values
+	if m.nextWalk < minWalkInterval {
+		m.nextWalk = minWalkInterval
+	}
+}
+
+// limitAllocations replaces library functions, which could allocate a lot of memory at once, by the ones, which check
+// the memory limit before the allocation
+func limitAllocations(L *lua.LState, m *memoryLimit) {
+	str := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	tbl := L.GetGlobal(lua.TabLibName).(*lua.LTable)
+
+	wrap := func(t *lua.LTable, name string, size func(L *lua.LState) int64) {
+		f := t.RawGetString(name).(*lua.LFunction)
+		t.RawSetString(name, L.NewFunction(func(L *lua.LState) int {
+			if m.exceeds(size(L)) {
+				L.RaiseError("%s: %s", name, m.err.Error())
+			}
+			return f.GFunction(L)
+		}))
+	}
+
+	wrap(str, "rep", func(L *lua.LState) int64 {
+		s, n := int64(len(L.CheckString(1))), int64(L.CheckInt(2))
+		if s == 0 || n <= 0 {
+			return 0
+		}
+		if n > m.available()/s {
+			return -1
+		}
+		return s * n
+	})
+	for _, name := range []string{"lower", "upper", "reverse"} {
+		wrap(str, name, func(L *lua.LState) int64 {
+			return int64(len(L.CheckString(1)))
+		})
+	}
+	wrap(str, "format", func(L *lua.LState) int64 {
+		format := L.CheckString(1)
+		if err := checkFormat(format); err != "" {
+			L.RaiseError("format: %s", err)
+		}
+		size := int64(len(format))
+		for i := 2; i <= L.GetTop(); i++ {
+			// width and precision are up to 99
+			size += 99
+			if s, ok := L.Get(i).(lua.LString); ok {
+				size += int64(len(s))
+			}
+		}
+		return size
+	})
+	wrap(tbl, "concat", func(L *lua.LState) int64 {
+		t := L.CheckTable(1)
+		sep := int64(len(L.OptString(2, "")))
+		i := L.OptInt(3, 1)
+		j := L.OptInt(4, t.Len())
+		var size int64
+		for ; i <= j; i++ {
+			if s, ok := t.RawGetInt(i).(lua.LString); ok {
+				size += int64(len(s))
+			} else {
+				size += valueSize
+			}
+			size += sep
+			if size > m.available() {
+				return -1
+			}
+		}
+		return size
+	})
+
+	gsub := str.RawGetString("gsub").(*lua.LFunction)
+	str.RawSetString("gsub", L.NewFunction(func(L *lua.LState) int {
+		s := L.CheckString(1)
+		pattern := L.CheckString(2)
+		limit := L.OptInt(4, -1)
+		var size int64
+		switch repl := L.CheckAny(3).(type) {
+		case lua.LString:
+			matches, err := pm.Find(pattern, []byte(s), 0, limit)
+			if err != nil {
+				L.RaiseError(err.Error())
+			}
+			// every capture in the replacement is a part of the match or its position
+			captures := int64(strings.Count(string(repl), "%"))
+			size = int64(len(s))
+			for _, md := range matches {
+				n := int64(md.Capture(1) - md.Capture(0))
+				if n < 20 {
+					n = 20
+				}
+				size += int64(len(repl)) + captures*n
+			}
+		case *lua.LTable, *lua.LFunction:
+			// size of the result is counted as replacements are returned
+			size = int64(len(s))
+			L.Replace(3, L.NewFunction(func(L *lua.LState) int {
+				var v lua.LValue
+				if t, ok := repl.(*lua.LTable); ok {
+					v = L.GetTable(t, L.Get(1))
+				} else {
+					n := L.GetTop()
+					L.Push(repl)
+					for i := 1; i <= n; i++ {
+						L.Push(L.Get(i))
+					}
+					L.Call(n, 1)
+					v = L.Get(-1)
+				}
+				if s, ok := v.(lua.LString); ok && m.exceeds(int64(len(s))) {
+					L.RaiseError("gsub: %s", m.err.Error())
+				}
+				L.Push(v)
+				return 1
+			}))
+		}
+		if m.exceeds(size) {
+			L.RaiseError("gsub: %s", m.err.Error())
+		}
+		return gsub.GFunction(L)
+	}))
+}
+
+// checkFormat returns error if width or precision of any verb of the format is longer than 2 digits, like lua does
+func checkFormat(format string) string {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0 {
+			i++
+		}
+		for _, part := range []bool{false, true} {
+			if part {
+				if i >= len(format) || format[i] != '.' {
+					break
+				}
+				i++
+			}
+			digits := 0
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				i++
+				digits++
+			}
+			if digits > 2 {
+				return "invalid format (width or precision too long)"
+			}
+		}
+	}
+	return ""
+}
@@ -157,7 +157,7 @@ func (f *smartSummarize) Description() map[string]types.FunctionDescription {
 						"1d",
 						"1y",
 					),
-					Type: types.Interval,
+					Type: types.String,
 				},
 			},
 			NameChange:   true, // name changed
@@ -0,0 +1,107 @@
+package zScoreByGroup
+
+import (
+	"context"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type zScoreByGroup struct{}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &zScoreByGroup{}
+	functions := []string{"zScoreByGroup"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// zScoreByGroup(seriesList, *nodes)
+func (f *zScoreByGroup) Do(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(ctx, eval, e.Arg(0), from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := e.GetNodeOrTagArgs(1, false)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, groups := helper.GroupByAggKey(args, nodes)
+	results := make([]*types.MetricData, 0, len(args))
+	for _, k := range keys {
+		// avoid overwriting, align copies
+		group := helper.ScaleSeries(types.CopyMetricDataSlice(groups[k]))
+
+		res := make([]*types.MetricData, len(group))
+		for n, a := range group {
+			r := a.CopyName("zScoreByGroup(" + a.Name + ")")
+			r.Values = make([]float64, len(a.Values))
+			r.Tags["zScoreByGroup"] = "1"
+			res[n] = r
+		}
+
+		points := make([]float64, len(group))
+		for i := range group[0].Values {
+			for n, a := range group {
+				points[n] = a.Values[i]
+			}
+			mean := consolidations.AvgValue(points)
+			stddev := math.Sqrt(consolidations.VarianceValue(points))
+			for n, v := range points {
+				switch {
+				case math.IsNaN(v):
+					res[n].Values[i] = math.NaN()
+				case stddev == 0:
+					// all values in the group are the same
+					res[n].Values[i] = 0
+				default:
+					res[n].Values[i] = (v - mean) / stddev
+				}
+			}
+		}
+
+		results = append(results, res...)
+	}
+
+	return results, nil
+}
+
+func (f *zScoreByGroup) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"zScoreByGroup": {
+			Description: "Takes one metric or a wildcard seriesList, followed by zero or more nodes or tags.\nSeries are grouped by the given nodes (all series are in the same group if no nodes specified)\nand each value is replaced by its z-score within the group at the same timestamp: the number of\nstandard deviations it is above or below the mean of the group.\n\nExample:\n\n.. code-block:: none\n\n  &target=zScoreByGroup(dc*.host*.cpu.usage, 0)\n\nShows how far each host is from the other hosts of the same datacenter.",
+			Function:    "zScoreByGroup(seriesList, *nodes)",
+			Group:       "Transform",
+			Module:      "graphite.render.functions.custom",
+			Name:        "zScoreByGroup",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Multiple: true,
+					Name:     "nodes",
+					Type:     types.NodeOrTag,
+				},
+			},
+			NameChange:   true, // name changed
+			TagsChange:   true, // name tag changed
+			ValuesChange: true, // values changed
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package zScoreByGroup
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+var (
+	md []interfaces.FunctionMetadata = New("")
+)
+
+func init() {
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestZScoreByGroup(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			"zScoreByGroup(dc*.host*.cpu)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"dc*.host*.cpu", "", 0, 1}: {
+					types.MakeMetricData("dc1.host1.cpu", []float64{1, 2, math.NaN(), 4}, 1, now32),
+					types.MakeMetricData("dc1.host2.cpu", []float64{3, 2, 5, 6}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("zScoreByGroup(dc1.host1.cpu)", []float64{-1, 0, math.NaN(), -1}, 1, now32).SetTag("zScoreByGroup", "1").SetNameTag("zScoreByGroup(dc1.host1.cpu)"),
+				types.MakeMetricData("zScoreByGroup(dc1.host2.cpu)", []float64{1, 0, 0, 1}, 1, now32).SetTag("zScoreByGroup", "1").SetNameTag("zScoreByGroup(dc1.host2.cpu)"),
+			},
+		},
+		{
+			"zScoreByGroup(dc*.host*.cpu, 0)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"dc*.host*.cpu", "", 0, 1}: {
+					types.MakeMetricData("dc1.host1.cpu", []float64{1, 2}, 1, now32),
+					types.MakeMetricData("dc2.host1.cpu", []float64{10, 20}, 1, now32),
+					types.MakeMetricData("dc1.host2.cpu", []float64{3, 2}, 1, now32),
+					types.MakeMetricData("dc2.host2.cpu", []float64{30, 40}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("zScoreByGroup(dc1.host1.cpu)", []float64{-1, 0}, 1, now32).SetTag("zScoreByGroup", "1").SetNameTag("zScoreByGroup(dc1.host1.cpu)"),
+				types.MakeMetricData("zScoreByGroup(dc1.host2.cpu)", []float64{1, 0}, 1, now32).SetTag("zScoreByGroup", "1").SetNameTag("zScoreByGroup(dc1.host2.cpu)"),
+				types.MakeMetricData("zScoreByGroup(dc2.host1.cpu)", []float64{-1, -1}, 1, now32).SetTag("zScoreByGroup", "1").SetNameTag("zScoreByGroup(dc2.host1.cpu)"),
+				types.MakeMetricData("zScoreByGroup(dc2.host2.cpu)", []float64{1, 1}, 1, now32).SetTag("zScoreByGroup", "1").SetNameTag("zScoreByGroup(dc2.host2.cpu)"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			eval := th.EvaluatorFromFunc(md[0].F)
+			th.TestEvalExpr(t, eval, &tt)
+		})
+	}
+}
@@ -108,6 +108,20 @@ func AggKey(arg *types.MetricData, nodesOrTags []parser.NodeOrTag) string {
 	return ""
 }
 
+// GroupByAggKey splits series to groups by AggKey. Keys are returned in order of their first appearance.
+func GroupByAggKey(args []*types.MetricData, nodesOrTags []parser.NodeOrTag) ([]string, map[string][]*types.MetricData) {
+	groups := make(map[string][]*types.MetricData)
+	keys := make([]string, 0, 4)
+	for _, a := range args {
+		key := AggKey(a, nodesOrTags)
+		if len(groups[key]) == 0 {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], a)
+	}
+	return keys, groups
+}
+
 type seriesFunc1 func(*types.MetricData) *types.MetricData
 
 // ForEachSeriesDo do action for each serie in list.
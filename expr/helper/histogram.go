@@ -0,0 +1,276 @@
+package helper
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-graphite/carbonapi/expr/tags"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// Histogram is a set of series with cumulative counters of the same histogram buckets (Prometheus-style)
+type Histogram struct {
+	// Name is a name of the series without bucket bound
+	Name string
+	// Tags of the series without bucket tag
+	Tags map[string]string
+	// Bounds are sorted upper bounds of the buckets
+	Bounds []float64
+	// Buckets are aligned series for the corresponding bounds
+	Buckets []*types.MetricData
+}
+
+// GroupHistograms splits series to histograms. Bucket bound is taken from the tag or node specified by bucket,
+// if it's nil - from the `le` tag or the last `le_*` node. Series without bucket bound are skipped.
+// Buckets of each histogram are sorted by bound and aligned, passed series are not modified.
+func GroupHistograms(args []*types.MetricData, bucket *parser.NodeOrTag) []*Histogram {
+	var histograms []*Histogram
+	index := make(map[string]*Histogram)
+
+	for _, a := range args {
+		bound, name, tagName, ok := bucketBound(a, bucket)
+		if !ok {
+			continue
+		}
+		h, exist := index[name]
+		if !exist {
+			h = &Histogram{Name: name, Tags: make(map[string]string, len(a.Tags))}
+			for k, v := range a.Tags {
+				if k != tagName {
+					h.Tags[k] = v
+				}
+			}
+			if tagName == "" {
+				// bound was in the node, so name tag is changed
+				h.Tags["name"] = types.ExtractNameTag(name)
+			}
+			index[name] = h
+			histograms = append(histograms, h)
+		}
+		h.Bounds = append(h.Bounds, bound)
+		h.Buckets = append(h.Buckets, a)
+	}
+
+	for _, h := range histograms {
+		sort.Stable(h)
+		// remove duplicated bounds
+		n := 0
+		for i := range h.Bounds {
+			if i > 0 && h.Bounds[i] == h.Bounds[n-1] {
+				continue
+			}
+			h.Bounds[n], h.Buckets[n] = h.Bounds[i], h.Buckets[i]
+			n++
+		}
+		h.Bounds, h.Buckets = h.Bounds[:n], h.Buckets[:n]
+		// avoid overwriting, align copies
+		h.Buckets = ScaleSeries(types.CopyMetricDataSlice(h.Buckets))
+	}
+
+	return histograms
+}
+
+// bucketBound returns bucket bound of the series, name of the series without it and the tag with bound (if bound is taken from tag)
+func bucketBound(a *types.MetricData, bucket *parser.NodeOrTag) (float64, string, string, bool) {
+	if bucket == nil {
+		if v, ok := a.Tags[tags.BucketTag]; ok {
+			return tagBucketBound(a, tags.BucketTag, v)
+		}
+		nameTag := types.ExtractNameTag(a.Name)
+		if node, ok := tags.BucketNode(nameTag); ok {
+			return nodeBucketBound(a, nameTag, node)
+		}
+		return 0, "", "", false
+	}
+
+	if bucket.IsTag {
+		tag := bucket.Value.(string)
+		v, ok := a.Tags[tag]
+		if !ok {
+			return 0, "", "", false
+		}
+		return tagBucketBound(a, tag, v)
+	}
+
+	nameTag := types.ExtractNameTag(a.Name)
+	node := bucket.Value.(int)
+	if node < 0 {
+		node += strings.Count(nameTag, ".") + 1
+	}
+	return nodeBucketBound(a, nameTag, node)
+}
+
+func tagBucketBound(a *types.MetricData, tag, value string) (float64, string, string, bool) {
+	bound, ok := tags.ParseBucketBound(value)
+	if !ok {
+		return 0, "", "", false
+	}
+	return bound, strings.Replace(a.Name, ";"+tag+"="+value, "", 1), tag, true
+}
+
+func nodeBucketBound(a *types.MetricData, nameTag string, node int) (float64, string, string, bool) {
+	nodes := strings.Split(nameTag, ".")
+	if node < 0 || node >= len(nodes) {
+		return 0, "", "", false
+	}
+	bound, ok := tags.ParseBucketBound(nodes[node])
+	if !ok {
+		return 0, "", "", false
+	}
+	nodes = append(nodes[:node], nodes[node+1:]...)
+	return bound, strings.Replace(a.Name, nameTag, strings.Join(nodes, "."), 1), "", true
+}
+
+func (h *Histogram) Len() int           { return len(h.Bounds) }
+func (h *Histogram) Less(i, j int) bool { return h.Bounds[i] < h.Bounds[j] }
+func (h *Histogram) Swap(i, j int) {
+	h.Bounds[i], h.Bounds[j] = h.Bounds[j], h.Bounds[i]
+	h.Buckets[i], h.Buckets[j] = h.Buckets[j], h.Buckets[i]
+}
+
+// counts returns cumulative bucket counters at point i, fixed to be monotonic. Returns nil if some of them are absent.
+func (h *Histogram) counts(i int) []float64 {
+	counts := make([]float64, len(h.Buckets))
+	for n, b := range h.Buckets {
+		v := b.Values[i]
+		if math.IsNaN(v) {
+			return nil
+		}
+		// counters are scraped at different time, so they can be slightly inconsistent
+		if n > 0 && v < counts[n-1] {
+			v = counts[n-1]
+		}
+		counts[n] = v
+	}
+	return counts
+}
+
+// Quantile estimates q-quantile at point i with linear interpolation inside the bucket, like Prometheus histogram_quantile does.
+// The last bucket must be +Inf, quantiles within it are reported as upper bound of the previous bucket.
+func (h *Histogram) Quantile(q float64, i int) float64 {
+	switch {
+	case math.IsNaN(q):
+		return math.NaN()
+	case q < 0:
+		return math.Inf(-1)
+	case q > 1:
+		return math.Inf(1)
+	}
+
+	n := len(h.Bounds)
+	if n < 2 || !math.IsInf(h.Bounds[n-1], 1) {
+		return math.NaN()
+	}
+	counts := h.counts(i)
+	if counts == nil || counts[n-1] == 0 {
+		return math.NaN()
+	}
+
+	rank := q * counts[n-1]
+	b := sort.SearchFloat64s(counts[:n-1], rank)
+	if b == n-1 {
+		return h.Bounds[n-2]
+	}
+	if b == 0 && h.Bounds[0] <= 0 {
+		return h.Bounds[0]
+	}
+
+	start, end, count := 0.0, h.Bounds[b], counts[b]
+	if b > 0 {
+		start = h.Bounds[b-1]
+		count -= counts[b-1]
+		rank -= counts[b-1]
+	}
+	if count == 0 {
+		return start
+	}
+	return start + (end-start)*(rank/count)
+}
+
+// Count returns amount of observations at point i (value of the last bucket)
+func (h *Histogram) Count(i int) float64 {
+	counts := h.counts(i)
+	if counts == nil {
+		return math.NaN()
+	}
+	return counts[len(counts)-1]
+}
+
+// Mean estimates mean of observations at point i, assuming they are placed in the middle of their buckets.
+// Observations of the +Inf bucket are counted as equal to upper bound of the previous one.
+func (h *Histogram) Mean(i int) float64 {
+	counts := h.counts(i)
+	if counts == nil || counts[len(counts)-1] == 0 {
+		return math.NaN()
+	}
+
+	var sum, prev float64
+	for n, c := range counts {
+		var v float64
+		switch {
+		case n == 0 && h.Bounds[0] <= 0:
+			v = h.Bounds[0]
+		case n == 0:
+			v = h.Bounds[0] / 2
+		case math.IsInf(h.Bounds[n], 1):
+			v = h.Bounds[n-1]
+		default:
+			v = (h.Bounds[n-1] + h.Bounds[n]) / 2
+		}
+		sum += v * (c - prev)
+		prev = c
+	}
+	return sum / counts[len(counts)-1]
+}
+
+// FormatBucketBound formats bucket bound like Prometheus does
+func FormatBucketBound(bound float64) string {
+	if math.IsInf(bound, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+// Heatmap converts histograms in series list to the per-bucket (non-cumulative) counters, named by bucket upper bound,
+// as expected by heatmaps with time series buckets (e.x. Grafana). Other series are returned unchanged.
+func Heatmap(args []*types.MetricData) []*types.MetricData {
+	histograms := GroupHistograms(args, nil)
+	if len(histograms) == 0 {
+		return args
+	}
+
+	results := make([]*types.MetricData, 0, len(args))
+	for _, a := range args {
+		if _, _, _, ok := bucketBound(a, nil); !ok {
+			results = append(results, a)
+		}
+	}
+
+	for _, h := range histograms {
+		for n, b := range h.Buckets {
+			name := FormatBucketBound(h.Bounds[n])
+			bucketTags := make(map[string]string, len(h.Tags)+1)
+			for k, v := range h.Tags {
+				bucketTags[k] = v
+			}
+			bucketTags["name"] = h.Name
+			bucketTags[tags.BucketTag] = name
+			r := b.CopyTag(name, bucketTags)
+			r.Values = make([]float64, len(b.Values))
+			for i, v := range b.Values {
+				if n == 0 || math.IsNaN(v) {
+					r.Values[i] = v
+					continue
+				}
+				// counters are scraped at different time, so they can be slightly inconsistent
+				r.Values[i] = math.Max(v-h.Buckets[n-1].Values[i], 0)
+			}
+			results = append(results, r)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,103 @@
+package helper
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	args := []*types.MetricData{
+		types.MakeMetricData("latency;le=+Inf", []float64{100, 0, math.NaN()}, 1, 1),
+		types.MakeMetricData("latency;le=0.1", []float64{10, 0, 1}, 1, 1),
+		types.MakeMetricData("latency;le=1", []float64{90, 0, 1}, 1, 1),
+		types.MakeMetricData("latency;le=0.5", []float64{50, 0, 1}, 1, 1),
+	}
+	histograms := GroupHistograms(args, nil)
+	if !assert.Len(t, histograms, 1) {
+		return
+	}
+	h := histograms[0]
+	assert.Equal(t, "latency", h.Name)
+	assert.Equal(t, []float64{0.1, 0.5, 1, math.Inf(1)}, h.Bounds)
+	assert.Equal(t, map[string]string{"name": "latency"}, h.Tags)
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{q: 0.05, want: 0.05},
+		{q: 0.5, want: 0.5},
+		{q: 0.7, want: 0.75},
+		{q: 0.99, want: 1},
+		{q: -1, want: math.Inf(-1)},
+		{q: 2, want: math.Inf(1)},
+	}
+	for _, tt := range tests {
+		assert.InDelta(t, tt.want, h.Quantile(tt.q, 0), 1e-9, "q=%v", tt.q)
+	}
+	// no observations
+	assert.True(t, math.IsNaN(h.Quantile(0.5, 1)))
+	// absent bucket
+	assert.True(t, math.IsNaN(h.Quantile(0.5, 2)))
+
+	assert.InDelta(t, 0.525, h.Mean(0), 1e-9)
+	assert.Equal(t, 100.0, h.Count(0))
+	assert.True(t, math.IsNaN(h.Count(2)))
+}
+
+func TestGroupHistograms(t *testing.T) {
+	args := []*types.MetricData{
+		types.MakeMetricData("app1.latency.le_0_5", []float64{1}, 1, 1),
+		types.MakeMetricData("app1.latency.le_inf", []float64{2}, 1, 1),
+		types.MakeMetricData("app2.latency.le_inf", []float64{3}, 1, 1),
+		types.MakeMetricData("app1.requests", []float64{4}, 1, 1),
+	}
+
+	histograms := GroupHistograms(args, nil)
+	if !assert.Len(t, histograms, 2) {
+		return
+	}
+	assert.Equal(t, "app1.latency", histograms[0].Name)
+	assert.Equal(t, "app1.latency", histograms[0].Tags["name"])
+	assert.Equal(t, []float64{0.5, math.Inf(1)}, histograms[0].Bounds)
+	assert.Equal(t, "app2.latency", histograms[1].Name)
+
+	histograms = GroupHistograms(args, &parser.NodeOrTag{Value: 0})
+	assert.Len(t, histograms, 0)
+}
+
+func TestHeatmap(t *testing.T) {
+	args := []*types.MetricData{
+		types.MakeMetricData("latency;host=a;le=+Inf", []float64{100, math.NaN()}, 1, 1),
+		types.MakeMetricData("latency;host=a;le=0.1", []float64{10, 1}, 1, 1),
+		types.MakeMetricData("requests;host=a", []float64{5, 6}, 1, 1),
+		types.MakeMetricData("latency;host=a;le=0.5", []float64{50, 2}, 1, 1),
+	}
+
+	results := Heatmap(args)
+	if !assert.Len(t, results, 4) {
+		return
+	}
+	assert.Equal(t, "requests;host=a", results[0].Name)
+
+	wantNames := []string{"0.1", "0.5", "+Inf"}
+	wantValues := [][]float64{{10, 1}, {40, 1}, {50, math.NaN()}}
+	for i, r := range results[1:] {
+		assert.Equal(t, wantNames[i], r.Name)
+		assert.Equal(t, map[string]string{"name": "latency;host=a", "host": "a", "le": wantNames[i]}, r.Tags)
+		for j, v := range wantValues[i] {
+			if math.IsNaN(v) {
+				assert.True(t, math.IsNaN(r.Values[j]))
+			} else {
+				assert.Equal(t, v, r.Values[j])
+			}
+		}
+	}
+	// source series are not modified
+	assert.Equal(t, []float64{50, 2}, args[3].Values)
+}
@@ -0,0 +1,381 @@
+package helper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// ValidateExpr checks arguments of all function calls of the expression, which is parsed from target, against declared
+// parameters of the functions, see ValidateArgs. Positions in the errors are offsets from the start of the target. Calls,
+// which can't be found in the target as is, e.x. the ones rewritten by pipes or defines, are reported without position.
+func ValidateExpr(e parser.Expr, target string) error {
+	return validateExpr(e, target, 0)
+}
+
+// validateExpr validates call e and its nested calls, src is the source of e, which starts at offset of the target.
+// Negative offset means that the source is unknown.
+func validateExpr(e parser.Expr, src string, offset int) error {
+	if !e.IsFunc() {
+		return nil
+	}
+
+	metadata.FunctionMD.RLock()
+	desc := metadata.FunctionMD.Descriptions[e.Target()]
+	metadata.FunctionMD.RUnlock()
+
+	rawArgs, rawOffset, call := e.RawArgs(), -1, e.ToString()
+	var positions []int
+	if offset >= 0 {
+		trimmed := strings.TrimLeft(src, " ")
+		offset += len(src) - len(trimmed)
+		if strings.HasPrefix(trimmed, e.Target()+"(") {
+			args := trimmed[len(e.Target())+1:]
+			p, end := scanArgs(args)
+			if end < len(args) && len(p) == e.ArgsLen()+len(e.NamedArgs()) {
+				rawArgs, rawOffset, call = args[:end], offset+len(e.Target())+1, trimmed[:len(e.Target())+end+2]
+				positions = p
+			}
+		}
+	}
+
+	if err := validateCall(e, desc, call, rawArgs, rawOffset); err != nil {
+		return err
+	}
+
+	for i, arg := range e.Args() {
+		if !arg.IsFunc() {
+			continue
+		}
+		var err error
+		if rawOffset < 0 {
+			err = validateExpr(arg, "", -1)
+		} else {
+			err = validateExpr(arg, rawArgs[positions[i]:], rawOffset+positions[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateArgs checks arguments of the function call against its declared parameters: amount of positional
+// arguments, presence of required ones, types, lists of allowed options and names of named arguments.
+// Returned error is one of parser errors with HTTP code 400 and a message that points to the argument, positions are
+// offsets from the start of the call. Optional parameter with default value can be omitted before the next parameter,
+// if the argument is one of the options of the next parameter, e.x. highest(seriesList, 'max').
+// Calls of proxied functions, functions without declared parameters or with SkipArgsValidation are not checked.
+func ValidateArgs(e parser.Expr, desc types.FunctionDescription) error {
+	return validateCall(e, desc, e.ToString(), e.RawArgs(), len(e.Target())+1)
+}
+
+// validateCall validates arguments of call e, rawArgs is the source of the arguments, which starts at offset of the
+// target. Negative offset means that positions of the arguments are unknown.
+func validateCall(e parser.Expr, desc types.FunctionDescription, call, rawArgs string, offset int) error {
+	params := desc.Params
+	if !e.IsFunc() || len(params) == 0 || desc.Proxied || desc.SkipArgsValidation {
+		return nil
+	}
+
+	var positions []int
+	if offset >= 0 {
+		positions = argPositions(rawArgs)
+	}
+
+	argError := func(err error, n int, p *types.FunctionParam, format string, a ...interface{}) error {
+		name := ""
+		if p != nil {
+			name = " (" + p.Name + ")"
+		}
+		if offset < 0 {
+			return merry.WithHTTPCode(
+				merry.WithMessagef(err, "%s: argument %d%s: %s", call, n+1, name, fmt.Sprintf(format, a...)),
+				400,
+			)
+		}
+		pos := offset
+		if n < len(positions) {
+			pos += positions[n]
+		} else {
+			pos += len(rawArgs)
+		}
+		return merry.WithHTTPCode(
+			merry.WithMessagef(err, "%s: argument %d%s at position %d: %s", call, n+1, name, pos, fmt.Sprintf(format, a...)),
+			400,
+		)
+	}
+
+	// namedArgPositions maps named arguments to their position in the list of all arguments
+	names := make([]string, 0, len(e.NamedArgs()))
+	for name := range e.NamedArgs() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	namedArgPositions := make(map[string]int)
+	for i, name := range names {
+		namedArgPositions[name] = e.ArgsLen() + i
+	}
+	for i, pos := range positions {
+		if name, ok := namedArgAt(rawArgs[pos:]); ok {
+			if _, ok := e.NamedArg(name); ok {
+				namedArgPositions[name] = i
+			}
+		}
+	}
+
+	args := e.Args()
+	// n is the index of the next positional argument
+	n := 0
+	seen := make(map[string]bool, len(params))
+	for i := range params {
+		p := &params[i]
+		seen[p.Name] = true
+
+		named, isNamed := e.NamedArg(p.Name)
+		if isNamed && n < len(args) {
+			return argError(parser.ErrInvalidArg, namedArgPositions[p.Name], p, "value is already passed as positional argument %d", n+1)
+		}
+
+		switch {
+		case isNamed:
+			if err := validateArg(named, p); err != nil {
+				return argError(err, namedArgPositions[p.Name], p, "%s", err)
+			}
+		case n < len(args):
+			if i+1 < len(params) && isOmitted(args[n], p, &params[i+1]) {
+				continue
+			}
+			until := n + 1
+			if p.Multiple {
+				until = len(args)
+			}
+			for ; n < until; n++ {
+				if err := validateArg(args[n], p); err != nil {
+					return argError(err, n, p, "%s", err)
+				}
+			}
+		case p.Required:
+			err := parser.ErrMissingArgument
+			if p.Type == types.SeriesList || p.Type == types.SeriesLists {
+				err = parser.ErrMissingTimeseries
+			}
+			return argError(err, e.ArgsLen()+len(e.NamedArgs()), p, "required argument is missing")
+		}
+	}
+
+	if n < len(args) {
+		return argError(parser.ErrInvalidArg, n, nil, "too many arguments, %s accepts at most %d", e.Target(), len(params))
+	}
+
+	for _, name := range names {
+		if !seen[name] {
+			return argError(parser.ErrInvalidArg, namedArgPositions[name], nil, "unknown named argument %q", name)
+		}
+	}
+
+	return nil
+}
+
+// isOmitted checks if optional parameter p is omitted, so positional argument arg is the value of the next parameter
+func isOmitted(arg parser.Expr, p, next *types.FunctionParam) bool {
+	if p.Required || p.Multiple || p.Default == nil || !arg.IsString() || len(next.Options) == 0 || validateArg(arg, p) == nil {
+		return false
+	}
+	for _, o := range next.Options {
+		if fmt.Sprint(o.Value) == arg.StringValue() {
+			return true
+		}
+	}
+	return false
+}
+
+// validateArg checks if argument can be used as a value of parameter p.
+// Accepted values follow the rules of parser.Expr getters for the corresponding types.
+func validateArg(arg parser.Expr, p *types.FunctionParam) error {
+	var ok bool
+	switch p.Type {
+	case types.SeriesList, types.SeriesLists:
+		ok = arg.IsName() || arg.IsFunc()
+	case types.AggOrSeriesFunc:
+		ok = arg.IsName() || arg.IsFunc() || arg.IsString()
+	case types.Boolean:
+		ok = (arg.IsBool() || arg.IsString() || arg.IsConst()) && isBool(arg.StringValue())
+	case types.Float:
+		ok = arg.IsConst() || isInf(arg) || arg.IsString() && isFloat(arg.StringValue())
+	case types.SeriesListOrFloat:
+		ok = arg.IsName() || arg.IsFunc() || arg.IsConst() || arg.IsString() && isFloat(arg.StringValue())
+	case types.Integer, types.Node:
+		ok = arg.IsConst() || arg.IsString() && isInt(arg.StringValue())
+	case types.IntOrInf:
+		ok = arg.IsConst() || isInf(arg) || arg.IsString() && isInt(arg.StringValue())
+	case types.Interval:
+		ok = arg.IsString() && isInterval(arg.StringValue())
+	case types.IntOrInterval:
+		ok = arg.IsConst() || arg.IsString() && (isInt(arg.StringValue()) || isInterval(arg.StringValue()))
+	case types.NodeOrTag:
+		ok = arg.IsConst() || arg.IsString()
+	case types.String, types.Tag, types.AggFunc:
+		ok = arg.IsString()
+	default:
+		return nil
+	}
+
+	if !ok {
+		return merry.WithMessagef(parser.ErrBadType, "expected %s, got %s", types.FunctionTypeToStr[p.Type], describeArg(arg))
+	}
+
+	if len(p.Options) > 0 && arg.IsString() {
+		v := arg.StringValue()
+		for _, o := range p.Options {
+			if fmt.Sprint(o.Value) == v {
+				return nil
+			}
+		}
+		// percentiles (p50, p99.9, ...) are valid aggregation functions, but can't be listed in options
+		if (p.Type == types.AggFunc || p.Type == types.AggOrSeriesFunc) && consolidations.CheckValidConsolidationFunc(v) == nil {
+			return nil
+		}
+		if p.Type == types.AggOrSeriesFunc && isFunction(v) {
+			return nil
+		}
+		return merry.WithMessagef(parser.ErrInvalidArg, "unsupported value %q, expected one of %s", v, optionsString(p.Options))
+	}
+
+	return nil
+}
+
+// argPositions returns offsets of top-level arguments in raw argument string
+func argPositions(rawArgs string) []int {
+	positions, _ := scanArgs(rawArgs)
+	return positions
+}
+
+// scanArgs returns offsets of top-level arguments in s and offset of the parenthesis, which closes the argument list,
+// or length of s, if there is no such parenthesis
+func scanArgs(s string) ([]int, int) {
+	var (
+		positions = []int{0}
+		depth     int
+		quote     byte
+		end       = len(s)
+	)
+loop:
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '{' || c == '[':
+			depth++
+		case c == ')' && depth == 0:
+			end = i
+			break loop
+		case c == ')' || c == '}' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			positions = append(positions, i+1)
+		}
+	}
+
+	if strings.TrimSpace(s[:end]) == "" {
+		return nil, end
+	}
+	for i, pos := range positions {
+		for pos < end && s[pos] == ' ' {
+			pos++
+		}
+		positions[i] = pos
+	}
+
+	return positions, end
+}
+
+// namedArgAt returns name of named argument if s starts with one
+func namedArgAt(s string) (string, bool) {
+	i := 0
+	for i < len(s) && (s[i] == '_' || s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z' || i > 0 && s[i] >= '0' && s[i] <= '9') {
+		i++
+	}
+	if i == 0 {
+		return "", false
+	}
+	rest := strings.TrimLeft(s[i:], " ")
+	if !strings.HasPrefix(rest, "=") {
+		return "", false
+	}
+	return s[:i], true
+}
+
+func describeArg(arg parser.Expr) string {
+	switch arg.Type() {
+	case parser.EtName:
+		return fmt.Sprintf("series %q", arg.Target())
+	case parser.EtFunc:
+		return fmt.Sprintf("function %s", arg.Target())
+	case parser.EtConst:
+		return fmt.Sprintf("number %v", arg.FloatValue())
+	case parser.EtString:
+		return fmt.Sprintf("string %q", arg.StringValue())
+	case parser.EtBool:
+		return fmt.Sprintf("boolean %v", arg.StringValue())
+	}
+	return arg.ToString()
+}
+
+func optionsString(options []types.Suggestion) string {
+	values := make([]string, 0, len(options))
+	for _, o := range options {
+		values = append(values, fmt.Sprint(o.Value))
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+func isFunction(name string) bool {
+	metadata.FunctionMD.RLock()
+	_, ok := metadata.FunctionMD.Functions[name]
+	metadata.FunctionMD.RUnlock()
+	return ok
+}
+
+func isBool(s string) bool {
+	switch s {
+	case "False", "false", "0", "True", "true", "1":
+		return true
+	}
+	return false
+}
+
+func isInf(arg parser.Expr) bool {
+	return (arg.IsName() && strings.ToLower(arg.Target()) == "inf") || (arg.IsString() && strings.ToLower(arg.StringValue()) == "inf")
+}
+
+func isFloat(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func isInt(s string) bool {
+	_, err := strconv.ParseInt(s, 0, 32)
+	return err == nil
+}
+
+func isInterval(s string) bool {
+	_, err := parser.IntervalString(s, 1)
+	return err == nil
+}
@@ -0,0 +1,303 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+func TestValidateArgs(t *testing.T) {
+	desc := types.FunctionDescription{
+		Name: "testFunc",
+		Params: []types.FunctionParam{
+			{
+				Name:     "seriesList",
+				Type:     types.SeriesList,
+				Required: true,
+			},
+			{
+				Name:     "n",
+				Type:     types.Integer,
+				Required: true,
+			},
+			{
+				Name:    "func",
+				Type:    types.AggFunc,
+				Options: types.StringsToSuggestionList(consolidations.AvailableSummarizers),
+			},
+			{
+				Name: "interval",
+				Type: types.Interval,
+			},
+			{
+				Name: "flag",
+				Type: types.Boolean,
+			},
+			{
+				Multiple: true,
+				Name:     "nodes",
+				Type:     types.NodeOrTag,
+			},
+		},
+	}
+
+	tests := []struct {
+		target  string
+		err     error
+		message string
+	}{
+		{target: "testFunc(a.b,1)"},
+		{target: "testFunc(a.b,'1','p99.9','1min',true,1,'tag',3)"},
+		{target: "testFunc(sumSeries(a.*),n=3,flag=False)"},
+		{target: "testFunc(a.b,n=3,func='max',interval='-1h')"},
+		{
+			target:  "testFunc()",
+			err:     parser.ErrMissingTimeseries,
+			message: "testFunc(): argument 1 (seriesList) at position 9: required argument is missing",
+		},
+		{
+			target:  "testFunc(a.b)",
+			err:     parser.ErrMissingArgument,
+			message: "testFunc(a.b): argument 2 (n) at position 12: required argument is missing",
+		},
+		{
+			target:  "testFunc(1,2)",
+			err:     parser.ErrBadType,
+			message: "testFunc(1,2): argument 1 (seriesList) at position 9: expected seriesList, got number 1",
+		},
+		{
+			target:  "testFunc(a.b, 'x')",
+			err:     parser.ErrBadType,
+			message: `testFunc(a.b, 'x'): argument 2 (n) at position 14: expected integer, got string "x"`,
+		},
+		{
+			target:  "testFunc(a.b,1,'foo')",
+			err:     parser.ErrInvalidArg,
+			message: `testFunc(a.b,1,'foo'): argument 3 (func) at position 15: unsupported value "foo", expected one of [` + strings.Join(consolidations.AvailableSummarizers, ", ") + "]",
+		},
+		{
+			target:  "testFunc(a.b,1,interval='1x')",
+			err:     parser.ErrBadType,
+			message: `testFunc(a.b,1,interval='1x'): argument 3 (interval) at position 15: expected interval, got string "1x"`,
+		},
+		{
+			target:  "testFunc(a.b,1,flag='maybe')",
+			err:     parser.ErrBadType,
+			message: `testFunc(a.b,1,flag='maybe'): argument 3 (flag) at position 15: expected boolean, got string "maybe"`,
+		},
+		{
+			target:  "testFunc(a.b,1,unknown=1)",
+			err:     parser.ErrInvalidArg,
+			message: `testFunc(a.b,1,unknown=1): argument 3 at position 15: unknown named argument "unknown"`,
+		},
+		{
+			target:  "testFunc(a.b,1,'sum',n=2)",
+			err:     parser.ErrInvalidArg,
+			message: "testFunc(a.b,1,'sum',n=2): argument 4 (n) at position 21: value is already passed as positional argument 2",
+		},
+		{
+			target:  "testFunc(a.b,1,'sum','1h',true,1,sumSeries(a.b))",
+			err:     parser.ErrBadType,
+			message: "testFunc(a.b,1,'sum','1h',true,1,sumSeries(a.b)): argument 7 (nodes) at position 33: expected nodeOrTag, got function sumSeries",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			e, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+			err = ValidateArgs(e, desc)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !merry.Is(err, tt.err) {
+				t.Fatalf("unexpected error: got %v, want %v", err, tt.err)
+			}
+			if merry.HTTPCode(err) != 400 {
+				t.Errorf("unexpected HTTP code: %d", merry.HTTPCode(err))
+			}
+			if msg := merry.Message(err); msg != tt.message {
+				t.Errorf("unexpected message:\ngot  %s\nwant %s", msg, tt.message)
+			}
+		})
+	}
+}
+
+func TestValidateArgsTooMany(t *testing.T) {
+	desc := types.FunctionDescription{
+		Name: "testFunc",
+		Params: []types.FunctionParam{
+			{
+				Name:     "seriesList",
+				Type:     types.SeriesList,
+				Required: true,
+			},
+		},
+	}
+
+	e, _, err := parser.ParseExpr("testFunc(a.b,c.d)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ValidateArgs(e, desc)
+	if !merry.Is(err, parser.ErrInvalidArg) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "testFunc(a.b,c.d): argument 2 at position 13: too many arguments, testFunc accepts at most 1"
+	if msg := merry.Message(err); msg != want {
+		t.Errorf("unexpected message:\ngot  %s\nwant %s", msg, want)
+	}
+
+	desc.SkipArgsValidation = true
+	if err := ValidateArgs(e, desc); err != nil {
+		t.Errorf("unexpected error with validation disabled: %v", err)
+	}
+}
+
+func TestValidateArgsOmitted(t *testing.T) {
+	desc := types.FunctionDescription{
+		Name: "testFunc",
+		Params: []types.FunctionParam{
+			{
+				Name:     "seriesList",
+				Type:     types.SeriesList,
+				Required: true,
+			},
+			{
+				Name:    "n",
+				Type:    types.Integer,
+				Default: types.NewSuggestion(1),
+			},
+			{
+				Name:    "func",
+				Type:    types.String,
+				Options: types.StringsToSuggestionList([]string{"average", "max"}),
+			},
+		},
+	}
+
+	tests := []struct {
+		target  string
+		message string
+	}{
+		{target: "testFunc(a.b,'max')"},
+		{target: "testFunc(a.b,2,'max')"},
+		{
+			target:  "testFunc(a.b,'foo')",
+			message: `testFunc(a.b,'foo'): argument 2 (n) at position 13: expected integer, got string "foo"`,
+		},
+		{
+			target:  "testFunc(a.b,'max','max')",
+			message: "testFunc(a.b,'max','max'): argument 3 at position 19: too many arguments, testFunc accepts at most 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			e, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+			err = ValidateArgs(e, desc)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if msg := merry.Message(err); msg != tt.message {
+				t.Errorf("unexpected message:\ngot  %s\nwant %s", msg, tt.message)
+			}
+		})
+	}
+}
+
+func TestValidateExpr(t *testing.T) {
+	metadata.FunctionMD.Lock()
+	metadata.FunctionMD.Descriptions["testFunc"] = types.FunctionDescription{
+		Name: "testFunc",
+		Params: []types.FunctionParam{
+			{
+				Name:     "seriesList",
+				Type:     types.SeriesList,
+				Required: true,
+			},
+			{
+				Name:     "n",
+				Type:     types.Integer,
+				Required: true,
+			},
+		},
+	}
+	metadata.FunctionMD.Unlock()
+	defer func() {
+		metadata.FunctionMD.Lock()
+		delete(metadata.FunctionMD.Descriptions, "testFunc")
+		metadata.FunctionMD.Unlock()
+	}()
+
+	tests := []struct {
+		target  string
+		message string
+	}{
+		{target: "sumSeries(testFunc(a.b,1),testFunc(c.d, 2))"},
+		{
+			target:  "sumSeries(testFunc(a.b, 'x'))",
+			message: `testFunc(a.b, 'x'): argument 2 (n) at position 24: expected integer, got string "x"`,
+		},
+		{
+			target:  "sumSeries(a.b, testFunc(c.d))",
+			message: "testFunc(c.d): argument 2 (n) at position 27: required argument is missing",
+		},
+		{
+			target:  "sumSeries(a.b,testFunc(testFunc(c.d,1),'1',testFunc(e.f)))",
+			message: "testFunc(testFunc(c.d,1),'1',testFunc(e.f)): argument 3 at position 43: too many arguments, testFunc accepts at most 2",
+		},
+		{
+			target:  "sumSeries(a.b,testFunc(testFunc(c.d,1),'1'),testFunc(e.f))",
+			message: "testFunc(e.f): argument 2 (n) at position 56: required argument is missing",
+		},
+		{
+			// pipes rewrite the call, so its position in the target is unknown
+			target:  "a.b|testFunc('x')",
+			message: `testFunc(a.b,'x'): argument 2 (n): expected integer, got string "x"`,
+		},
+		{
+			target:  "sumSeries(testFunc(a.b,1,unknown=1,other='x'))",
+			message: `testFunc(a.b,1,unknown=1,other='x'): argument 4 at position 35: unknown named argument "other"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			e, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.target, err)
+			}
+			err = ValidateExpr(e, tt.target)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if merry.HTTPCode(err) != 400 {
+				t.Errorf("unexpected HTTP code: %d", merry.HTTPCode(err))
+			}
+			if msg := merry.Message(err); msg != tt.message {
+				t.Errorf("unexpected message:\ngot  %s\nwant %s", msg, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+package expr
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/holtwinters"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type ctxKey int
+
+const (
+	evalPoolKey ctxKey = iota
+	validatedKey
+)
+
+// evalPool bounds the number of goroutines used to evaluate a single request.
+// A slot is acquired without blocking, so nested evaluation never deadlocks: if the pool
+// is exhausted, the work is done inline in the calling goroutine.
+type evalPool struct {
+	slots chan struct{}
+}
+
+// WithEvalParallelism returns a context that allows up to n concurrent evaluations
+// of independent targets and function arguments. Values below 2 keep evaluation sequential.
+func WithEvalParallelism(ctx context.Context, n int) context.Context {
+	if n < 2 {
+		return ctx
+	}
+	// the calling goroutine is one of the workers
+	return context.WithValue(ctx, evalPoolKey, &evalPool{slots: make(chan struct{}, n-1)})
+}
+
+func getEvalPool(ctx context.Context) *evalPool {
+	if v := ctx.Value(evalPoolKey); v != nil {
+		return v.(*evalPool)
+	}
+	return nil
+}
+
+func (p *evalPool) tryAcquire() bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *evalPool) release() {
+	<-p.slots
+}
+
+// run calls f(i) for every i in [0, n). Calls are spread across free pool slots, the rest
+// are done in the calling goroutine. A panic in any call is re-raised in the caller after all
+// calls are finished, so the render handler can recover it as usual.
+func (p *evalPool) run(n int, f func(i int)) {
+	var (
+		wg       sync.WaitGroup
+		panicMu  sync.Mutex
+		panicVal interface{}
+	)
+
+	call := func(i int) {
+		defer func() {
+			if r := recover(); r != nil {
+				panicMu.Lock()
+				if panicVal == nil {
+					panicVal = r
+				}
+				panicMu.Unlock()
+			}
+		}()
+		f(i)
+	}
+
+	for i := 0; i < n; i++ {
+		if i < n-1 && p.tryAcquire() {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer p.release()
+				call(i)
+			}(i)
+		} else {
+			call(i)
+		}
+	}
+	wg.Wait()
+
+	if panicVal != nil {
+		panic(panicVal)
+	}
+}
+
+// branchRefs counts concurrently evaluated branches, which reference a series
+type branchRefs struct {
+	first, last, n int
+}
+
+// branchValues returns values for concurrently evaluated branches, values[i] and metrics[i] are fetched values and
+// metric requests of the i-th branch. Each branch gets its own map with series of its metrics only, so nested fetches
+// in one branch never write to the map that is read by another one. Series, which are referenced by more than one
+// branch, are copied for all of them but the first one, as functions could change series or their lazily computed
+// fields, e.x. aggregated values. Other series are passed as is.
+func branchValues(values []map[parser.MetricRequest][]*types.MetricData, metrics [][]parser.MetricRequest) []map[parser.MetricRequest][]*types.MetricData {
+	keys := make([][]parser.MetricRequest, len(values))
+	refs := make(map[*types.MetricData]*branchRefs)
+	for i := range values {
+		for _, m := range metrics[i] {
+			// series are looked up by the name and the range only, as EvalExpr does
+			k := parser.MetricRequest{Metric: m.Metric, From: m.From, Until: m.Until}
+			if _, ok := values[i][k]; ok {
+				keys[i] = append(keys[i], k)
+			}
+		}
+		for _, k := range keys[i] {
+			for _, s := range values[i][k] {
+				r, ok := refs[s]
+				if !ok {
+					refs[s] = &branchRefs{first: i, last: i, n: 1}
+				} else if r.last != i {
+					r.last = i
+					r.n++
+				}
+			}
+		}
+	}
+
+	branches := make([]map[parser.MetricRequest][]*types.MetricData, len(values))
+	for i := range values {
+		branches[i] = make(map[parser.MetricRequest][]*types.MetricData, len(keys[i]))
+		for _, k := range keys[i] {
+			if _, ok := branches[i][k]; ok {
+				// the metric is requested more than once, e.x. divideSeries(a.b, a.b)
+				continue
+			}
+			v := values[i][k]
+			series := make([]*types.MetricData, len(v))
+			for j, s := range v {
+				if r := refs[s]; r.n > 1 && r.first != i {
+					s = s.Copy(true)
+				}
+				series[j] = s
+			}
+			branches[i][k] = series
+		}
+	}
+	return branches
+}
+
+// sortFetched sorts res, if it's fetched series as is. Sequential evaluation sorts fetched series after each target
+// in place, so such results are returned sorted.
+func sortFetched(res []*types.MetricData, values map[parser.MetricRequest][]*types.MetricData) {
+	if len(res) == 0 {
+		return
+	}
+	for mReq, data := range values {
+		if len(data) > 0 && &data[0] == &res[0] {
+			SortMetrics(res, mReq)
+			return
+		}
+	}
+}
+
+// timeRange is a range, which arguments of a function are evaluated over
+type timeRange struct {
+	from, until int64
+}
+
+// prefetchRanges returns ranges, which all series arguments of e are evaluated over, or nil if they aren't known
+type prefetchRanges func(e parser.Expr, from, until int64) []timeRange
+
+func requestedRange(_ parser.Expr, from, until int64) []timeRange {
+	return []timeRange{{from, until}}
+}
+
+// bootstrapRanges returns ranges of holtWinters functions, which evaluate their argument with bootstrapInterval before
+// the requested range, holtWintersAberration evaluates it over the requested range too
+func bootstrapRanges(pos int, requested bool) prefetchRanges {
+	return func(e parser.Expr, from, until int64) []timeRange {
+		bootstrapInterval, err := e.GetIntervalNamedOrPosArgDefault("bootstrapInterval", pos, 1, holtwinters.DefaultBootstrapInterval)
+		if err != nil {
+			// the function returns the error on its own
+			return nil
+		}
+		ranges := []timeRange{{from - bootstrapInterval, until}}
+		if requested {
+			ranges = append([]timeRange{{from, until}}, ranges...)
+		}
+		return ranges
+	}
+}
+
+// prefetchFunctions are functions, which evaluate all their series arguments over the known time ranges, so their
+// arguments could be evaluated ahead of time. Other functions could skip some arguments or evaluate them over another
+// range (e.x. timeShift), so their arguments are evaluated by them as usual. CPU-heavy functions are listed too, so
+// their arguments are evaluated concurrently, e.x. both ranges of holtWintersAberration.
+var prefetchFunctions = func() map[string]prefetchRanges {
+	functions := map[string]prefetchRanges{
+		"divideSeries":               requestedRange,
+		"group":                      requestedRange,
+		"fft":                        requestedRange,
+		"polyfit":                    requestedRange,
+		"smartSummarize":             requestedRange,
+		"holtWintersForecast":        bootstrapRanges(1, false),
+		"holtWintersConfidenceBands": bootstrapRanges(2, false),
+		"holtWintersAberration":      bootstrapRanges(2, true),
+	}
+	// aggregate aliases, e.x. sumSeries(a.*, b.*)
+	for _, n := range consolidations.AvailableSummarizers {
+		functions[n] = requestedRange
+		functions[n+"Series"] = requestedRange
+	}
+	return functions
+}()
+
+type memoKey struct {
+	e      parser.Expr
+	from   int64
+	until  int64
+	values uintptr
+}
+
+type memoResult struct {
+	data []*types.MetricData
+	err  error
+}
+
+// memoEvaluator returns results of arguments evaluated ahead of time in parallel. Each result
+// is handed out only once, any other call is passed to the wrapped evaluator.
+type memoEvaluator struct {
+	interfaces.Evaluator
+
+	mu   sync.Mutex
+	memo map[memoKey]memoResult
+}
+
+func valuesID(values map[parser.MetricRequest][]*types.MetricData) uintptr {
+	return reflect.ValueOf(values).Pointer()
+}
+
+func (eval *memoEvaluator) Eval(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	key := memoKey{e: e, from: from, until: until, values: valuesID(values)}
+	eval.mu.Lock()
+	r, ok := eval.memo[key]
+	if ok {
+		delete(eval.memo, key)
+	}
+	eval.mu.Unlock()
+	if ok {
+		return r.data, r.err
+	}
+	return eval.Evaluator.Eval(ctx, e, from, until, values)
+}
+
+// prefetchArgs evaluates function arguments of e concurrently if the request allows parallel
+// evaluation and there are at least two arguments or ranges to evaluate. The returned evaluator should be passed to the
+// function instead of the original one.
+func prefetchArgs(ctx context.Context, eval interfaces.Evaluator, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) interfaces.Evaluator {
+	pool := getEvalPool(ctx)
+	if pool == nil {
+		return eval
+	}
+	ranges, ok := prefetchFunctions[e.Target()]
+	if !ok {
+		return eval
+	}
+
+	type task struct {
+		arg parser.Expr
+		// eval is evaluated instead of arg, functions could change their expressions, e.x. aggregate ones
+		eval parser.Expr
+		timeRange
+	}
+	var tasks []task
+	for n, r := range ranges(e, from, until) {
+		for _, arg := range e.Args() {
+			if !arg.IsFunc() {
+				continue
+			}
+			t := task{arg: arg, eval: arg, timeRange: r}
+			if n > 0 {
+				// the same argument is evaluated over another range concurrently
+				exp, _, err := parser.ParseExpr(arg.ToString())
+				if err != nil {
+					return eval
+				}
+				t.eval = exp
+			}
+			tasks = append(tasks, t)
+		}
+	}
+	if len(tasks) < 2 {
+		return eval
+	}
+
+	taskValues := make([]map[parser.MetricRequest][]*types.MetricData, len(tasks))
+	metrics := make([][]parser.MetricRequest, len(tasks))
+	for i, t := range tasks {
+		taskValues[i] = values
+		metrics[i] = t.arg.Metrics(t.from, t.until)
+	}
+	taskValues = branchValues(taskValues, metrics)
+
+	results := make([]memoResult, len(tasks))
+	pool.run(len(tasks), func(i int) {
+		results[i].data, results[i].err = eval.Eval(ctx, tasks[i].eval, tasks[i].from, tasks[i].until, taskValues[i])
+	})
+
+	memo := make(map[memoKey]memoResult, len(tasks))
+	id := valuesID(values)
+	for i, t := range tasks {
+		memo[memoKey{e: t.arg, from: t.from, until: t.until, values: id}] = results[i]
+	}
+
+	return &memoEvaluator{Evaluator: eval, memo: memo}
+}
+
+// evalTargets evaluates already fetched targets, concurrently if the request allows it.
+// Results and errors are returned in the order of exprs. Targets, which are not started yet, are skipped after an
+// error, which stops the evaluation.
+func evalTargets(ctx context.Context, eval interfaces.Evaluator, exprs []parser.Expr, from, until int64, targetValues []map[parser.MetricRequest][]*types.MetricData, stop func(merry.Error) bool) ([][]*types.MetricData, []merry.Error) {
+	results := make([][]*types.MetricData, len(exprs))
+	errs := make([]merry.Error, len(exprs))
+
+	var stopped atomic.Bool
+	pool := getEvalPool(ctx)
+	if pool != nil {
+		metrics := make([][]parser.MetricRequest, len(exprs))
+		for i, e := range exprs {
+			metrics[i] = e.Metrics(from, until)
+		}
+		targetValues = branchValues(targetValues, metrics)
+	}
+	evalOne := func(i int) {
+		if stopped.Load() {
+			return
+		}
+		if err := deadline.Check(ctx); err != nil {
+			errs[i] = err
+			stopped.Store(true)
+			return
+		}
+		values := targetValues[i]
+		res, err := eval.Eval(ctx, exprs[i], from, until, values)
+		if pool != nil {
+			sortFetched(res, values)
+		}
+		if err != nil {
+			errs[i] = merry.Wrap(err)
+			if stop != nil && stop(errs[i]) {
+				stopped.Store(true)
+			}
+		}
+		results[i] = res
+	}
+
+	if pool != nil {
+		pool.run(len(exprs), evalOne)
+	} else {
+		for i := range exprs {
+			evalOne(i)
+		}
+	}
+
+	return results, errs
+}
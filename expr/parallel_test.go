@@ -0,0 +1,285 @@
+package expr
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+	"github.com/go-graphite/carbonapi/tests/compare"
+)
+
+func TestFetchAndEvalExpsParallel(t *testing.T) {
+	from := int64(100)
+	until := int64(105)
+	fetched := map[parser.MetricRequest][]*types.MetricData{
+		{Metric: "a.*", From: from, Until: until}: {
+			types.MakeMetricData("a.b", []float64{1, 2, 3, 4, 5}, 1, from).SetPathExpression("a.*"),
+			types.MakeMetricData("a.a", []float64{2, 3, 4, 5, 6}, 1, from).SetPathExpression("a.*"),
+		},
+		{Metric: "b.*", From: from, Until: until}: {
+			types.MakeMetricData("b.a", []float64{1, 1, 1, 1, 1}, 1, from).SetPathExpression("b.*"),
+			types.MakeMetricData("b.b", []float64{2, 2, 2, 2, 2}, 1, from).SetPathExpression("b.*"),
+		},
+		{Metric: "a.*", From: from - 5, Until: until}: {
+			types.MakeMetricData("a.b", []float64{1, 2, 1, 2, 1, 1, 2, 3, 4, 5}, 1, from-5).SetPathExpression("a.*"),
+			types.MakeMetricData("a.a", []float64{2, 3, 2, 3, 2, 2, 3, 4, 5, 6}, 1, from-5).SetPathExpression("a.*"),
+		},
+	}
+
+	targets := []string{
+		"a.*",
+		"divideSeries(sumSeries(a.*),sumSeries(b.*))",
+		"asPercent(sumSeries(a.*),sumSeries(b.*))",
+		"sumSeries(scale(a.*,2),offset(b.*,1),absolute(a.*))",
+		"holtWintersAberration(sumSeries(a.*),3,'5s')",
+		"sumSeries(polyfit(a.*),polyfit(b.*,2))",
+		"unknownFunction(a.*)",
+		"b.*",
+	}
+
+	eval := func(ctx context.Context) ([][]*types.MetricData, []error) {
+		exprs := make([]parser.Expr, 0, len(targets))
+		for _, target := range targets {
+			exp, _, err := parser.ParseExpr(target)
+			require.NoError(t, err)
+			exprs = append(exprs, exp)
+		}
+
+		evaluator, err := NewEvaluator(nil, th.NewTestZipper(fetched), false)
+		require.NoError(t, err)
+
+		results, merryErrs := FetchAndEvalExps(ctx, evaluator, exprs, from, until, make(map[parser.MetricRequest][]*types.MetricData), nil)
+		errs := make([]error, len(merryErrs))
+		for i, err := range merryErrs {
+			if err != nil {
+				errs[i] = err
+			}
+		}
+		return results, errs
+	}
+
+	wantResults, wantErrs := eval(context.Background())
+	require.Len(t, wantResults, len(targets))
+
+	for _, n := range []int{2, 3, 16} {
+		gotResults, gotErrs := eval(WithEvalParallelism(context.Background(), n))
+		require.Len(t, gotResults, len(targets))
+		for i := range targets {
+			if wantErrs[i] == nil {
+				require.NotEmpty(t, wantResults[i], "target %s", targets[i])
+			}
+			assert.Equal(t, wantErrs[i] == nil, gotErrs[i] == nil, "target %s, parallelism %d", targets[i], n)
+			compare.TestMetricData(t, gotResults[i], wantResults[i])
+		}
+	}
+}
+
+func TestEvalPoolPanic(t *testing.T) {
+	pool := getEvalPool(WithEvalParallelism(context.Background(), 4))
+	require.NotNil(t, pool)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		pool.run(8, func(i int) {
+			if i == 3 {
+				panic("boom")
+			}
+		})
+	})
+	// all slots are released after a panic
+	assert.Equal(t, 0, len(pool.slots))
+}
+
+func TestWithEvalParallelismSequential(t *testing.T) {
+	assert.Nil(t, getEvalPool(WithEvalParallelism(context.Background(), 0)))
+	assert.Nil(t, getEvalPool(WithEvalParallelism(context.Background(), 1)))
+}
+
+func TestFetchAndEvalExpsStop(t *testing.T) {
+	from := int64(100)
+	until := int64(105)
+	fetched := map[parser.MetricRequest][]*types.MetricData{
+		{Metric: "a.*", From: from, Until: until}: {types.MakeMetricData("a.a", []float64{1, 2, 3, 4, 5}, 1, from).SetPathExpression("a.*")},
+		{Metric: "b.*", From: from, Until: until}: {types.MakeMetricData("b.a", []float64{1, 1, 1, 1, 1}, 1, from).SetPathExpression("b.*")},
+	}
+	targets := []string{"a.*", "unknownFunction(a.*)", "b.*"}
+	stop := func(err merry.Error) bool { return true }
+
+	// with parallelism 2 the first target is evaluated in another goroutine, the rest ones in the calling goroutine
+	for _, n := range []int{0, 2} {
+		exprs := make([]parser.Expr, 0, len(targets))
+		for _, target := range targets {
+			exp, _, err := parser.ParseExpr(target)
+			require.NoError(t, err)
+			exprs = append(exprs, exp)
+		}
+		evaluator, err := NewEvaluator(nil, th.NewTestZipper(fetched), false)
+		require.NoError(t, err)
+
+		results, errs := FetchAndEvalExps(WithEvalParallelism(context.Background(), n), evaluator, exprs, from, until, make(map[parser.MetricRequest][]*types.MetricData), stop)
+		require.Len(t, results, len(targets))
+		// the first target could be skipped too, if its goroutine isn't started before the failure
+		assert.NoError(t, errs[0], "parallelism %d", n)
+		if n == 0 {
+			assert.Len(t, results[0], 1)
+		}
+		assert.Error(t, errs[1], "parallelism %d", n)
+		assert.NoError(t, errs[2], "parallelism %d", n)
+		assert.Empty(t, results[2], "target after the failed one is evaluated, parallelism %d", n)
+	}
+}
+
+func TestPrefetchArgs(t *testing.T) {
+	ctx := WithEvalParallelism(context.Background(), 4)
+	evaluator, err := NewEvaluator(nil, th.NewTestZipper(nil), false)
+	require.NoError(t, err)
+
+	tests := []struct {
+		target   string
+		prefetch bool
+	}{
+		{"sumSeries(scale(a.*,2),offset(b.*,1))", true},
+		{"divideSeries(sumSeries(a.*),sumSeries(b.*))", true},
+		{"sumSeries(scale(a.*,2))", false},
+		// the argument is evaluated over the requested range and with bootstrapInterval before it
+		{"holtWintersAberration(sumSeries(a.*))", true},
+		{"holtWintersForecast(sumSeries(a.*))", false},
+		{"fft(sumSeries(a.*))", false},
+		{"sumSeries(fft(a.*),polyfit(b.*),smartSummarize(c.*,'1h'))", true},
+		// arguments could be evaluated over another range or skipped
+		{"asPercent(sumSeries(a.*),sumSeries(b.*))", false},
+		{"fallbackSeries(sumSeries(a.*),sumSeries(b.*))", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			require.NoError(t, err)
+			eval := prefetchArgs(ctx, evaluator, exp, 100, 105, make(map[parser.MetricRequest][]*types.MetricData))
+			_, prefetched := eval.(*memoEvaluator)
+			assert.Equal(t, tt.prefetch, prefetched)
+		})
+	}
+}
+
+func TestEvalTargetsCopyValues(t *testing.T) {
+	from := int64(100)
+	series := types.MakeMetricData("a.a", []float64{1, 2, 3, 4, 5}, 1, from).SetPathExpression("a.*")
+	other := types.MakeMetricData("b.a", []float64{1, 1, 1, 1, 1}, 1, from).SetPathExpression("b.*")
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{Metric: "a.*", From: from, Until: from + 5}: {series},
+		{Metric: "b.*", From: from, Until: from + 5}: {other},
+	}
+	var exprs []parser.Expr
+	for _, target := range []string{"a.*", "a.*", "b.*"} {
+		exp, _, err := parser.ParseExpr(target)
+		require.NoError(t, err)
+		exprs = append(exprs, exp)
+	}
+	evaluator, err := NewEvaluator(nil, th.NewTestZipper(nil), false)
+	require.NoError(t, err)
+
+	ctx := WithEvalParallelism(context.Background(), 4)
+	results, errs := evalTargets(ctx, evaluator, exprs, from, from+5, []map[parser.MetricRequest][]*types.MetricData{values, values, values}, nil)
+	for i := range exprs {
+		require.NoError(t, errs[i])
+		require.Len(t, results[i], 1)
+	}
+	// concurrent targets never share series, series of a single target aren't copied
+	assert.Same(t, series, results[0][0])
+	assert.NotSame(t, series, results[1][0])
+	assert.Equal(t, series.Values, results[1][0].Values)
+	assert.Same(t, other, results[2][0])
+}
+
+func TestBranchValues(t *testing.T) {
+	from, until := int64(100), int64(105)
+	a := types.MakeMetricData("a.a", []float64{1, 2, 3, 4, 5}, 1, from)
+	aBootstrap := types.MakeMetricData("a.a", []float64{0, 1, 2, 3, 4, 5}, 1, from-1)
+	b := types.MakeMetricData("b.a", []float64{1, 1, 1, 1, 1}, 1, from)
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{Metric: "a.*", From: from, Until: until}:     {a},
+		{Metric: "a.*", From: from - 1, Until: until}: {aBootstrap},
+		{Metric: "b.*", From: from, Until: until}:     {b},
+	}
+
+	branches := branchValues(
+		[]map[parser.MetricRequest][]*types.MetricData{values, values, values},
+		[][]parser.MetricRequest{
+			{{Metric: "a.*", From: from, Until: until}, {Metric: "b.*", From: from, Until: until}},
+			{{Metric: "a.*", From: from - 1, Until: until}},
+			{{Metric: "b.*", From: from, Until: until, ConsolidationFunc: "max"}},
+		},
+	)
+	require.Len(t, branches, 3)
+
+	require.Len(t, branches[0], 2)
+	assert.Same(t, a, branches[0][parser.MetricRequest{Metric: "a.*", From: from, Until: until}][0])
+	assert.Same(t, b, branches[0][parser.MetricRequest{Metric: "b.*", From: from, Until: until}][0])
+
+	// another range of the same metric isn't shared
+	require.Len(t, branches[1], 1)
+	assert.Same(t, aBootstrap, branches[1][parser.MetricRequest{Metric: "a.*", From: from - 1, Until: until}][0])
+
+	require.Len(t, branches[2], 1)
+	copied := branches[2][parser.MetricRequest{Metric: "b.*", From: from, Until: until}][0]
+	assert.NotSame(t, b, copied)
+	assert.Equal(t, b.Values, copied.Values)
+
+	// the map of the first branch is its own one
+	assert.Len(t, values, 3)
+	delete(branches[0], parser.MetricRequest{Metric: "b.*", From: from, Until: until})
+	assert.Len(t, values, 3)
+}
+
+func TestFetchAndEvalExpsDeadline(t *testing.T) {
+	from := int64(100)
+	until := int64(105)
+	fetched := map[parser.MetricRequest][]*types.MetricData{
+		{Metric: "a.*", From: from, Until: until}: {types.MakeMetricData("a.a", []float64{1, 2, 3, 4, 5}, 1, from).SetPathExpression("a.*")},
+	}
+	targets := []string{"sumSeries(a.*)", "a.*"}
+
+	for _, n := range []int{0, 2} {
+		exprs := make([]parser.Expr, 0, len(targets))
+		for _, target := range targets {
+			exp, _, err := parser.ParseExpr(target)
+			require.NoError(t, err)
+			exprs = append(exprs, exp)
+		}
+		evaluator, err := NewEvaluator(nil, th.NewTestZipper(fetched), false)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(WithEvalParallelism(context.Background(), n), time.Nanosecond)
+		<-ctx.Done()
+		results, errs := FetchAndEvalExps(ctx, evaluator, exprs, from, until, make(map[parser.MetricRequest][]*types.MetricData), nil)
+		cancel()
+		require.Len(t, results, len(targets))
+		// evaluation is stopped at the first target
+		require.Error(t, errs[0], "parallelism %d", n)
+		assert.True(t, merry.Is(errs[0], deadline.ErrExpired), "parallelism %d", n)
+		assert.Equal(t, http.StatusGatewayTimeout, merry.HTTPCode(errs[0]))
+		assert.Empty(t, results[0])
+		assert.NoError(t, errs[1], "parallelism %d", n)
+		assert.Empty(t, results[1])
+	}
+}
+
+func TestEvalExprDeadline(t *testing.T) {
+	exp, _, err := parser.ParseExpr("sumSeries(a.*)")
+	require.NoError(t, err)
+	evaluator, err := NewEvaluator(nil, th.NewTestZipper(nil), false)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = EvalExpr(ctx, evaluator, exp, 100, 105, make(map[parser.MetricRequest][]*types.MetricData))
+	assert.True(t, merry.Is(err, context.Canceled), "function is evaluated after the context is done: %v", err)
+}
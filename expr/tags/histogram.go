@@ -0,0 +1,44 @@
+package tags
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// BucketTag is a tag with upper bound of the histogram bucket, as used by Prometheus
+	BucketTag = "le"
+	// BucketNodePrefix is a prefix of the node with upper bound of the histogram bucket in graphite-style names, e.x. latency.bucket.le_0_5
+	BucketNodePrefix = "le_"
+)
+
+// ParseBucketBound parses upper bound of the histogram bucket. Bounds can be specified as tag value (0.5, +Inf) or
+// as metric node, where dot is replaced by underscore (le_0_5, le_inf)
+func ParseBucketBound(s string) (float64, bool) {
+	s = strings.TrimPrefix(s, BucketNodePrefix)
+	switch strings.ToLower(s) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "":
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(s, "_", "."), 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, false
+	}
+	return v, true
+}
+
+// BucketNode returns index of the last node with histogram bucket bound (le_*) in metric name
+func BucketNode(name string) (int, bool) {
+	nodes := strings.Split(name, ".")
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if strings.HasPrefix(nodes[i], BucketNodePrefix) {
+			if _, ok := ParseBucketBound(nodes[i]); ok {
+				return i, true
+			}
+		}
+	}
+	return -1, false
+}
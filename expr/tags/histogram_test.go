@@ -0,0 +1,45 @@
+package tags
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseBucketBound(t *testing.T) {
+	tests := []struct {
+		input string
+		bound float64
+		ok    bool
+	}{
+		{input: "0.25", bound: 0.25, ok: true},
+		{input: "+Inf", bound: math.Inf(1), ok: true},
+		{input: "le_0_25", bound: 0.25, ok: true},
+		{input: "le_100", bound: 100, ok: true},
+		{input: "le_inf", bound: math.Inf(1), ok: true},
+		{input: "le_1e-3", bound: 0.001, ok: true},
+		{input: "le_", ok: false},
+		{input: "bucket", ok: false},
+		{input: "NaN", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			bound, ok := ParseBucketBound(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("unexpected result: got %v, want %v", ok, tt.ok)
+			}
+			if ok && bound != tt.bound {
+				t.Errorf("unexpected bound: got %v, want %v", bound, tt.bound)
+			}
+		})
+	}
+}
+
+func TestBucketNode(t *testing.T) {
+	if node, ok := BucketNode("app.latency.le_0_5.bucket"); !ok || node != 2 {
+		t.Errorf("unexpected node: got %d, %v", node, ok)
+	}
+	if _, ok := BucketNode("app.latency.level"); ok {
+		t.Errorf("unexpected bucket node in app.latency.level")
+	}
+}
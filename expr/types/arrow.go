@@ -0,0 +1,68 @@
+package types
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+)
+
+// MarshalArrow marshals metrics to Apache Arrow IPC stream with schema and single record batch.
+// NaN values are written as nulls. See metricsTable for the table layouts.
+func MarshalArrow(results []*MetricData, wide bool) []byte {
+	columns, _ := metricsTable(results, wide)
+
+	fields := make([]arrow.Field, len(columns))
+	for i := range columns {
+		fields[i] = arrowField(&columns[i])
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for i := range columns {
+		c := &columns[i]
+		switch c.kind {
+		case stringColumn:
+			b.Field(i).(*array.StringBuilder).AppendValues(c.strings, nil)
+		case timestampColumn:
+			timestamps := make([]arrow.Timestamp, len(c.ints))
+			for j, v := range c.ints {
+				timestamps[j] = arrow.Timestamp(v)
+			}
+			b.Field(i).(*array.TimestampBuilder).AppendValues(timestamps, nil)
+		case doubleColumn:
+			var valid []bool
+			if c.nulls() > 0 {
+				valid = make([]bool, len(c.floats))
+				for j, v := range c.floats {
+					valid[j] = !math.IsNaN(v)
+				}
+			}
+			b.Field(i).(*array.Float64Builder).AppendValues(c.floats, valid)
+		}
+	}
+	record := b.NewRecord()
+	defer record.Release()
+
+	var out bytes.Buffer
+	w := ipc.NewWriter(&out, ipc.WithSchema(schema))
+	// writes to bytes.Buffer don't fail and the record matches the schema
+	_ = w.Write(record)
+	_ = w.Close()
+	return out.Bytes()
+}
+
+func arrowField(c *tableColumn) arrow.Field {
+	switch c.kind {
+	case stringColumn:
+		return arrow.Field{Name: c.name, Type: arrow.BinaryTypes.String}
+	case timestampColumn:
+		return arrow.Field{Name: c.name, Type: &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}}
+	default:
+		return arrow.Field{Name: c.name, Type: arrow.PrimitiveTypes.Float64, Nullable: true}
+	}
+}
@@ -0,0 +1,139 @@
+package types
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+)
+
+// decodeArrow reads the stream with arrow IPC reader, it returns the schema and values of the columns, nulls are NaN
+func decodeArrow(t *testing.T, b []byte) (*arrow.Schema, []interface{}, int64) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	r, err := ipc.NewReader(bytes.NewReader(b), ipc.WithAllocator(mem))
+	if err != nil {
+		t.Fatalf("failed to read arrow stream: %v", err)
+	}
+	defer r.Release()
+
+	columns := make([]interface{}, len(r.Schema().Fields()))
+	var rows int64
+	for r.Next() {
+		record := r.Record()
+		rows += record.NumRows()
+		for i, c := range record.Columns() {
+			switch c := c.(type) {
+			case *array.String:
+				values, _ := columns[i].([]string)
+				for j := 0; j < c.Len(); j++ {
+					values = append(values, c.Value(j))
+				}
+				columns[i] = values
+			case *array.Timestamp:
+				values, _ := columns[i].([]int64)
+				for _, v := range c.TimestampValues() {
+					values = append(values, int64(v))
+				}
+				columns[i] = values
+			case *array.Float64:
+				values, _ := columns[i].([]float64)
+				for j, v := range c.Float64Values() {
+					if c.IsNull(j) {
+						v = math.NaN()
+					}
+					values = append(values, v)
+				}
+				columns[i] = values
+			default:
+				t.Fatalf("unexpected column type %s", c.DataType())
+			}
+		}
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("failed to read arrow stream: %v", err)
+	}
+
+	return r.Schema(), columns, rows
+}
+
+func floatsEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !(math.IsNaN(a[i]) && math.IsNaN(b[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestArrowResponse(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("metric1", []float64{1, 1.5, math.NaN()}, 100, 100),
+		MakeMetricData("metric2;foo=bar", []float64{2, 2.5}, 200, 100),
+	}
+	timestampType := &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}
+
+	schema, columns, rows := decodeArrow(t, MarshalArrow(results, false))
+	wantSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "metric", Type: arrow.BinaryTypes.String},
+		{Name: "tags", Type: arrow.BinaryTypes.String},
+		{Name: "timestamp", Type: timestampType},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	if !schema.Equal(wantSchema) {
+		t.Fatalf("unexpected schema: got %v, want %v", schema, wantSchema)
+	}
+	if rows != 5 {
+		t.Errorf("unexpected rows: %d", rows)
+	}
+	if want := []string{"metric1", "metric1", "metric1", "metric2;foo=bar", "metric2;foo=bar"}; !reflect.DeepEqual(columns[0], want) {
+		t.Errorf("unexpected metrics: got %v, want %v", columns[0], want)
+	}
+	if want := `{"foo":"bar","name":"metric2"}`; columns[1].([]string)[4] != want {
+		t.Errorf("unexpected tags: got %v, want %v", columns[1].([]string)[4], want)
+	}
+	if want := []int64{100000, 200000, 300000, 100000, 300000}; !reflect.DeepEqual(columns[2], want) {
+		t.Errorf("unexpected timestamps: got %v, want %v", columns[2], want)
+	}
+	if want := []float64{1, 1.5, math.NaN(), 2, 2.5}; !floatsEqual(columns[3].([]float64), want) {
+		t.Errorf("unexpected values: got %v, want %v", columns[3], want)
+	}
+
+	schema, columns, rows = decodeArrow(t, MarshalArrow(results, true))
+	wantSchema = arrow.NewSchema([]arrow.Field{
+		{Name: "timestamp", Type: timestampType},
+		{Name: "metric1", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "metric2;foo=bar", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+	if !schema.Equal(wantSchema) {
+		t.Fatalf("unexpected wide schema: got %v, want %v", schema, wantSchema)
+	}
+	if rows != 3 {
+		t.Errorf("unexpected rows: %d", rows)
+	}
+	if want := []int64{100000, 200000, 300000}; !reflect.DeepEqual(columns[0], want) {
+		t.Errorf("unexpected timestamps: got %v, want %v", columns[0], want)
+	}
+	if want := []float64{1, 1.5, math.NaN()}; !floatsEqual(columns[1].([]float64), want) {
+		t.Errorf("unexpected metric1: got %v, want %v", columns[1], want)
+	}
+	if want := []float64{2, math.NaN(), 2.5}; !floatsEqual(columns[2].([]float64), want) {
+		t.Errorf("unexpected metric2: got %v, want %v", columns[2], want)
+	}
+}
+
+func TestArrowResponseEmpty(t *testing.T) {
+	schema, _, rows := decodeArrow(t, MarshalArrow(nil, false))
+	if len(schema.Fields()) != 4 || rows != 0 {
+		t.Errorf("unexpected empty stream: %v, %d rows", schema, rows)
+	}
+}
@@ -0,0 +1,128 @@
+package types
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Grafana data frame JSON, see https://grafana.com/developers/plugin-tools/key-concepts/data-frames
+type dataFrame struct {
+	Schema dataFrameSchema `json:"schema"`
+	Data   dataFrameData   `json:"data"`
+}
+
+type dataFrameSchema struct {
+	Meta   dataFrameMeta    `json:"meta"`
+	Fields []dataFrameField `json:"fields"`
+}
+
+type dataFrameMeta struct {
+	Type        string              `json:"type"`
+	TypeVersion [2]int              `json:"typeVersion"`
+	Custom      dataFrameMetaCustom `json:"custom"`
+}
+
+type dataFrameMetaCustom struct {
+	Series []dataFrameSeriesMeta `json:"series"`
+}
+
+// dataFrameSeriesMeta describes how values of the series were produced
+type dataFrameSeriesMeta struct {
+	Name              string `json:"name"`
+	ConsolidationFunc string `json:"consolidationFunc"`
+	// Step is an actual step of the values in seconds, after consolidation and alignment
+	Step           int64 `json:"step"`
+	ValuesPerPoint int   `json:"valuesPerPoint"`
+}
+
+type dataFrameField struct {
+	Name     string                `json:"name"`
+	Type     string                `json:"type"`
+	TypeInfo dataFrameFieldType    `json:"typeInfo"`
+	Labels   map[string]string     `json:"labels,omitempty"`
+	Config   *dataFrameFieldConfig `json:"config,omitempty"`
+}
+
+type dataFrameFieldType struct {
+	Frame    string `json:"frame"`
+	Nullable bool   `json:"nullable,omitempty"`
+}
+
+type dataFrameFieldConfig struct {
+	DisplayNameFromDS string `json:"displayNameFromDS"`
+	// Interval is a step of the values in milliseconds
+	Interval int64 `json:"interval"`
+}
+
+type dataFrameData struct {
+	Values []interface{} `json:"values"`
+}
+
+// MarshalDataFrame marshals metrics to Grafana data frame JSON: list with single wide frame, that has time field shared
+// by all series and value field per series with series tags as labels. NaN and infinite values are nulls.
+// Frame meta has consolidation function and actual step of every series.
+func MarshalDataFrame(results []*MetricData) []byte {
+	if len(results) == 0 {
+		return []byte("[]")
+	}
+
+	columns, _ := wideTable(results)
+	frame := dataFrame{
+		Schema: dataFrameSchema{
+			Meta: dataFrameMeta{
+				Type:        "timeseries-wide",
+				TypeVersion: [2]int{0, 1},
+				Custom:      dataFrameMetaCustom{Series: make([]dataFrameSeriesMeta, 0, len(results))},
+			},
+			Fields: make([]dataFrameField, 0, len(columns)),
+		},
+		Data: dataFrameData{Values: make([]interface{}, 0, len(columns))},
+	}
+
+	frame.Schema.Fields = append(frame.Schema.Fields, dataFrameField{
+		Name:     "Time",
+		Type:     "time",
+		TypeInfo: dataFrameFieldType{Frame: "time.Time"},
+	})
+	frame.Data.Values = append(frame.Data.Values, columns[0].ints)
+
+	for i, r := range results {
+		_, step := points(r)
+		consolidationFunc := r.ConsolidationFunc
+		if consolidationFunc == "" {
+			consolidationFunc = "average"
+		}
+		valuesPerPoint := r.ValuesPerPoint
+		if valuesPerPoint == 0 {
+			valuesPerPoint = 1
+		}
+		frame.Schema.Meta.Custom.Series = append(frame.Schema.Meta.Custom.Series, dataFrameSeriesMeta{
+			Name:              r.Name,
+			ConsolidationFunc: consolidationFunc,
+			Step:              step,
+			ValuesPerPoint:    valuesPerPoint,
+		})
+
+		c := &columns[i+1]
+		frame.Schema.Fields = append(frame.Schema.Fields, dataFrameField{
+			Name:     c.name,
+			Type:     "number",
+			TypeInfo: dataFrameFieldType{Frame: "float64", Nullable: true},
+			Labels:   r.Tags,
+			Config:   &dataFrameFieldConfig{DisplayNameFromDS: r.Name, Interval: step * 1000},
+		})
+		values := make([]*float64, len(c.floats))
+		for j := range c.floats {
+			if v := c.floats[j]; !math.IsNaN(v) && !math.IsInf(v, 0) {
+				values[j] = &c.floats[j]
+			}
+		}
+		frame.Data.Values = append(frame.Data.Values, values)
+	}
+
+	b, err := json.Marshal([]dataFrame{frame})
+	if err != nil {
+		return []byte("[]")
+	}
+	return b
+}
@@ -0,0 +1,56 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDataFrameResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []*MetricData
+		out     string
+	}{
+		{
+			name:    "empty",
+			results: []*MetricData{},
+			out:     `[]`,
+		},
+		{
+			name: "mixed steps",
+			results: []*MetricData{
+				MakeMetricData("metric1", []float64{1, math.NaN(), 3, math.Inf(1)}, 60, 60),
+				MakeMetricData("metric2;foo=bar", []float64{2, 4}, 120, 60).SetConsolidationFunc("max"),
+			},
+			out: `[{"schema":{"meta":{"type":"timeseries-wide","typeVersion":[0,1],"custom":{"series":[` +
+				`{"name":"metric1","consolidationFunc":"average","step":60,"valuesPerPoint":1},` +
+				`{"name":"metric2;foo=bar","consolidationFunc":"max","step":120,"valuesPerPoint":1}]}},"fields":[` +
+				`{"name":"Time","type":"time","typeInfo":{"frame":"time.Time"}},` +
+				`{"name":"metric1","type":"number","typeInfo":{"frame":"float64","nullable":true},"labels":{"name":"metric1"},"config":{"displayNameFromDS":"metric1","interval":60000}},` +
+				`{"name":"metric2;foo=bar","type":"number","typeInfo":{"frame":"float64","nullable":true},"labels":{"foo":"bar","name":"metric2"},"config":{"displayNameFromDS":"metric2;foo=bar","interval":120000}}]},` +
+				`"data":{"values":[[60000,120000,180000,240000],[1,null,3,null],[2,null,4,null]]}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if b := MarshalDataFrame(tt.results); string(b) != tt.out {
+				t.Errorf("MarshalDataFrame: got\n%s\nwant\n%s", b, tt.out)
+			}
+		})
+	}
+}
+
+func TestDataFrameResponseConsolidated(t *testing.T) {
+	results := []*MetricData{MakeMetricData("metric1", []float64{1, 2, 3, 4}, 60, 60)}
+	results[0].SetValuesPerPoint(2)
+
+	out := `[{"schema":{"meta":{"type":"timeseries-wide","typeVersion":[0,1],"custom":{"series":[` +
+		`{"name":"metric1","consolidationFunc":"average","step":120,"valuesPerPoint":2}]}},"fields":[` +
+		`{"name":"Time","type":"time","typeInfo":{"frame":"time.Time"}},` +
+		`{"name":"metric1","type":"number","typeInfo":{"frame":"float64","nullable":true},"labels":{"name":"metric1"},"config":{"displayNameFromDS":"metric1","interval":120000}}]},` +
+		`"data":{"values":[[60000,180000],[1.5,3.5]]}}]`
+	if b := MarshalDataFrame(results); string(b) != out {
+		t.Errorf("MarshalDataFrame: got\n%s\nwant\n%s", b, out)
+	}
+}
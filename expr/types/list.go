@@ -43,45 +43,49 @@ const (
 	AggOrSeriesFunc
 	// IntOrInf is a constant for Integer that can be infinity
 	IntOrInf
+	// SeriesListOrFloat is a constant for SeriesList or Float type
+	SeriesListOrFloat
 )
 
 var strToFunctionType = map[string]FunctionType{
-	"aggFunc":         AggFunc,
-	"boolean":         Boolean,
-	"date":            Date,
-	"float":           Float,
-	"intOrInterval":   IntOrInterval,
-	"integer":         Integer,
-	"interval":        Interval,
-	"node":            Node,
-	"nodeOrTag":       NodeOrTag,
-	"seriesList":      SeriesList,
-	"seriesLists":     SeriesLists,
-	"string":          String,
-	"tag":             Tag,
-	"any":             Any,
-	"aggOrSeriesFunc": AggOrSeriesFunc,
-	"intOrInf":        IntOrInf,
+	"aggFunc":           AggFunc,
+	"boolean":           Boolean,
+	"date":              Date,
+	"float":             Float,
+	"intOrInterval":     IntOrInterval,
+	"integer":           Integer,
+	"interval":          Interval,
+	"node":              Node,
+	"nodeOrTag":         NodeOrTag,
+	"seriesList":        SeriesList,
+	"seriesLists":       SeriesLists,
+	"string":            String,
+	"tag":               Tag,
+	"any":               Any,
+	"aggOrSeriesFunc":   AggOrSeriesFunc,
+	"intOrInf":          IntOrInf,
+	"seriesListOrFloat": SeriesListOrFloat,
 }
 
 // FunctionTypeToStr provides a mapping between internal type constants and graphite-friendly string that have a name of a type
 var FunctionTypeToStr = map[FunctionType]string{
-	AggFunc:         "aggFunc",
-	Boolean:         "boolean",
-	Date:            "date",
-	Float:           "float",
-	IntOrInterval:   "intOrInterval",
-	Integer:         "integer",
-	Interval:        "interval",
-	Node:            "node",
-	NodeOrTag:       "nodeOrTag",
-	SeriesList:      "seriesList",
-	SeriesLists:     "seriesLists",
-	String:          "string",
-	Tag:             "tag",
-	Any:             "any",
-	AggOrSeriesFunc: "aggOrSeriesFunc",
-	IntOrInf:        "intOrInf",
+	AggFunc:           "aggFunc",
+	Boolean:           "boolean",
+	Date:              "date",
+	Float:             "float",
+	IntOrInterval:     "intOrInterval",
+	Integer:           "integer",
+	Interval:          "interval",
+	Node:              "node",
+	NodeOrTag:         "nodeOrTag",
+	SeriesList:        "seriesList",
+	SeriesLists:       "seriesLists",
+	String:            "string",
+	Tag:               "tag",
+	Any:               "any",
+	AggOrSeriesFunc:   "aggOrSeriesFunc",
+	IntOrInf:          "intOrInf",
+	SeriesListOrFloat: "seriesListOrFloat",
 }
 
 // MarshalJSON marshals metric data to JSON
@@ -280,6 +284,10 @@ type FunctionDescription struct {
 
 	Proxied bool `json:"proxied"`
 
+	// SkipArgsValidation disables validation of arguments against Params, for functions that also accept
+	// arguments that can't be expressed by parameter list (e.g. legacy argument order)
+	SkipArgsValidation bool `json:"-"`
+
 	SeriesChange bool `json:"aggregate,omitempty"`       //  function aggregate metrics, for tests and verify results in future
 	NameChange   bool `json:"name-change,omitempty"`     // function change name, for tests and verify results in future
 	TagsChange   bool `json:"name-tag-change,omitempty"` //  function change name tag, for tests and verify results in future
@@ -0,0 +1,195 @@
+package types
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PromName returns name, that is valid as Prometheus metric name: invalid characters are replaced with underscores.
+// Graphite path separators become underscores too, so `foo.bar-baz` is `foo_bar_baz`.
+func PromName(name string) string {
+	return promSanitize(name, true)
+}
+
+// PromLabelName returns name, that is valid as Prometheus label name
+func PromLabelName(name string) string {
+	return promSanitize(name, false)
+}
+
+func promSanitize(name string, colon bool) string {
+	if name == "" {
+		return "_"
+	}
+	var sb strings.Builder
+	sb.Grow(len(name) + 1)
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', colon && c == ':':
+			sb.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(c)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// PromLabels returns tags of the series as sorted Prometheus labels, name tag is skipped
+func PromLabels(r *MetricData) [][2]string {
+	labels := make([][2]string, 0, len(r.Tags))
+	seen := make(map[string]bool, len(r.Tags))
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		if k != "name" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := PromLabelName(k)
+		// names with double underscores are reserved by Prometheus
+		if strings.HasPrefix(name, "__") {
+			name = "tag" + name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		labels = append(labels, [2]string{name, r.Tags[k]})
+	}
+	return labels
+}
+
+// PromSeriesName returns Prometheus metric name of the series: name of the series without tags, sanitized
+func PromSeriesName(r *MetricData) string {
+	name := r.Name
+	if n := strings.IndexByte(name, ';'); n >= 0 {
+		name = name[:n]
+	}
+	return PromName(name)
+}
+
+func appendPromLabelValue(b []byte, v string) []byte {
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			b = append(b, `\\`...)
+		case '"':
+			b = append(b, `\"`...)
+		case '\n':
+			b = append(b, `\n`...)
+		default:
+			b = append(b, v[i])
+		}
+	}
+	return b
+}
+
+func appendPromFloat(b []byte, v float64) []byte {
+	switch {
+	case math.IsInf(v, 1):
+		return append(b, "+Inf"...)
+	case math.IsInf(v, -1):
+		return append(b, "-Inf"...)
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		// integers, like timestamps or counters, are written without exponent
+		return strconv.AppendFloat(b, v, 'f', -1, 64)
+	}
+	return strconv.AppendFloat(b, v, 'g', -1, 64)
+}
+
+// MarshalOpenMetrics marshals metrics to OpenMetrics text format as gauges. Name of the series becomes metric name
+// and tags become labels, both are sanitized. Only last non-null value of the series is written, unless allPoints is set.
+// Series are grouped to metric families by name, series with duplicated name and labels are skipped.
+func MarshalOpenMetrics(results []*MetricData, allPoints bool) []byte {
+	type family struct {
+		name   string
+		series []*MetricData
+		labels [][][2]string
+	}
+	var families []*family
+	byName := make(map[string]*family)
+	seen := make(map[string]bool)
+
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		name := PromSeriesName(r)
+		labels := PromLabels(r)
+
+		key := PromSeriesKey(name, labels)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		f, ok := byName[name]
+		if !ok {
+			f = &family{name: name}
+			byName[name] = f
+			families = append(families, f)
+		}
+		f.series = append(f.series, r)
+		f.labels = append(f.labels, labels)
+	}
+
+	b := make([]byte, 0, 128*len(results))
+	for _, f := range families {
+		b = append(b, "# TYPE "...)
+		b = append(b, f.name...)
+		b = append(b, " gauge\n"...)
+		for i, r := range f.series {
+			values, step := points(r)
+			ts := r.StartTime
+			if !allPoints {
+				// find last non-null value
+				last := -1
+				for j := len(values) - 1; j >= 0; j-- {
+					if !math.IsNaN(values[j]) {
+						last = j
+						break
+					}
+				}
+				if last < 0 {
+					continue
+				}
+				ts += int64(last) * step
+				values = values[last : last+1]
+			}
+			for _, v := range values {
+				if !math.IsNaN(v) {
+					b = append(b, f.name...)
+					if len(f.labels[i]) > 0 {
+						b = append(b, '{')
+						for j, l := range f.labels[i] {
+							if j > 0 {
+								b = append(b, ',')
+							}
+							b = append(b, l[0]...)
+							b = append(b, `="`...)
+							b = appendPromLabelValue(b, l[1])
+							b = append(b, '"')
+						}
+						b = append(b, '}')
+					}
+					b = append(b, ' ')
+					b = appendPromFloat(b, v)
+					b = append(b, ' ')
+					b = strconv.AppendInt(b, ts, 10)
+					b = append(b, '\n')
+				}
+				ts += step
+			}
+		}
+	}
+	b = append(b, "# EOF\n"...)
+
+	return b
+}
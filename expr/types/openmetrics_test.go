@@ -0,0 +1,57 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOpenMetricsResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   []*MetricData
+		allPoints bool
+		out       string
+	}{
+		{
+			name:    "empty",
+			results: []*MetricData{},
+			out:     "# EOF\n",
+		},
+		{
+			name: "last value",
+			results: []*MetricData{
+				MakeMetricData("foo.bar-baz", []float64{1, 2, math.NaN()}, 60, 60),
+				MakeMetricData("1min.load;host=a;__meta=x", []float64{0.5, math.Inf(1)}, 60, 60),
+				MakeMetricData("foo.bar_baz", []float64{3}, 60, 60),
+				MakeMetricData("foo.bar-baz;dc=\"eu\\1\"", []float64{math.NaN(), 4}, 60, 60),
+				MakeMetricData("empty", []float64{math.NaN()}, 60, 60),
+			},
+			out: "# TYPE foo_bar_baz gauge\n" +
+				"foo_bar_baz 2 120\n" +
+				"foo_bar_baz{dc=\"\\\"eu\\\\1\\\"\"} 4 120\n" +
+				"# TYPE _1min_load gauge\n" +
+				"_1min_load{tag__meta=\"x\",host=\"a\"} +Inf 120\n" +
+				"# TYPE empty gauge\n" +
+				"# EOF\n",
+		},
+		{
+			name: "all points",
+			results: []*MetricData{
+				MakeMetricData("foo.bar;host=a", []float64{1, math.NaN(), 1e-9}, 60, 60),
+			},
+			allPoints: true,
+			out: "# TYPE foo_bar gauge\n" +
+				"foo_bar{host=\"a\"} 1 60\n" +
+				"foo_bar{host=\"a\"} 1e-09 180\n" +
+				"# EOF\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if b := MarshalOpenMetrics(tt.results, tt.allPoints); string(b) != tt.out {
+				t.Errorf("MarshalOpenMetrics: got\n%s\nwant\n%s", b, tt.out)
+			}
+		})
+	}
+}
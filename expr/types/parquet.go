@@ -0,0 +1,319 @@
+package types
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Parquet format constants, see https://github.com/apache/parquet-format/blob/master/src/main/thrift/parquet.thrift
+const (
+	parquetMagic = "PAR1"
+
+	parquetTypeInt64     = 2
+	parquetTypeDouble    = 5
+	parquetTypeByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	parquetPageData = 0
+)
+
+// Thrift compact protocol types
+const (
+	thriftBoolTrue  = 1
+	thriftBoolFalse = 2
+	thriftI32       = 5
+	thriftI64       = 6
+	thriftBinary    = 8
+	thriftList      = 9
+	thriftStruct    = 12
+)
+
+// thriftWriter is a minimal writer of thrift compact protocol, enough to write parquet metadata
+type thriftWriter struct {
+	buf    []byte
+	lastID int16
+	stack  []int16
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if delta := id - w.lastID; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.zigzag(int64(id))
+	}
+	w.lastID = id
+}
+
+func (w *thriftWriter) structBegin() {
+	w.stack = append(w.stack, w.lastID)
+	w.lastID = 0
+}
+
+func (w *thriftWriter) structEnd() {
+	w.buf = append(w.buf, 0)
+	w.lastID = w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+}
+
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.structBegin()
+}
+
+func (w *thriftWriter) i32Field(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64Field(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) boolField(id int16, v bool) {
+	if v {
+		w.field(id, thriftBoolTrue)
+	} else {
+		w.field(id, thriftBoolFalse)
+	}
+}
+
+func (w *thriftWriter) binary(s string) {
+	w.varint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *thriftWriter) stringField(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.binary(s)
+}
+
+func (w *thriftWriter) listField(id int16, elemType byte, size int) {
+	w.field(id, thriftList)
+	if size < 15 {
+		w.buf = append(w.buf, byte(size)<<4|elemType)
+	} else {
+		w.buf = append(w.buf, 0xf0|elemType)
+		w.varint(uint64(size))
+	}
+}
+
+// Row groups and data pages of MarshalParquet are bounded, so readers don't need to load whole column of the file and
+// sizes of pages always fit into int32 fields of their headers
+var (
+	parquetRowGroupRows = 1 << 20
+	parquetPageSize     = 1 << 20
+)
+
+type parquetRowGroup struct {
+	rows    int
+	offsets []int64
+	sizes   []int64
+}
+
+// MarshalParquet marshals metrics to Apache Parquet file with uncompressed PLAIN encoded pages. Rows are split into
+// row groups of parquetRowGroupRows, column chunks are split into pages of about parquetPageSize bytes.
+// NaN values are written as nulls. See metricsTable for the table layouts.
+func MarshalParquet(results []*MetricData, wide bool) []byte {
+	columns, rows := metricsTable(results, wide)
+
+	out := []byte(parquetMagic)
+	var rowGroups []parquetRowGroup
+	for start := 0; start < rows; start += parquetRowGroupRows {
+		end := min(start+parquetRowGroupRows, rows)
+		g := parquetRowGroup{rows: end - start, offsets: make([]int64, len(columns)), sizes: make([]int64, len(columns))}
+		for i := range columns {
+			g.offsets[i] = int64(len(out))
+			out = parquetColumnChunk(out, &columns[i], start, end)
+			g.sizes[i] = int64(len(out)) - g.offsets[i]
+		}
+		rowGroups = append(rowGroups, g)
+	}
+
+	w := &thriftWriter{}
+	w.structBegin()
+	w.i32Field(1, 1)
+
+	w.listField(2, thriftStruct, len(columns)+1)
+	w.structBegin()
+	w.stringField(4, "schema")
+	w.i32Field(5, int32(len(columns)))
+	w.structEnd()
+	for i := range columns {
+		parquetSchemaElement(w, &columns[i])
+	}
+
+	w.i64Field(3, int64(rows))
+
+	w.listField(4, thriftStruct, len(rowGroups))
+	for _, g := range rowGroups {
+		var totalSize int64
+		w.structBegin()
+		w.listField(1, thriftStruct, len(columns))
+		for i := range columns {
+			c := &columns[i]
+			w.structBegin()
+			w.i64Field(2, g.offsets[i])
+			w.structField(3)
+			w.i32Field(1, parquetPhysicalType(c.kind))
+			w.listField(2, thriftI32, 2)
+			w.zigzag(parquetEncodingPlain)
+			w.zigzag(parquetEncodingRLE)
+			w.listField(3, thriftBinary, 1)
+			w.binary(c.name)
+			w.i32Field(4, 0)
+			w.i64Field(5, int64(g.rows))
+			w.i64Field(6, g.sizes[i])
+			w.i64Field(7, g.sizes[i])
+			w.i64Field(9, g.offsets[i])
+			w.structEnd()
+			w.structEnd()
+			totalSize += g.sizes[i]
+		}
+		w.i64Field(2, totalSize)
+		w.i64Field(3, int64(g.rows))
+		w.structEnd()
+	}
+
+	w.stringField(6, "carbonapi")
+	w.structEnd()
+
+	out = append(out, w.buf...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(w.buf)))
+	return append(out, parquetMagic...)
+}
+
+func parquetPhysicalType(kind columnKind) int32 {
+	switch kind {
+	case stringColumn:
+		return parquetTypeByteArray
+	case timestampColumn:
+		return parquetTypeInt64
+	default:
+		return parquetTypeDouble
+	}
+}
+
+func parquetSchemaElement(w *thriftWriter, c *tableColumn) {
+	w.structBegin()
+	w.i32Field(1, parquetPhysicalType(c.kind))
+	if c.kind == doubleColumn {
+		w.i32Field(3, parquetOptional)
+	} else {
+		w.i32Field(3, parquetRequired)
+	}
+	w.stringField(4, c.name)
+	switch c.kind {
+	case stringColumn:
+		w.i32Field(6, parquetConvertedUTF8)
+		w.structField(10)
+		// STRING
+		w.structField(1)
+		w.structEnd()
+		w.structEnd()
+	case timestampColumn:
+		w.i32Field(6, parquetConvertedTimestampMillis)
+		w.structField(10)
+		// TIMESTAMP(isAdjustedToUTC=true, unit=MILLIS)
+		w.structField(8)
+		w.boolField(1, true)
+		w.structField(2)
+		w.structField(1)
+		w.structEnd()
+		w.structEnd()
+		w.structEnd()
+		w.structEnd()
+	}
+	w.structEnd()
+}
+
+// parquetColumnChunk appends pages with rows start..end of the column to out
+func parquetColumnChunk(out []byte, c *tableColumn, start, end int) []byte {
+	for from := start; from < end; {
+		to, size := from, 0
+		for to < end && size < parquetPageSize {
+			if c.kind == stringColumn {
+				size += 4 + len(c.strings[to])
+			} else {
+				size += 8
+			}
+			to++
+		}
+		out = parquetPage(out, c, from, to)
+		from = to
+	}
+	return out
+}
+
+// parquetPage appends data page with rows from..to of the column and its header to out
+func parquetPage(out []byte, c *tableColumn, from, to int) []byte {
+	var data []byte
+	switch c.kind {
+	case stringColumn:
+		for _, s := range c.strings[from:to] {
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(s)))
+			data = append(data, s...)
+		}
+	case timestampColumn:
+		for _, v := range c.ints[from:to] {
+			data = binary.LittleEndian.AppendUint64(data, uint64(v))
+		}
+	case doubleColumn:
+		floats := c.floats[from:to]
+		// definition levels of optional column, encoded as RLE runs with bit width 1 and prefixed with the length
+		var levels []byte
+		for i := 0; i < len(floats); {
+			defined := !math.IsNaN(floats[i])
+			j := i + 1
+			for j < len(floats) && !math.IsNaN(floats[j]) == defined {
+				j++
+			}
+			levels = binary.AppendUvarint(levels, uint64(j-i)<<1)
+			if defined {
+				levels = append(levels, 1)
+			} else {
+				levels = append(levels, 0)
+			}
+			i = j
+		}
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(levels)))
+		data = append(data, levels...)
+		for _, v := range floats {
+			if !math.IsNaN(v) {
+				data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+			}
+		}
+	}
+
+	w := &thriftWriter{buf: out}
+	w.structBegin()
+	w.i32Field(1, parquetPageData)
+	w.i32Field(2, int32(len(data)))
+	w.i32Field(3, int32(len(data)))
+	w.structField(5)
+	w.i32Field(1, int32(to-from))
+	w.i32Field(2, parquetEncodingPlain)
+	w.i32Field(3, parquetEncodingRLE)
+	w.i32Field(4, parquetEncodingRLE)
+	w.structEnd()
+	w.structEnd()
+
+	return append(w.buf, data...)
+}
@@ -0,0 +1,302 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// thriftReader is a minimal reader of thrift compact protocol, structs are read as maps by field id
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftBoolTrue:
+		return true
+	case thriftBoolFalse:
+		return false
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		r.pos += n
+		return string(r.buf[r.pos-n : r.pos])
+	case thriftList:
+		h := r.buf[r.pos]
+		r.pos++
+		size := int(h >> 4)
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			if h&0x0f == thriftBoolTrue {
+				list[i] = r.buf[r.pos] == 1
+				r.pos++
+			} else {
+				list[i] = r.value(h & 0x0f)
+			}
+		}
+		return list
+	case thriftStruct:
+		s := make(map[int16]interface{})
+		var id int16
+		for {
+			h := r.buf[r.pos]
+			r.pos++
+			if h == 0 {
+				return s
+			}
+			if delta := int16(h >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(r.zigzag())
+			}
+			s[id] = r.value(h & 0x0f)
+		}
+	}
+	panic("unsupported thrift type")
+}
+
+func decodeParquetFooter(t *testing.T, b []byte) map[int16]interface{} {
+	if string(b[:4]) != parquetMagic || string(b[len(b)-4:]) != parquetMagic {
+		t.Fatalf("parquet magic is missing")
+	}
+	size := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	r := &thriftReader{buf: b[len(b)-8-size : len(b)-8]}
+	meta := r.value(thriftStruct).(map[int16]interface{})
+	if r.pos != size {
+		t.Fatalf("footer is not fully read: %d of %d", r.pos, size)
+	}
+	return meta
+}
+
+// decodeParquetColumn returns values of the column from all row groups, nulls of optional column are NaN
+func decodeParquetColumn(t *testing.T, b []byte, meta map[int16]interface{}, column int, optional bool) []interface{} {
+	var values []interface{}
+	for _, g := range meta[4].([]interface{}) {
+		chunk := g.(map[int16]interface{})[1].([]interface{})[column].(map[int16]interface{})
+		chunkMeta := chunk[3].(map[int16]interface{})
+		r := &thriftReader{buf: b, pos: int(chunkMeta[9].(int64))}
+		for rows := 0; rows < int(chunkMeta[5].(int64)); {
+			header := r.value(thriftStruct).(map[int16]interface{})
+			page := b[r.pos : r.pos+int(header[3].(int64))]
+			r.pos += len(page)
+			n := int(header[5].(map[int16]interface{})[1].(int64))
+			values = append(values, decodeParquetPage(t, page, chunkMeta[1].(int64), n, optional)...)
+			rows += n
+		}
+		if size := int64(r.pos) - chunkMeta[9].(int64); size != chunkMeta[7].(int64) {
+			t.Errorf("unexpected size of column chunk: %d, want %d", size, chunkMeta[7])
+		}
+	}
+	return values
+}
+
+func decodeParquetPage(t *testing.T, page []byte, typ int64, rows int, optional bool) []interface{} {
+	defined := make([]bool, rows)
+	for i := range defined {
+		defined[i] = true
+	}
+	if optional {
+		levels := &thriftReader{buf: page[4 : 4+binary.LittleEndian.Uint32(page)]}
+		page = page[4+len(levels.buf):]
+		for i := 0; levels.pos < len(levels.buf); {
+			run := int(levels.varint() >> 1)
+			v := levels.buf[levels.pos]
+			levels.pos++
+			for j := 0; j < run; j++ {
+				defined[i] = v == 1
+				i++
+			}
+		}
+	}
+
+	var values []interface{}
+	for i := 0; i < rows; i++ {
+		if !defined[i] {
+			values = append(values, math.NaN())
+			continue
+		}
+		switch typ {
+		case parquetTypeByteArray:
+			n := binary.LittleEndian.Uint32(page)
+			values = append(values, string(page[4:4+n]))
+			page = page[4+n:]
+		case parquetTypeInt64:
+			values = append(values, int64(binary.LittleEndian.Uint64(page)))
+			page = page[8:]
+		case parquetTypeDouble:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(page)))
+			page = page[8:]
+		}
+	}
+	if len(page) != 0 {
+		t.Errorf("page is not fully read, %d bytes left", len(page))
+	}
+	return values
+}
+
+func floats(values []interface{}) []float64 {
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = v.(float64)
+	}
+	return res
+}
+
+func parquetTestResults() []*MetricData {
+	return []*MetricData{
+		MakeMetricData("metric1", []float64{1, math.NaN(), math.NaN(), 2}, 100, 100),
+		MakeMetricData("metric2;foo=bar", []float64{3}, 100, 200),
+	}
+}
+
+func TestParquetResponse(t *testing.T) {
+	results := parquetTestResults()
+
+	b := MarshalParquet(results, false)
+	meta := decodeParquetFooter(t, b)
+	if meta[3].(int64) != 5 {
+		t.Errorf("unexpected num_rows: %v", meta[3])
+	}
+
+	schema := meta[2].([]interface{})
+	var names []string
+	for _, e := range schema[1:] {
+		names = append(names, e.(map[int16]interface{})[4].(string))
+	}
+	if want := []string{"metric", "tags", "timestamp", "value"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("unexpected columns: got %v, want %v", names, want)
+	}
+	if repetition := schema[4].(map[int16]interface{})[3].(int64); repetition != parquetOptional {
+		t.Errorf("value column is not optional")
+	}
+	timestampType := schema[3].(map[int16]interface{})[10].(map[int16]interface{})[8].(map[int16]interface{})
+	if timestampType[1] != true {
+		t.Errorf("timestamp is not adjusted to UTC")
+	}
+
+	want := [][]interface{}{
+		{"metric1", "metric1", "metric1", "metric1", "metric2;foo=bar"},
+		{`{"name":"metric1"}`, `{"name":"metric1"}`, `{"name":"metric1"}`, `{"name":"metric1"}`, `{"foo":"bar","name":"metric2"}`},
+		{int64(100000), int64(200000), int64(300000), int64(400000), int64(200000)},
+	}
+	for i, w := range want {
+		if got := decodeParquetColumn(t, b, meta, i, false); !reflect.DeepEqual(got, w) {
+			t.Errorf("unexpected column %s: got %v, want %v", names[i], got, w)
+		}
+	}
+	values := floats(decodeParquetColumn(t, b, meta, 3, true))
+	if w := []float64{1, math.NaN(), math.NaN(), 2, 3}; !floatsEqual(values, w) {
+		t.Errorf("unexpected values: got %v, want %v", values, w)
+	}
+
+	b = MarshalParquet(results, true)
+	meta = decodeParquetFooter(t, b)
+	if meta[3].(int64) != 4 {
+		t.Errorf("unexpected wide num_rows: %v", meta[3])
+	}
+	if n := len(meta[2].([]interface{})) - 1; n != 3 {
+		t.Fatalf("unexpected wide columns: %d", n)
+	}
+	values = floats(decodeParquetColumn(t, b, meta, 2, true))
+	if w := []float64{math.NaN(), 3, math.NaN(), math.NaN()}; !floatsEqual(values, w) {
+		t.Errorf("unexpected wide values: got %v, want %v", values, w)
+	}
+}
+
+func TestParquetRowGroupsAndPages(t *testing.T) {
+	savedRows, savedSize := parquetRowGroupRows, parquetPageSize
+	defer func() { parquetRowGroupRows, parquetPageSize = savedRows, savedSize }()
+	parquetRowGroupRows, parquetPageSize = 2, 20
+
+	b := MarshalParquet(parquetTestResults(), false)
+	meta := decodeParquetFooter(t, b)
+	rowGroups := meta[4].([]interface{})
+	if len(rowGroups) != 3 {
+		t.Fatalf("unexpected row groups: %d", len(rowGroups))
+	}
+	var rows []int64
+	for _, g := range rowGroups {
+		rows = append(rows, g.(map[int16]interface{})[3].(int64))
+	}
+	if want := []int64{2, 2, 1}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("unexpected rows of row groups: got %v, want %v", rows, want)
+	}
+
+	// tags are longer than the page, so every value is in own page
+	tags := decodeParquetColumn(t, b, meta, 1, false)
+	if want := []interface{}{`{"name":"metric1"}`, `{"name":"metric1"}`, `{"name":"metric1"}`, `{"name":"metric1"}`, `{"foo":"bar","name":"metric2"}`}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("unexpected tags: got %v, want %v", tags, want)
+	}
+	if w, values := []float64{1, math.NaN(), math.NaN(), 2, 3}, floats(decodeParquetColumn(t, b, meta, 3, true)); !floatsEqual(values, w) {
+		t.Errorf("unexpected values: got %v, want %v", values, w)
+	}
+
+	b = MarshalParquet(nil, true)
+	meta = decodeParquetFooter(t, b)
+	if meta[3].(int64) != 0 || len(meta[4].([]interface{})) != 0 {
+		t.Errorf("unexpected empty file: %v", meta)
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestParquetGolden compares files with golden ones, which are checked by pyarrow, see testdata/check_parquet.py
+func TestParquetGolden(t *testing.T) {
+	savedRows, savedSize := parquetRowGroupRows, parquetPageSize
+	defer func() { parquetRowGroupRows, parquetPageSize = savedRows, savedSize }()
+
+	tests := []struct {
+		file         string
+		wide         bool
+		rowGroupRows int
+		pageSize     int
+	}{
+		{file: "long.parquet"},
+		{file: "wide.parquet", wide: true},
+		{file: "long_row_groups.parquet", rowGroupRows: 2, pageSize: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			parquetRowGroupRows, parquetPageSize = savedRows, savedSize
+			if tt.rowGroupRows != 0 {
+				parquetRowGroupRows, parquetPageSize = tt.rowGroupRows, tt.pageSize
+			}
+			b := MarshalParquet(parquetTestResults(), tt.wide)
+			golden := filepath.Join("testdata", tt.file)
+			if *update {
+				if err := os.WriteFile(golden, b, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, want) {
+				t.Errorf("file differs from %s, run tests with -update and check it with testdata/check_parquet.py", golden)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package types
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// PromSeriesKey returns identity of the series in Prometheus: metric name and labels
+func PromSeriesKey(name string, labels [][2]string) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, l := range labels {
+		sb.WriteByte(0)
+		sb.WriteString(l[0])
+		sb.WriteByte(0)
+		sb.WriteString(l[1])
+	}
+	return sb.String()
+}
+
+// MarshalRemoteWrite marshals metrics to Prometheus remote write WriteRequest protobuf (not compressed).
+// Name and tags of the series become labels like in MarshalOpenMetrics, NaN values are skipped.
+// Only points newer than the timestamp in since (in milliseconds, by PromSeriesKey) are written, timestamps of
+// the last written points are returned with count of written samples, so the caller can update since when the
+// request is accepted.
+func MarshalRemoteWrite(results []*MetricData, since map[string]int64) ([]byte, map[string]int64, int) {
+	var b, series, label []byte
+	last := make(map[string]int64)
+	total := 0
+	seen := make(map[string]bool)
+
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		name := PromSeriesName(r)
+		labels := PromLabels(r)
+		key := PromSeriesKey(name, labels)
+		if seen[key] {
+			// series with the same labels is already written
+			continue
+		}
+		seen[key] = true
+
+		labels = append(labels, [2]string{"__name__", name})
+		// labels should be sorted by name
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+		series = series[:0]
+		for _, l := range labels {
+			label = label[:0]
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l[0])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l[1])
+
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+
+		values, step := points(r)
+		ts := r.StartTime * 1000
+		after, hasSince := since[key]
+		samples := 0
+		for _, v := range values {
+			if !math.IsNaN(v) && (!hasSince || ts > after) {
+				var sample []byte
+				sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+				sample = protowire.AppendFixed64(sample, math.Float64bits(v))
+				sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+				sample = protowire.AppendVarint(sample, uint64(ts))
+
+				series = protowire.AppendTag(series, 2, protowire.BytesType)
+				series = protowire.AppendBytes(series, sample)
+				last[key] = ts
+				samples++
+			}
+			ts += step * 1000
+		}
+		if samples == 0 {
+			continue
+		}
+		total += samples
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, series)
+	}
+
+	return b, last, total
+}
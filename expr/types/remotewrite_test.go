@@ -0,0 +1,113 @@
+package types
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type remoteWriteSeries struct {
+	labels  [][2]string
+	samples [][2]float64
+}
+
+// decodeMessage returns fields of protobuf message by number, fixed64 and varint values are returned as uint64
+func decodeMessage(t *testing.T, b []byte) map[protowire.Number][]interface{} {
+	fields := make(map[protowire.Number][]interface{})
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		var v interface{}
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		if n < 0 {
+			t.Fatalf("invalid field %d: %v", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		fields[num] = append(fields[num], v)
+	}
+	return fields
+}
+
+func decodeRemoteWrite(t *testing.T, b []byte) []remoteWriteSeries {
+	var result []remoteWriteSeries
+	for _, ts := range decodeMessage(t, b)[1] {
+		var s remoteWriteSeries
+		fields := decodeMessage(t, ts.([]byte))
+		for _, l := range fields[1] {
+			label := decodeMessage(t, l.([]byte))
+			s.labels = append(s.labels, [2]string{string(label[1][0].([]byte)), string(label[2][0].([]byte))})
+		}
+		for _, smp := range fields[2] {
+			sample := decodeMessage(t, smp.([]byte))
+			s.samples = append(s.samples, [2]float64{math.Float64frombits(sample[1][0].(uint64)), float64(int64(sample[2][0].(uint64)))})
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestRemoteWrite(t *testing.T) {
+	results := []*MetricData{
+		MakeMetricData("foo.bar;host=a", []float64{1, math.NaN(), 3}, 60, 60),
+		MakeMetricData("foo.baz", []float64{math.NaN()}, 60, 60),
+		MakeMetricData("Load;host=b", []float64{4, 5}, 60, 60),
+	}
+
+	b, last, samples := MarshalRemoteWrite(results, nil)
+	want := []remoteWriteSeries{
+		{
+			labels:  [][2]string{{"__name__", "foo_bar"}, {"host", "a"}},
+			samples: [][2]float64{{1, 60000}, {3, 180000}},
+		},
+		{
+			labels:  [][2]string{{"__name__", "Load"}, {"host", "b"}},
+			samples: [][2]float64{{4, 60000}, {5, 120000}},
+		},
+	}
+	if got := decodeRemoteWrite(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected series:\ngot  %v\nwant %v", got, want)
+	}
+	if samples != 4 {
+		t.Errorf("unexpected samples count: got %d, want 4", samples)
+	}
+	wantLast := map[string]int64{
+		PromSeriesKey("foo_bar", [][2]string{{"host", "a"}}): 180000,
+		PromSeriesKey("Load", [][2]string{{"host", "b"}}):    120000,
+	}
+	if !reflect.DeepEqual(last, wantLast) {
+		t.Errorf("unexpected last timestamps: got %v, want %v", last, wantLast)
+	}
+
+	// only new points are written next time
+	results = append(results, MakeMetricData("foo.bar;host=a", []float64{7}, 60, 60))
+	b, last, samples = MarshalRemoteWrite(results, map[string]int64{PromSeriesKey("foo_bar", [][2]string{{"host", "a"}}): 60000, PromSeriesKey("Load", [][2]string{{"host", "b"}}): 120000})
+	want = []remoteWriteSeries{
+		{
+			labels:  [][2]string{{"__name__", "foo_bar"}, {"host", "a"}},
+			samples: [][2]float64{{3, 180000}},
+		},
+	}
+	if got := decodeRemoteWrite(t, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected series:\ngot  %v\nwant %v", got, want)
+	}
+	if samples != 1 {
+		t.Errorf("unexpected samples count: got %d, want 1", samples)
+	}
+	if len(last) != 1 {
+		t.Errorf("unexpected last timestamps: %v", last)
+	}
+}
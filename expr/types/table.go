@@ -0,0 +1,139 @@
+package types
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type columnKind int8
+
+const (
+	stringColumn columnKind = iota
+	// timestampColumn is a column of timestamps in milliseconds
+	timestampColumn
+	// doubleColumn is a nullable column of values, NaN is null
+	doubleColumn
+)
+
+// tableColumn is a column of the table representation of metrics, used by columnar formats
+type tableColumn struct {
+	name    string
+	kind    columnKind
+	strings []string
+	ints    []int64
+	floats  []float64
+}
+
+func (c *tableColumn) nulls() int {
+	n := 0
+	for _, v := range c.floats {
+		if math.IsNaN(v) {
+			n++
+		}
+	}
+	return n
+}
+
+// metricsTable returns metrics as a table. Long layout has metric, tags, timestamp and value columns with row per point.
+// Wide layout has timestamp column and value column per metric, points are aligned by timestamps.
+func metricsTable(results []*MetricData, wide bool) ([]tableColumn, int) {
+	if wide {
+		return wideTable(results)
+	}
+	return longTable(results)
+}
+
+// points returns values of the series and their step, consolidated values are used if series is consolidated
+func points(r *MetricData) ([]float64, int64) {
+	if r.ValuesPerPoint > 1 {
+		return r.AggregatedValues(), r.AggregatedTimeStep()
+	}
+	return r.Values, r.StepTime
+}
+
+func longTable(results []*MetricData) ([]tableColumn, int) {
+	rows := 0
+	for _, r := range results {
+		values, _ := points(r)
+		rows += len(values)
+	}
+	metric := tableColumn{name: "metric", kind: stringColumn, strings: make([]string, 0, rows)}
+	tags := tableColumn{name: "tags", kind: stringColumn, strings: make([]string, 0, rows)}
+	timestamp := tableColumn{name: "timestamp", kind: timestampColumn, ints: make([]int64, 0, rows)}
+	value := tableColumn{name: "value", kind: doubleColumn, floats: make([]float64, 0, rows)}
+
+	for _, r := range results {
+		// tags are encoded as JSON object with sorted keys
+		t := "{}"
+		if len(r.Tags) > 0 {
+			if b, err := json.Marshal(r.Tags); err == nil {
+				t = string(b)
+			}
+		}
+		values, step := points(r)
+		ts := r.StartTime
+		for _, v := range values {
+			metric.strings = append(metric.strings, r.Name)
+			tags.strings = append(tags.strings, t)
+			timestamp.ints = append(timestamp.ints, ts*1000)
+			value.floats = append(value.floats, v)
+			ts += step
+		}
+	}
+
+	return []tableColumn{metric, tags, timestamp, value}, rows
+}
+
+func wideTable(results []*MetricData) ([]tableColumn, int) {
+	seen := make(map[int64]struct{})
+	for _, r := range results {
+		values, step := points(r)
+		ts := r.StartTime
+		for range values {
+			seen[ts] = struct{}{}
+			ts += step
+		}
+	}
+	timestamps := make([]int64, 0, len(seen))
+	for ts := range seen {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	index := make(map[int64]int, len(timestamps))
+	for i, ts := range timestamps {
+		index[ts] = i
+	}
+
+	columns := make([]tableColumn, 0, len(results)+1)
+	timestamp := tableColumn{name: "timestamp", kind: timestampColumn, ints: make([]int64, len(timestamps))}
+	for i, ts := range timestamps {
+		timestamp.ints[i] = ts * 1000
+	}
+	columns = append(columns, timestamp)
+
+	names := map[string]int{"timestamp": 1}
+	for _, r := range results {
+		name := r.Name
+		// column names should be unique
+		if n := names[name]; n > 0 {
+			name += "#" + strconv.Itoa(n)
+		}
+		names[r.Name]++
+
+		c := tableColumn{name: name, kind: doubleColumn, floats: make([]float64, len(timestamps))}
+		for i := range c.floats {
+			c.floats[i] = math.NaN()
+		}
+		values, step := points(r)
+		ts := r.StartTime
+		for _, v := range values {
+			c.floats[index[ts]] = v
+			ts += step
+		}
+		columns = append(columns, c)
+	}
+
+	return columns, len(timestamps)
+}
@@ -0,0 +1,87 @@
+#!/usr/bin/env python3
+"""Checks golden parquet files of TestParquetGolden with pyarrow.
+
+Run it after golden files are updated by `go test ./expr/types/ -run TestParquetGolden -update`:
+
+    pip install pyarrow
+    python3 expr/types/testdata/check_parquet.py
+"""
+
+import datetime
+import os
+import sys
+
+import pyarrow as pa
+import pyarrow.parquet as pq
+
+TESTDATA = os.path.dirname(os.path.abspath(__file__))
+
+
+def ts(seconds):
+    return datetime.datetime.fromtimestamp(seconds, tz=datetime.timezone.utc)
+
+
+LONG = {
+    "schema": pa.schema([
+        pa.field("metric", pa.string(), nullable=False),
+        pa.field("tags", pa.string(), nullable=False),
+        pa.field("timestamp", pa.timestamp("ms", tz="UTC"), nullable=False),
+        pa.field("value", pa.float64()),
+    ]),
+    "rows": {
+        "metric": ["metric1"] * 4 + ["metric2;foo=bar"],
+        "tags": ['{"name":"metric1"}'] * 4 + ['{"foo":"bar","name":"metric2"}'],
+        "timestamp": [ts(100), ts(200), ts(300), ts(400), ts(200)],
+        "value": [1.0, None, None, 2.0, 3.0],
+    },
+}
+
+WIDE = {
+    "schema": pa.schema([
+        pa.field("timestamp", pa.timestamp("ms", tz="UTC"), nullable=False),
+        pa.field("metric1", pa.float64()),
+        pa.field("metric2;foo=bar", pa.float64()),
+    ]),
+    "rows": {
+        "timestamp": [ts(100), ts(200), ts(300), ts(400)],
+        "metric1": [1.0, None, None, 2.0],
+        "metric2;foo=bar": [None, 3.0, None, None],
+    },
+}
+
+FILES = {
+    "long.parquet": (LONG, 1),
+    "wide.parquet": (WIDE, 1),
+    "long_row_groups.parquet": (LONG, 3),
+}
+
+
+def check(name, want, row_groups):
+    path = os.path.join(TESTDATA, name)
+    f = pq.ParquetFile(path)
+    errors = []
+    if f.metadata.num_row_groups != row_groups:
+        errors.append("row groups: got %d, want %d" % (f.metadata.num_row_groups, row_groups))
+    table = f.read()
+    if not table.schema.equals(want["schema"]):
+        errors.append("schema: got\n%s\nwant\n%s" % (table.schema, want["schema"]))
+    got = table.to_pydict()
+    for column, values in want["rows"].items():
+        if got.get(column) != values:
+            errors.append("column %s: got %s, want %s" % (column, got.get(column), values))
+    return errors
+
+
+def main():
+    failed = False
+    for name, (want, row_groups) in FILES.items():
+        errors = check(name, want, row_groups)
+        print("%s: %s" % (name, "FAIL" if errors else "ok"))
+        for e in errors:
+            print("    " + e)
+        failed = failed or bool(errors)
+    sys.exit(1 if failed else 0)
+
+
+if __name__ == "__main__":
+    main()
@@ -52,32 +52,37 @@ func MarshalCSV(results []*MetricData) []byte {
 	b := make([]byte, 0, n)
 
 	for _, r := range results {
+		b = AppendCSVSeries(b, r)
+	}
+	return b
+}
 
-		step := r.StepTime
-		t := r.StartTime
-		for _, v := range r.Values {
-			b = append(b, '"')
-			b = append(b, r.Name...)
-			b = append(b, `",`...)
-			tm := time.Unix(t, 0).UTC()
-			b = strconv.AppendInt(b, int64(tm.Year()), 10)
-			b = append(b, '-')
-			b = appendInt2(b, int64(tm.Month()))
-			b = append(b, '-')
-			b = appendInt2(b, int64(tm.Day()))
-			b = append(b, ' ')
-			b = appendInt2(b, int64(tm.Hour()))
-			b = append(b, ':')
-			b = appendInt2(b, int64(tm.Minute()))
-			b = append(b, ':')
-			b = appendInt2(b, int64(tm.Second()))
-			b = append(b, ',')
-			if !math.IsNaN(v) {
-				b = strconv.AppendFloat(b, v, 'f', -1, 64)
-			}
-			b = append(b, '\n')
-			t += step
+// AppendCSVSeries appends CSV lines of the series to b
+func AppendCSVSeries(b []byte, r *MetricData) []byte {
+	step := r.StepTime
+	t := r.StartTime
+	for _, v := range r.Values {
+		b = append(b, '"')
+		b = append(b, r.Name...)
+		b = append(b, `",`...)
+		tm := time.Unix(t, 0).UTC()
+		b = strconv.AppendInt(b, int64(tm.Year()), 10)
+		b = append(b, '-')
+		b = appendInt2(b, int64(tm.Month()))
+		b = append(b, '-')
+		b = appendInt2(b, int64(tm.Day()))
+		b = append(b, ' ')
+		b = appendInt2(b, int64(tm.Hour()))
+		b = append(b, ':')
+		b = appendInt2(b, int64(tm.Minute()))
+		b = append(b, ':')
+		b = appendInt2(b, int64(tm.Second()))
+		b = append(b, ',')
+		if !math.IsNaN(v) {
+			b = strconv.AppendFloat(b, v, 'f', -1, 64)
 		}
+		b = append(b, '\n')
+		t += step
 	}
 	return b
 }
@@ -136,61 +141,68 @@ func MarshalJSON(results []*MetricData, timestampMultiplier int64, noNullPoints
 		}
 		topComma = true
 
-		b = append(b, `{"target":`...)
-		b = strconv.AppendQuoteToASCII(b, r.Name)
-		b = append(b, `,"datapoints":[`...)
+		b = AppendJSONSeries(b, r, timestampMultiplier, noNullPoints)
+	}
 
-		var innerComma bool
-		t := r.StartTime * timestampMultiplier
-		for _, v := range r.AggregatedValues() {
-			if noNullPoints && math.IsNaN(v) {
-				t += r.AggregatedTimeStep() * timestampMultiplier
-			} else {
-				if innerComma {
-					b = append(b, ',')
-				}
-				innerComma = true
+	b = append(b, ']')
 
-				b = append(b, '[')
+	return b
+}
 
-				if math.IsNaN(v) || math.IsInf(v, 1) || math.IsInf(v, -1) {
-					b = append(b, "null"...)
-				} else {
-					b = strconv.AppendFloat(b, v, 'f', -1, 64)
-				}
+// AppendJSONSeries appends series as JSON object of MarshalJSON output to b
+func AppendJSONSeries(b []byte, r *MetricData, timestampMultiplier int64, noNullPoints bool) []byte {
+	b = append(b, `{"target":`...)
+	b = strconv.AppendQuoteToASCII(b, r.Name)
+	b = append(b, `,"datapoints":[`...)
 
+	var innerComma bool
+	t := r.StartTime * timestampMultiplier
+	for _, v := range r.AggregatedValues() {
+		if noNullPoints && math.IsNaN(v) {
+			t += r.AggregatedTimeStep() * timestampMultiplier
+		} else {
+			if innerComma {
 				b = append(b, ',')
+			}
+			innerComma = true
 
-				b = strconv.AppendInt(b, t, 10)
-
-				b = append(b, ']')
+			b = append(b, '[')
 
-				t += r.AggregatedTimeStep() * timestampMultiplier
+			if math.IsNaN(v) || math.IsInf(v, 1) || math.IsInf(v, -1) {
+				b = append(b, "null"...)
+			} else {
+				b = strconv.AppendFloat(b, v, 'f', -1, 64)
 			}
-		}
 
-		b = append(b, `],"tags":{`...)
-		notFirstTag := false
-		responseTags := make([]string, 0, len(r.Tags))
-		for tag := range r.Tags {
-			responseTags = append(responseTags, tag)
-		}
-		sort.Strings(responseTags)
-		for _, tag := range responseTags {
-			v := r.Tags[tag]
-			if notFirstTag {
-				b = append(b, ',')
-			}
-			b = strconv.AppendQuoteToASCII(b, tag)
-			b = append(b, ':')
-			b = strconv.AppendQuoteToASCII(b, v)
-			notFirstTag = true
+			b = append(b, ',')
+
+			b = strconv.AppendInt(b, t, 10)
+
+			b = append(b, ']')
+
+			t += r.AggregatedTimeStep() * timestampMultiplier
 		}
+	}
 
-		b = append(b, `}}`...)
+	b = append(b, `],"tags":{`...)
+	notFirstTag := false
+	responseTags := make([]string, 0, len(r.Tags))
+	for tag := range r.Tags {
+		responseTags = append(responseTags, tag)
+	}
+	sort.Strings(responseTags)
+	for _, tag := range responseTags {
+		v := r.Tags[tag]
+		if notFirstTag {
+			b = append(b, ',')
+		}
+		b = strconv.AppendQuoteToASCII(b, tag)
+		b = append(b, ':')
+		b = strconv.AppendQuoteToASCII(b, v)
+		notFirstTag = true
 	}
 
-	b = append(b, ']')
+	b = append(b, `}}`...)
 
 	return b
 }
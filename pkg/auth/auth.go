@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	merry2 "github.com/ansel1/merry/v2"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnauthorized     = merry2.New("unauthorized", merry2.WithHTTPCode(http.StatusUnauthorized))
+	ErrUnknownAuthType  = merry2.New("unknown authentication type")
+	ErrInvalidPassword  = merry2.New("invalid password hash")
+	ErrInvalidToken     = merry2.New("invalid token", merry2.WithHTTPCode(http.StatusUnauthorized))
+	ErrUntrustedRequest = merry2.New("request is not from trusted proxy", merry2.WithHTTPCode(http.StatusUnauthorized))
+)
+
+// User is an authenticated user
+type User struct {
+	Name   string
+	Groups []string
+	// Scope is a set of metrics available to the user
+	Scope *Scope
+}
+
+type ctxKey struct{}
+
+// WithUser returns context with authenticated user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, ctxKey{}, user)
+}
+
+// UserFromContext returns authenticated user, nil if authentication is disabled
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(ctxKey{}).(*User)
+	return user
+}
+
+// ScopeFromContext returns scope of the authenticated user. Request without user has no access to metrics.
+func ScopeFromContext(ctx context.Context) *Scope {
+	if user := UserFromContext(ctx); user != nil && user.Scope != nil {
+		return user.Scope
+	}
+	return ScopeNone
+}
+
+// CacheKey returns suffix for cache keys of the responses, which depend on metrics available to the user.
+// It's empty if authentication is disabled or user has access to all metrics.
+func CacheKey(ctx context.Context) string {
+	if user := UserFromContext(ctx); user != nil {
+		return ScopeFromContext(ctx).Key()
+	}
+	return ""
+}
+
+// authenticator checks credentials of the request
+type authenticator interface {
+	// authenticate returns name and groups of the user
+	authenticate(r *http.Request) (string, []string, error)
+	// challenge returns value of WWW-Authenticate header for unauthenticated requests
+	challenge() string
+}
+
+// Auth authenticates requests and resolves metrics available to the users
+type Auth struct {
+	authenticator
+	rules  *rules
+	public map[string]struct{}
+	logger *zap.Logger
+}
+
+// New returns Auth for config, nil if authentication is disabled. Prefix is prepended to public paths.
+func New(logger *zap.Logger, cfg *Config, prefix string) (*Auth, error) {
+	a := &Auth{
+		public: make(map[string]struct{}),
+		logger: logger,
+	}
+
+	var err error
+	switch cfg.Type {
+	case TypeNone:
+		return nil, nil
+	case TypeHtpasswd:
+		a.authenticator, err = newHtpasswdAuthenticator(cfg.Htpasswd, cfg.Realm)
+	case TypeJWT:
+		a.authenticator, err = newJWTAuthenticator(&cfg.JWT)
+	case TypeHeader:
+		a.authenticator, err = newHeaderAuthenticator(&cfg.Header)
+	default:
+		return nil, merry2.Wrap(ErrUnknownAuthType, merry2.WithMessagef("unknown authentication type '%s', supported: %s", cfg.Type,
+			strings.Join([]string{TypeHtpasswd, TypeJWT, TypeHeader}, ", ")))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a.rules, err = newRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range cfg.Public {
+		a.public[prefix+path] = struct{}{}
+	}
+
+	return a, nil
+}
+
+// Middleware authenticates requests and adds user to their context. Requests to public paths and CORS preflight ones
+// are passed without authentication, but have no access to metrics.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := a.public[r.URL.Path]; ok || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), &User{Scope: ScopeNone})))
+			return
+		}
+
+		name, groups, err := a.authenticate(r)
+		if err != nil {
+			a.logger.Debug("authentication failed",
+				zap.String("url", r.URL.Path),
+				zap.String("peer", r.RemoteAddr),
+				zap.Error(err),
+			)
+			if c := a.challenge(); c != "" {
+				w.Header().Set("WWW-Authenticate", c)
+			}
+			code := merry2.HTTPCode(err)
+			if code != http.StatusForbidden {
+				code = http.StatusUnauthorized
+			}
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+
+		user := &User{
+			Name:   name,
+			Groups: groups,
+			Scope:  a.rules.scope(name, groups),
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
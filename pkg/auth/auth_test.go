@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+func TestMiddleware(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Type = TypeHeader
+	cfg.Header = HeaderConfig{User: "X-User", Groups: "X-Groups", TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1"}}
+	cfg.Rules = []Rule{{Groups: []string{"team_a"}, Allow: []string{"team_a"}}}
+	a, err := New(zap.NewNop(), &cfg, "/api")
+	require.NoError(t, err)
+
+	var user *User
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = UserFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name   string
+		path   string
+		remote string
+		header map[string]string
+		code   int
+		user   string
+		key    string
+	}{
+		{"authenticated", "/api/render", "10.1.2.3:1234", map[string]string{"X-User": "alice", "X-Groups": "team_a, dev"}, http.StatusOK, "alice", "team_a"},
+		{"no rules", "/api/render", "127.0.0.1:1234", map[string]string{"X-User": "bob"}, http.StatusOK, "bob", "-"},
+		{"untrusted", "/api/render", "192.168.0.1:1234", map[string]string{"X-User": "alice"}, http.StatusUnauthorized, "", ""},
+		{"no user", "/api/render", "10.1.2.3:1234", nil, http.StatusUnauthorized, "", ""},
+		{"public", "/api/lb_check", "192.168.0.1:1234", nil, http.StatusOK, "", "-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user = nil
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, tt.code, w.Code)
+			if tt.code != http.StatusOK {
+				assert.Nil(t, user)
+				return
+			}
+			require.NotNil(t, user)
+			assert.Equal(t, tt.user, user.Name)
+			assert.Equal(t, tt.key, CacheKey(WithUser(context.Background(), user)))
+		})
+	}
+
+	a, err = New(zap.NewNop(), &Config{}, "")
+	assert.NoError(t, err)
+	assert.Nil(t, a)
+
+	_, err = New(zap.NewNop(), &Config{Type: "ldap"}, "")
+	assert.ErrorIs(t, err, ErrUnknownAuthType)
+}
+
+type testZipper struct {
+	tagQuery   string
+	findSeries []string
+	paths      []string
+	// queries are globs of the last find or render request
+	queries []string
+}
+
+func (z *testZipper) Find(ctx context.Context, request pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
+	z.queries = request.Metrics
+	return &pb.MultiGlobResponse{Metrics: []pb.GlobResponse{{
+		Name: request.Metrics[0],
+		Matches: []pb.GlobMatch{
+			{Path: "team_a", IsLeaf: false},
+			{Path: "team_b", IsLeaf: false},
+			{Path: "team_a.cpu", IsLeaf: true},
+			{Path: "other", IsLeaf: true},
+		},
+	}}}, new(zipperTypes.Stats), nil
+}
+
+func (z *testZipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, merry.Error) {
+	res := &pb.ZipperInfoResponse{Info: map[string]pb.MultiMetricsInfoResponse{}}
+	for _, m := range metrics {
+		res.Info["server"] = pb.MultiMetricsInfoResponse{Metrics: append(res.Info["server"].Metrics, pb.MetricsInfoResponse{Name: m})}
+	}
+	return res, new(zipperTypes.Stats), nil
+}
+
+func (z *testZipper) render() []*types.MetricData {
+	return []*types.MetricData{
+		types.MakeMetricData("team_a.cpu", []float64{1}, 1, 0),
+		types.MakeMetricData("team_b.cpu;dc=1", []float64{1}, 1, 0),
+		types.MakeMetricData("team_a.mem;dc=1", []float64{1}, 1, 0),
+	}
+}
+
+func (z *testZipper) RenderCompat(ctx context.Context, metrics []string, from, until int64) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	return z.render(), new(zipperTypes.Stats), nil
+}
+
+func (z *testZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	z.queries = nil
+	for _, m := range request.Metrics {
+		z.queries = append(z.queries, m.Name)
+	}
+	return z.render(), new(zipperTypes.Stats), nil
+}
+
+func (z *testZipper) TagNames(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	z.tagQuery = query
+	return []string{"dc", "name"}, new(zipperTypes.Stats), nil
+}
+
+func (z *testZipper) TagValues(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	z.tagQuery = query
+	return []string{"team_a.cpu", "team_b.cpu"}, new(zipperTypes.Stats), nil
+}
+
+func (z *testZipper) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	z.findSeries = exprs
+	return []string{"team_a.cpu;dc=1", "team_b.cpu;dc=1"}, nil
+}
+
+func (z *testZipper) TagDetails(ctx context.Context, tag, filter string) (*zipperTypes.TagDetails, merry.Error) {
+	return &zipperTypes.TagDetails{Tag: tag, Values: []zipperTypes.TagValue{{Count: 1, Value: "team_a.cpu"}, {Count: 1, Value: "team_b.cpu"}}}, nil
+}
+
+func (z *testZipper) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	z.paths = paths
+	return paths, nil
+}
+
+func (z *testZipper) DelSeries(ctx context.Context, paths []string) merry.Error {
+	z.paths = paths
+	return nil
+}
+
+func (z *testZipper) ScaleToCommonStep() bool {
+	return false
+}
+
+func metricNames(metrics []*types.MetricData) []string {
+	res := make([]string, len(metrics))
+	for i, m := range metrics {
+		res[i] = m.Name
+	}
+	return res
+}
+
+func TestZipper(t *testing.T) {
+	scope, err := NewScope([]string{"team_a"})
+	require.NoError(t, err)
+	ctx := WithUser(context.Background(), &User{Name: "alice", Scope: scope})
+	tz := &testZipper{}
+	z := NewZipper(tz)
+
+	find, _, err := z.Find(ctx, pb.MultiGlobRequest{Metrics: []string{"*"}})
+	require.NoError(t, err)
+	assert.Equal(t, []pb.GlobMatch{{Path: "team_a"}, {Path: "team_a.cpu", IsLeaf: true}}, find.Metrics[0].Matches)
+
+	info, _, err := z.Info(ctx, []string{"team_a.cpu", "team_b.cpu"})
+	require.NoError(t, err)
+	assert.Equal(t, []pb.MetricsInfoResponse{{Name: "team_a.cpu"}}, info.Info["server"].Metrics)
+
+	// queries, which can't match allowed metrics, aren't sent to backends
+	find, _, err = z.Find(ctx, pb.MultiGlobRequest{Metrics: []string{"team_b.*", "*.cpu"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*.cpu"}, tz.queries)
+	require.Len(t, find.Metrics, 2)
+	assert.Equal(t, "team_b.*", find.Metrics[1].Name)
+	assert.Empty(t, find.Metrics[1].Matches)
+	tz.queries = nil
+	find, _, err = z.Find(ctx, pb.MultiGlobRequest{Metrics: []string{"team_b.*"}})
+	require.NoError(t, err)
+	assert.Nil(t, tz.queries)
+	require.Len(t, find.Metrics, 1)
+	assert.Empty(t, find.Metrics[0].Matches)
+
+	render, _, err := z.Render(ctx, pb.MultiFetchRequest{Metrics: []pb.FetchRequest{
+		{Name: "team_a.cpu"},
+		{Name: "team_b.cpu"},
+		{Name: "seriesByTag('dc=1')"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team_a.cpu", "team_a.mem;dc=1"}, metricNames(render))
+	assert.Equal(t, []string{"team_a.cpu", "seriesByTag('dc=1')"}, tz.queries)
+	tz.queries = nil
+	render, _, err = z.Render(ctx, pb.MultiFetchRequest{Metrics: []pb.FetchRequest{{Name: "team_b.cpu"}}})
+	require.NoError(t, err)
+	assert.Empty(t, render)
+	assert.Nil(t, tz.queries)
+
+	render, _, err = z.RenderCompat(WithUser(context.Background(), &User{Scope: ScopeAll}), nil, 0, 1)
+	require.NoError(t, err)
+	assert.Len(t, render, 3)
+
+	_, _, err = z.TagNames(ctx, "tagPrefix=d", -1)
+	require.NoError(t, err)
+	q, _ := url.ParseQuery(tz.tagQuery)
+	assert.Equal(t, []string{`name=~^(?:team_a)(?:\..*)?$`}, q["expr"])
+
+	values, _, err := z.TagValues(ctx, "tag=name", -1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team_a.cpu"}, values)
+
+	series, err := z.FindSeries(ctx, []string{"dc=1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team_a.cpu;dc=1"}, series)
+	assert.Equal(t, []string{"dc=1", `name=~^(?:team_a)(?:\..*)?$`}, tz.findSeries)
+
+	details, err := z.TagDetails(ctx, "name", "")
+	require.NoError(t, err)
+	assert.Equal(t, []zipperTypes.TagValue{{Count: 1, Value: "team_a.cpu"}}, details.Values)
+	_, err = z.TagDetails(ctx, "dc", "")
+	assert.ErrorIs(t, err, zipperTypes.ErrForbidden)
+
+	_, err = z.TagSeries(ctx, []string{"team_a.cpu;dc=1", "team_b.cpu;dc=1"})
+	assert.ErrorIs(t, err, zipperTypes.ErrForbidden)
+	assert.Nil(t, tz.paths)
+	err = z.DelSeries(ctx, []string{"team_a.cpu;dc=1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team_a.cpu;dc=1"}, tz.paths)
+}
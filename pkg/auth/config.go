@@ -0,0 +1,76 @@
+package auth
+
+import "time"
+
+const (
+	TypeNone     = ""
+	TypeHtpasswd = "htpasswd"
+	TypeJWT      = "jwt"
+	TypeHeader   = "header"
+)
+
+// Config describes authentication of the users and rules to authorize them to access metrics
+type Config struct {
+	// Type is an authentication method: htpasswd, jwt or header. Authentication is disabled if it's empty.
+	Type string `mapstructure:"type"`
+	// Realm is sent to the client with basic authentication challenge
+	Realm string `mapstructure:"realm"`
+	// Htpasswd is a path to the htpasswd file
+	Htpasswd string       `mapstructure:"htpasswd"`
+	JWT      JWTConfig    `mapstructure:"jwt"`
+	Header   HeaderConfig `mapstructure:"header"`
+
+	// Groups are static groups with lists of their members, used in addition to groups provided by authentication method
+	Groups map[string][]string `mapstructure:"groups"`
+	// Rules grant users and groups access to metrics
+	Rules []Rule `mapstructure:"rules"`
+	// Public are paths (without prefix), available without authentication, e.x. /lb_check
+	Public []string `mapstructure:"public"`
+}
+
+// JWTConfig describes validation of the bearer tokens
+type JWTConfig struct {
+	// JWKS is a path to the file with JSON Web Key Set, which is used to check tokens signatures
+	JWKS string `mapstructure:"jwks"`
+	// Issuer must match iss claim, if set
+	Issuer string `mapstructure:"issuer"`
+	// Audience must be one of aud claim values, if set
+	Audience string `mapstructure:"audience"`
+	// UsernameClaim is a claim with the name of user, sub by default
+	UsernameClaim string `mapstructure:"usernameClaim"`
+	// GroupsClaim is a claim with the list of user groups, groups by default
+	GroupsClaim string `mapstructure:"groupsClaim"`
+	// Leeway is allowed clock skew when exp and nbf claims are checked
+	Leeway time.Duration `mapstructure:"leeway"`
+}
+
+// HeaderConfig describes authentication by the headers, set by trusted authenticating proxy
+type HeaderConfig struct {
+	// User is a header with the name of user
+	User string `mapstructure:"user"`
+	// Groups is a header with comma-separated list of user groups
+	Groups string `mapstructure:"groups"`
+	// TrustedProxies are CIDRs of proxies, which are allowed to set headers. Headers from any address are trusted if it's empty.
+	TrustedProxies []string `mapstructure:"trustedProxies"`
+}
+
+// Rule allows users and members of groups to access metrics, which names start with one of glob prefixes
+type Rule struct {
+	Users  []string `mapstructure:"users"`
+	Groups []string `mapstructure:"groups"`
+	// Allow are glob prefixes of metric names, e.x. "team_a.*.cpu" grants access to "team_a.host1.cpu.user", "*" grants access to all metrics
+	Allow []string `mapstructure:"allow"`
+}
+
+// DefaultConfig returns default values of authentication config
+func DefaultConfig() Config {
+	return Config{
+		Realm: "carbonapi",
+		JWT: JWTConfig{
+			UsernameClaim: "sub",
+			GroupsClaim:   "groups",
+			Leeway:        time.Minute,
+		},
+		Public: []string{"/lb_check", "/version", "/version/"},
+	}
+}
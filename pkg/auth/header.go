@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	merry2 "github.com/ansel1/merry/v2"
+)
+
+// headerAuthenticator trusts user and groups from the headers, set by authenticating proxy
+type headerAuthenticator struct {
+	user    string
+	groups  string
+	trusted []*net.IPNet
+}
+
+func newHeaderAuthenticator(cfg *HeaderConfig) (*headerAuthenticator, error) {
+	if cfg.User == "" {
+		return nil, merry2.New("user header is not set")
+	}
+	a := &headerAuthenticator{
+		user:   cfg.User,
+		groups: cfg.Groups,
+	}
+	for _, cidr := range cfg.TrustedProxies {
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, merry2.Prepend(err, "invalid trusted proxy")
+		}
+		a.trusted = append(a.trusted, ipNet)
+	}
+	return a, nil
+}
+
+func (a *headerAuthenticator) isTrusted(remoteAddr string) bool {
+	if len(a.trusted) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range a.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *headerAuthenticator) authenticate(r *http.Request) (string, []string, error) {
+	if !a.isTrusted(r.RemoteAddr) {
+		return "", nil, merry2.Wrap(ErrUntrustedRequest, merry2.WithMessagef("request from %s is not trusted", r.RemoteAddr))
+	}
+	user := strings.TrimSpace(r.Header.Get(a.user))
+	if user == "" {
+		return "", nil, ErrUnauthorized
+	}
+	var groups []string
+	if a.groups != "" {
+		for _, g := range strings.Split(r.Header.Get(a.groups), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return user, groups, nil
+}
+
+func (a *headerAuthenticator) challenge() string {
+	return ""
+}
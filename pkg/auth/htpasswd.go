@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	merry2 "github.com/ansel1/merry/v2"
+)
+
+// htpasswdAuthenticator checks basic authentication credentials against htpasswd file.
+// Supported password formats are SHA1 ({SHA}), Apache MD5 ($apr1$), SHA-256 ($5$) and SHA-512 ($6$) crypt.
+type htpasswdAuthenticator struct {
+	users map[string]string
+	realm string
+}
+
+func newHtpasswdAuthenticator(path, realm string) (*htpasswdAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, merry2.Prepend(err, "failed to open htpasswd file")
+	}
+	defer f.Close()
+
+	a := &htpasswdAuthenticator{
+		users: make(map[string]string),
+		realm: realm,
+	}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		user, hash, ok := strings.Cut(s, ":")
+		if !ok || user == "" {
+			return nil, merry2.Errorf("htpasswd %s:%d: invalid line", path, line)
+		}
+		if !htpasswdSupported(hash) {
+			return nil, merry2.Wrap(ErrInvalidPassword, merry2.WithMessagef("htpasswd %s:%d: unsupported password format of user %s, use SHA-256, SHA-512, MD5 or SHA1", path, line, user))
+		}
+		a.users[user] = hash
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, merry2.Prepend(err, "failed to read htpasswd file")
+	}
+
+	return a, nil
+}
+
+func htpasswdSupported(hash string) bool {
+	for _, prefix := range []string{"{SHA}", "$apr1$", "$5$", "$6$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *htpasswdAuthenticator) authenticate(r *http.Request) (string, []string, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", nil, ErrUnauthorized
+	}
+	hash, ok := a.users[user]
+	if !ok || !htpasswdVerify(hash, password) {
+		return "", nil, merry2.Wrap(ErrUnauthorized, merry2.WithMessagef("invalid password of user %s", user))
+	}
+	return user, nil, nil
+}
+
+func (a *htpasswdAuthenticator) challenge() string {
+	return `Basic realm="` + a.realm + `"`
+}
+
+// htpasswdVerify checks password against hash from htpasswd file
+func htpasswdVerify(hash, password string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, "$apr1$"):
+		computed = md5Crypt(password, hash)
+	case strings.HasPrefix(hash, "$5$"):
+		computed = shaCrypt(password, hash, "$5$", sha256.New, sha256Perm, sha256Tail)
+	case strings.HasPrefix(hash, "$6$"):
+		computed = shaCrypt(password, hash, "$6$", sha512.New, sha512Perm, sha512Tail)
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(computed)) == 1
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptEncode encodes digest with crypt(3) base64 in order of perm triples, tail bytes are encoded last
+func cryptEncode(sb *strings.Builder, digest []byte, perm [][3]int, tail []int) {
+	encode := func(w uint, n int) {
+		for i := 0; i < n; i++ {
+			sb.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	for _, p := range perm {
+		encode(uint(digest[p[0]])<<16|uint(digest[p[1]])<<8|uint(digest[p[2]]), 4)
+	}
+	var w uint
+	for _, i := range tail {
+		w = w<<8 | uint(digest[i])
+	}
+	encode(w, len(tail)+1)
+}
+
+// cryptSalt returns salt from the hash after magic prefix, limited by size
+func cryptSalt(hash string, size int) string {
+	salt, _, _ := strings.Cut(hash, "$")
+	if len(salt) > size {
+		salt = salt[:size]
+	}
+	return salt
+}
+
+var (
+	md5Perm = [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}}
+	md5Tail = []int{11}
+)
+
+// md5Crypt computes Apache MD5 ($apr1$) hash of password with the salt from hash
+func md5Crypt(password, hash string) string {
+	const magic = "$apr1$"
+	salt := cryptSalt(hash[len(magic):], 8)
+	pw := []byte(password)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(salt))
+	d.Write(pw)
+	mixin := d.Sum(nil)
+
+	d.Reset()
+	d.Write(pw)
+	d.Write([]byte(magic))
+	d.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		d.Write(mixin[:min(16, i)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d.Reset()
+		if i&1 == 1 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 == 1 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(final[:0])
+	}
+
+	var sb strings.Builder
+	sb.WriteString(magic + salt + "$")
+	cryptEncode(&sb, final, md5Perm, md5Tail)
+	return sb.String()
+}
+
+var (
+	sha256Perm = [][3]int{{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14}, {15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29}}
+	sha256Tail = []int{31, 30}
+	sha512Perm = [][3]int{{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41}}
+	sha512Tail = []int{63}
+)
+
+// shaCrypt computes SHA-256 ($5$) or SHA-512 ($6$) crypt hash of password with the salt and rounds from hash
+func shaCrypt(password, hash, magic string, newHash func() hash.Hash, perm [][3]int, tail []int) string {
+	const (
+		roundsPrefix  = "rounds="
+		defaultRounds = 5000
+	)
+	rest := hash[len(magic):]
+	rounds := defaultRounds
+	customRounds := false
+	if strings.HasPrefix(rest, roundsPrefix) {
+		if r, after, ok := strings.Cut(rest[len(roundsPrefix):], "$"); ok {
+			if n, err := strconv.Atoi(r); err == nil {
+				rounds = min(max(n, 1000), 999999999)
+				customRounds = true
+				rest = after
+			}
+		}
+	}
+	salt := []byte(cryptSalt(rest, 16))
+	pw := []byte(password)
+
+	d := newHash()
+	d.Write(pw)
+	d.Write(salt)
+	d.Write(pw)
+	b := d.Sum(nil)
+	size := len(b)
+
+	d.Reset()
+	d.Write(pw)
+	d.Write(salt)
+	for i := len(pw); i > 0; i -= size {
+		d.Write(b[:min(size, i)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write(b)
+		} else {
+			d.Write(pw)
+		}
+	}
+	a := d.Sum(nil)
+
+	d.Reset()
+	for i := 0; i < len(pw); i++ {
+		d.Write(pw)
+	}
+	dp := d.Sum(nil)
+	p := make([]byte, 0, len(pw))
+	for i := len(pw); i > 0; i -= size {
+		p = append(p, dp[:min(size, i)]...)
+	}
+
+	d.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		d.Write(salt)
+	}
+	ds := d.Sum(nil)
+	s := make([]byte, 0, len(salt))
+	for i := len(salt); i > 0; i -= size {
+		s = append(s, ds[:min(size, i)]...)
+	}
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		d.Reset()
+		if i&1 == 1 {
+			d.Write(p)
+		} else {
+			d.Write(c)
+		}
+		if i%3 != 0 {
+			d.Write(s)
+		}
+		if i%7 != 0 {
+			d.Write(p)
+		}
+		if i&1 == 1 {
+			d.Write(c)
+		} else {
+			d.Write(p)
+		}
+		c = d.Sum(c[:0])
+	}
+
+	var sb strings.Builder
+	sb.WriteString(magic)
+	if customRounds {
+		sb.WriteString(roundsPrefix + strconv.Itoa(rounds) + "$")
+	}
+	sb.Write(salt)
+	sb.WriteByte('$')
+	cryptEncode(&sb, c, perm, tail)
+	return sb.String()
+}
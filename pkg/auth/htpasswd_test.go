@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHtpasswdVerify(t *testing.T) {
+	tests := []struct {
+		hash     string
+		password string
+	}{
+		{"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "secret"},
+		{"$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/", "myPassword"},
+		{"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!"},
+		{"$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!"},
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hash, func(t *testing.T) {
+			assert.True(t, htpasswdVerify(tt.hash, tt.password))
+			assert.False(t, htpasswdVerify(tt.hash, tt.password+"x"))
+		})
+	}
+}
+
+func TestHtpasswdAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "htpasswd")
+	require.NoError(t, os.WriteFile(path, []byte("# users\nalice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/\n\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0600))
+
+	a, err := newHtpasswdAuthenticator(path, "test")
+	require.NoError(t, err)
+	assert.Equal(t, `Basic realm="test"`, a.challenge())
+
+	r := httptest.NewRequest("GET", "/render", nil)
+	_, _, err = a.authenticate(r)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	r.SetBasicAuth("alice", "myPassword")
+	user, _, err := a.authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user)
+
+	r.SetBasicAuth("bob", "myPassword")
+	_, _, err = a.authenticate(r)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	require.NoError(t, os.WriteFile(path, []byte("carol:$2y$05$Xk0Z3xH5Wq3JY6cZ0oCk9eM7m2l8Q0W1o8v6n3l9s1y2a3b4c5d6e\n"), 0600))
+	_, err = newHtpasswdAuthenticator(path, "test")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+}
@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	merry2 "github.com/ansel1/merry/v2"
+)
+
+// jwtAuthenticator checks bearer tokens, signed with RSA or ECDSA keys from JWKS file.
+// Symmetric and unsigned tokens are not accepted.
+type jwtAuthenticator struct {
+	cfg JWTConfig
+	now func() time.Time
+
+	mu    sync.RWMutex
+	keys  map[string]crypto.PublicKey
+	mtime time.Time
+}
+
+func newJWTAuthenticator(cfg *JWTConfig) (*jwtAuthenticator, error) {
+	if cfg.JWKS == "" {
+		return nil, merry2.New("jwks file is not set")
+	}
+	a := &jwtAuthenticator{
+		cfg: *cfg,
+		now: time.Now,
+	}
+	if a.cfg.UsernameClaim == "" {
+		a.cfg.UsernameClaim = "sub"
+	}
+	if err := a.loadKeys(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadKeys reads keys from JWKS file if it was modified since last load
+func (a *jwtAuthenticator) loadKeys() error {
+	fi, err := os.Stat(a.cfg.JWKS)
+	if err != nil {
+		return merry2.Prepend(err, "failed to read jwks file")
+	}
+	a.mu.RLock()
+	modified := !fi.ModTime().Equal(a.mtime)
+	a.mu.RUnlock()
+	if !modified {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.cfg.JWKS)
+	if err != nil {
+		return merry2.Prepend(err, "failed to read jwks file")
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return merry2.Prepend(err, "failed to parse jwks file")
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return merry2.Prepend(err, "invalid key "+k.Kid+" in jwks file")
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.mtime = fi.ModTime()
+	a.mu.Unlock()
+
+	return nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// publicKey returns key for RSA and EC keys, nil for other key types
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, merry2.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, merry2.New("unsupported curve " + k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, merry2.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, nil
+}
+
+// key returns key by its id, JWKS file is reloaded for unknown keys to pick up key rotation
+func (a *jwtAuthenticator) key(kid string) (crypto.PublicKey, bool) {
+	a.mu.RLock()
+	key, ok := a.keys[kid]
+	a.mu.RUnlock()
+	if ok {
+		return key, true
+	}
+	if err := a.loadKeys(); err != nil {
+		return nil, false
+	}
+	a.mu.RLock()
+	key, ok = a.keys[kid]
+	a.mu.RUnlock()
+	return key, ok
+}
+
+func invalidToken(format string, args ...interface{}) error {
+	return merry2.Wrap(ErrInvalidToken, merry2.WithMessagef(format, args...))
+}
+
+func (a *jwtAuthenticator) authenticate(r *http.Request) (string, []string, error) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", nil, ErrUnauthorized
+	}
+	claims, err := a.verify(strings.TrimSpace(header[7:]))
+	if err != nil {
+		return "", nil, err
+	}
+
+	user, _ := claims[a.cfg.UsernameClaim].(string)
+	if user == "" {
+		return "", nil, invalidToken("claim %s is empty", a.cfg.UsernameClaim)
+	}
+	var groups []string
+	if a.cfg.GroupsClaim != "" {
+		switch v := claims[a.cfg.GroupsClaim].(type) {
+		case string:
+			groups = []string{v}
+		case []interface{}:
+			for _, g := range v {
+				if s, ok := g.(string); ok {
+					groups = append(groups, s)
+				}
+			}
+		}
+	}
+
+	return user, groups, nil
+}
+
+func (a *jwtAuthenticator) challenge() string {
+	return "Bearer"
+}
+
+// verify checks signature and registered claims of the token and returns its claims
+func (a *jwtAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("malformed header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature: %v", err)
+	}
+	key, ok := a.key(header.Kid)
+	if !ok {
+		return nil, invalidToken("unknown key '%s'", header.Kid)
+	}
+	if err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken("malformed claims: %v", err)
+	}
+
+	now := a.now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(a.cfg.Leeway)) {
+		return nil, invalidToken("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-a.cfg.Leeway)) {
+		return nil, invalidToken("token is not valid yet")
+	}
+	if a.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.cfg.Issuer {
+			return nil, invalidToken("invalid issuer '%s'", iss)
+		}
+	}
+	if a.cfg.Audience != "" && !hasAudience(claims["aud"], a.cfg.Audience) {
+		return nil, invalidToken("invalid audience")
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature checks signature of RS*, PS* and ES* algorithms
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return invalidToken("unsupported algorithm '%s'", alg)
+	}
+	var h crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return invalidToken("unsupported algorithm '%s'", alg)
+	}
+	hasher := h.New()
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	var valid bool
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalidToken("key type doesn't match algorithm '%s'", alg)
+		}
+		if alg[0] == 'R' {
+			valid = rsa.VerifyPKCS1v15(pub, h, digest, sig) == nil
+		} else {
+			valid = rsa.VerifyPSS(pub, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return invalidToken("key type doesn't match algorithm '%s'", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return invalidToken("invalid signature size")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		valid = ecdsa.Verify(pub, digest, r, s)
+	default:
+		return invalidToken("unsupported algorithm '%s'", alg)
+	}
+	if !valid {
+		return invalidToken("invalid signature")
+	}
+	return nil
+}
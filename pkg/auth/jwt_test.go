@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(header) + "." + b64(payload)
+
+	h := crypto.SHA256
+	d := h.New()
+	d.Write([]byte(signed))
+	digest := d.Sum(nil)
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg == "PS256" {
+			sig, err = rsa.SignPSS(rand.Reader, k, h, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, h, digest)
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	require.NoError(t, err)
+
+	return signed + "." + b64(sig)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rotatedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	ecJWK := func(kid string, k *ecdsa.PrivateKey) map[string]string {
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+	}
+	keys := []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		ecJWK("ec", ecKey),
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeKeys := func() {
+		data, err := json.Marshal(map[string]interface{}{"keys": keys})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0600))
+	}
+	writeKeys()
+
+	now := time.Unix(1700000000, 0)
+	a, err := newJWTAuthenticator(&JWTConfig{
+		JWKS:          path,
+		Issuer:        "idp",
+		Audience:      "carbonapi",
+		UsernameClaim: "sub",
+		GroupsClaim:   "groups",
+		Leeway:        time.Minute,
+	})
+	require.NoError(t, err)
+	a.now = func() time.Time { return now }
+
+	claims := func(override map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":    "alice",
+			"iss":    "idp",
+			"aud":    []string{"grafana", "carbonapi"},
+			"exp":    now.Add(time.Hour).Unix(),
+			"nbf":    now.Add(-time.Hour).Unix(),
+			"groups": []string{"ops", "dev"},
+		}
+		for k, v := range override {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		token  func() string
+		user   string
+		groups []string
+		err    error
+	}{
+		{"RS256", func() string { return signToken(t, "RS256", "rsa", rsaKey, claims(nil)) }, "alice", []string{"ops", "dev"}, nil},
+		{"PS256", func() string { return signToken(t, "PS256", "rsa", rsaKey, claims(nil)) }, "alice", []string{"ops", "dev"}, nil},
+		{"ES256", func() string {
+			return signToken(t, "ES256", "ec", ecKey, claims(map[string]interface{}{"groups": "ops"}))
+		}, "alice", []string{"ops"}, nil},
+		{"expired within leeway", func() string {
+			return signToken(t, "ES256", "ec", ecKey, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}))
+		}, "alice", []string{"ops", "dev"}, nil},
+		{"expired", func() string {
+			return signToken(t, "ES256", "ec", ecKey, claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}))
+		}, "", nil, ErrInvalidToken},
+		{"not valid yet", func() string {
+			return signToken(t, "ES256", "ec", ecKey, claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()}))
+		}, "", nil, ErrInvalidToken},
+		{"wrong issuer", func() string {
+			return signToken(t, "ES256", "ec", ecKey, claims(map[string]interface{}{"iss": "other"}))
+		}, "", nil, ErrInvalidToken},
+		{"wrong audience", func() string {
+			return signToken(t, "ES256", "ec", ecKey, claims(map[string]interface{}{"aud": "grafana"}))
+		}, "", nil, ErrInvalidToken},
+		{"no user", func() string { return signToken(t, "ES256", "ec", ecKey, claims(map[string]interface{}{"sub": nil})) }, "", nil, ErrInvalidToken},
+		{"wrong key", func() string { return signToken(t, "ES256", "ec", rotatedKey, claims(nil)) }, "", nil, ErrInvalidToken},
+		{"key type mismatch", func() string { return signToken(t, "RS256", "ec", rsaKey, claims(nil)) }, "", nil, ErrInvalidToken},
+		{"unknown key", func() string { return signToken(t, "ES256", "unknown", ecKey, claims(nil)) }, "", nil, ErrInvalidToken},
+		{"hmac", func() string { return signToken(t, "HS256", "hmac", ecKey, claims(nil)) }, "", nil, ErrInvalidToken},
+		{"none", func() string {
+			token := signToken(t, "ES256", "ec", ecKey, claims(nil))
+			header := b64([]byte(`{"alg":"none","kid":"ec"}`))
+			return header + token[len(b64([]byte(`{"alg":"ES256","kid":"ec","typ":"JWT"}`))):]
+		}, "", nil, ErrInvalidToken},
+		{"malformed", func() string { return "abc.def" }, "", nil, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/render", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token())
+			user, groups, err := a.authenticate(r)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.user, user)
+			assert.Equal(t, tt.groups, groups)
+		})
+	}
+
+	// rotated key is picked up without restart
+	keys = append(keys, ecJWK("rotated", rotatedKey))
+	writeKeys()
+	require.NoError(t, os.Chtimes(path, now, now))
+	r := httptest.NewRequest("GET", "/render", nil)
+	r.Header.Set("Authorization", "Bearer "+signToken(t, "ES256", "rotated", rotatedKey, claims(nil)))
+	user, _, err := a.authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user)
+
+	r.Header.Del("Authorization")
+	_, _, err = a.authenticate(r)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rules resolves scopes of the users
+type rules struct {
+	users  map[string][]string
+	groups map[string][]string
+	// members are static groups of the users
+	members map[string][]string
+
+	// scopes caches compiled scopes by their patterns
+	scopes sync.Map
+}
+
+func newRules(cfg *Config) (*rules, error) {
+	r := &rules{
+		users:   make(map[string][]string),
+		groups:  make(map[string][]string),
+		members: make(map[string][]string),
+	}
+	for _, rule := range cfg.Rules {
+		// check patterns on start
+		if _, err := NewScope(rule.Allow); err != nil {
+			return nil, err
+		}
+		for _, user := range rule.Users {
+			r.users[user] = append(r.users[user], rule.Allow...)
+		}
+		for _, group := range rule.Groups {
+			r.groups[group] = append(r.groups[group], rule.Allow...)
+		}
+	}
+	for group, users := range cfg.Groups {
+		for _, user := range users {
+			r.members[user] = append(r.members[user], group)
+		}
+	}
+	return r, nil
+}
+
+// scope returns scope for the user, which is a member of groups
+func (r *rules) scope(user string, groups []string) *Scope {
+	patterns := append([]string(nil), r.users[user]...)
+	for _, group := range groups {
+		patterns = append(patterns, r.groups[group]...)
+	}
+	for _, group := range r.members[user] {
+		patterns = append(patterns, r.groups[group]...)
+	}
+	if len(patterns) == 0 {
+		return ScopeNone
+	}
+	sort.Strings(patterns)
+
+	key := strings.Join(patterns, ",")
+	if s, ok := r.scopes.Load(key); ok {
+		return s.(*Scope)
+	}
+	s, err := NewScope(patterns)
+	if err != nil {
+		// patterns are checked on start
+		return ScopeNone
+	}
+	r.scopes.Store(key, s)
+	return s
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	merry2 "github.com/ansel1/merry/v2"
+
+	"github.com/go-graphite/carbonapi/pkg/glob"
+)
+
+// Scope is a set of metrics, which user is allowed to access. It's defined by glob prefixes of metric names.
+type Scope struct {
+	all      bool
+	key      string
+	prefixes []scopePrefix
+}
+
+type scopePrefix struct {
+	globs []string
+	nodes []*regexp.Regexp
+	re    string
+}
+
+var (
+	// ScopeAll grants access to all metrics
+	ScopeAll = &Scope{all: true}
+	// ScopeNone denies access to any metric
+	ScopeNone = &Scope{key: "-"}
+)
+
+// NewScope returns scope, which allows metrics that start with one of glob prefixes
+func NewScope(patterns []string) (*Scope, error) {
+	patterns = append([]string(nil), patterns...)
+	sort.Strings(patterns)
+
+	s := &Scope{}
+	n := 0
+	for i, pattern := range patterns {
+		if pattern == "" || (i > 0 && pattern == patterns[i-1]) {
+			continue
+		}
+		patterns[n] = pattern
+		n++
+
+		nodes := strings.Split(pattern, ".")
+		p := scopePrefix{globs: nodes, nodes: make([]*regexp.Regexp, len(nodes))}
+		all := true
+		reNodes := make([]string, len(nodes))
+		for j, node := range nodes {
+			if node != "*" {
+				all = false
+			}
+			reNodes[j] = glob.ToRegexp(node)
+			re, err := regexp.Compile("^" + reNodes[j] + "$")
+			if err != nil {
+				return nil, merry2.Prepend(err, "invalid glob prefix "+pattern)
+			}
+			p.nodes[j] = re
+		}
+		if all && len(nodes) == 1 {
+			return ScopeAll, nil
+		}
+		p.re = strings.Join(reNodes, `\.`)
+		s.prefixes = append(s.prefixes, p)
+	}
+	if n == 0 {
+		return ScopeNone, nil
+	}
+	s.key = strings.Join(patterns[:n], ",")
+
+	return s, nil
+}
+
+// All returns true if scope grants access to all metrics
+func (s *Scope) All() bool {
+	return s.all
+}
+
+// Key identifies the scope, e.x. in cache keys. It's empty for scope with access to all metrics.
+func (s *Scope) Key() string {
+	return s.key
+}
+
+// metricName strips tags from the name of tagged series
+func metricName(name string) string {
+	if n := strings.IndexByte(name, ';'); n >= 0 {
+		return name[:n]
+	}
+	return name
+}
+
+// Allowed checks access to the metric. Tags of the tagged series are ignored, access is checked by the name.
+func (s *Scope) Allowed(name string) bool {
+	if s.all {
+		return true
+	}
+	nodes := strings.Split(metricName(name), ".")
+	for _, p := range s.prefixes {
+		if len(nodes) < len(p.nodes) {
+			continue
+		}
+		if p.match(nodes, len(p.nodes)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Visible checks if the path is allowed or leads to allowed metrics, so it could be shown in find responses
+func (s *Scope) Visible(path string) bool {
+	if s.all {
+		return true
+	}
+	nodes := strings.Split(path, ".")
+	for _, p := range s.prefixes {
+		n := len(nodes)
+		if n > len(p.nodes) {
+			n = len(p.nodes)
+		}
+		if p.match(nodes, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// MayMatch checks if glob query could match allowed metrics or paths, which lead to them, so queries, which can't, aren't
+// sent to backends. Wildcards of the query and the scope in the same node are considered as overlapping. Tagged series
+// queries (seriesByTag) are always considered as matching, they are checked by names of found series.
+func (s *Scope) MayMatch(query string) bool {
+	if s.all {
+		return true
+	}
+	if strings.HasPrefix(query, "seriesByTag(") {
+		return true
+	}
+	nodes := strings.Split(query, ".")
+	for _, node := range nodes {
+		// alternatives with dots can't be matched by nodes
+		if strings.Count(node, "{") != strings.Count(node, "}") {
+			return true
+		}
+	}
+	for _, p := range s.prefixes {
+		n := len(nodes)
+		if n > len(p.nodes) {
+			n = len(p.nodes)
+		}
+		i := 0
+		for i < n && p.mayMatch(nodes[i], i) {
+			i++
+		}
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatch checks if glob node of the query could match i-th node of the prefix
+func (p *scopePrefix) mayMatch(node string, i int) bool {
+	if !hasWildcard(node) {
+		return p.nodes[i].MatchString(node)
+	}
+	if hasWildcard(p.globs[i]) {
+		return true
+	}
+	re, err := regexp.Compile("^" + glob.ToRegexp(node) + "$")
+	if err != nil {
+		return true
+	}
+	return re.MatchString(p.globs[i])
+}
+
+func hasWildcard(s string) bool {
+	return strings.ContainsAny(s, "*?[{")
+}
+
+func (p *scopePrefix) match(nodes []string, n int) bool {
+	for i := 0; i < n; i++ {
+		if !p.nodes[i].MatchString(nodes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// NameRegexp returns regular expression, which matches names of allowed metrics, e.x. to be used in tag expressions.
+// It's empty for scope with access to all metrics.
+func (s *Scope) NameRegexp() string {
+	if s.all {
+		return ""
+	}
+	if len(s.prefixes) == 0 {
+		// nothing should match
+		return `^\b\B$`
+	}
+	res := make([]string, len(s.prefixes))
+	for i, p := range s.prefixes {
+		res[i] = p.re
+	}
+	return `^(?:` + strings.Join(res, "|") + `)(?:\..*)?$`
+}
+
+// FilterNames returns allowed metric names
+func (s *Scope) FilterNames(names []string) []string {
+	if s.all {
+		return names
+	}
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		if s.Allowed(name) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScope(t *testing.T) {
+	s, err := NewScope([]string{"team_a.*.cpu", "team_b", "team_a.*.cpu", "dc{1,2}.host?"})
+	require.NoError(t, err)
+	assert.False(t, s.All())
+	assert.Equal(t, "dc{1,2}.host?,team_a.*.cpu,team_b", s.Key())
+
+	tests := []struct {
+		name    string
+		allowed bool
+		visible bool
+	}{
+		{"team_a.host1.cpu", true, true},
+		{"team_a.host1.cpu.user", true, true},
+		{"team_a.host1.cpu.user;dc=1", true, true},
+		{"team_a.host1.mem", false, false},
+		{"team_a.host1", false, true},
+		{"team_a", false, true},
+		{"team_b.anything", true, true},
+		{"team_bb.anything", false, false},
+		{"dc2.host1.load", true, true},
+		{"dc3.host1.load", false, false},
+		{"dc1.host10.load", false, false},
+		{"other", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, s.Allowed(tt.name), "allowed")
+			assert.Equal(t, tt.visible, s.Visible(tt.name), "visible")
+		})
+	}
+
+	re := regexp.MustCompile(s.NameRegexp())
+	assert.True(t, re.MatchString("team_a.host1.cpu.user"))
+	assert.True(t, re.MatchString("dc1.host1"))
+	assert.False(t, re.MatchString("team_a.host1.mem"))
+	assert.False(t, re.MatchString("team_bb"))
+
+	assert.Equal(t, []string{"team_b.x", "dc1.host1.la"}, s.FilterNames([]string{"team_b.x", "team_c.x", "dc1.host1.la"}))
+
+	for query, want := range map[string]bool{
+		"team_a.host1.cpu":              true,
+		"team_a.*.cpu.*":                true,
+		"team_a.host1.mem":              false,
+		"team_a":                        true,
+		"*":                             true,
+		"team_?.x":                      true,
+		"team_[cd].x":                   false,
+		"team_{b,c}.x":                  true,
+		"team_{c,d}.x":                  false,
+		"dc3.*":                         false,
+		"dc*.host1":                     true,
+		"{team_c.x,team_b.x}":           true,
+		"other.*":                       false,
+		"seriesByTag('name=other.x')":   true,
+		"seriesByTag('name=~team_a.*')": true,
+	} {
+		assert.Equal(t, want, s.MayMatch(query), query)
+	}
+}
+
+func TestScopeAllNone(t *testing.T) {
+	s, err := NewScope([]string{"team_a", "*"})
+	require.NoError(t, err)
+	assert.Same(t, ScopeAll, s)
+	assert.True(t, s.Allowed("anything"))
+	assert.Equal(t, "", s.NameRegexp())
+
+	s, err = NewScope(nil)
+	require.NoError(t, err)
+	assert.Same(t, ScopeNone, s)
+	assert.False(t, s.Allowed("anything"))
+	assert.False(t, s.Visible("anything"))
+	assert.False(t, regexp.MustCompile(s.NameRegexp()).MatchString("anything"))
+
+	_, err = NewScope([]string{"a.[z-a]"})
+	assert.Error(t, err)
+}
+
+func TestRules(t *testing.T) {
+	r, err := newRules(&Config{
+		Groups: map[string][]string{"ops": {"alice"}},
+		Rules: []Rule{
+			{Users: []string{"bob"}, Allow: []string{"team_b"}},
+			{Groups: []string{"ops"}, Allow: []string{"*"}},
+			{Groups: []string{"team_a"}, Allow: []string{"team_a"}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Same(t, ScopeAll, r.scope("alice", nil))
+	assert.Same(t, ScopeNone, r.scope("eve", nil))
+	assert.Equal(t, "team_b", r.scope("bob", nil).Key())
+	assert.Equal(t, "team_a,team_b", r.scope("bob", []string{"team_a"}).Key())
+	assert.Same(t, r.scope("bob", []string{"team_a"}), r.scope("bob", []string{"team_a"}))
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/zipper/interfaces"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// Zipper restricts responses of the zipper to metrics from the scope of the user in request context
+type Zipper struct {
+	interfaces.CarbonZipper
+}
+
+// NewZipper returns zipper, which filters responses of z by scope of the user
+func NewZipper(z interfaces.CarbonZipper) *Zipper {
+	return &Zipper{CarbonZipper: z}
+}
+
+func (z *Zipper) Find(ctx context.Context, request pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if scope.All() {
+		return z.CarbonZipper.Find(ctx, request)
+	}
+
+	// queries, which can't match allowed metrics, aren't sent to backends
+	var skipped []string
+	metrics := request.Metrics[:0:0]
+	for _, m := range request.Metrics {
+		if scope.MayMatch(m) {
+			metrics = append(metrics, m)
+		} else {
+			skipped = append(skipped, m)
+		}
+	}
+	if len(metrics) == 0 {
+		res := &pb.MultiGlobResponse{}
+		for _, m := range skipped {
+			res.Metrics = append(res.Metrics, pb.GlobResponse{Name: m, Matches: []pb.GlobMatch{}})
+		}
+		return res, new(zipperTypes.Stats), nil
+	}
+	request.Metrics = metrics
+
+	res, stats, err := z.CarbonZipper.Find(ctx, request)
+	if res == nil {
+		return res, stats, err
+	}
+	for _, m := range skipped {
+		res.Metrics = append(res.Metrics, pb.GlobResponse{Name: m, Matches: []pb.GlobMatch{}})
+	}
+
+	for i := range res.Metrics {
+		matches := res.Metrics[i].Matches[:0:0]
+		for _, m := range res.Metrics[i].Matches {
+			if (m.IsLeaf && scope.Allowed(m.Path)) || (!m.IsLeaf && scope.Visible(m.Path)) {
+				matches = append(matches, m)
+			}
+		}
+		res.Metrics[i].Matches = matches
+	}
+	return res, stats, err
+}
+
+func (z *Zipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if !scope.All() {
+		metrics = scope.FilterNames(metrics)
+		if len(metrics) == 0 {
+			return &pb.ZipperInfoResponse{Info: map[string]pb.MultiMetricsInfoResponse{}}, new(zipperTypes.Stats), nil
+		}
+	}
+	res, stats, err := z.CarbonZipper.Info(ctx, metrics)
+	if res == nil || scope.All() {
+		return res, stats, err
+	}
+
+	for server, info := range res.Info {
+		filtered := info.Metrics[:0:0]
+		for _, m := range info.Metrics {
+			if scope.Allowed(m.Name) {
+				filtered = append(filtered, m)
+			}
+		}
+		res.Info[server] = pb.MultiMetricsInfoResponse{Metrics: filtered}
+	}
+	return res, stats, err
+}
+
+func filterMetrics(scope *Scope, metrics []*types.MetricData) []*types.MetricData {
+	if scope.All() {
+		return metrics
+	}
+	res := metrics[:0:0]
+	for _, m := range metrics {
+		if scope.Allowed(m.Name) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func (z *Zipper) RenderCompat(ctx context.Context, metrics []string, from, until int64) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if !scope.All() {
+		// targets, which can't match allowed metrics, aren't fetched
+		allowed := metrics[:0:0]
+		for _, m := range metrics {
+			if scope.MayMatch(m) {
+				allowed = append(allowed, m)
+			}
+		}
+		if len(allowed) == 0 {
+			return nil, new(zipperTypes.Stats), nil
+		}
+		metrics = allowed
+	}
+	res, stats, err := z.CarbonZipper.RenderCompat(ctx, metrics, from, until)
+	return filterMetrics(scope, res), stats, err
+}
+
+func (z *Zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if !scope.All() {
+		// targets, which can't match allowed metrics, aren't fetched
+		metrics := request.Metrics[:0:0]
+		for _, m := range request.Metrics {
+			if scope.MayMatch(m.Name) {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) == 0 {
+			return nil, new(zipperTypes.Stats), nil
+		}
+		request.Metrics = metrics
+	}
+	res, stats, err := z.CarbonZipper.Render(ctx, request)
+	return filterMetrics(scope, res), stats, err
+}
+
+// scopeQuery adds name expression of the scope to the tags autocomplete query
+func scopeQuery(scope *Scope, query string) string {
+	v, err := url.ParseQuery(query)
+	if err != nil {
+		v = url.Values{}
+	}
+	v.Add("expr", "name=~"+scope.NameRegexp())
+	return v.Encode()
+}
+
+func (z *Zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if scope.All() {
+		return z.CarbonZipper.TagNames(ctx, query, limit)
+	}
+	return z.CarbonZipper.TagNames(ctx, scopeQuery(scope, query), limit)
+}
+
+func (z *Zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if scope.All() {
+		return z.CarbonZipper.TagValues(ctx, query, limit)
+	}
+	res, stats, err := z.CarbonZipper.TagValues(ctx, scopeQuery(scope, query), limit)
+	if v, _ := url.ParseQuery(query); v.Get("tag") == "name" {
+		// backend may ignore expressions for values of name tag
+		res = scope.FilterNames(res)
+	}
+	return res, stats, err
+}
+
+func (z *Zipper) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if scope.All() {
+		return z.CarbonZipper.FindSeries(ctx, exprs)
+	}
+	exprs = append(exprs[:len(exprs):len(exprs)], "name=~"+scope.NameRegexp())
+	res, err := z.CarbonZipper.FindSeries(ctx, exprs)
+	return scope.FilterNames(res), err
+}
+
+func (z *Zipper) TagDetails(ctx context.Context, tag, filter string) (*zipperTypes.TagDetails, merry.Error) {
+	scope := ScopeFromContext(ctx)
+	if scope.All() {
+		return z.CarbonZipper.TagDetails(ctx, tag, filter)
+	}
+	// counts of other tags values can't be restricted to the scope
+	if tag != "name" {
+		return nil, zipperTypes.ErrForbidden.WithMessagef("details of tag %s are not available", tag)
+	}
+	res, err := z.CarbonZipper.TagDetails(ctx, tag, filter)
+	if res == nil {
+		return res, err
+	}
+	values := res.Values[:0:0]
+	for _, v := range res.Values {
+		if scope.Allowed(v.Value) {
+			values = append(values, v)
+		}
+	}
+	res.Values = values
+	return res, err
+}
+
+func checkPaths(scope *Scope, paths []string) merry.Error {
+	for _, path := range paths {
+		if !scope.Allowed(path) {
+			return zipperTypes.ErrForbidden.WithMessagef("access to %s is forbidden", path)
+		}
+	}
+	return nil
+}
+
+func (z *Zipper) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	if err := checkPaths(ScopeFromContext(ctx), paths); err != nil {
+		return nil, err
+	}
+	return z.CarbonZipper.TagSeries(ctx, paths)
+}
+
+func (z *Zipper) DelSeries(ctx context.Context, paths []string) merry.Error {
+	if err := checkPaths(ScopeFromContext(ctx), paths); err != nil {
+		return err
+	}
+	return z.CarbonZipper.DelSeries(ctx, paths)
+}
@@ -0,0 +1,51 @@
+package deadline
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultHeader is a header with timeout of the request in seconds, it's accepted from the clients and sent to the
+// backends
+const DefaultHeader = "X-Carbonapi-Timeout"
+
+// Config describes deadline of the requests
+type Config struct {
+	// Timeout of the request, it's a budget of all stages. 0 disables deadlines.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxTimeout limits timeout, which is requested by the client with Header or timeout parameter. Timeout by default.
+	MaxTimeout time.Duration `mapstructure:"maxTimeout"`
+	// Header with timeout of the request in seconds, requested by the client
+	Header string `mapstructure:"header"`
+	// FetchShare is a share of the remaining budget, which is given to each fetch from backends. The rest is left for
+	// evaluation of the fetched series.
+	FetchShare float64 `mapstructure:"fetchShare"`
+}
+
+// DefaultConfig returns config with disabled deadlines
+func DefaultConfig() Config {
+	return Config{
+		Header:     DefaultHeader,
+		FetchShare: 0.8,
+	}
+}
+
+// Validate fills defaults and returns error if config is invalid
+func (c *Config) Validate() error {
+	if c.Timeout < 0 || c.MaxTimeout < 0 {
+		return errors.New("timeouts can't be negative")
+	}
+	if c.MaxTimeout == 0 {
+		c.MaxTimeout = c.Timeout
+	}
+	if c.MaxTimeout < c.Timeout {
+		return errors.New("maxTimeout can't be less than timeout")
+	}
+	if c.FetchShare <= 0 || c.FetchShare > 1 {
+		return errors.New("fetchShare should be in (0, 1]")
+	}
+	if c.Header == "" {
+		c.Header = DefaultHeader
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+)
+
+// Stages of the request, which share its budget
+const (
+	StageFetch = "fetch"
+	StageEval  = "eval"
+)
+
+var (
+	ErrExpired        = merry.New("request deadline exceeded").WithHTTPCode(http.StatusGatewayTimeout)
+	ErrInvalidTimeout = merry.New("invalid timeout").WithHTTPCode(http.StatusBadRequest)
+)
+
+// ParseTimeout parses timeout in seconds, e.x. "2.5", or duration, e.x. "2500ms"
+func ParseTimeout(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		// !(seconds > 0) is true for NaN too
+		if !(seconds > 0) || seconds > math.MaxInt64/float64(time.Second) {
+			return 0, ErrInvalidTimeout.WithValue("timeout", s)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, ErrInvalidTimeout.WithValue("timeout", s)
+	}
+	return d, nil
+}
+
+// FormatTimeout formats timeout in seconds with milliseconds precision
+func FormatTimeout(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// Budget is a deadline of the request, which is shared by its stages: fetches from backends get a share of the
+// remaining budget, evaluation gets the rest
+type Budget struct {
+	start      time.Time
+	deadline   time.Time
+	fetchShare float64
+
+	lock sync.Mutex
+	// fetching counts fetches in flight, fetch is time spent with at least one of them
+	fetching   int
+	fetchStart time.Time
+	fetch      time.Duration
+	expired    string
+}
+
+type ctxKey struct{}
+
+// WithBudget returns context with deadline after timeout and its budget
+func WithBudget(ctx context.Context, timeout time.Duration, fetchShare float64) (context.Context, *Budget, context.CancelFunc) {
+	now := time.Now()
+	b := &Budget{
+		start:      now,
+		deadline:   now.Add(timeout),
+		fetchShare: fetchShare,
+	}
+	ctx, cancel := context.WithDeadline(context.WithValue(ctx, ctxKey{}, b), b.deadline)
+	return ctx, b, cancel
+}
+
+// FromContext returns budget of the request, nil if it has no deadline
+func FromContext(ctx context.Context) *Budget {
+	b, _ := ctx.Value(ctxKey{}).(*Budget)
+	return b
+}
+
+// Fetch returns context of the fetch stage, which deadline is a share of the remaining budget of the request.
+// Returned function finishes the stage, it should be called when the fetch is done.
+func Fetch(ctx context.Context) (context.Context, func()) {
+	b := FromContext(ctx)
+	if b == nil {
+		return ctx, func() {}
+	}
+
+	now := time.Now()
+	stageCtx, cancel := context.WithDeadline(ctx, now.Add(time.Duration(float64(b.deadline.Sub(now))*b.fetchShare)))
+	b.lock.Lock()
+	if b.fetching == 0 {
+		b.fetchStart = now
+	}
+	b.fetching++
+	b.lock.Unlock()
+
+	return stageCtx, func() {
+		expired := errors.Is(stageCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		if expired && b.expired == "" {
+			b.expired = StageFetch
+		}
+		b.fetching--
+		if b.fetching == 0 {
+			b.fetch += time.Since(b.fetchStart)
+		}
+	}
+}
+
+// Expired returns the stage, which ran out of its budget, or false if the budget isn't exceeded. Evaluation is
+// considered to run out of the budget, if the deadline is passed and fetches were done in time.
+func (b *Budget) Expired() (string, bool) {
+	if b == nil {
+		return "", false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.expired != "" {
+		return b.expired, true
+	}
+	if time.Now().Before(b.deadline) {
+		return "", false
+	}
+	return StageEval, true
+}
+
+// Spent returns time spent by fetches and evaluation
+func (b *Budget) Spent() (fetch, eval time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	fetch = b.fetch
+	if b.fetching > 0 {
+		fetch += now.Sub(b.fetchStart)
+	}
+	eval = now.Sub(b.start) - fetch
+	if eval < 0 {
+		eval = 0
+	}
+	return fetch, eval
+}
+
+// Err returns ErrExpired with breakdown of the spent budget by stages, if the budget is exceeded
+func (b *Budget) Err() merry.Error {
+	stage, expired := b.Expired()
+	if !expired {
+		return nil
+	}
+	fetch, eval := b.Spent()
+	return ErrExpired.
+		WithMessage(fmt.Sprintf("request deadline exceeded: %s stage ran out of budget (timeout %s, fetch %s, eval %s)",
+			stage, b.deadline.Sub(b.start), fetch.Round(time.Millisecond), eval.Round(time.Millisecond))).
+		WithValue("stage", stage)
+}
+
+// Check returns error, if the context is done: ErrExpired of the stage, which ran out of the budget, or of the eval
+// stage, if the context has no budget. Evaluation checks it between targets and function calls, so expired request
+// isn't evaluated further.
+func Check(ctx context.Context) merry.Error {
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	if e := FromContext(ctx).Err(); e != nil {
+		return e
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrExpired.WithValue("stage", StageEval)
+	}
+	return merry.Wrap(err)
+}
+
+type headerKey struct{}
+
+// WithHeader returns context, which passes remaining time of its deadline to backends in the header
+func WithHeader(ctx context.Context, header string) context.Context {
+	return context.WithValue(ctx, headerKey{}, header)
+}
+
+// Header returns name of the header, which passes remaining time of the request to backends, DefaultHeader if the
+// context has none
+func Header(ctx context.Context) string {
+	if h, ok := ctx.Value(headerKey{}).(string); ok && h != "" {
+		return h
+	}
+	return DefaultHeader
+}
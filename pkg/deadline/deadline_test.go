@@ -0,0 +1,122 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "2", want: 2 * time.Second},
+		{s: "0.25", want: 250 * time.Millisecond},
+		{s: "1500ms", want: 1500 * time.Millisecond},
+		{s: "1m", want: time.Minute},
+		{s: "0", wantErr: true},
+		{s: "-1", wantErr: true},
+		{s: "-1s", wantErr: true},
+		{s: "NaN", wantErr: true},
+		{s: "1e300", wantErr: true},
+		{s: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseTimeout(tt.s)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.True(t, merry.Is(err, ErrInvalidTimeout))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBudget(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()).Err(), "no budget")
+
+	ctx, b, cancel := WithBudget(context.Background(), time.Hour, 0.5)
+	defer cancel()
+	require.Same(t, b, FromContext(ctx))
+	assert.Nil(t, b.Err())
+
+	fetchCtx, done := Fetch(ctx)
+	d, ok := fetchCtx.Deadline()
+	require.True(t, ok)
+	assert.InDelta(t, float64(30*time.Minute), float64(time.Until(d)), float64(time.Second))
+	done()
+	assert.Nil(t, b.Err())
+}
+
+func TestBudgetExpired(t *testing.T) {
+	t.Run("fetch", func(t *testing.T) {
+		ctx, b, cancel := WithBudget(context.Background(), 20*time.Millisecond, 0.5)
+		defer cancel()
+
+		fetchCtx, done := Fetch(ctx)
+		<-fetchCtx.Done()
+		done()
+		<-ctx.Done()
+
+		err := b.Err()
+		require.Error(t, err)
+		assert.True(t, merry.Is(err, ErrExpired))
+		assert.Equal(t, 504, merry.HTTPCode(err))
+		assert.Equal(t, StageFetch, merry.Value(err, "stage"))
+		fetch, _ := b.Spent()
+		assert.GreaterOrEqual(t, fetch, 10*time.Millisecond)
+	})
+
+	t.Run("eval", func(t *testing.T) {
+		ctx, b, cancel := WithBudget(context.Background(), 20*time.Millisecond, 0.5)
+		defer cancel()
+
+		_, done := Fetch(ctx)
+		done()
+		<-ctx.Done()
+
+		err := b.Err()
+		require.Error(t, err)
+		assert.Equal(t, StageEval, merry.Value(err, "stage"))
+		assert.Contains(t, err.Error(), "eval stage ran out of budget")
+	})
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Check(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Check(ctx)
+	require.Error(t, err)
+	assert.True(t, merry.Is(err, context.Canceled))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	err = Check(ctx)
+	require.Error(t, err)
+	assert.True(t, merry.Is(err, ErrExpired))
+	assert.Equal(t, StageEval, merry.Value(err, "stage"))
+
+	ctx, _, cancel = WithBudget(context.Background(), time.Nanosecond, 0.5)
+	defer cancel()
+	<-ctx.Done()
+	err = Check(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "eval stage ran out of budget")
+}
+
+func TestHeader(t *testing.T) {
+	assert.Equal(t, DefaultHeader, Header(context.Background()))
+	assert.Equal(t, "X-Timeout", Header(WithHeader(context.Background(), "X-Timeout")))
+}
@@ -0,0 +1,63 @@
+package glob
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ToRegexp converts glob of the metric name node to the regular expression (without anchors)
+func ToRegexp(glob string) string {
+	var sb strings.Builder
+	for {
+		n := strings.IndexAny(glob, "*?[{")
+		if n < 0 {
+			sb.WriteString(regexp.QuoteMeta(glob))
+			return sb.String()
+		}
+
+		sb.WriteString(regexp.QuoteMeta(glob[:n]))
+		ch := glob[n]
+		glob = glob[n+1:]
+
+		switch ch {
+		case '*':
+			sb.WriteString(`[^.]*`)
+		case '?':
+			sb.WriteString(`[^.]`)
+		case '[':
+			n = strings.Index(glob, "]")
+			if n < 0 {
+				sb.WriteString(regexp.QuoteMeta("[" + glob))
+				return sb.String()
+			}
+			sb.WriteString("[" + glob[:n+1])
+			glob = glob[n+1:]
+		case '{':
+			n = strings.Index(glob, "}")
+			if n < 0 {
+				sb.WriteString(regexp.QuoteMeta("{" + glob))
+				return sb.String()
+			}
+			alts := strings.Split(glob[:n], ",")
+			glob = glob[n+1:]
+			for i := range alts {
+				alts[i] = ToRegexp(alts[i])
+			}
+			sb.WriteString("(?:" + strings.Join(alts, "|") + ")")
+		}
+	}
+}
+
+// NodeMatchers compiles glob of the metric name to the anchored regular expressions of its nodes
+func NodeMatchers(pattern string) ([]*regexp.Regexp, error) {
+	nodes := strings.Split(pattern, ".")
+	res := make([]*regexp.Regexp, len(nodes))
+	for i, node := range nodes {
+		re, err := regexp.Compile("^" + ToRegexp(node) + "$")
+		if err != nil {
+			return nil, err
+		}
+		res[i] = re
+	}
+	return res, nil
+}
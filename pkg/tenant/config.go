@@ -0,0 +1,36 @@
+package tenant
+
+import (
+	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
+)
+
+// Config describes how tenant of the request is resolved and backends of the tenants
+type Config struct {
+	// Header with the name of tenant, e.x. X-Scope-OrgID
+	Header string `mapstructure:"header"`
+	// PathPrefix enables tenant in the path (after global prefix), e.x. /tenant/<name>/render with "/tenant" path prefix
+	PathPrefix string `mapstructure:"pathPrefix"`
+	// Default is a tenant of the requests without tenant. If it's empty, such requests are rejected, unless AllowGlobal
+	// is set.
+	Default string `mapstructure:"default"`
+	// AllowGlobal sends requests without tenant to the global upstreams instead of rejecting them
+	AllowGlobal bool `mapstructure:"allowGlobal"`
+	// Tenants by their names
+	Tenants map[string]TenantConfig `mapstructure:"tenants"`
+}
+
+// TenantConfig describes backends and limits of the tenant
+type TenantConfig struct {
+	// Upstreams are backends of the tenant. Options, which are not set, are inherited from the global upstreams.
+	Upstreams zipperCfg.Config `mapstructure:"upstreams"`
+	// Users and Groups resolve tenant of the authenticated users, when tenant is not set in the request.
+	// If they are set, users from other groups are not allowed to use the tenant.
+	Users  []string `mapstructure:"users"`
+	Groups []string `mapstructure:"groups"`
+	// CacheNamespace separates cached responses of the tenant, tenant name by default
+	CacheNamespace string `mapstructure:"cacheNamespace"`
+	// MaxConcurrentRequests limits requests of the tenant in flight, requests over the limit are rejected with 429
+	MaxConcurrentRequests int `mapstructure:"maxConcurrentRequests"`
+	// MaxQueryLength overrides global maxQueryLength for the tenant
+	MaxQueryLength uint64 `mapstructure:"maxQueryLength"`
+}
@@ -0,0 +1,318 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	merry2 "github.com/ansel1/merry/v2"
+	"github.com/msaf1980/go-metrics"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/pkg/auth"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+)
+
+var (
+	ErrUnknownTenant     = merry2.New("unknown tenant", merry2.WithHTTPCode(http.StatusNotFound))
+	ErrConflictingTenant = merry2.New("tenant in the header doesn't match tenant in the path", merry2.WithHTTPCode(http.StatusBadRequest))
+	ErrForbidden         = merry2.New("access to the tenant is forbidden", merry2.WithHTTPCode(http.StatusForbidden))
+	ErrTooManyRequests   = merry2.New("too many requests of the tenant", merry2.WithHTTPCode(http.StatusTooManyRequests))
+	ErrNoTenant          = merry2.New("tenant of the request is not specified", merry2.WithHTTPCode(http.StatusBadRequest))
+)
+
+// Metrics are per-tenant counters
+type Metrics struct {
+	Requests         metrics.Counter
+	RejectedRequests metrics.Counter
+	FailedRequests   metrics.Counter
+	ZipperRequests   metrics.Counter
+	ZipperErrors     metrics.Counter
+	ZipperTimeouts   metrics.Counter
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		Requests:         metrics.NewCounter(),
+		RejectedRequests: metrics.NewCounter(),
+		FailedRequests:   metrics.NewCounter(),
+		ZipperRequests:   metrics.NewCounter(),
+		ZipperErrors:     metrics.NewCounter(),
+		ZipperTimeouts:   metrics.NewCounter(),
+	}
+}
+
+// Tenant is a set of backends with own cache namespace and limits
+type Tenant struct {
+	Name           string
+	CacheNamespace string
+	MaxQueryLength uint64
+	Metrics        *Metrics
+
+	users   map[string]struct{}
+	groups  map[string]struct{}
+	limiter chan struct{}
+}
+
+// member checks if user is allowed to use the tenant, tenants without users and groups are available to everyone
+func (t *Tenant) member(user *auth.User) bool {
+	if len(t.users) == 0 && len(t.groups) == 0 {
+		return true
+	}
+	if user == nil || user.Name == "" {
+		return false
+	}
+	if _, ok := t.users[user.Name]; ok {
+		return true
+	}
+	for _, g := range user.Groups {
+		if _, ok := t.groups[g]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tenant) enter() bool {
+	if t.limiter == nil {
+		return true
+	}
+	select {
+	case t.limiter <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *Tenant) leave() {
+	if t.limiter != nil {
+		<-t.limiter
+	}
+}
+
+// StatsSender returns zipper stats sender, which counts zipper requests of the tenant and passes stats to next
+func (t *Tenant) StatsSender(next func(*zipperTypes.Stats)) func(*zipperTypes.Stats) {
+	return func(stats *zipperTypes.Stats) {
+		if stats != nil {
+			t.Metrics.ZipperRequests.Add(stats.FindRequests + stats.RenderRequests + stats.InfoRequests + stats.TagRequests)
+			t.Metrics.ZipperErrors.Add(stats.FindErrors + stats.RenderErrors + stats.InfoErrors + stats.TagErrors)
+			t.Metrics.ZipperTimeouts.Add(stats.Timeouts)
+		}
+		next(stats)
+	}
+}
+
+type ctxKey struct{}
+
+// WithTenant returns context with the tenant of the request
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext returns tenant of the request, nil for requests to the global upstreams
+func FromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(ctxKey{}).(*Tenant)
+	return t
+}
+
+// Name returns name of the request tenant, empty for requests to the global upstreams
+func Name(ctx context.Context) string {
+	if t := FromContext(ctx); t != nil {
+		return t.Name
+	}
+	return ""
+}
+
+// CacheKey returns cache namespace of the request tenant, empty for requests to the global upstreams
+func CacheKey(ctx context.Context) string {
+	if t := FromContext(ctx); t != nil {
+		return t.CacheNamespace
+	}
+	return ""
+}
+
+// Tenants resolves tenants of the requests
+type Tenants struct {
+	header      string
+	pathPrefix  string
+	prefix      string
+	defaultName string
+	allowGlobal bool
+	tenants     map[string]*Tenant
+	// names are sorted tenant names
+	names  []string
+	logger *zap.Logger
+}
+
+// New returns tenants for config, nil if there are no tenants. Prefix is a global prefix of the paths.
+func New(logger *zap.Logger, cfg *Config, prefix string) (*Tenants, error) {
+	if len(cfg.Tenants) == 0 {
+		if cfg.Default != "" {
+			return nil, merry2.Wrap(ErrUnknownTenant, merry2.WithMessagef("default tenant %s is not configured", cfg.Default))
+		}
+		return nil, nil
+	}
+
+	t := &Tenants{
+		header:      cfg.Header,
+		prefix:      prefix,
+		defaultName: cfg.Default,
+		allowGlobal: cfg.AllowGlobal,
+		tenants:     make(map[string]*Tenant, len(cfg.Tenants)),
+		logger:      logger,
+	}
+	if cfg.PathPrefix != "" {
+		t.pathPrefix = prefix + "/" + strings.Trim(cfg.PathPrefix, "/") + "/"
+	}
+	for name, tc := range cfg.Tenants {
+		if name == "" || strings.ContainsAny(name, "/.") {
+			return nil, merry2.Errorf("invalid tenant name '%s'", name)
+		}
+		tenant := &Tenant{
+			Name:           name,
+			CacheNamespace: tc.CacheNamespace,
+			MaxQueryLength: tc.MaxQueryLength,
+			Metrics:        newMetrics(),
+			users:          make(map[string]struct{}, len(tc.Users)),
+			groups:         make(map[string]struct{}, len(tc.Groups)),
+		}
+		if tenant.CacheNamespace == "" {
+			tenant.CacheNamespace = name
+		}
+		if tc.MaxConcurrentRequests > 0 {
+			tenant.limiter = make(chan struct{}, tc.MaxConcurrentRequests)
+		}
+		for _, u := range tc.Users {
+			tenant.users[u] = struct{}{}
+		}
+		for _, g := range tc.Groups {
+			tenant.groups[g] = struct{}{}
+		}
+		t.tenants[name] = tenant
+		t.names = append(t.names, name)
+	}
+	sort.Strings(t.names)
+	if t.defaultName != "" && t.tenants[t.defaultName] == nil {
+		return nil, merry2.Wrap(ErrUnknownTenant, merry2.WithMessagef("default tenant %s is not configured", t.defaultName))
+	}
+
+	return t, nil
+}
+
+// Names returns sorted names of the tenants
+func (t *Tenants) Names() []string {
+	return t.names
+}
+
+// Get returns tenant by name
+func (t *Tenants) Get(name string) *Tenant {
+	return t.tenants[name]
+}
+
+// byIdentity returns first tenant, which lists the user or one of its groups
+func (t *Tenants) byIdentity(user *auth.User) string {
+	for _, name := range t.names {
+		tenant := t.tenants[name]
+		if (len(tenant.users) > 0 || len(tenant.groups) > 0) && tenant.member(user) {
+			return name
+		}
+	}
+	return ""
+}
+
+// resolve returns tenant of the request and request with tenant stripped from the path
+func (t *Tenants) resolve(r *http.Request) (*Tenant, *http.Request, error) {
+	var name string
+	if t.pathPrefix != "" && strings.HasPrefix(r.URL.Path, t.pathPrefix) {
+		var rest string
+		name, rest, _ = strings.Cut(r.URL.Path[len(t.pathPrefix):], "/")
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = t.prefix + "/" + rest
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	if t.header != "" {
+		if h := r.Header.Get(t.header); h != "" {
+			if name != "" && name != h {
+				return nil, r, ErrConflictingTenant
+			}
+			name = h
+		}
+	}
+	user := auth.UserFromContext(r.Context())
+	if name == "" && user != nil {
+		name = t.byIdentity(user)
+	}
+	if name == "" {
+		name = t.defaultName
+	}
+	if name == "" {
+		return nil, r, nil
+	}
+
+	tenant := t.tenants[name]
+	if tenant == nil {
+		// names of the tenants are lowercased by config parser
+		tenant = t.tenants[strings.ToLower(name)]
+	}
+	if tenant == nil {
+		return nil, r, merry2.Wrap(ErrUnknownTenant, merry2.WithMessagef("unknown tenant '%s'", name))
+	}
+	// tenants with members aren't available to requests without authenticated user
+	if !tenant.member(user) {
+		if user == nil || user.Name == "" {
+			return nil, r, merry2.Wrap(ErrForbidden, merry2.WithMessagef("anonymous user is not allowed to use tenant %s", name))
+		}
+		return nil, r, merry2.Wrap(ErrForbidden, merry2.WithMessagef("user %s is not allowed to use tenant %s", user.Name, name))
+	}
+	return tenant, r, nil
+}
+
+// Middleware resolves tenant of the request, checks its limits and adds it to the request context.
+// Requests without tenant are rejected, unless global upstreams are allowed or the path starts with one of untenanted
+// prefixes, e.x. health checks, which don't reach backends. Such requests are passed as is.
+func (t *Tenants) Middleware(next http.Handler, untenanted ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, r, err := t.resolve(r)
+		if err == nil && tenant == nil && !t.allowGlobal && !hasAnyPrefix(r.URL.Path, untenanted) {
+			err = ErrNoTenant
+		}
+		if err == nil && tenant != nil && !tenant.enter() {
+			tenant.Metrics.RejectedRequests.Add(1)
+			err = merry2.Wrap(ErrTooManyRequests, merry2.WithMessagef("too many requests of tenant %s", tenant.Name))
+		}
+		if err != nil {
+			t.logger.Debug("tenant rejected",
+				zap.String("url", r.URL.Path),
+				zap.String("peer", r.RemoteAddr),
+				zap.Error(err),
+			)
+			code := merry2.HTTPCode(err)
+			http.Error(w, http.StatusText(code)+": "+err.Error(), code)
+			return
+		}
+		if tenant == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer tenant.leave()
+
+		tenant.Metrics.Requests.Add(1)
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/auth"
+	"github.com/go-graphite/carbonapi/zipper/interfaces"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+func TestMiddleware(t *testing.T) {
+	tenants, err := New(zap.NewNop(), &Config{
+		Header:      "X-Tenant",
+		PathPrefix:  "/tenant",
+		AllowGlobal: true,
+		Tenants: map[string]TenantConfig{
+			"team_a": {Groups: []string{"team_a"}, MaxQueryLength: 100},
+			"team_b": {Users: []string{"bob"}, CacheNamespace: "b", MaxConcurrentRequests: 1},
+			"shared": {},
+		},
+	}, "/api")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shared", "team_a", "team_b"}, tenants.Names())
+
+	var (
+		tenant *Tenant
+		path   string
+		block  chan struct{}
+	)
+	h := tenants.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = FromContext(r.Context())
+		path = r.URL.Path
+		if block != nil {
+			<-block
+		}
+	}))
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		user   *auth.User
+		code   int
+		tenant string
+		upath  string
+	}{
+		{"global", "/api/render", "", nil, http.StatusOK, "", "/api/render"},
+		{"header", "/api/render", "team_a", &auth.User{Name: "alice", Groups: []string{"team_a"}}, http.StatusOK, "team_a", "/api/render"},
+		{"header case", "/api/render", "Team_A", &auth.User{Name: "alice", Groups: []string{"team_a"}}, http.StatusOK, "team_a", "/api/render"},
+		{"path", "/api/tenant/team_b/metrics/find", "", &auth.User{Name: "bob"}, http.StatusOK, "team_b", "/api/metrics/find"},
+		{"path and header", "/api/tenant/team_b/render", "team_b", &auth.User{Name: "bob"}, http.StatusOK, "team_b", "/api/render"},
+		{"anonymous header", "/api/render", "team_a", nil, http.StatusForbidden, "", ""},
+		{"anonymous path", "/api/tenant/team_b/render", "", nil, http.StatusForbidden, "", ""},
+		{"anonymous user", "/api/render", "team_b", &auth.User{}, http.StatusForbidden, "", ""},
+		{"anonymous open tenant", "/api/render", "shared", nil, http.StatusOK, "shared", "/api/render"},
+		{"conflict", "/api/tenant/team_b/render", "team_a", nil, http.StatusBadRequest, "", ""},
+		{"unknown", "/api/render", "team_c", nil, http.StatusNotFound, "", ""},
+		{"identity user", "/api/render", "", &auth.User{Name: "bob"}, http.StatusOK, "team_b", "/api/render"},
+		{"identity group", "/api/render", "", &auth.User{Name: "alice", Groups: []string{"dev", "team_a"}}, http.StatusOK, "team_a", "/api/render"},
+		{"no identity", "/api/render", "", &auth.User{Name: "eve"}, http.StatusOK, "", "/api/render"},
+		{"forbidden", "/api/render", "team_a", &auth.User{Name: "bob"}, http.StatusForbidden, "", ""},
+		{"open tenant", "/api/render", "shared", &auth.User{Name: "bob"}, http.StatusOK, "shared", "/api/render"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, path = nil, ""
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("X-Tenant", tt.header)
+			}
+			if tt.user != nil {
+				r = r.WithContext(auth.WithUser(r.Context(), tt.user))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			if tt.code != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.upath, path)
+			if tt.tenant == "" {
+				assert.Nil(t, tenant)
+			} else {
+				require.NotNil(t, tenant)
+				assert.Equal(t, tt.tenant, tenant.Name)
+			}
+		})
+	}
+
+	b := tenants.Get("team_b")
+	assert.Equal(t, "b", b.CacheNamespace)
+	assert.Equal(t, uint64(100), tenants.Get("team_a").MaxQueryLength)
+
+	// concurrent requests over the limit are rejected
+	block = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r := httptest.NewRequest("GET", "/api/render", nil)
+		r.Header.Set("X-Tenant", "team_b")
+		r = r.WithContext(auth.WithUser(r.Context(), &auth.User{Name: "bob"}))
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(b.limiter) == 1 }, time.Second, time.Millisecond)
+	r := httptest.NewRequest("GET", "/api/render", nil)
+	r.Header.Set("X-Tenant", "team_b")
+	r = r.WithContext(auth.WithUser(r.Context(), &auth.User{Name: "bob"}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, uint64(1), b.Metrics.RejectedRequests.Count())
+	close(block)
+	<-done
+}
+
+func TestMiddlewareWithoutTenant(t *testing.T) {
+	tenants, err := New(zap.NewNop(), &Config{
+		Header:  "X-Tenant",
+		Tenants: map[string]TenantConfig{"team_a": {Groups: []string{"team_a"}}},
+	}, "/api")
+	require.NoError(t, err)
+
+	var served bool
+	h := tenants.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = FromContext(r.Context()) == nil
+	}), "/api/lb_check")
+
+	tests := []struct {
+		name string
+		path string
+		user *auth.User
+		code int
+	}{
+		{"rejected", "/api/render", nil, http.StatusBadRequest},
+		{"no identity", "/api/render", &auth.User{Name: "eve"}, http.StatusBadRequest},
+		{"untenanted path", "/api/lb_check", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served = false
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.user != nil {
+				r = r.WithContext(auth.WithUser(r.Context(), tt.user))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+			assert.Equal(t, tt.code == http.StatusOK, served)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tenants, err := New(zap.NewNop(), &Config{}, "")
+	assert.NoError(t, err)
+	assert.Nil(t, tenants)
+
+	_, err = New(zap.NewNop(), &Config{Default: "a"}, "")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	_, err = New(zap.NewNop(), &Config{Default: "a", Tenants: map[string]TenantConfig{"b": {}}}, "")
+	assert.ErrorIs(t, err, ErrUnknownTenant)
+
+	_, err = New(zap.NewNop(), &Config{Tenants: map[string]TenantConfig{"a/b": {}}}, "")
+	assert.Error(t, err)
+}
+
+type testZipper struct {
+	interfaces.CarbonZipper
+	name     string
+	requests int
+}
+
+func (z *testZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	z.requests++
+	return []*types.MetricData{types.MakeMetricData(z.name, []float64{1}, 1, 0)}, new(zipperTypes.Stats), nil
+}
+
+func TestZipper(t *testing.T) {
+	global := &testZipper{name: "global"}
+	a := &testZipper{name: "a"}
+	z := NewZipper(global, map[string]interfaces.CarbonZipper{"a": a})
+
+	res, _, err := z.Render(context.Background(), pb.MultiFetchRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "global", res[0].Name)
+
+	res, _, err = z.Render(WithTenant(context.Background(), &Tenant{Name: "a"}), pb.MultiFetchRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "a", res[0].Name)
+
+	_, _, err = z.Render(WithTenant(context.Background(), &Tenant{Name: "b"}), pb.MultiFetchRequest{})
+	assert.ErrorIs(t, err, zipperTypes.ErrForbidden)
+	assert.Equal(t, 1, global.requests)
+	assert.Equal(t, 1, a.requests)
+}
+
+func TestStatsSender(t *testing.T) {
+	tenant := &Tenant{Name: "a", Metrics: newMetrics()}
+	var sent *zipperTypes.Stats
+	sender := tenant.StatsSender(func(stats *zipperTypes.Stats) { sent = stats })
+
+	stats := &zipperTypes.Stats{RenderRequests: 2, FindRequests: 1, RenderErrors: 1, Timeouts: 1}
+	sender(stats)
+	sender(nil)
+	assert.Nil(t, sent)
+	assert.Equal(t, uint64(3), tenant.Metrics.ZipperRequests.Count())
+	assert.Equal(t, uint64(1), tenant.Metrics.ZipperErrors.Count())
+	assert.Equal(t, uint64(1), tenant.Metrics.ZipperTimeouts.Count())
+}
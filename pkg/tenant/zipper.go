@@ -0,0 +1,123 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/zipper/interfaces"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// Zipper routes requests to the zipper of the request tenant. Requests without tenant are sent to the global zipper.
+type Zipper struct {
+	global  interfaces.CarbonZipper
+	tenants map[string]interfaces.CarbonZipper
+}
+
+// NewZipper returns zipper, which routes requests to the zippers of the tenants by their names
+func NewZipper(global interfaces.CarbonZipper, tenants map[string]interfaces.CarbonZipper) *Zipper {
+	return &Zipper{
+		global:  global,
+		tenants: tenants,
+	}
+}
+
+func (z *Zipper) zipper(ctx context.Context) (interfaces.CarbonZipper, merry.Error) {
+	t := FromContext(ctx)
+	if t == nil {
+		return z.global, nil
+	}
+	if zipper, ok := z.tenants[t.Name]; ok {
+		return zipper, nil
+	}
+	// never fall back to other backends
+	return nil, zipperTypes.ErrForbidden.WithMessagef("tenant %s has no backends", t.Name)
+}
+
+func (z *Zipper) Find(ctx context.Context, request pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, new(zipperTypes.Stats), err
+	}
+	return zipper.Find(ctx, request)
+}
+
+func (z *Zipper) Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, new(zipperTypes.Stats), err
+	}
+	return zipper.Info(ctx, metrics)
+}
+
+func (z *Zipper) RenderCompat(ctx context.Context, metrics []string, from, until int64) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, new(zipperTypes.Stats), err
+	}
+	return zipper.RenderCompat(ctx, metrics, from, until)
+}
+
+func (z *Zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, new(zipperTypes.Stats), err
+	}
+	return zipper.Render(ctx, request)
+}
+
+func (z *Zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, new(zipperTypes.Stats), err
+	}
+	return zipper.TagNames(ctx, query, limit)
+}
+
+func (z *Zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, new(zipperTypes.Stats), err
+	}
+	return zipper.TagValues(ctx, query, limit)
+}
+
+func (z *Zipper) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return zipper.FindSeries(ctx, exprs)
+}
+
+func (z *Zipper) TagDetails(ctx context.Context, tag, filter string) (*zipperTypes.TagDetails, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return zipper.TagDetails(ctx, tag, filter)
+}
+
+func (z *Zipper) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return zipper.TagSeries(ctx, paths)
+}
+
+func (z *Zipper) DelSeries(ctx context.Context, paths []string) merry.Error {
+	zipper, err := z.zipper(ctx)
+	if err != nil {
+		return err
+	}
+	return zipper.DelSeries(ctx, paths)
+}
+
+// ScaleToCommonStep is a global option, it's not context-aware
+func (z *Zipper) ScaleToCommonStep() bool {
+	return z.global.ScaleToCommonStep()
+}
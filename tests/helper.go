@@ -559,14 +559,30 @@ func (zp TestZipper) Render(ctx context.Context, request pb.MultiFetchRequest) (
 	return resp, nil, nil
 }
 
-func (zp TestZipper) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+func (zp TestZipper) TagNames(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	return nil, nil, zipperTypes.ErrNotImplementedYet
+}
+
+func (zp TestZipper) TagValues(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error) {
+	return nil, nil, zipperTypes.ErrNotImplementedYet
+}
+
+func (zp TestZipper) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
 	return nil, zipperTypes.ErrNotImplementedYet
 }
 
-func (zp TestZipper) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+func (zp TestZipper) TagDetails(ctx context.Context, tag, filter string) (*zipperTypes.TagDetails, merry.Error) {
 	return nil, zipperTypes.ErrNotImplementedYet
 }
 
+func (zp TestZipper) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return nil, zipperTypes.ErrNotImplementedYet
+}
+
+func (zp TestZipper) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return zipperTypes.ErrNotImplementedYet
+}
+
 func (zp TestZipper) ScaleToCommonStep() bool {
 	return false
 }
@@ -0,0 +1,127 @@
+package broadcast
+
+import (
+	"sync"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// latencySmoothing is a weight of the latest observation in moving average of latency per point
+const latencySmoothing = 0.2
+
+// adaptiveSplitter sizes sub-requests of fetch by estimated number of points and observed latency of the backends
+type adaptiveSplitter struct {
+	config types.AdaptiveSplitConfig
+
+	lock      sync.Mutex
+	estimates map[string]*backendEstimate
+}
+
+// backendEstimate is observed performance of the backend
+type backendEstimate struct {
+	// step is the finest step in the responses, in seconds
+	step int64
+	// pointLatency is moving average of response latency per fetched point, in nanoseconds
+	pointLatency float64
+}
+
+func newAdaptiveSplitter(config types.AdaptiveSplitConfig) *adaptiveSplitter {
+	config.FillDefaults()
+	return &adaptiveSplitter{
+		config:    config,
+		estimates: make(map[string]*backendEstimate),
+	}
+}
+
+// limits returns step, which is used to estimate points, and limit of points per sub-request to the backend
+func (s *adaptiveSplitter) limits(backend string) (int64, int64) {
+	step := int64(s.config.DefaultStep / time.Second)
+	maxPoints := s.config.MaxPointsPerRequest
+
+	s.lock.Lock()
+	if e, ok := s.estimates[backend]; ok {
+		if e.step > 0 {
+			step = e.step
+		}
+		if s.config.TargetLatency > 0 && e.pointLatency > 0 {
+			if points := int64(float64(s.config.TargetLatency) / e.pointLatency); points < maxPoints {
+				maxPoints = points
+			}
+		}
+	}
+	s.lock.Unlock()
+
+	if step < 1 {
+		step = 1
+	}
+	if maxPoints < 1 {
+		maxPoints = 1
+	}
+	return step, maxPoints
+}
+
+// estimatePoints returns number of points of the series with the step
+func estimatePoints(m *protov3.FetchRequest, step int64) int64 {
+	points := (m.StopTime-m.StartTime)/step + 1
+	if points < 1 {
+		return 1
+	}
+	return points
+}
+
+// split groups series into sub-requests to the backend, so estimated points of each one don't exceed the limit.
+// maxMetrics limits number of series per sub-request, if it's not 0.
+func (s *adaptiveSplitter) split(backend string, metrics []protov3.FetchRequest, maxMetrics int) []*protov3.MultiFetchRequest {
+	step, maxPoints := s.limits(backend)
+
+	var requests []*protov3.MultiFetchRequest
+	var request *protov3.MultiFetchRequest
+	var points int64
+	for i := range metrics {
+		p := estimatePoints(&metrics[i], step)
+		if request == nil || points+p > maxPoints || (maxMetrics > 0 && len(request.Metrics) >= maxMetrics) {
+			request = &protov3.MultiFetchRequest{}
+			requests = append(requests, request)
+			points = 0
+		}
+		request.Metrics = append(request.Metrics, metrics[i])
+		points += p
+	}
+	return requests
+}
+
+// observe updates estimates of the backend by successful response to the sub-request
+func (s *adaptiveSplitter) observe(backend string, latency time.Duration, response *protov3.MultiFetchResponse) {
+	if response == nil {
+		return
+	}
+	var points, step int64
+	for i := range response.Metrics {
+		points += int64(len(response.Metrics[i].Values))
+		if st := response.Metrics[i].StepTime; st > 0 && (step == 0 || st < step) {
+			step = st
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.estimates[backend]
+	if !ok {
+		e = &backendEstimate{}
+		s.estimates[backend] = e
+	}
+	if step > 0 && (e.step == 0 || step < e.step) {
+		e.step = step
+	}
+	if points > 0 {
+		pointLatency := float64(latency) / float64(points)
+		if e.pointLatency == 0 {
+			e.pointLatency = pointLatency
+		} else {
+			e.pointLatency += latencySmoothing * (pointLatency - e.pointLatency)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestAdaptiveSplit(t *testing.T) {
+	metric := func(name string, start, stop int64) protov3.FetchRequest {
+		return protov3.FetchRequest{Name: name, StartTime: start, StopTime: stop, PathExpression: "a.*"}
+	}
+	names := func(requests []*protov3.MultiFetchRequest) [][]string {
+		var res [][]string
+		for _, r := range requests {
+			var n []string
+			for _, m := range r.Metrics {
+				n = append(n, m.Name)
+			}
+			res = append(res, n)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name       string
+		config     types.AdaptiveSplitConfig
+		observed   *protov3.MultiFetchResponse
+		latency    time.Duration
+		metrics    []protov3.FetchRequest
+		maxMetrics int
+		expected   [][]string
+	}{
+		{
+			name:   "by points with default step",
+			config: types.AdaptiveSplitConfig{MaxPointsPerRequest: 200},
+			// 100 points each
+			metrics:  []protov3.FetchRequest{metric("a.1", 0, 5940), metric("a.2", 0, 5940), metric("a.3", 0, 5940)},
+			expected: [][]string{{"a.1", "a.2"}, {"a.3"}},
+		},
+		{
+			name:     "series longer than limit",
+			config:   types.AdaptiveSplitConfig{MaxPointsPerRequest: 50},
+			metrics:  []protov3.FetchRequest{metric("a.1", 0, 5940), metric("a.2", 0, 60)},
+			expected: [][]string{{"a.1"}, {"a.2"}},
+		},
+		{
+			name:       "by max metrics",
+			config:     types.AdaptiveSplitConfig{MaxPointsPerRequest: 1000},
+			metrics:    []protov3.FetchRequest{metric("a.1", 0, 60), metric("a.2", 0, 60), metric("a.3", 0, 60)},
+			maxMetrics: 2,
+			expected:   [][]string{{"a.1", "a.2"}, {"a.3"}},
+		},
+		{
+			name:   "by observed step",
+			config: types.AdaptiveSplitConfig{MaxPointsPerRequest: 200},
+			observed: &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{
+				{Name: "a.0", StepTime: 10, Values: make([]float64, 10)},
+			}},
+			// 595 points each with step 10
+			metrics:  []protov3.FetchRequest{metric("a.1", 0, 5940), metric("a.2", 0, 5940)},
+			expected: [][]string{{"a.1"}, {"a.2"}},
+		},
+		{
+			name:   "by observed latency",
+			config: types.AdaptiveSplitConfig{MaxPointsPerRequest: 1000, TargetLatency: time.Second},
+			observed: &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{
+				{Name: "a.0", StepTime: 60, Values: make([]float64, 100)},
+			}},
+			// 10ms per point, so 100 points per second
+			latency:  time.Second,
+			metrics:  []protov3.FetchRequest{metric("a.1", 0, 5940), metric("a.2", 0, 5940)},
+			expected: [][]string{{"a.1"}, {"a.2"}},
+		},
+		{
+			name:     "empty",
+			config:   types.AdaptiveSplitConfig{},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAdaptiveSplitter(tt.config)
+			if tt.observed != nil {
+				s.observe("backend", tt.latency, tt.observed)
+			}
+			got := names(s.split("backend", tt.metrics, tt.maxMetrics))
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// splitClient answers fetch of any metrics and counts concurrent fetches
+type splitClient struct {
+	*dummy.DummyClient
+
+	lock     sync.Mutex
+	requests [][]string
+	inFlight int
+	peak     int
+}
+
+func (c *splitClient) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	var names []string
+	res := &protov3.MultiFetchResponse{}
+	for _, m := range request.Metrics {
+		names = append(names, m.Name)
+		res.Metrics = append(res.Metrics, protov3.FetchResponse{
+			Name: m.Name, PathExpression: m.PathExpression, StartTime: m.StartTime, StopTime: m.StopTime, StepTime: 60,
+			Values: make([]float64, (m.StopTime-m.StartTime)/60),
+		})
+	}
+
+	c.lock.Lock()
+	c.requests = append(c.requests, names)
+	c.inFlight++
+	if c.inFlight > c.peak {
+		c.peak = c.inFlight
+	}
+	c.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	c.lock.Lock()
+	c.inFlight--
+	c.lock.Unlock()
+
+	return res, &types.Stats{}, nil
+}
+
+func TestFetchAdaptiveSplit(t *testing.T) {
+	const seriesCount = 20
+	find := &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{Name: "a.*"}}}
+	for i := 0; i < seriesCount; i++ {
+		find.Metrics[0].Matches = append(find.Metrics[0].Matches, protov3.GlobMatch{Path: fmt.Sprintf("a.%02d", i), IsLeaf: true})
+	}
+	client := &splitClient{DummyClient: dummy.NewDummyClient("client", []string{"backend1"}, 0)}
+	client.AddFindResponse(&protov3.MultiGlobRequest{Metrics: []string{"a.*"}}, find, &types.Stats{}, nil)
+
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("group"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{client}),
+		WithPathCache(60),
+		WithLimiter(500),
+		WithTimeouts(timeouts),
+		WithTLDCache(false),
+		// 3 series of 100 points per sub-request
+		WithAdaptiveSplit(&types.AdaptiveSplitConfig{MaxPointsPerRequest: 300, Parallelism: 2}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if b.MaxMetricsPerRequest() != 0 {
+		t.Errorf("group with adaptive split must not be split by parent, got max metrics %d", b.MaxMetricsPerRequest())
+	}
+
+	res, _, err := b.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "a.*", StartTime: 0, StopTime: 5940, PathExpression: "a.*"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != seriesCount {
+		t.Errorf("got %d series, expected %d", len(res.Metrics), seriesCount)
+	}
+
+	if len(client.requests) != 7 {
+		t.Errorf("got %d sub-requests, expected 7: %v", len(client.requests), client.requests)
+	}
+	var names []string
+	for _, r := range client.requests {
+		if len(r) > 3 {
+			t.Errorf("sub-request %v has more than 3 series", r)
+		}
+		names = append(names, r...)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if expected := fmt.Sprintf("a.%02d", i); name != expected {
+			t.Fatalf("got series %v, expected each of a.00..a.%02d once", names, seriesCount-1)
+		}
+	}
+	if client.peak > 2 {
+		t.Errorf("got %d concurrent sub-requests, expected at most 2", client.peak)
+	}
+}
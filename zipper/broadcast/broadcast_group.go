@@ -6,6 +6,7 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/ansel1/merry"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -15,6 +16,7 @@ import (
 	"github.com/go-graphite/carbonapi/pathcache"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/routing"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
 	"go.uber.org/zap"
@@ -31,9 +33,13 @@ type BroadcastGroup struct {
 	tldCacheDisabled          bool
 	concurrencyLimit          int
 	requireSuccessAll         bool
+	mergePolicy               *types.MergePolicy
+	adaptive                  *adaptiveSplitter
+	completenessStats         bool
 
 	fetcher   types.Fetcher
 	pathCache pathcache.PathCache
+	router    *routing.Router
 	logger    *zap.Logger
 	dialer    *net.Dialer
 }
@@ -83,6 +89,13 @@ func WithPathCache(expireDelaySec int32) Option {
 	}
 }
 
+// WithRouter enables routing of the requests to the children groups by the routing rules
+func WithRouter(router *routing.Router) Option {
+	return func(bg *BroadcastGroup) {
+		bg.router = router
+	}
+}
+
 func WithLimiter(concurrencyLimit int) Option {
 	return func(bg *BroadcastGroup) {
 		bg.concurrencyLimit = concurrencyLimit
@@ -119,6 +132,29 @@ func WithSuccess(requireSuccessAll bool) Option {
 	}
 }
 
+// WithMergePolicy sets how series with the same name and time range from different children are merged
+func WithMergePolicy(strategy types.MergeStrategy, primary string) Option {
+	return func(bg *BroadcastGroup) {
+		if strategy == "" {
+			bg.mergePolicy = nil
+			return
+		}
+		bg.mergePolicy = &types.MergePolicy{Strategy: strategy, Primary: primary}
+	}
+}
+
+// WithAdaptiveSplit makes fetch requests split into sub-requests by estimated points and observed latency of the
+// children, sub-requests are sent with bounded parallelism. nil config disables it.
+func WithAdaptiveSplit(config *types.AdaptiveSplitConfig) Option {
+	return func(bg *BroadcastGroup) {
+		if config == nil {
+			bg.adaptive = nil
+			return
+		}
+		bg.adaptive = newAdaptiveSplitter(*config)
+	}
+}
+
 func New(opts ...Option) (*BroadcastGroup, merry.Error) {
 	bg := &BroadcastGroup{
 		limiter: limiter.NoopLimiter{},
@@ -142,6 +178,9 @@ func New(opts ...Option) (*BroadcastGroup, merry.Error) {
 	if bg.concurrencyLimit != 0 {
 		bg.limiter = limiter.NewServerLimiter(bg.servers, bg.concurrencyLimit)
 	}
+	if bg.adaptive != nil {
+		bg.fetcher = bg.doAdaptiveFetch
+	}
 
 	return bg, nil
 }
@@ -152,7 +191,9 @@ func (bg *BroadcastGroup) Children() []types.BackendServer {
 
 func (bg *BroadcastGroup) SetDoMultipleRequestIfSplit(v bool) {
 	bg.doMultipleRequestsIfSplit = v
-	if v {
+	if bg.adaptive != nil {
+		bg.fetcher = bg.doAdaptiveFetch
+	} else if v {
 		bg.fetcher = bg.doMultiFetch
 	} else {
 		bg.fetcher = bg.doSingleFetch
@@ -174,6 +215,17 @@ func NewBroadcastGroup(logger *zap.Logger, groupName string, doMultipleRequestsI
 	)
 }
 
+// SetAdaptiveSplit enables adaptive splitting of fetch requests, nil config disables it
+func (bg *BroadcastGroup) SetAdaptiveSplit(config *types.AdaptiveSplitConfig) {
+	WithAdaptiveSplit(config)(bg)
+	bg.SetDoMultipleRequestIfSplit(bg.doMultipleRequestsIfSplit)
+}
+
+// SetMergePolicy sets how series with the same name and time range from different children are merged
+func (bg *BroadcastGroup) SetMergePolicy(strategy types.MergeStrategy, primary string) {
+	WithMergePolicy(strategy, primary)(bg)
+}
+
 func (bg BroadcastGroup) Name() string {
 	return bg.groupName
 }
@@ -219,7 +271,33 @@ func (bg *BroadcastGroup) filterServersByTLD(requests []string, backends []types
 	return filteredBackends
 }
 
+// route selects children for the requests by the routing rules. Route is nil if some request doesn't match any rule.
+func (bg *BroadcastGroup) route(requests []string) (*routing.Route, []types.BackendServer, []types.BackendServer) {
+	route := bg.router.Route(requests)
+	if route == nil {
+		return nil, nil, nil
+	}
+	return route, bg.childrenByName(route.Groups), bg.childrenByName(route.Fallback)
+}
+
+func (bg *BroadcastGroup) childrenByName(names []string) []types.BackendServer {
+	var res []types.BackendServer
+	for _, b := range bg.backends {
+		for _, name := range names {
+			if b.Name() == name {
+				res = append(res, b)
+				break
+			}
+		}
+	}
+	return res
+}
+
 func (bg BroadcastGroup) MaxMetricsPerRequest() int {
+	if bg.adaptive != nil {
+		// requests are split by the group itself
+		return 0
+	}
 	return bg.maxMetricsPerRequest
 }
 
@@ -239,6 +317,7 @@ func (bg *BroadcastGroup) doMultiFetch(ctx context.Context, logger *zap.Logger,
 		response := types.NewServerFetchResponse()
 		response.Server = backend.Name()
 		response.AddError(err)
+		bg.failedChild(response)
 		resCh <- response
 		return
 	}
@@ -255,7 +334,9 @@ func (bg *BroadcastGroup) doMultiFetch(ctx context.Context, logger *zap.Logger,
 
 			if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
 				logger.Debug("timeout waiting for a slot")
-				resCh <- response.NonFatalError(merry.Prepend(err, "timeout waiting for slot"))
+				response.AddError(merry.Prepend(err, "timeout waiting for slot"))
+				bg.failedChild(response)
+				resCh <- response
 				return
 			}
 
@@ -288,6 +369,7 @@ func (bg *BroadcastGroup) doMultiFetch(ctx context.Context, logger *zap.Logger,
 				)
 			}
 
+			bg.failedChild(response)
 			resCh <- response
 		}(req)
 	}
@@ -312,6 +394,7 @@ func (bg *BroadcastGroup) doSingleFetch(ctx context.Context, logger *zap.Logger,
 			response := types.NewServerFetchResponse()
 			response.Server = backend.Name()
 			response.AddError(splitErr)
+			bg.failedChild(response)
 			resCh <- response
 			return
 		}
@@ -327,7 +410,9 @@ func (bg *BroadcastGroup) doSingleFetch(ctx context.Context, logger *zap.Logger,
 
 	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
 		logger.Debug("timeout waiting for a slot")
-		resCh <- response.NonFatalError(merry.Prepend(err, "timeout waiting for slot"))
+		response.AddError(merry.Prepend(err, "timeout waiting for slot"))
+		bg.failedChild(response)
+		resCh <- response
 		return
 	}
 
@@ -376,27 +461,120 @@ func (bg *BroadcastGroup) doSingleFetch(ctx context.Context, logger *zap.Logger,
 		zap.Int("failed_servers_count", len(response.Stats.FailedServers)),
 	)
 
+	bg.failedChild(response)
 	resCh <- response
 }
 
+// doAdaptiveFetch splits the request by estimated points and sends sub-requests to the backend with bounded
+// parallelism, so huge requests don't time out as a single one. Responses are merged into one.
+func (bg *BroadcastGroup) doAdaptiveFetch(ctx context.Context, logger *zap.Logger, backend types.BackendServer, reqs interface{}, resCh chan types.ServerFetcherResponse) {
+	logger = logger.With(zap.Bool("adaptive_split", true), zap.String("backend_name", backend.Name()))
+	request, ok := reqs.(*protov3.MultiFetchRequest)
+	if !ok {
+		logger.Fatal("unhandled error in doAdaptiveFetch",
+			zap.Stack("stack"),
+			zap.String("got_type", fmt.Sprintf("%T", reqs)),
+			zap.String("expected_type", fmt.Sprintf("%T", request)),
+		)
+	}
+
+	response := types.NewServerFetchResponse()
+	response.Server = backend.Name()
+
+	requests, splitErr := bg.splitRequest(ctx, request, backend)
+	if len(requests) == 0 {
+		if splitErr != nil {
+			response.AddError(splitErr)
+		}
+		bg.failedChild(response)
+		resCh <- response
+		return
+	}
+	logger.Debug("request is split",
+		zap.Int("metrics_count", len(request.Metrics)),
+		zap.Int("sub_requests_count", len(requests)),
+	)
+
+	results := make(chan *types.ServerFetchResponse, len(requests))
+	slots := make(chan struct{}, bg.adaptive.config.Parallelism)
+	for _, req := range requests {
+		go func(req *protov3.MultiFetchRequest) {
+			r := types.NewServerFetchResponse()
+			r.Server = backend.Name()
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				results <- r.NonFatalError(types.ErrTimeoutExceeded.WithValue("server", backend.Name()))
+				return
+			}
+			defer func() { <-slots }()
+
+			if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
+				logger.Debug("timeout waiting for a slot")
+				results <- r.NonFatalError(merry.Prepend(err, "timeout waiting for slot"))
+				return
+			}
+			defer bg.limiter.Leave(ctx, backend.Name())
+
+			t0 := time.Now()
+			var err merry.Error
+			r.Response, r.Stats, err = backend.Fetch(ctx, req)
+			r.AddError(err)
+			if err == nil {
+				bg.adaptive.observe(backend.Name(), time.Since(t0), r.Response)
+			}
+			results <- r
+		}(req)
+	}
+
+	for range requests {
+		_ = response.Merge(<-results)
+	}
+	logger.Debug("got response (after merge)",
+		zap.Int("metrics_in_response", len(response.Response.Metrics)),
+		zap.Int("errors_count", len(response.Err)),
+	)
+
+	bg.failedChild(response)
+	resCh <- response
+}
+
+// splitRequest splits the request into sub-requests to the backend: by estimated points if adaptive splitting is
+// enabled, otherwise by MaxMetricsPerRequest of the backend. Globs are resolved by find requests to count series.
 func (bg *BroadcastGroup) splitRequest(ctx context.Context, request *protov3.MultiFetchRequest, backend types.BackendServer) ([]*protov3.MultiFetchRequest, merry.Error) {
-	if backend.MaxMetricsPerRequest() == 0 {
+	maxMetrics := backend.MaxMetricsPerRequest()
+	if bg.adaptive != nil {
+		metrics, err := bg.expandRequest(ctx, request, backend)
+		return bg.adaptive.split(backend.Name(), metrics, maxMetrics), err
+	}
+	if maxMetrics == 0 {
 		return []*protov3.MultiFetchRequest{request}, nil
 	}
 
+	metrics, err := bg.expandRequest(ctx, request, backend)
 	var requests []*protov3.MultiFetchRequest
-	newRequest := &protov3.MultiFetchRequest{}
+	for len(metrics) > 0 {
+		n := maxMetrics
+		if n > len(metrics) {
+			n = len(metrics)
+		}
+		requests = append(requests, &protov3.MultiFetchRequest{Metrics: metrics[:n:n]})
+		metrics = metrics[n:]
+	}
+
+	return requests, err
+}
+
+// expandRequest resolves globs of the request by find requests to the backend, it returns requests of the series
+func (bg *BroadcastGroup) expandRequest(ctx context.Context, request *protov3.MultiFetchRequest, backend types.BackendServer) ([]protov3.FetchRequest, merry.Error) {
+	var metrics []protov3.FetchRequest
 
 	var err merry.Error
 	for _, metric := range request.Metrics {
-		if len(newRequest.Metrics) >= backend.MaxMetricsPerRequest() {
-			requests = append(requests, newRequest)
-			newRequest = &protov3.MultiFetchRequest{}
-		}
-
 		// TODO(Civil): Tags: improve logic
 		if strings.HasPrefix(metric.Name, "seriesByTag") {
-			newRequest.Metrics = append(newRequest.Metrics, protov3.FetchRequest{
+			metrics = append(metrics, protov3.FetchRequest{
 				Name:            metric.PathExpression,
 				StartTime:       metric.StartTime,
 				StopTime:        metric.StopTime,
@@ -409,7 +587,7 @@ func (bg *BroadcastGroup) splitRequest(ctx context.Context, request *protov3.Mul
 
 		// Do not send Find requests if we have neither globs in the request nor metric expansions
 		if !strings.ContainsAny(metric.Name, "*{") {
-			newRequest.Metrics = append(newRequest.Metrics, protov3.FetchRequest{
+			metrics = append(metrics, protov3.FetchRequest{
 				Name:            metric.Name,
 				StartTime:       metric.StartTime,
 				StopTime:        metric.StopTime,
@@ -463,27 +641,18 @@ func (bg *BroadcastGroup) splitRequest(ctx context.Context, request *protov3.Mul
 				if !match.IsLeaf {
 					continue
 				}
-				newRequest.Metrics = append(newRequest.Metrics, protov3.FetchRequest{
+				metrics = append(metrics, protov3.FetchRequest{
 					Name:            match.Path,
 					StartTime:       metric.StartTime,
 					StopTime:        metric.StopTime,
 					PathExpression:  metric.PathExpression,
 					FilterFunctions: metric.FilterFunctions,
 				})
-
-				if len(newRequest.Metrics) >= backend.MaxMetricsPerRequest() {
-					requests = append(requests, newRequest)
-					newRequest = &protov3.MultiFetchRequest{}
-				}
 			}
 		}
 	}
 
-	if len(newRequest.Metrics) > 0 {
-		requests = append(requests, newRequest)
-	}
-
-	return requests, err
+	return metrics, err
 }
 
 func (bg *BroadcastGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
@@ -494,22 +663,47 @@ func (bg *BroadcastGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 	logger := bg.logger.With(zap.String("type", "fetch"), zap.Strings("request", requestNames), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
 	logger.Debug("will try to fetch data")
 
-	backends := bg.filterServersByTLD(requestNames, bg.Children())
-
-	result := types.NewServerFetchResponse()
+	route, backends, fallback := bg.route(requestNames)
+	if route != nil {
+		logger = logger.With(zap.Strings("routing_rules", route.Rules))
+		logger.Debug("request is routed by rules",
+			zap.Strings("groups", route.Groups),
+			zap.Strings("fallback", route.Fallback),
+		)
+	} else {
+		backends = bg.filterServersByTLD(requestNames, bg.Children())
+	}
 
 	ctxNew, cancel := context.WithTimeout(ctx, bg.timeout.Render)
 	defer cancel()
 
-	resultNew, responseCount := types.DoRequest(ctxNew, logger, backends, result, request, bg.fetcher)
+	fetch := func(backends []types.BackendServer) (*types.ServerFetchResponse, int) {
+		result := types.NewServerFetchResponse()
+		result.MergePolicy = bg.mergePolicy
+		resultNew, responseCount := types.DoRequest(ctxNew, logger, backends, result, request, bg.fetcher)
+
+		result, ok := resultNew.Self().(*types.ServerFetchResponse)
+		if !ok {
+			logger.Fatal("unhandled error in Fetch",
+				zap.Stack("stack"),
+				zap.String("got_type", fmt.Sprintf("%T", resultNew.Self())),
+				zap.String("expected_type", fmt.Sprintf("%T", result)),
+			)
+		}
+		result.MergeDuplicates()
+		bg.completeness(result.Stats, backends, result.Err)
+		return result, responseCount
+	}
 
-	result, ok := resultNew.Self().(*types.ServerFetchResponse)
-	if !ok {
-		logger.Fatal("unhandled error in Fetch",
-			zap.Stack("stack"),
-			zap.String("got_type", fmt.Sprintf("%T", resultNew.Self())),
-			zap.String("expected_type", fmt.Sprintf("%T", result)),
+	result, responseCount := fetch(backends)
+	if len(result.Response.Metrics) == 0 && len(fallback) > 0 {
+		logger.Debug("routed groups returned no data, querying fallback groups",
+			zap.Any("errors", result.Err),
 		)
+		stats := result.Stats
+		backends = fallback
+		result, responseCount = fetch(backends)
+		result.Stats.Merge(stats)
 	}
 
 	if len(result.Response.Metrics) == 0 || (bg.requireSuccessAll && len(result.Err) > 0) {
@@ -583,6 +777,7 @@ func (bg *BroadcastGroup) doFind(ctx context.Context, logger *zap.Logger, backen
 	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
 		logger.Debug("timeout waiting for a slot")
 		r.AddError(merry.Prepend(err, "timeout waiting for slot"))
+		bg.failedChild(r)
 		resCh <- r
 		return
 	}
@@ -597,13 +792,19 @@ func (bg *BroadcastGroup) doFind(ctx context.Context, logger *zap.Logger, backen
 	logger.Debug("fetched response",
 		zap.Int("response_size", r.Response.Size()),
 	)
+	bg.failedChild(r)
 	resCh <- r
 }
 
 func (bg *BroadcastGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
 	logger := bg.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
 
-	backends := bg.Children()
+	route, backends, fallback := bg.route(request.Metrics)
+	if route != nil {
+		logger = logger.With(zap.Strings("routing_rules", route.Rules))
+	} else {
+		backends = bg.Children()
+	}
 
 	logger.Debug("will do query with timeout",
 		zap.Any("backends", backends),
@@ -613,18 +814,33 @@ func (bg *BroadcastGroup) Find(ctx context.Context, request *protov3.MultiGlobRe
 	ctxNew, cancel := context.WithTimeout(ctx, bg.timeout.Find)
 	defer cancel()
 
-	result := types.NewServerFindResponse()
-	result.Server = bg.Name()
-	result.Stats.ZipperRequests = uint64(len(backends))
-	resultNew, responseCount := types.DoRequest(ctxNew, logger, backends, result, request, bg.doFind)
+	find := func(backends []types.BackendServer) (*types.ServerFindResponse, int) {
+		result := types.NewServerFindResponse()
+		result.Server = bg.Name()
+		result.Stats.ZipperRequests = uint64(len(backends))
+		resultNew, responseCount := types.DoRequest(ctxNew, logger, backends, result, request, bg.doFind)
+
+		result, ok := resultNew.Self().(*types.ServerFindResponse)
+		if !ok {
+			logger.Fatal("unhandled error in Find",
+				zap.Stack("stack"),
+				zap.String("got_type", fmt.Sprintf("%T", resultNew.Self())),
+				zap.String("expected_type", fmt.Sprintf("%T", result)),
+			)
+		}
+		bg.completeness(result.Stats, backends, result.Err)
+		return result, responseCount
+	}
 
-	result, ok := resultNew.Self().(*types.ServerFindResponse)
-	if !ok {
-		logger.Fatal("unhandled error in Find",
-			zap.Stack("stack"),
-			zap.String("got_type", fmt.Sprintf("%T", resultNew.Self())),
-			zap.String("expected_type", fmt.Sprintf("%T", result)),
+	result, responseCount := find(backends)
+	if len(result.Response.Metrics) == 0 && len(fallback) > 0 {
+		logger.Debug("routed groups returned nothing, querying fallback groups",
+			zap.Any("errors", result.Err),
 		)
+		stats := result.Stats
+		backends = fallback
+		result, responseCount = find(backends)
+		result.Stats.Merge(stats)
 	}
 
 	var err merry.Error
@@ -704,7 +920,14 @@ func (bg *BroadcastGroup) Info(ctx context.Context, request *protov3.MultiMetric
 
 	ctxNew, cancel := context.WithTimeout(ctx, bg.timeout.Render)
 	defer cancel()
-	backends := bg.Children()
+	route, backends, fallback := bg.route(request.Names)
+	if route != nil {
+		logger = logger.With(zap.Strings("routing_rules", route.Rules))
+		// info is merged from all backends, so fallback groups are queried too
+		backends = append(backends, fallback...)
+	} else {
+		backends = bg.Children()
+	}
 	result := types.NewServerInfoResponse()
 	result.Server = bg.Name()
 	result.Stats.ZipperRequests = uint64(len(backends))
@@ -786,9 +1009,9 @@ func (bg *BroadcastGroup) doTagRequest(ctx context.Context, logger *zap.Logger,
 	logger.Debug("got a slot")
 	var err merry.Error
 	if request.IsName {
-		r.Response, err = backend.TagNames(ctx, request.Query, request.Limit)
+		r.Response, r.Stats, err = backend.TagNames(ctx, request.Query, request.Limit)
 	} else {
-		r.Response, err = backend.TagValues(ctx, request.Query, request.Limit)
+		r.Response, r.Stats, err = backend.TagValues(ctx, request.Query, request.Limit)
 	}
 
 	if err != nil {
@@ -801,7 +1024,7 @@ func (bg *BroadcastGroup) doTagRequest(ctx context.Context, logger *zap.Logger,
 	resCh <- r
 }
 
-func (bg *BroadcastGroup) tagEverything(ctx context.Context, isTagName bool, query string, limit int64) ([]string, merry.Error) {
+func (bg *BroadcastGroup) tagEverything(ctx context.Context, isTagName bool, query string, limit int64) ([]string, *types.Stats, merry.Error) {
 	logger := bg.logger.With(zap.String("query", query))
 	if isTagName {
 		logger = logger.With(zap.String("type", "tagName"))
@@ -821,6 +1044,7 @@ func (bg *BroadcastGroup) tagEverything(ctx context.Context, isTagName bool, que
 	backends := bg.Children()
 	result := types.NewServerTagResponse()
 	result.Server = bg.Name()
+	result.Stats.ZipperRequests = uint64(len(backends))
 
 	resultNew, responseCount := types.DoRequest(ctxNew, logger, backends, result, request, bg.doTagRequest)
 
@@ -838,6 +1062,13 @@ func (bg *BroadcastGroup) tagEverything(ctx context.Context, isTagName bool, que
 		result.Response = result.Response[:limit-1]
 	}
 
+	if noAnswer := uint64(len(backends) - responseCount); noAnswer > 0 {
+		result.Stats.TagRequests += noAnswer
+		result.Stats.TagErrors += noAnswer
+		result.Stats.TagTimeouts += noAnswer
+		result.Stats.Timeouts += noAnswer
+	}
+
 	logger.Debug("got some responses",
 		zap.Int("backends_count", len(backends)),
 		zap.Int("response_count", responseCount),
@@ -852,14 +1083,14 @@ func (bg *BroadcastGroup) tagEverything(ctx context.Context, isTagName bool, que
 		}
 	}
 
-	return result.Response, err
+	return result.Response, result.Stats, err
 }
 
-func (bg *BroadcastGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+func (bg *BroadcastGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
 	return bg.tagEverything(ctx, true, query, limit)
 }
 
-func (bg *BroadcastGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+func (bg *BroadcastGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
 	return bg.tagEverything(ctx, false, query, limit)
 }
 
@@ -12,6 +12,7 @@ import (
 	"github.com/ansel1/merry"
 
 	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/routing"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -1170,3 +1171,348 @@ func TestFetchRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestTagsAPIRequests(t *testing.T) {
+	client1 := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client1.SetFindSeriesResponse([]string{"b;dc=a", "a;dc=a"})
+	client1.SetTagDetailsResponse(&types.TagDetails{Tag: "dc", Values: []types.TagValue{{Count: 2, Value: "a"}}})
+	client2 := dummy.NewDummyClient("client2", []string{"backend2"}, 1)
+	client2.SetFindSeriesResponse([]string{"c;dc=b"})
+	client2.SetTagDetailsResponse(&types.TagDetails{Tag: "dc", Values: []types.TagValue{{Count: 1, Value: "b"}, {Count: 3, Value: "a"}}})
+
+	b, err := NewBroadcastGroup(logger, "tags", true, []types.BackendServer{client1, client2}, 60, 500, 100, timeouts, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	ctx := context.Background()
+
+	t.Run("findSeries", func(t *testing.T) {
+		res, err := b.FindSeries(ctx, []string{"dc=~.*"})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		expected := []string{"a;dc=a", "b;dc=a", "c;dc=b"}
+		if !reflect.DeepEqual(res, expected) {
+			t.Errorf("got %v, expected %v", res, expected)
+		}
+	})
+
+	t.Run("tagDetails", func(t *testing.T) {
+		res, err := b.TagDetails(ctx, "dc", "")
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		expected := &types.TagDetails{Tag: "dc", Values: []types.TagValue{{Count: 5, Value: "a"}, {Count: 1, Value: "b"}}}
+		if !reflect.DeepEqual(res, expected) {
+			t.Errorf("got %+v, expected %+v", res, expected)
+		}
+	})
+
+	t.Run("delSeries", func(t *testing.T) {
+		err := b.DelSeries(ctx, []string{"a;dc=a"})
+		if !errorsAreEqual(err, types.ErrFailedToFetch) {
+			t.Errorf("unexpected error %v, expected %v", err, types.ErrFailedToFetch)
+		}
+	})
+}
+
+func TestTagSeries(t *testing.T) {
+	paths := []string{"b;dc=a", "a;dc=b"}
+	client1 := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client1.SetTagSeriesResponse([]string{"", "a;dc=b"})
+	client2 := dummy.NewDummyClient("client2", []string{"backend2"}, 1)
+	client2.SetTagSeriesResponse([]string{"b;dc=a", "a;dc=b"})
+	client3 := dummy.NewDummyClient("client3", []string{"backend3"}, 1)
+
+	b, err := NewBroadcastGroup(logger, "tags", true, []types.BackendServer{client1, client2, client3}, 60, 500, 100, timeouts, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// responses are merged by position, regardless of order of the responses
+	for i := 0; i < 10; i++ {
+		res, err := b.TagSeries(context.Background(), paths)
+		if err != nil && !errorsAreEqual(err, types.ErrNonFatalErrors) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(res, paths) {
+			t.Fatalf("got %v, expected %v", res, paths)
+		}
+	}
+
+	t.Run("failed", func(t *testing.T) {
+		b, err := NewBroadcastGroup(logger, "tags", true, []types.BackendServer{client3}, 60, 500, 100, timeouts, false, false)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		_, err = b.TagSeries(context.Background(), paths)
+		if !errorsAreEqual(err, types.ErrFailedToFetch) {
+			t.Errorf("unexpected error %v, expected %v", err, types.ErrFailedToFetch)
+		}
+	})
+}
+
+func TestTagNamesStats(t *testing.T) {
+	client1 := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client1.SetTagNamesResponse([]string{"dc", "name"})
+	client2 := dummy.NewDummyClient("client2", []string{"backend2"}, 1)
+	client2.SetTagNamesResponse([]string{"host", "name"})
+
+	b, err := NewBroadcastGroup(logger, "tags", true, []types.BackendServer{client1, client2}, 60, 500, 100, timeouts, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res, stats, err := b.TagNames(context.Background(), "", -1)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	sort.Strings(res)
+	expected := []string{"dc", "host", "name"}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("got %v, expected %v", res, expected)
+	}
+	if stats.ZipperRequests != 2 || stats.TagRequests != 2 || stats.TagErrors != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestFetchRouting(t *testing.T) {
+	request := func(name string) *protov3.MultiFetchRequest {
+		return &protov3.MultiFetchRequest{
+			Metrics: []protov3.FetchRequest{{Name: name, StartTime: 0, StopTime: 120, PathExpression: name}},
+		}
+	}
+	response := func(name string) *protov3.MultiFetchResponse {
+		return &protov3.MultiFetchResponse{
+			Metrics: []protov3.FetchResponse{{Name: name, PathExpression: name, StartTime: 0, StopTime: 120, StepTime: 60, Values: []float64{0, 1}}},
+		}
+	}
+
+	prod := dummy.NewDummyClient("prod", []string{"backend1"}, 1)
+	db := dummy.NewDummyClient("db", []string{"backend2"}, 1)
+	archive := dummy.NewDummyClient("archive", []string{"backend3"}, 1)
+	for _, c := range []*dummy.DummyClient{prod, archive} {
+		for _, name := range []string{"app.prod.cpu", "app.prod.db.cpu", "app.dev.cpu"} {
+			c.AddFetchResponse(request(name), response(c.Name()+"."+name), &types.Stats{}, nil)
+		}
+	}
+
+	router, err := routing.New([]types.RoutingRule{
+		{Name: "db", Paths: []string{"*.prod.db"}, Groups: []string{"db"}, Fallback: []string{"archive"}, Priority: 1},
+		{Name: "prod", Paths: []string{"*.prod"}, Groups: []string{"prod"}},
+	}, []string{"prod", "db", "archive"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("root"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{prod, db, archive}),
+		WithPathCache(60),
+		WithMaxMetricsPerRequest(100),
+		WithTimeouts(timeouts),
+		WithTLDCache(false),
+		WithRouter(router),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		request  string
+		expected []string
+	}{
+		{"routed", "app.prod.cpu", []string{"prod.app.prod.cpu"}},
+		{"fallback", "app.prod.db.cpu", []string{"archive.app.prod.db.cpu"}},
+		{"not routed", "app.dev.cpu", []string{"archive.app.dev.cpu", "prod.app.dev.cpu"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _, err := b.Fetch(context.Background(), request(tt.request))
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			var names []string
+			for _, m := range res.Metrics {
+				names = append(names, m.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("got %v, expected %v", names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchMergePolicy(t *testing.T) {
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: 0, StopTime: 180, PathExpression: "foo"}},
+	}
+	response := func(start int64, values ...float64) *protov3.MultiFetchResponse {
+		return &protov3.MultiFetchResponse{
+			Metrics: []protov3.FetchResponse{{
+				Name: "foo", PathExpression: "foo", ConsolidationFunc: "average",
+				StartTime: start, StopTime: start + int64(len(values))*60, StepTime: 60, Values: values,
+				RequestStartTime: 0, RequestStopTime: 180,
+			}},
+		}
+	}
+
+	old := dummy.NewDummyClient("old", []string{"backend1"}, 1)
+	old.AddFetchResponse(request, response(0, 1, 2, math.NaN()), &types.Stats{}, nil)
+	new := dummy.NewDummyClient("new", []string{"backend2"}, 1)
+	// new cluster got dual writes later and its data is shifted by a minute
+	new.AddFetchResponse(request, response(60, 20, 30, 40), &types.Stats{}, nil)
+
+	tests := []struct {
+		strategy types.MergeStrategy
+		start    int64
+		expected []float64
+	}{
+		{types.MergePreferPrimary, 0, []float64{1, 20, 30, 40}},
+		{types.MergeMax, 0, []float64{1, 20, 30, 40}},
+		{types.MergeAverage, 0, []float64{1, 11, 30, 40}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			b, err := New(
+				WithLogger(logger),
+				WithGroupName("root"),
+				WithSplitMultipleRequests(false),
+				WithBackends([]types.BackendServer{old, new}),
+				WithPathCache(60),
+				WithTimeouts(timeouts),
+				WithTLDCache(false),
+				WithMergePolicy(tt.strategy, "new"),
+			)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			res, _, err := b.Fetch(context.Background(), request)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != 1 {
+				t.Fatalf("unexpected metrics count %d", len(res.Metrics))
+			}
+			m := res.Metrics[0]
+			if m.StartTime != tt.start || !reflect.DeepEqual(m.Values, tt.expected) {
+				t.Errorf("got start %d values %v, expected start %d values %v", m.StartTime, m.Values, tt.start, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchCompletenessStats(t *testing.T) {
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: 0, StopTime: 120, PathExpression: "foo"}},
+	}
+	response := &protov3.MultiFetchResponse{
+		Metrics: []protov3.FetchResponse{{Name: "foo", PathExpression: "foo", StartTime: 0, StopTime: 120, StepTime: 60, Values: []float64{0, 1}}},
+	}
+
+	prod := dummy.NewDummyClient("prod", []string{"backend1"}, 1)
+	prod.AddFetchResponse(request, response, &types.Stats{}, nil)
+	db := dummy.NewDummyClient("db", []string{"backend2"}, 1)
+	db.AddFetchResponse(request, nil, &types.Stats{}, types.ErrBackendError)
+	archive := dummy.NewDummyClient("archive", []string{"backend3"}, 1)
+	archive.AddFetchResponse(request, nil, &types.Stats{}, types.ErrNotFound.WithHTTPCode(404))
+	slow := dummy.NewDummyClientWithTimeout("slow", []string{"backend4"}, 1, time.Second)
+
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("root"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{prod, db, archive, slow}),
+		WithPathCache(60),
+		WithTimeouts(types.Timeouts{Find: time.Second, Render: 100 * time.Millisecond, Connect: time.Second}),
+		WithTLDCache(false),
+		WithCompletenessStats(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res, stats, err := b.Fetch(context.Background(), request)
+	if err != nil && !merry.Is(err, types.ErrNonFatalErrors) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != 1 {
+		t.Fatalf("unexpected metrics count %d", len(res.Metrics))
+	}
+
+	c := stats.Completeness()
+	expected := types.Completeness{
+		FailedGroups:    []string{"db", "slow"},
+		TimedOutServers: []string{"slow"},
+		SeriesFraction:  0.5,
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("got completeness %+v, expected %+v", c, expected)
+	}
+}
+
+func TestFetchCompletenessFailedServer(t *testing.T) {
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", StartTime: 0, StopTime: 120, PathExpression: "foo"}},
+	}
+	response := &protov3.MultiFetchResponse{
+		Metrics: []protov3.FetchResponse{{Name: "foo", PathExpression: "foo", StartTime: 0, StopTime: 120, StepTime: 60, Values: []float64{0, 1}}},
+	}
+
+	// group of 2 servers, one of them fails
+	server1 := dummy.NewDummyClient("server1", []string{"server1"}, 1)
+	server1.AddFetchResponse(request, response, &types.Stats{}, nil)
+	server2 := dummy.NewDummyClient("server2", []string{"server2"}, 1)
+	server2.AddFetchResponse(request, nil, &types.Stats{}, types.ErrBackendError)
+	group, err := New(
+		WithLogger(logger),
+		WithGroupName("group"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{server1, server2}),
+		WithPathCache(60),
+		WithTimeouts(types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second}),
+		WithTLDCache(false),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	prod := dummy.NewDummyClient("prod", []string{"backend1"}, 1)
+	prod.AddFetchResponse(request, response, &types.Stats{}, nil)
+
+	b, err := New(
+		WithLogger(logger),
+		WithGroupName("root"),
+		WithSplitMultipleRequests(false),
+		WithBackends([]types.BackendServer{prod, group}),
+		WithPathCache(60),
+		WithTimeouts(types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second}),
+		WithTLDCache(false),
+		WithCompletenessStats(true),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res, stats, err := b.Fetch(context.Background(), request)
+	if err != nil && !merry.Is(err, types.ErrNonFatalErrors) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != 1 {
+		t.Fatalf("unexpected metrics count %d", len(res.Metrics))
+	}
+
+	c := stats.Completeness()
+	expected := types.Completeness{
+		FailedServers:  []string{"server2"},
+		SeriesFraction: 0.75,
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("got completeness %+v, expected %+v", c, expected)
+	}
+}
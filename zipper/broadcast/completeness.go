@@ -0,0 +1,112 @@
+package broadcast
+
+import (
+	"net/http"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// WithCompletenessStats makes the group count its children as backend groups in completeness stats of the responses:
+// QueriedGroups, FailedGroups and PartialGroups. It's enabled for the root group only.
+func WithCompletenessStats(enabled bool) Option {
+	return func(bg *BroadcastGroup) {
+		bg.completenessStats = enabled
+	}
+}
+
+// isFailure returns true if there are errors other than "not found"
+func isFailure(errs []merry.Error) bool {
+	for _, err := range errs {
+		if !merry.Is(err, types.ErrNotFound) && merry.HTTPCode(err) != http.StatusNotFound {
+			return true
+		}
+	}
+	return false
+}
+
+// failedChild records the child in FailedGroups of its stats, if the group counts completeness and the child returned
+// errors without data. Otherwise the failed child is recorded in FailedServers, unless it reported its failed servers
+// itself, so failures of servers inside groups are seen by the root group.
+func (bg *BroadcastGroup) failedChild(res types.ServerFetcherResponse) {
+	if !isFailure(res.Errors()) {
+		return
+	}
+	var stats **types.Stats
+	hasData := false
+	switch r := res.Self().(type) {
+	case *types.ServerFetchResponse:
+		hasData = r.Response != nil && len(r.Response.Metrics) > 0
+		stats = &r.Stats
+	case *types.ServerFindResponse:
+		hasData = r.Response != nil && len(r.Response.Metrics) > 0
+		stats = &r.Stats
+	default:
+		return
+	}
+	if *stats == nil {
+		*stats = new(types.Stats)
+	}
+	if bg.completenessStats && !hasData {
+		(*stats).FailedGroups = append((*stats).FailedGroups, res.GetServer())
+	} else if len((*stats).FailedServers) == 0 {
+		(*stats).FailedServers = append((*stats).FailedServers, res.GetServer())
+	}
+}
+
+// completeness records queried children, the ones, which didn't answer in time, and the share of series lost by
+// failed servers of the children in the stats
+func (bg *BroadcastGroup) completeness(stats *types.Stats, backends []types.BackendServer, errs []merry.Error) {
+	var timedOut []string
+	for _, err := range errs {
+		if servers, ok := merry.Value(err, "timedout_backends").([]string); ok {
+			timedOut = append(timedOut, servers...)
+		}
+	}
+	stats.TimedOutServers = append(stats.TimedOutServers, timedOut...)
+	if !bg.completenessStats {
+		return
+	}
+	stats.QueriedGroups += uint64(len(backends))
+
+	// a child could fail several times, if the request is split
+	failed := make(map[string]struct{}, len(stats.FailedGroups)+len(timedOut))
+	var groups []string
+	for _, group := range append(stats.FailedGroups, timedOut...) {
+		if _, ok := failed[group]; !ok {
+			failed[group] = struct{}{}
+			groups = append(groups, group)
+		}
+	}
+	stats.FailedGroups = groups
+
+	// servers failed in the groups, which returned data, lose their share of the group's series
+	failedServers := make(map[string]struct{}, len(stats.FailedServers))
+	for _, server := range stats.FailedServers {
+		failedServers[server] = struct{}{}
+	}
+	for _, backend := range backends {
+		if _, ok := failed[backend.Name()]; ok || len(failedServers) == 0 {
+			continue
+		}
+		servers := backend.Backends()
+		n := 0
+		for _, server := range servers {
+			if _, ok := failedServers[server]; ok {
+				n++
+			}
+		}
+		if _, ok := failedServers[backend.Name()]; ok && n == 0 {
+			n = 1
+		}
+		if n == 0 {
+			continue
+		}
+		if len(servers) == 0 || n > len(servers) {
+			stats.PartialGroups++
+		} else {
+			stats.PartialGroups += float64(n) / float64(len(servers))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// tagOperation is a tags API request that is sent to every backend of the group
+type tagOperation struct {
+	name        string
+	newResponse func(server string) types.ServerFetcherResponse
+	do          func(ctx context.Context, backend types.BackendServer, r types.ServerFetcherResponse) merry.Error
+}
+
+func (bg *BroadcastGroup) doTagOperation(ctx context.Context, logger *zap.Logger, backend types.BackendServer, reqs interface{}, resCh chan types.ServerFetcherResponse) {
+	op, ok := reqs.(tagOperation)
+	logger = logger.With(
+		zap.String("group_name", bg.groupName),
+		zap.String("backend_name", backend.Name()),
+	)
+	if !ok {
+		logger.Fatal("unhandled error",
+			zap.Stack("stack"),
+			zap.String("got_type", fmt.Sprintf("%T", reqs)),
+			zap.String("expected_type", fmt.Sprintf("%T", op)),
+		)
+	}
+	r := op.newResponse(backend.Name())
+
+	logger.Debug("waiting for a slot")
+
+	if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
+		logger.Debug("timeout waiting for a slot")
+		r.AddError(merry.Prepend(err, "timeout waiting for slot"))
+		resCh <- r
+		return
+	}
+	defer bg.limiter.Leave(ctx, backend.Name())
+
+	logger.Debug("got a slot")
+	if err := op.do(ctx, backend, r); err != nil {
+		r.AddError(err)
+	}
+	resCh <- r
+}
+
+// broadcastTagOperation sends operation to all backends and merges their responses into result.
+// Returned error is fatal only if all backends failed.
+func (bg *BroadcastGroup) broadcastTagOperation(ctx context.Context, op tagOperation, result types.ServerFetcherResponse) merry.Error {
+	logger := bg.logger.With(zap.String("type", op.name))
+
+	ctxNew, cancel := context.WithTimeout(ctx, bg.timeout.Find)
+	defer cancel()
+
+	backends := bg.Children()
+	_, responseCount := types.DoRequest(ctxNew, logger, backends, result, op, bg.doTagOperation)
+
+	errs := result.Errors()
+	logger.Debug("got some responses",
+		zap.Int("backends_count", len(backends)),
+		zap.Int("response_count", responseCount),
+		zap.Bool("have_errors", len(errs) != 0),
+	)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	code, errors := helper.MergeHttpErrors(errs)
+	if len(errors) == 0 {
+		return nil
+	}
+	if len(errs) >= len(backends) {
+		return types.ErrFailedToFetch.WithHTTPCode(code).WithMessage(strings.Join(errors, "\n"))
+	}
+	return types.ErrNonFatalErrors.WithHTTPCode(code).WithMessage(strings.Join(errors, "\n"))
+}
+
+func newTagResponse(server string) types.ServerFetcherResponse {
+	r := types.NewServerTagResponse()
+	r.Server = server
+	return r
+}
+
+func (bg *BroadcastGroup) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	op := tagOperation{
+		name:        "findSeries",
+		newResponse: newTagResponse,
+		do: func(ctx context.Context, backend types.BackendServer, r types.ServerFetcherResponse) (err merry.Error) {
+			res := r.(*types.ServerTagResponse)
+			res.Response, err = backend.FindSeries(ctx, exprs)
+			return err
+		},
+	}
+
+	result := types.NewServerTagResponse()
+	result.Server = bg.Name()
+	err := bg.broadcastTagOperation(ctx, op, result)
+	sort.Strings(result.Response)
+
+	return result.Response, err
+}
+
+func (bg *BroadcastGroup) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	op := tagOperation{
+		name: "tagDetails",
+		newResponse: func(server string) types.ServerFetcherResponse {
+			r := types.NewServerTagDetailsResponse()
+			r.Server = server
+			return r
+		},
+		do: func(ctx context.Context, backend types.BackendServer, r types.ServerFetcherResponse) (err merry.Error) {
+			res := r.(*types.ServerTagDetailsResponse)
+			res.Response, err = backend.TagDetails(ctx, tag, filter)
+			return err
+		},
+	}
+
+	result := types.NewServerTagDetailsResponse()
+	result.Server = bg.Name()
+	result.Response.Tag = tag
+	err := bg.broadcastTagOperation(ctx, op, result)
+
+	return result.Response, err
+}
+
+// TagSeries registers series in all backends, paths in the result are merged by position, so n-th path is the path of
+// n-th requested series
+func (bg *BroadcastGroup) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	op := tagOperation{
+		name: "tagSeries",
+		newResponse: func(server string) types.ServerFetcherResponse {
+			r := types.NewServerTagSeriesResponse()
+			r.Server = server
+			return r
+		},
+		do: func(ctx context.Context, backend types.BackendServer, r types.ServerFetcherResponse) (err merry.Error) {
+			res := r.(*types.ServerTagSeriesResponse)
+			res.Response, err = backend.TagSeries(ctx, paths)
+			return err
+		},
+	}
+
+	result := types.NewServerTagSeriesResponse()
+	result.Server = bg.Name()
+	err := bg.broadcastTagOperation(ctx, op, result)
+
+	return result.Response, err
+}
+
+func (bg *BroadcastGroup) DelSeries(ctx context.Context, paths []string) merry.Error {
+	op := tagOperation{
+		name:        "delSeries",
+		newResponse: newTagResponse,
+		do: func(ctx context.Context, backend types.BackendServer, r types.ServerFetcherResponse) merry.Error {
+			return backend.DelSeries(ctx, paths)
+		},
+	}
+
+	result := types.NewServerTagResponse()
+	result.Server = bg.Name()
+	return bg.broadcastTagOperation(ctx, op, result)
+}
@@ -36,6 +36,9 @@ type Config struct {
 	// ScaleToCommonStep controls if metrics in one target should be aggregated to common step
 	ScaleToCommonStep bool `mapstructure:"scaleToCommonStep"`
 
+	// Index is an in-process index of metric names for find and tag autocomplete requests
+	Index types.IndexConfig `mapstructure:"index"`
+
 	isSanitized bool
 }
 
@@ -52,14 +52,17 @@ type DummyClient struct {
 	backends             []string
 	maxMetricsPerRequest int
 
-	fetchResponses    map[string]FetchResponse
-	findResponses     map[string]FindResponse
-	infoResponses     map[string]InfoResponse
-	statsResponses    map[string]StatsResponse
-	tagNameResponse   []string
-	tagValuesResponse []string
-	probeResponses    ProbeResponse
-	alwaysTimeout     time.Duration
+	fetchResponses     map[string]FetchResponse
+	findResponses      map[string]FindResponse
+	infoResponses      map[string]InfoResponse
+	statsResponses     map[string]StatsResponse
+	tagNameResponse    []string
+	tagValuesResponse  []string
+	findSeriesResponse []string
+	tagDetailsResponse *types.TagDetails
+	tagSeriesResponse  []string
+	probeResponses     ProbeResponse
+	alwaysTimeout      time.Duration
 }
 
 func (d *DummyClient) Children() []types.BackendServer {
@@ -209,18 +212,52 @@ func (c *DummyClient) SetTagNamesResponse(response []string) {
 	c.tagNameResponse = response
 }
 
-func (c *DummyClient) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.tagNameResponse, nil
+func (c *DummyClient) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	return c.tagNameResponse, types.TagStats(nil), nil
 }
 
 func (c *DummyClient) SetTagValuesResponse(response []string) {
 	c.tagValuesResponse = response
 }
 
-func (c *DummyClient) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.tagNameResponse, nil
+func (c *DummyClient) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	return c.tagValuesResponse, types.TagStats(nil), nil
 }
 
 func (c *DummyClient) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
 	return c.probeResponses.Response, c.probeResponses.Errors
 }
+
+func (c *DummyClient) SetFindSeriesResponse(response []string) {
+	c.findSeriesResponse = response
+}
+
+func (c *DummyClient) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return c.findSeriesResponse, nil
+}
+
+func (c *DummyClient) SetTagDetailsResponse(response *types.TagDetails) {
+	c.tagDetailsResponse = response
+}
+
+func (c *DummyClient) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	if c.tagDetailsResponse == nil {
+		return &types.TagDetails{Tag: tag, Values: []types.TagValue{}}, nil
+	}
+	return c.tagDetailsResponse, nil
+}
+
+func (c *DummyClient) SetTagSeriesResponse(response []string) {
+	c.tagSeriesResponse = response
+}
+
+func (c *DummyClient) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	if c.tagSeriesResponse == nil {
+		return nil, types.ErrNotImplementedYet
+	}
+	return c.tagSeriesResponse, nil
+}
+
+func (c *DummyClient) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return types.ErrNotImplementedYet
+}
@@ -0,0 +1,155 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ansel1/merry"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/msaf1980/go-metrics"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+var (
+	ErrUnsupportedEncoding = merry.New("unsupported content encoding of the response")
+	ErrDecodedTooLarge     = merry.New("decompressed response is larger than the limit")
+)
+
+// CompressionMetrics are per-server counters of compressed request and response bodies: CompressedBytes are sent or
+// received over the network, UncompressedBytes are the same bodies before compression or after decompression
+type CompressionMetrics struct {
+	CompressedBytes   metrics.Counter
+	UncompressedBytes metrics.Counter
+}
+
+var (
+	compressionMetricsLock sync.Mutex
+	compressionMetrics     = make(map[string]*CompressionMetrics)
+)
+
+// ServerCompressionMetrics returns counters of the server, they are created on the first call
+func ServerCompressionMetrics(server string) *CompressionMetrics {
+	compressionMetricsLock.Lock()
+	defer compressionMetricsLock.Unlock()
+	m, ok := compressionMetrics[server]
+	if !ok {
+		m = &CompressionMetrics{
+			CompressedBytes:   metrics.NewCounter(),
+			UncompressedBytes: metrics.NewCounter(),
+		}
+		compressionMetrics[server] = m
+	}
+	return m
+}
+
+// compression is compression config of HttpQuery
+type compression struct {
+	acceptEncoding  string
+	requestEncoding string
+	requestMinSize  int
+	maxDecodedSize  int
+	zstd            *zstd.Decoder
+	metrics         map[string]*CompressionMetrics
+}
+
+func newCompression(config *types.CompressionConfig, servers []string) *compression {
+	c := &compression{
+		acceptEncoding:  strings.Join(config.AcceptEncoding, ", "),
+		requestEncoding: config.RequestEncoding,
+		requestMinSize:  config.RequestMinSize,
+		maxDecodedSize:  config.MaxDecodedSize,
+		metrics:         make(map[string]*CompressionMetrics),
+	}
+	if c.maxDecodedSize == 0 {
+		c.maxDecodedSize = types.DefaultMaxDecodedSize
+	}
+	// decoder is used by DecodeAll only, so it doesn't start goroutines and it's safe for concurrent use
+	c.zstd, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(uint64(c.maxDecodedSize)))
+	for _, server := range servers {
+		c.metrics[server] = ServerCompressionMetrics(server)
+	}
+	return c
+}
+
+// encode compresses request body, if it's long enough. It returns content encoding of the result, empty if body
+// isn't compressed.
+func (c *compression) encode(server string, body []byte) ([]byte, string, error) {
+	if c.requestEncoding == "" || len(body) < c.requestMinSize {
+		return body, "", nil
+	}
+	var encoded []byte
+	switch c.requestEncoding {
+	case types.EncodingSnappy:
+		encoded = snappy.Encode(nil, body)
+	case types.EncodingGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, "", err
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		encoded = buf.Bytes()
+	default:
+		return body, "", nil
+	}
+	c.count(server, len(encoded), len(body))
+	return encoded, c.requestEncoding, nil
+}
+
+// decode decompresses response body of the content encoding. Decompressed body can't be larger than maxDecodedSize.
+func (c *compression) decode(server, encoding string, body []byte) ([]byte, error) {
+	var decoded []byte
+	var err error
+	switch strings.TrimSpace(strings.ToLower(encoding)) {
+	case "", "identity":
+		return body, nil
+	case types.EncodingZstd:
+		decoded, err = c.zstd.DecodeAll(body, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			err = ErrDecodedTooLarge
+		}
+	case types.EncodingSnappy:
+		var n int
+		if n, err = snappy.DecodedLen(body); err == nil {
+			if n > c.maxDecodedSize {
+				err = ErrDecodedTooLarge
+			} else {
+				decoded, err = snappy.Decode(nil, body)
+			}
+		}
+	case types.EncodingGzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(body)); err == nil {
+			decoded, err = io.ReadAll(io.LimitReader(r, int64(c.maxDecodedSize)+1))
+			if err == nil && len(decoded) > c.maxDecodedSize {
+				err = ErrDecodedTooLarge
+			}
+		}
+	default:
+		return nil, ErrUnsupportedEncoding.WithValue("encoding", encoding)
+	}
+	if err == ErrDecodedTooLarge {
+		return nil, ErrDecodedTooLarge.Here().WithMessagef("decompressed response is larger than %d bytes", c.maxDecodedSize).
+			WithValue("encoding", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.count(server, len(body), len(decoded))
+	return decoded, nil
+}
+
+func (c *compression) count(server string, compressed, uncompressed int) {
+	if m := c.metrics[server]; m != nil {
+		m.CompressedBytes.Add(uint64(compressed))
+		m.UncompressedBytes.Add(uint64(uncompressed))
+	}
+}
@@ -0,0 +1,183 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// zstd frame of "hello, world"
+var helloZstd = []byte{
+	0x28, 0xb5, 0x2f, 0xfd, 0x24, 0x0c, 0x61, 0x00, 0x00, 0x68, 0x65, 0x6c,
+	0x6c, 0x6f, 0x2c, 0x20, 0x77, 0x6f, 0x72, 0x6c, 0x64, 0x42, 0x12, 0x1b,
+	0x6d,
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(b)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func TestHttpQueryCompression(t *testing.T) {
+	hello := []byte("hello, world")
+	request := types.MultiFetchRequestV3{MultiFetchRequest: protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{
+		{Name: "carbonapi.compression.test", StartTime: 1, StopTime: 2},
+	}}}
+	requestBody, _ := request.Marshal()
+
+	tests := []struct {
+		name                  string
+		config                *types.CompressionConfig
+		responseEncoding      string
+		response              []byte
+		wantAcceptEncoding    string
+		wantRequestEncoding   string
+		wantCompressedBytes   uint64
+		wantUncompressedBytes uint64
+		wantErr               bool
+	}{
+		{
+			name:               "zstd",
+			config:             &types.CompressionConfig{AcceptEncoding: []string{"zstd", "snappy", "gzip"}},
+			responseEncoding:   "zstd",
+			response:           helloZstd,
+			wantAcceptEncoding: "zstd, snappy, gzip",
+			// response only
+			wantCompressedBytes:   uint64(len(helloZstd)),
+			wantUncompressedBytes: uint64(len(hello)),
+		},
+		{
+			name:                  "snappy request and response",
+			config:                &types.CompressionConfig{AcceptEncoding: []string{"snappy"}, RequestEncoding: "snappy"},
+			responseEncoding:      "snappy",
+			response:              snappy.Encode(nil, hello),
+			wantAcceptEncoding:    "snappy",
+			wantRequestEncoding:   "snappy",
+			wantCompressedBytes:   uint64(len(snappy.Encode(nil, requestBody)) + len(snappy.Encode(nil, hello))),
+			wantUncompressedBytes: uint64(len(requestBody) + len(hello)),
+		},
+		{
+			name:                  "gzip request shorter than min size",
+			config:                &types.CompressionConfig{AcceptEncoding: []string{"gzip"}, RequestEncoding: "gzip", RequestMinSize: 1 << 20},
+			responseEncoding:      "gzip",
+			response:              gzipped(hello),
+			wantAcceptEncoding:    "gzip",
+			wantCompressedBytes:   uint64(len(gzipped(hello))),
+			wantUncompressedBytes: uint64(len(hello)),
+		},
+		{
+			name:               "uncompressed response",
+			config:             &types.CompressionConfig{AcceptEncoding: []string{"zstd"}},
+			response:           hello,
+			wantAcceptEncoding: "zstd",
+		},
+		{
+			name:               "unsupported response encoding",
+			config:             &types.CompressionConfig{AcceptEncoding: []string{"zstd"}},
+			responseEncoding:   "br",
+			response:           hello,
+			wantAcceptEncoding: "zstd",
+			wantErr:            true,
+		},
+		{
+			name:               "corrupted response",
+			config:             &types.CompressionConfig{AcceptEncoding: []string{"zstd"}},
+			responseEncoding:   "zstd",
+			response:           helloZstd[:10],
+			wantAcceptEncoding: "zstd",
+			wantErr:            true,
+		},
+		{
+			name: "disabled",
+			// transport decompresses gzip transparently
+			responseEncoding:   "gzip",
+			response:           gzipped(hello),
+			wantAcceptEncoding: "gzip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acceptEncoding, requestEncoding string
+			var body []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = r.Header.Get("Accept-Encoding")
+				requestEncoding = r.Header.Get("Content-Encoding")
+				body, _ = io.ReadAll(r.Body)
+				if tt.responseEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.responseEncoding)
+				}
+				_, _ = w.Write(tt.response)
+			}))
+			defer srv.Close()
+
+			q := NewHttpQuery("test", []string{srv.URL}, 1, limiter.NewServerLimiter([]string{srv.URL}, 1), srv.Client(), "").WithCompression(tt.config)
+			res, err := q.DoQuery(context.Background(), zap.NewNop(), "/render/", request)
+			assert.Equal(t, tt.wantAcceptEncoding, acceptEncoding)
+			assert.Equal(t, tt.wantRequestEncoding, requestEncoding)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, hello, res.Response)
+
+			if requestEncoding == "snappy" {
+				body, _ = snappy.Decode(nil, body)
+			}
+			assert.Equal(t, requestBody, body)
+
+			if tt.config != nil {
+				m := ServerCompressionMetrics(srv.URL)
+				assert.Equal(t, tt.wantCompressedBytes, m.CompressedBytes.Count())
+				assert.Equal(t, tt.wantUncompressedBytes, m.UncompressedBytes.Count())
+			}
+		})
+	}
+}
+
+func TestCompressionMaxDecodedSize(t *testing.T) {
+	// zstd frames have at least 1KB window, so limits are larger than it
+	body := bytes.Repeat([]byte("hello, world"), 1000)
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	responses := map[string][]byte{
+		"zstd":   encoder.EncodeAll(body, nil),
+		"snappy": snappy.Encode(nil, body),
+		"gzip":   gzipped(body),
+	}
+
+	for encoding, response := range responses {
+		t.Run(encoding, func(t *testing.T) {
+			c := newCompression(&types.CompressionConfig{MaxDecodedSize: len(body)}, nil)
+			decoded, err := c.decode("server", encoding, response)
+			require.NoError(t, err)
+			assert.Equal(t, body, decoded)
+
+			c = newCompression(&types.CompressionConfig{MaxDecodedSize: len(body) - 1}, nil)
+			_, err = c.decode("server", encoding, response)
+			assert.True(t, merry.Is(err, ErrDecodedTooLarge), err)
+		})
+	}
+
+	c := newCompression(&types.CompressionConfig{}, nil)
+	assert.Equal(t, types.DefaultMaxDecodedSize, c.maxDecodedSize)
+}
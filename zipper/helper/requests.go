@@ -8,12 +8,14 @@ import (
 	"net/url"
 	"strings"
 	"sync/atomic"
+	"time"
 	"unicode/utf8"
 
 	"github.com/ansel1/merry"
 	"go.uber.org/zap"
 
 	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
 	util "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/types"
 )
@@ -93,6 +95,9 @@ type HttpQuery struct {
 	client    *http.Client
 	encoding  string
 
+	compression *compression
+	retry       *retryPolicy
+
 	counter uint64
 }
 
@@ -107,6 +112,35 @@ func NewHttpQuery(groupName string, servers []string, maxTries int, limiter limi
 	}
 }
 
+// WithCompression enables negotiation of compressed responses and compression of request bodies, nil config
+// disables it
+func (c *HttpQuery) WithCompression(config *types.CompressionConfig) *HttpQuery {
+	if config == nil {
+		c.compression = nil
+	} else {
+		c.compression = newCompression(config, c.servers)
+	}
+	return c
+}
+
+// WithRetry retries failed requests according to the policy, nil config retries every failed request without backoff
+func (c *HttpQuery) WithRetry(config *types.RetryConfig) *HttpQuery {
+	if config == nil {
+		c.retry = nil
+	} else {
+		c.retry = newRetryPolicy(config, c.groupName)
+	}
+	return c
+}
+
+// requestMethod returns HTTP method of the request
+func requestMethod(r types.Request) string {
+	if mr, ok := r.(types.MethodRequest); ok {
+		return mr.Method()
+	}
+	return http.MethodGet
+}
+
 func (c *HttpQuery) pickServer(logger *zap.Logger) string {
 	if len(c.servers) == 1 {
 		// No need to do heavy operations here
@@ -137,11 +171,18 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, u
 
 	var reader io.Reader
 	var body []byte
+	contentEncoding := ""
 	if r != nil {
 		body, err = r.Marshal()
 		if err != nil {
 			return nil, merry.Here(err).WithValue("server", server)
 		}
+		if body != nil && c.compression != nil {
+			body, contentEncoding, err = c.compression.encode(server, body)
+			if err != nil {
+				return nil, merry.Here(err).WithValue("server", server)
+			}
+		}
 		if body != nil {
 			reader = bytes.NewReader(body)
 		}
@@ -152,13 +193,33 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, u
 		zap.String("uri", u.String()),
 	)
 
+	method := requestMethod(r)
+	contentType := ""
+	if mr, ok := r.(types.MethodRequest); ok {
+		contentType = mr.ContentType()
+	}
+
 	// TODO: change to NewRequestWithContext
-	req, err := http.NewRequest("GET", u.String(), reader)
+	req, err := http.NewRequest(method, u.String(), reader)
 	if err != nil {
 		return nil, merry.Here(err).WithValue("server", server)
 	}
 
 	req.Header.Set("Accept", c.encoding)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if c.compression != nil && c.compression.acceptEncoding != "" {
+		// transport doesn't decompress responses, if Accept-Encoding is set explicitly
+		req.Header.Set("Accept-Encoding", c.compression.acceptEncoding)
+	}
+	if d, ok := ctx.Deadline(); ok {
+		// let the backend abort the request, which won't be waited for anyway
+		req.Header.Set(deadline.Header(ctx), deadline.FormatTimeout(time.Until(d)))
+	}
 	req = util.MarshalPassHeaders(ctx, util.MarshalCtx(ctx, util.MarshalCtx(ctx, req, util.HeaderUUIDZipper), util.HeaderUUIDAPI))
 
 	logger.Debug("trying to get slot",
@@ -185,7 +246,8 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, u
 			zap.Error(err),
 		)
 
-		return nil, requestError(err, server)
+		reason, sent := classifyRequestError(err)
+		return nil, withRetryable(requestError(err, server), reason, sent)
 
 	}
 	defer func() {
@@ -202,11 +264,22 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, u
 		logger.Debug("error reading body",
 			zap.Error(err),
 		)
-		return nil, merry.Here(err).WithValue("server", server)
+		return nil, withRetryable(merry.Here(err).WithValue("server", server), types.RetryBody, true)
+	}
+	if c.compression != nil {
+		body, err = c.compression.decode(server, resp.Header.Get("Content-Encoding"), body)
+		if err != nil {
+			logger.Debug("error decoding body",
+				zap.String("content_encoding", resp.Header.Get("Content-Encoding")),
+				zap.Error(err),
+			)
+			return nil, merry.Here(err).WithValue("server", server)
+		}
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, types.ErrFailedToFetch.WithValue("server", server).WithMessage(string(body)).WithHTTPCode(resp.StatusCode)
+		err := types.ErrFailedToFetch.WithValue("server", server).WithMessage(string(body)).WithHTTPCode(resp.StatusCode)
+		return nil, withRetryable(err, types.RetryStatus, true)
 	}
 
 	return &ServerResponse{Server: server, Response: body}, nil
@@ -218,6 +291,7 @@ func (c *HttpQuery) DoQuery(ctx context.Context, logger *zap.Logger, uri string,
 		maxTries = len(c.servers)
 	}
 
+	budget := retryBudgetFromContext(ctx)
 	e := types.ErrFailedToFetch.WithValue("uri", uri)
 	code := http.StatusInternalServerError
 	for try := 0; try < maxTries; try++ {
@@ -232,7 +306,9 @@ func (c *HttpQuery) DoQuery(ctx context.Context, logger *zap.Logger, uri string,
 			e = e.WithCause(err).WithHTTPCode(merry.HTTPCode(err))
 			code = merry.HTTPCode(err)
 			// TODO (msaf1980): may be metric for server failures ?
-			// TODO (msaf1980): may be retry policy for avoid retry bad queries ?
+			if c.retry != nil && (try+1 == maxTries || !c.retry.next(ctx, budget, c.groupName, try, err, requestMethod(r))) {
+				break
+			}
 			continue
 		}
 
@@ -248,6 +324,7 @@ func (c *HttpQuery) DoQueryToAll(ctx context.Context, logger *zap.Logger, uri st
 		maxTries = len(c.servers)
 	}
 
+	budget := retryBudgetFromContext(ctx)
 	res := make([]*ServerResponse, len(c.servers))
 	e := types.ErrFailedToFetch.WithValue("uri", uri)
 	responseCount := 0
@@ -262,6 +339,9 @@ func (c *HttpQuery) DoQueryToAll(ctx context.Context, logger *zap.Logger, uri st
 
 				e = e.WithCause(err)
 				code = merry.HTTPCode(err)
+				if c.retry != nil && (try+1 == maxTries || !c.retry.next(ctx, budget, c.groupName, try, err, requestMethod(r))) {
+					break
+				}
 				continue
 			}
 
@@ -1,10 +1,20 @@
 package helper
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/deadline"
+	"github.com/go-graphite/carbonapi/zipper/types"
 )
 
 func Test_stripHtmlTags(t *testing.T) {
@@ -69,3 +79,39 @@ func Test_recalcCode(t *testing.T) {
 		})
 	}
 }
+
+func TestHttpQueryDeadlineHeader(t *testing.T) {
+	var timeout string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout = r.Header.Get(deadline.DefaultHeader)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	q := NewHttpQuery("test", []string{srv.URL}, 1, limiter.NewServerLimiter([]string{srv.URL}, 1), srv.Client(), "")
+	request := types.MultiFetchRequestV3{}
+
+	_, err := q.DoQuery(context.Background(), zap.NewNop(), "/render/", request)
+	require.NoError(t, err)
+	assert.Empty(t, timeout, "header is sent without deadline")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = q.DoQuery(ctx, zap.NewNop(), "/render/", request)
+	require.NoError(t, err)
+	seconds, parseErr := strconv.ParseFloat(timeout, 64)
+	require.NoError(t, parseErr)
+	assert.InDelta(t, 10, seconds, 1)
+
+	// header is configured by the request
+	var custom string
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout = r.Header.Get(deadline.DefaultHeader)
+		custom = r.Header.Get("X-Timeout")
+		_, _ = w.Write([]byte("ok"))
+	})
+	_, err = q.DoQuery(deadline.WithHeader(ctx, "X-Timeout"), zap.NewNop(), "/render/", request)
+	require.NoError(t, err)
+	assert.Empty(t, timeout)
+	assert.NotEmpty(t, custom)
+}
@@ -0,0 +1,235 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/msaf1980/go-metrics"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// RetryMetrics are per-group counters of retried requests by reason of the retry. BudgetExhausted counts failed
+// requests, which were not retried, because retry budget of the request of carbonapi was exhausted.
+type RetryMetrics struct {
+	Timeout         metrics.Counter
+	Connection      metrics.Counter
+	Body            metrics.Counter
+	Status          metrics.Counter
+	BudgetExhausted metrics.Counter
+}
+
+var (
+	retryMetricsLock sync.Mutex
+	retryMetrics     = make(map[string]*RetryMetrics)
+)
+
+// GroupRetryMetrics returns counters of the group, they are created on the first call
+func GroupRetryMetrics(group string) *RetryMetrics {
+	retryMetricsLock.Lock()
+	defer retryMetricsLock.Unlock()
+	m, ok := retryMetrics[group]
+	if !ok {
+		m = &RetryMetrics{
+			Timeout:         metrics.NewCounter(),
+			Connection:      metrics.NewCounter(),
+			Body:            metrics.NewCounter(),
+			Status:          metrics.NewCounter(),
+			BudgetExhausted: metrics.NewCounter(),
+		}
+		retryMetrics[group] = m
+	}
+	return m
+}
+
+func (m *RetryMetrics) count(reason string) {
+	switch reason {
+	case types.RetryTimeout:
+		m.Timeout.Add(1)
+	case types.RetryConnection:
+		m.Connection.Add(1)
+	case types.RetryBody:
+		m.Body.Add(1)
+	case types.RetryStatus:
+		m.Status.Add(1)
+	}
+}
+
+// retryableKey is a key of the value of failed request errors, which describes the failure
+type retryableKey struct{}
+
+type retryable struct {
+	reason string
+	// sent is false if the request didn't reach the server, so it could be retried even if it's not idempotent
+	sent bool
+}
+
+// withRetryable describes failure of the request in its error
+func withRetryable(err merry.Error, reason string, sent bool) merry.Error {
+	return err.WithValue(retryableKey{}, retryable{reason: reason, sent: sent})
+}
+
+// classifyRequestError returns reason of the failure of the request, which wasn't answered by the server
+func classifyRequestError(err error) (reason string, sent bool) {
+	if errors.Is(err, context.Canceled) {
+		return "", true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return types.RetryConnection, false
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return types.RetryTimeout, true
+	}
+	return types.RetryConnection, true
+}
+
+// retryBudgetKey is a key of the context value with retry budgets of the groups
+type retryBudgetKey struct{}
+
+// retryBudget counts retries of requests to the groups, made for one request of carbonapi
+type retryBudget struct {
+	lock sync.Mutex
+	used map[string]int
+}
+
+func newRetryBudget() *retryBudget {
+	return &retryBudget{used: make(map[string]int)}
+}
+
+// WithRetryBudget makes requests to backends, which are made with the context, share retry budgets of the groups.
+// Context is returned as is, if it already has them.
+func WithRetryBudget(ctx context.Context) context.Context {
+	if ctx.Value(retryBudgetKey{}) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, retryBudgetKey{}, newRetryBudget())
+}
+
+// CopyRetryBudget returns dst context with retry budgets of src one
+func CopyRetryBudget(dst, src context.Context) context.Context {
+	if b := src.Value(retryBudgetKey{}); b != nil {
+		return context.WithValue(dst, retryBudgetKey{}, b)
+	}
+	return dst
+}
+
+// retryBudgetFromContext returns retry budgets of the request, new ones if context doesn't have them
+func retryBudgetFromContext(ctx context.Context) *retryBudget {
+	if b, ok := ctx.Value(retryBudgetKey{}).(*retryBudget); ok {
+		return b
+	}
+	return newRetryBudget()
+}
+
+// take returns false if limit of the group is reached, otherwise it counts the retry
+func (b *retryBudget) take(group string, limit int) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.used[group] >= limit {
+		return false
+	}
+	b.used[group]++
+	return true
+}
+
+// retryPolicy is retry config of HttpQuery
+type retryPolicy struct {
+	config  types.RetryConfig
+	status  [][2]int
+	errors  map[string]bool
+	metrics *RetryMetrics
+
+	// random returns number in [0, 1) for jitter
+	random func() float64
+}
+
+func newRetryPolicy(config *types.RetryConfig, group string) *retryPolicy {
+	p := &retryPolicy{
+		config:  *config,
+		errors:  make(map[string]bool),
+		metrics: GroupRetryMetrics(group),
+		random:  rand.Float64,
+	}
+	for _, s := range config.RetryableStatus {
+		if from, to, err := types.ParseStatusClass(s); err == nil {
+			p.status = append(p.status, [2]int{from, to})
+		}
+	}
+	for _, e := range config.RetryableErrors {
+		p.errors[e] = true
+	}
+	return p
+}
+
+// reason returns reason to retry the failed request, empty if it shouldn't be retried
+func (p *retryPolicy) reason(err merry.Error, method string) string {
+	r, ok := merry.Value(err, retryableKey{}).(retryable)
+	if !ok {
+		return ""
+	}
+	if r.reason == types.RetryStatus {
+		code := merry.HTTPCode(err)
+		retry := false
+		for _, s := range p.status {
+			if code >= s[0] && code <= s[1] {
+				retry = true
+				break
+			}
+		}
+		if !retry {
+			return ""
+		}
+	} else if !p.errors[r.reason] {
+		return ""
+	}
+	if r.sent && method == http.MethodPost && !p.config.RetryPost {
+		return ""
+	}
+	return r.reason
+}
+
+// backoff returns delay before the retry, retries are counted from 0
+func (p *retryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.config.InitialBackoff) * math.Pow(p.config.Multiplier, float64(retry))
+	if d > float64(p.config.MaxBackoff) {
+		d = float64(p.config.MaxBackoff)
+	}
+	d *= 1 + p.config.Jitter*(2*p.random()-1)
+	return time.Duration(d)
+}
+
+// next returns true after backoff, if the failed request should be retried
+func (p *retryPolicy) next(ctx context.Context, budget *retryBudget, group string, retry int, err merry.Error, method string) bool {
+	reason := p.reason(err, method)
+	if reason == "" || ctx.Err() != nil {
+		return false
+	}
+
+	d := p.backoff(retry)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		// the retry won't be answered in time anyway, so it doesn't take the budget
+		return false
+	}
+	if p.config.Budget > 0 && !budget.take(group, p.config.Budget) {
+		p.metrics.BudgetExhausted.Add(1)
+		return false
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	p.metrics.count(reason)
+	return true
+}
@@ -0,0 +1,219 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestHttpQueryRetry(t *testing.T) {
+	form := types.FormRequest{Values: url.Values{"path": []string{"a;b=c"}}}
+
+	tests := []struct {
+		name      string
+		config    *types.RetryConfig
+		request   types.Request
+		codes     []int
+		maxTries  int
+		wantCalls int
+		wantErr   bool
+		wantRetry uint64
+	}{
+		{
+			name:      "retryable status",
+			config:    &types.RetryConfig{},
+			codes:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			maxTries:  3,
+			wantCalls: 3,
+			wantRetry: 2,
+		},
+		{
+			name:      "bad request isn't retried",
+			config:    &types.RetryConfig{},
+			codes:     []int{http.StatusBadRequest, http.StatusOK},
+			maxTries:  3,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "status code",
+			config:    &types.RetryConfig{RetryableStatus: []string{"429"}},
+			codes:     []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK},
+			maxTries:  3,
+			wantCalls: 2,
+			wantErr:   true,
+			wantRetry: 1,
+		},
+		{
+			name:      "max tries",
+			config:    &types.RetryConfig{},
+			codes:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			maxTries:  2,
+			wantCalls: 2,
+			wantErr:   true,
+			wantRetry: 1,
+		},
+		{
+			name:      "post isn't retried",
+			config:    &types.RetryConfig{},
+			request:   form,
+			codes:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			maxTries:  3,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "post is retried",
+			config:    &types.RetryConfig{RetryPost: true},
+			request:   form,
+			codes:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			maxTries:  3,
+			wantCalls: 2,
+			wantRetry: 1,
+		},
+		{
+			name:      "budget",
+			config:    &types.RetryConfig{Budget: 1},
+			codes:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			maxTries:  3,
+			wantCalls: 2,
+			wantErr:   true,
+			wantRetry: 1,
+		},
+		{
+			name:      "without policy",
+			codes:     []int{http.StatusBadRequest, http.StatusForbidden, http.StatusOK},
+			maxTries:  3,
+			wantCalls: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.WriteHeader(tt.codes[n-1])
+			}))
+			defer srv.Close()
+
+			if tt.config != nil {
+				tt.config.FillDefaults()
+				tt.config.InitialBackoff = time.Millisecond
+				require.NoError(t, tt.config.Validate())
+			}
+			group := "retry " + tt.name
+			m := GroupRetryMetrics(group)
+			retries, exhausted := m.Status.Count(), m.BudgetExhausted.Count()
+			q := NewHttpQuery(group, []string{srv.URL}, tt.maxTries, limiter.NewServerLimiter([]string{srv.URL}, 1), srv.Client(), "").WithRetry(tt.config)
+			_, err := q.DoQuery(context.Background(), zap.NewNop(), "/render/", tt.request)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, int64(tt.wantCalls), calls.Load())
+			assert.Equal(t, tt.wantRetry, m.Status.Count()-retries)
+			if tt.config != nil && tt.config.Budget > 0 {
+				assert.Equal(t, uint64(1), m.BudgetExhausted.Count()-exhausted)
+			}
+		})
+	}
+}
+
+func TestHttpQueryRetryConnection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+
+	config := &types.RetryConfig{InitialBackoff: time.Millisecond}
+	config.FillDefaults()
+	m := GroupRetryMetrics("retry connection")
+	retries := m.Connection.Count()
+	q := NewHttpQuery("retry connection", []string{srv.URL}, 3, limiter.NewServerLimiter([]string{srv.URL}, 1), srv.Client(), "").WithRetry(config)
+
+	// POST is retried too, request wasn't sent to the server
+	_, err := q.DoQuery(context.Background(), zap.NewNop(), "/tags/delSeries", types.FormRequest{Values: url.Values{"path": []string{"a"}}})
+	assert.Error(t, err)
+	assert.Equal(t, uint64(2), m.Connection.Count()-retries)
+}
+
+func TestRetryBudgetShared(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	config := &types.RetryConfig{InitialBackoff: time.Millisecond, Budget: 3}
+	config.FillDefaults()
+	q := NewHttpQuery("retry budget", []string{srv.URL}, 3, limiter.NewServerLimiter([]string{srv.URL}, 1), srv.Client(), "").WithRetry(config)
+
+	ctx := WithRetryBudget(context.Background())
+	for i := 0; i < 3; i++ {
+		_, err := q.DoQuery(ctx, zap.NewNop(), "/render/", nil)
+		assert.Error(t, err)
+	}
+	// 2 retries of the first query, 1 of the second one, the third one isn't retried
+	assert.Equal(t, int64(6), calls.Load())
+}
+
+func TestRetryBudgetDeadline(t *testing.T) {
+	config := &types.RetryConfig{InitialBackoff: time.Second, Budget: 1}
+	config.FillDefaults()
+	p := newRetryPolicy(config, "retry budget deadline")
+	err := withRetryable(types.ErrBackendError.WithHTTPCode(http.StatusServiceUnavailable), types.RetryStatus, true)
+	budget := newRetryBudget()
+
+	// retry, which won't be answered before the deadline, doesn't take the budget
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.False(t, p.next(ctx, budget, "group", 0, err, http.MethodGet))
+	assert.True(t, budget.take("group", config.Budget))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newRetryPolicy(&types.RetryConfig{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}, "backoff")
+
+	random := 0.5
+	p.random = func() float64 { return random }
+	assert.Equal(t, 100*time.Millisecond, p.backoff(0))
+	assert.Equal(t, 400*time.Millisecond, p.backoff(2))
+	assert.Equal(t, time.Second, p.backoff(10))
+
+	random = 0
+	assert.Equal(t, 50*time.Millisecond, p.backoff(0))
+	random = 1
+	assert.Equal(t, 1500*time.Millisecond, p.backoff(10))
+}
+
+func TestParseStatusClass(t *testing.T) {
+	from, to, err := types.ParseStatusClass("5xx")
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{500, 599}, [2]int{from, to})
+
+	from, to, err = types.ParseStatusClass("429")
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{429, 429}, [2]int{from, to})
+
+	for _, s := range []string{"", "6xx", "xx", "42", "abc", "5xxx"} {
+		_, _, err = types.ParseStatusClass(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/ansel1/merry"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// Helpers for backends that implement graphite-web tags HTTP API (graphite-web itself, VictoriaMetrics, ...).
+// prefix is prepended to API path, e.x. to use VictoriaMetrics cluster URLs.
+// Reads are sent to one of the servers, writes are sent to all of them, as servers of the group are replicas.
+
+// FindSeries returns series that match all of tag expressions (/tags/findSeries)
+func FindSeries(ctx context.Context, logger *zap.Logger, httpQuery *HttpQuery, prefix string, exprs []string) ([]string, merry.Error) {
+	logger = logger.With(zap.String("type", "findSeries"))
+	rewrite, _ := url.Parse("http://127.0.0.1" + prefix + "/tags/findSeries")
+	rewrite.RawQuery = url.Values{"expr": exprs}.Encode()
+
+	r := []string{}
+	res, e := httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	if e != nil {
+		return r, e
+	}
+	if len(res.Response) == 0 {
+		return r, nil
+	}
+
+	err := json.Unmarshal(res.Response, &r)
+	if err != nil {
+		return r, merry.Wrap(err)
+	}
+
+	logger.Debug("got client response",
+		zap.Int("series", len(r)),
+	)
+
+	return r, nil
+}
+
+// TagDetails returns values of the tag with amount of series, filter is a regular expression for values (/tags/<tag>)
+func TagDetails(ctx context.Context, logger *zap.Logger, httpQuery *HttpQuery, prefix, tag, filter string) (*types.TagDetails, merry.Error) {
+	logger = logger.With(zap.String("type", "tagDetails"))
+	rewrite, _ := url.Parse("http://127.0.0.1" + prefix + "/tags/" + url.PathEscape(tag))
+	if filter != "" {
+		rewrite.RawQuery = url.Values{"filter": []string{filter}}.Encode()
+	}
+
+	r := &types.TagDetails{Tag: tag, Values: []types.TagValue{}}
+	res, e := httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), nil)
+	if e != nil {
+		return r, e
+	}
+	if len(res.Response) == 0 {
+		return r, nil
+	}
+
+	err := json.Unmarshal(res.Response, r)
+	if err != nil {
+		return r, merry.Wrap(err)
+	}
+
+	logger.Debug("got client response",
+		zap.Int("values", len(r.Values)),
+	)
+
+	return r, nil
+}
+
+// TagSeries registers tagged series and returns their canonical paths (/tags/tagMultiSeries)
+func TagSeries(ctx context.Context, logger *zap.Logger, httpQuery *HttpQuery, prefix string, paths []string) ([]string, merry.Error) {
+	logger = logger.With(zap.String("type", "tagSeries"))
+	rewrite, _ := url.Parse("http://127.0.0.1" + prefix + "/tags/tagMultiSeries")
+
+	r := []string{}
+	res, e := httpQuery.DoQueryToAll(ctx, logger, rewrite.RequestURI(), types.FormRequest{Values: url.Values{"path": paths}})
+	if e != nil {
+		return r, e
+	}
+
+	for _, s := range res {
+		if s == nil || len(s.Response) == 0 {
+			continue
+		}
+		err := json.Unmarshal(s.Response, &r)
+		if err != nil {
+			return r, merry.Wrap(err).WithValue("server", s.Server)
+		}
+		break
+	}
+
+	logger.Debug("got client response",
+		zap.Strings("paths", r),
+	)
+
+	return r, nil
+}
+
+// DelSeries removes tagged series (/tags/delSeries)
+func DelSeries(ctx context.Context, logger *zap.Logger, httpQuery *HttpQuery, prefix string, paths []string) merry.Error {
+	logger = logger.With(zap.String("type", "delSeries"))
+	rewrite, _ := url.Parse("http://127.0.0.1" + prefix + "/tags/delSeries")
+
+	_, e := httpQuery.DoQueryToAll(ctx, logger, rewrite.RequestURI(), types.FormRequest{Values: url.Values{"path": paths}})
+	return e
+}
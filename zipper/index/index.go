@@ -0,0 +1,363 @@
+// Package index implements in-process index of metric names. It answers find and tag autocomplete requests without
+// requests to the backends, while it's fresh enough.
+package index
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const (
+	defaultRefreshInterval = 10 * time.Minute
+	defaultMaxDepth        = 16
+	// crawlTagsLimit is a limit of tag names and values requested from the backends
+	crawlTagsLimit = 100000
+)
+
+// Index is a backend group, which answers find and tag autocomplete requests from the index of metric names.
+// Index is populated by crawls of the backends and by their responses to the requests, which were not answered by it.
+// Requests, which index can't answer (tagged series, tag expressions), are sent to the backends, as well as all requests
+// if the index is older than MaxStaleness.
+type Index struct {
+	types.BackendServer
+
+	cfg     types.IndexConfig
+	timeout time.Duration
+	logger  *zap.Logger
+
+	mu      sync.RWMutex
+	tree    *tree
+	tags    map[string]map[string]struct{}
+	updated time.Time
+
+	now  func() time.Time
+	quit chan struct{}
+}
+
+// New returns index of the metrics of the backend. Snapshot is loaded if it's configured, refreshes are started by Start.
+func New(logger *zap.Logger, backend types.BackendServer, cfg types.IndexConfig, timeout time.Duration) *Index {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	if cfg.MaxStaleness <= 0 {
+		cfg.MaxStaleness = 3 * cfg.RefreshInterval
+	}
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = defaultMaxDepth
+	}
+
+	idx := &Index{
+		BackendServer: backend,
+		cfg:           cfg,
+		timeout:       timeout,
+		logger:        logger.With(zap.String("type", "index")),
+		now:           time.Now,
+		quit:          make(chan struct{}),
+	}
+
+	if cfg.SnapshotPath != "" {
+		s, err := loadSnapshot(cfg.SnapshotPath)
+		if err != nil {
+			idx.logger.Warn("failed to load index snapshot",
+				zap.String("path", cfg.SnapshotPath),
+				zap.Error(err),
+			)
+		} else {
+			idx.tree, idx.tags = s.restore()
+			idx.updated = s.Updated
+			idx.logger.Info("index snapshot is loaded",
+				zap.String("path", cfg.SnapshotPath),
+				zap.Time("updated", s.Updated),
+				zap.Int("nodes", idx.tree.size),
+			)
+		}
+	}
+	return idx
+}
+
+// Start starts periodic refreshes of the index. The first refresh is done immediately, unless the snapshot is recent.
+func (idx *Index) Start() {
+	idx.mu.RLock()
+	wait := idx.cfg.RefreshInterval - idx.now().Sub(idx.updated)
+	idx.mu.RUnlock()
+	if wait < 0 || wait > idx.cfg.RefreshInterval {
+		wait = 0
+	}
+	go idx.loop(wait)
+}
+
+// Stop stops refreshes of the index
+func (idx *Index) Stop() {
+	close(idx.quit)
+}
+
+func (idx *Index) loop(wait time.Duration) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-idx.quit:
+			return
+		case <-timer.C:
+		}
+		if err := idx.Refresh(context.Background()); err != nil {
+			idx.logger.Error("failed to refresh index",
+				zap.Error(err),
+			)
+		}
+		timer.Reset(idx.cfg.RefreshInterval)
+	}
+}
+
+// Refresh crawls the backends and replaces the index. Index isn't changed if crawl failed.
+func (idx *Index) Refresh(ctx context.Context) merry.Error {
+	t0 := time.Now()
+	t := newTree()
+	if err := idx.crawl(ctx, t); err != nil {
+		return err
+	}
+	var tags map[string]map[string]struct{}
+	if idx.cfg.Tags {
+		var err merry.Error
+		if tags, err = idx.crawlTags(ctx); err != nil {
+			return err
+		}
+	}
+
+	updated := idx.now()
+	// snapshot is taken before the tree is published, as it's changed by learned paths after that
+	var s *snapshot
+	if idx.cfg.SnapshotPath != "" {
+		s = newSnapshot(t, tags, updated)
+	}
+	nodes := t.size
+
+	idx.mu.Lock()
+	idx.tree, idx.tags, idx.updated = t, tags, updated
+	idx.mu.Unlock()
+
+	idx.logger.Info("index is refreshed",
+		zap.Int("nodes", nodes),
+		zap.Int("tags", len(tags)),
+		zap.Duration("runtime", time.Since(t0)),
+	)
+
+	if s != nil {
+		if err := s.save(idx.cfg.SnapshotPath); err != nil {
+			idx.logger.Error("failed to save index snapshot",
+				zap.String("path", idx.cfg.SnapshotPath),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// crawl fills the tree by the list of metrics, if backends support it, or by find requests level by level
+func (idx *Index) crawl(ctx context.Context, t *tree) merry.Error {
+	listCtx, cancel := context.WithTimeout(ctx, idx.timeout)
+	list, _, err := idx.BackendServer.List(listCtx)
+	cancel()
+	if err == nil && list != nil && len(list.Metrics) > 0 {
+		for _, name := range list.Metrics {
+			if !strings.ContainsRune(name, ';') {
+				t.insert(name, true)
+			}
+		}
+		return nil
+	}
+
+	pattern := "*"
+	for depth := 1; depth <= idx.cfg.MaxDepth; depth++ {
+		findCtx, cancel := context.WithTimeout(ctx, idx.timeout)
+		res, _, err := idx.BackendServer.Find(findCtx, &protov3.MultiGlobRequest{Metrics: []string{pattern}})
+		cancel()
+		if err != nil {
+			if merry.Is(err, types.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		branches := false
+		if res != nil {
+			for _, m := range res.Metrics {
+				for _, match := range m.Matches {
+					t.insert(match.Path, match.IsLeaf)
+					branches = branches || !match.IsLeaf
+				}
+			}
+		}
+		if !branches {
+			return nil
+		}
+		pattern += ".*"
+	}
+	return nil
+}
+
+func (idx *Index) crawlTags(ctx context.Context) (map[string]map[string]struct{}, merry.Error) {
+	limit := "&limit=" + strconv.Itoa(crawlTagsLimit)
+
+	tagCtx, cancel := context.WithTimeout(ctx, idx.timeout)
+	names, _, err := idx.BackendServer.TagNames(tagCtx, limit[1:], -1)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]map[string]struct{}, len(names))
+	for _, name := range names {
+		tagCtx, cancel := context.WithTimeout(ctx, idx.timeout)
+		values, _, err := idx.BackendServer.TagValues(tagCtx, "tag="+url.QueryEscape(name)+limit, -1)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		set := make(map[string]struct{}, len(values))
+		for _, v := range values {
+			set[v] = struct{}{}
+		}
+		tags[name] = set
+	}
+	return tags, nil
+}
+
+// fresh returns true if the index could answer requests, it should be called under lock
+func (idx *Index) fresh() bool {
+	return idx.tree != nil && idx.now().Sub(idx.updated) <= idx.cfg.MaxStaleness
+}
+
+// find answers the request from the index. It returns false if any glob isn't found, as the index could miss new metrics.
+func (idx *Index) find(request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.fresh() || len(request.Metrics) == 0 {
+		return nil, false
+	}
+
+	res := &protov3.MultiGlobResponse{Metrics: make([]protov3.GlobResponse, 0, len(request.Metrics))}
+	for _, pattern := range request.Metrics {
+		// tagged series are not indexed
+		if strings.ContainsAny(pattern, ";()") {
+			return nil, false
+		}
+		matches, err := idx.tree.match(pattern)
+		if err != nil || len(matches) == 0 {
+			return nil, false
+		}
+		res.Metrics = append(res.Metrics, protov3.GlobResponse{Name: pattern, Matches: matches})
+	}
+	return res, true
+}
+
+// learn adds paths of the find response to the index
+func (idx *Index) learn(res *protov3.MultiGlobResponse) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.tree == nil {
+		return
+	}
+	for _, m := range res.Metrics {
+		for _, match := range m.Matches {
+			if !strings.ContainsRune(match.Path, ';') {
+				idx.tree.insert(match.Path, match.IsLeaf)
+			}
+		}
+	}
+}
+
+func (idx *Index) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	if res, ok := idx.find(request); ok {
+		return res, &types.Stats{IndexHits: 1}, nil
+	}
+
+	res, stats, err := idx.BackendServer.Find(ctx, request)
+	if res != nil && (err == nil || merry.Is(err, types.ErrNonFatalErrors)) {
+		idx.learn(res)
+	}
+	return res, missStats(stats), err
+}
+
+// tagQuery answers autocomplete query from the index. Queries with tag expressions are not supported.
+func (idx *Index) tagQuery(isTagName bool, query string, limit int64) ([]string, bool) {
+	params, err := url.ParseQuery(query)
+	if err != nil || len(params["expr"]) > 0 {
+		return nil, false
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.fresh() || idx.tags == nil {
+		return nil, false
+	}
+
+	var res []string
+	if isTagName {
+		prefix := params.Get("tagPrefix")
+		for tag := range idx.tags {
+			if strings.HasPrefix(tag, prefix) {
+				res = append(res, tag)
+			}
+		}
+	} else {
+		tag := params.Get("tag")
+		if tag == "" {
+			return nil, false
+		}
+		prefix := params.Get("valuePrefix")
+		for v := range idx.tags[tag] {
+			if strings.HasPrefix(v, prefix) {
+				res = append(res, v)
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, false
+	}
+
+	sort.Strings(res)
+	if l, err := strconv.ParseInt(params.Get("limit"), 10, 64); err == nil && l > 0 && (limit <= 0 || l < limit) {
+		limit = l
+	}
+	if limit > 0 && int64(len(res)) > limit {
+		res = res[:limit]
+	}
+	return res, true
+}
+
+func (idx *Index) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	if res, ok := idx.tagQuery(true, query, limit); ok {
+		return res, &types.Stats{IndexHits: 1}, nil
+	}
+	res, stats, err := idx.BackendServer.TagNames(ctx, query, limit)
+	return res, missStats(stats), err
+}
+
+func (idx *Index) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	if res, ok := idx.tagQuery(false, query, limit); ok {
+		return res, &types.Stats{IndexHits: 1}, nil
+	}
+	res, stats, err := idx.BackendServer.TagValues(ctx, query, limit)
+	return res, missStats(stats), err
+}
+
+// missStats returns stats of the backends with the index miss, stats of the backends could be shared
+func missStats(stats *types.Stats) *types.Stats {
+	res := &types.Stats{IndexMisses: 1}
+	if stats != nil {
+		res.Merge(stats)
+	}
+	return res
+}
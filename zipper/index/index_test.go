@@ -0,0 +1,242 @@
+package index
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func globResponse(pattern string, matches ...protov3.GlobMatch) *protov3.MultiGlobResponse {
+	return &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{Name: pattern, Matches: matches}}}
+}
+
+func branch(path string) protov3.GlobMatch {
+	return protov3.GlobMatch{Path: path}
+}
+
+func leaf(path string) protov3.GlobMatch {
+	return protov3.GlobMatch{Path: path, IsLeaf: true}
+}
+
+func findRequest(patterns ...string) *protov3.MultiGlobRequest {
+	return &protov3.MultiGlobRequest{Metrics: patterns}
+}
+
+// newBackend returns backend with the tree: a.b.c, a.b.d, a.e, a.e.f, g
+func newBackend() *dummy.DummyClient {
+	backend := dummy.NewDummyClient("backend", []string{"backend1"}, 0)
+	backend.AddFindResponse(findRequest("*"), globResponse("*", branch("a"), leaf("g")), nil, nil)
+	backend.AddFindResponse(findRequest("*.*"), globResponse("*.*", branch("a.b"), branch("a.e"), leaf("a.e")), nil, nil)
+	backend.AddFindResponse(findRequest("*.*.*"), globResponse("*.*.*", leaf("a.b.c"), leaf("a.b.d"), leaf("a.e.f")), nil, nil)
+	return backend
+}
+
+func TestTreeMatch(t *testing.T) {
+	tr := newTree()
+	for _, path := range []string{"a.b.c", "a.b.d", "a.e", "a.e.f", "g"} {
+		tr.insert(path, true)
+	}
+	if tr.size != 7 {
+		t.Errorf("unexpected size %d", tr.size)
+	}
+	if tr.insert("a.b.c", true) {
+		t.Error("existing path changed the tree")
+	}
+
+	tests := []struct {
+		pattern  string
+		expected []protov3.GlobMatch
+	}{
+		{"*", []protov3.GlobMatch{branch("a"), leaf("g")}},
+		{"a.*", []protov3.GlobMatch{branch("a.b"), branch("a.e"), leaf("a.e")}},
+		{"a.b.*", []protov3.GlobMatch{leaf("a.b.c"), leaf("a.b.d")}},
+		{"a.b.{c,x}", []protov3.GlobMatch{leaf("a.b.c")}},
+		{"a.[be].?", []protov3.GlobMatch{leaf("a.b.c"), leaf("a.b.d"), leaf("a.e.f")}},
+		{"a.b.c", []protov3.GlobMatch{leaf("a.b.c")}},
+		{"a.x.*", nil},
+		{"a.b.c.d", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			matches, err := tr.match(tt.pattern)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(matches, tt.expected) {
+				t.Errorf("unexpected matches %v, expected %v", matches, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	backend := newBackend()
+	backend.AddFindResponse(findRequest("new.*"), globResponse("new.*", leaf("new.metric")), nil, nil)
+
+	idx := New(zap.NewNop(), backend, types.IndexConfig{Enabled: true, RefreshInterval: time.Minute}, time.Second)
+	now := time.Unix(1000000, 0)
+	idx.now = func() time.Time { return now }
+
+	// index is empty before the first refresh
+	_, stats, _ := idx.Find(context.Background(), findRequest("*"))
+	if stats.IndexMisses != 1 {
+		t.Errorf("request is answered by empty index: %+v", stats)
+	}
+
+	if err := idx.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	res, stats, err := idx.Find(context.Background(), findRequest("a.*", "a.b.c"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if stats.IndexHits != 1 {
+		t.Errorf("request isn't answered by index: %+v", stats)
+	}
+	expected := &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{
+		{Name: "a.*", Matches: []protov3.GlobMatch{branch("a.b"), branch("a.e"), leaf("a.e")}},
+		{Name: "a.b.c", Matches: []protov3.GlobMatch{leaf("a.b.c")}},
+	}}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("unexpected response %+v, expected %+v", res, expected)
+	}
+
+	// metric, which appeared after refresh, is requested from the backend and learned
+	_, stats, _ = idx.Find(context.Background(), findRequest("new.*"))
+	if stats.IndexMisses != 1 {
+		t.Errorf("unknown metric is answered by index: %+v", stats)
+	}
+	_, stats, _ = idx.Find(context.Background(), findRequest("new.*"))
+	if stats.IndexHits != 1 {
+		t.Errorf("learned metric isn't answered by index: %+v", stats)
+	}
+
+	// tagged series are not indexed
+	_, stats, _ = idx.Find(context.Background(), findRequest("seriesByTag('name=a')"))
+	if stats.IndexMisses != 1 {
+		t.Errorf("tagged request is answered by index: %+v", stats)
+	}
+
+	// stale index isn't used
+	now = now.Add(3*time.Minute + time.Second)
+	_, stats, _ = idx.Find(context.Background(), findRequest("a.*"))
+	if stats.IndexMisses != 1 {
+		t.Errorf("request is answered by stale index: %+v", stats)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.snapshot")
+	backend := newBackend()
+	backend.SetTagNamesResponse([]string{"dc", "name"})
+	backend.SetTagValuesResponse([]string{"x", "y"})
+	cfg := types.IndexConfig{Enabled: true, Tags: true, SnapshotPath: path}
+
+	idx := New(zap.NewNop(), backend, cfg, time.Second)
+	if err := idx.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// backend is not available after restart
+	restored := New(zap.NewNop(), dummy.NewDummyClient("empty", []string{"empty1"}, 0), cfg, time.Second)
+	res, stats, err := restored.Find(context.Background(), findRequest("a.b.*"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if stats.IndexHits != 1 {
+		t.Fatalf("request isn't answered by restored index: %+v", stats)
+	}
+	if !reflect.DeepEqual(res, globResponse("a.b.*", leaf("a.b.c"), leaf("a.b.d"))) {
+		t.Errorf("unexpected response %+v", res)
+	}
+	values, _, _ := restored.TagValues(context.Background(), "tag=dc", -1)
+	if !reflect.DeepEqual(values, []string{"x", "y"}) {
+		t.Errorf("unexpected tag values %v", values)
+	}
+}
+
+func TestTags(t *testing.T) {
+	backend := dummy.NewDummyClient("backend", []string{"backend1"}, 0)
+	backend.AddFindResponse(findRequest("*"), globResponse("*", leaf("a")), nil, nil)
+	backend.SetTagNamesResponse([]string{"dc", "datacenter", "name"})
+	backend.SetTagValuesResponse([]string{"dc1", "dc2", "other"})
+
+	idx := New(zap.NewNop(), backend, types.IndexConfig{Enabled: true, Tags: true}, time.Second)
+	if err := idx.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		isName   bool
+		query    string
+		limit    int64
+		expected []string
+		hit      bool
+	}{
+		{"names", true, "", -1, []string{"datacenter", "dc", "name"}, true},
+		{"names by prefix", true, "tagPrefix=d", -1, []string{"datacenter", "dc"}, true},
+		{"names with limit", true, "tagPrefix=d&limit=1", -1, []string{"datacenter"}, true},
+		{"values by prefix", false, "tag=dc&valuePrefix=dc", 1, []string{"dc1"}, true},
+		{"expressions", true, "expr=dc%3Ddc1", -1, []string{"dc", "datacenter", "name"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res []string
+			var stats *types.Stats
+			if tt.isName {
+				res, stats, _ = idx.TagNames(context.Background(), tt.query, tt.limit)
+			} else {
+				res, stats, _ = idx.TagValues(context.Background(), tt.query, tt.limit)
+			}
+			if !reflect.DeepEqual(res, tt.expected) {
+				t.Errorf("unexpected result %v, expected %v", res, tt.expected)
+			}
+			if (stats.IndexHits == 1) != tt.hit {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestRefreshWhileLearning(t *testing.T) {
+	backend := newBackend()
+	var patterns []string
+	for i := 0; i < 100; i++ {
+		pattern := "new" + strconv.Itoa(i) + ".*"
+		patterns = append(patterns, pattern)
+		backend.AddFindResponse(findRequest(pattern), globResponse(pattern, leaf("new"+strconv.Itoa(i)+".metric")), nil, nil)
+	}
+	cfg := types.IndexConfig{Enabled: true, SnapshotPath: filepath.Join(t.TempDir(), "index.snapshot")}
+
+	idx := New(zap.NewNop(), backend, cfg, time.Second)
+	if err := idx.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			if err := idx.Refresh(context.Background()); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}
+	}()
+	for _, pattern := range patterns {
+		_, _, _ = idx.Find(context.Background(), findRequest(pattern))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,112 @@
+package index
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// snapshot is a content of the index saved to disk
+type snapshot struct {
+	Version int
+	Updated time.Time
+	// Leaves are names of metrics, Branches are directories without metrics
+	Leaves   []string
+	Branches []string
+	Tags     map[string][]string
+}
+
+func newSnapshot(t *tree, tags map[string]map[string]struct{}, updated time.Time) *snapshot {
+	s := &snapshot{Version: snapshotVersion, Updated: updated}
+	t.walk(func(path string, isLeaf bool) {
+		if isLeaf {
+			s.Leaves = append(s.Leaves, path)
+		} else {
+			s.Branches = append(s.Branches, path)
+		}
+	})
+	if tags != nil {
+		s.Tags = make(map[string][]string, len(tags))
+		for tag, values := range tags {
+			list := make([]string, 0, len(values))
+			for v := range values {
+				list = append(list, v)
+			}
+			s.Tags[tag] = list
+		}
+	}
+	return s
+}
+
+// restore returns the tree and tags of the snapshot, tags are nil if they were not crawled
+func (s *snapshot) restore() (*tree, map[string]map[string]struct{}) {
+	t := newTree()
+	for _, path := range s.Leaves {
+		t.insert(path, true)
+	}
+	for _, path := range s.Branches {
+		t.insert(path, false)
+	}
+	var tags map[string]map[string]struct{}
+	if s.Tags != nil {
+		tags = make(map[string]map[string]struct{}, len(s.Tags))
+		for tag, values := range s.Tags {
+			set := make(map[string]struct{}, len(values))
+			for _, v := range values {
+				set[v] = struct{}{}
+			}
+			tags[tag] = set
+		}
+	}
+	return t, tags
+}
+
+// save writes the snapshot to the file atomically: it's written to the temporary file, which is renamed then
+func (s *snapshot) save(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	zw := gzip.NewWriter(f)
+	if err = gob.NewEncoder(zw).Encode(s); err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func loadSnapshot(path string) (*snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{}
+	if err = gob.NewDecoder(zr).Decode(s); err != nil {
+		return nil, err
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return s, nil
+}
@@ -0,0 +1,127 @@
+package index
+
+import (
+	"sort"
+	"strings"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"github.com/go-graphite/carbonapi/pkg/glob"
+)
+
+// node is a node of the metric tree. Node could be both a leaf and a branch, if metric has the same name as directory.
+type node struct {
+	children map[string]*node
+	leaf     bool
+}
+
+// tree is a trie of metric names by their dot-separated nodes. Names of nodes are interned, so common nodes like
+// `cpu` or `count` are stored once.
+type tree struct {
+	root  node
+	names map[string]string
+	// size is a count of the nodes
+	size int
+}
+
+func newTree() *tree {
+	return &tree{names: make(map[string]string)}
+}
+
+func (t *tree) intern(name string) string {
+	if s, ok := t.names[name]; ok {
+		return s
+	}
+	t.names[name] = name
+	return name
+}
+
+// insert adds path to the tree, it returns true if the tree was changed
+func (t *tree) insert(path string, isLeaf bool) bool {
+	changed := false
+	n := &t.root
+	for path != "" {
+		var name string
+		if i := strings.IndexByte(path, '.'); i >= 0 {
+			name, path = path[:i], path[i+1:]
+		} else {
+			name, path = path, ""
+		}
+		if n.children == nil {
+			n.children = make(map[string]*node)
+		}
+		child, ok := n.children[name]
+		if !ok {
+			child = &node{}
+			n.children[t.intern(name)] = child
+			t.size++
+			changed = true
+		}
+		n = child
+	}
+	if isLeaf && !n.leaf {
+		n.leaf = true
+		changed = true
+	}
+	return changed
+}
+
+func hasGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[{")
+}
+
+// match returns paths matched by the glob pattern, sorted by path. Node, which is both leaf and branch, is returned twice.
+func (t *tree) match(pattern string) ([]protov3.GlobMatch, error) {
+	nodes := strings.Split(pattern, ".")
+	matchers, err := glob.NodeMatchers(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []protov3.GlobMatch
+	var walk func(n *node, prefix string, level int)
+	visit := func(child *node, path string, level int) {
+		if level < len(nodes)-1 {
+			walk(child, path+".", level+1)
+			return
+		}
+		if len(child.children) > 0 || !child.leaf {
+			matches = append(matches, protov3.GlobMatch{Path: path, IsLeaf: false})
+		}
+		if child.leaf {
+			matches = append(matches, protov3.GlobMatch{Path: path, IsLeaf: true})
+		}
+	}
+	walk = func(n *node, prefix string, level int) {
+		if !hasGlob(nodes[level]) {
+			if child, ok := n.children[nodes[level]]; ok {
+				visit(child, prefix+nodes[level], level)
+			}
+			return
+		}
+		for name, child := range n.children {
+			if matchers[level].MatchString(name) {
+				visit(child, prefix+name, level)
+			}
+		}
+	}
+	walk(&t.root, "", 0)
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Path < matches[j].Path })
+	return matches, nil
+}
+
+// walk calls fn for every node of the tree, which is a leaf or has no children
+func (t *tree) walk(fn func(path string, isLeaf bool)) {
+	var walk func(n *node, prefix string)
+	walk = func(n *node, prefix string) {
+		for name, child := range n.children {
+			path := prefix + name
+			if child.leaf || len(child.children) == 0 {
+				fn(path, child.leaf)
+			}
+			walk(child, path+".")
+		}
+	}
+	walk(&t.root, "")
+}
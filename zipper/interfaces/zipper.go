@@ -17,7 +17,11 @@ type CarbonZipper interface {
 	Info(ctx context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, merry.Error)
 	RenderCompat(ctx context.Context, metrics []string, from, until int64) ([]*types.MetricData, *zipperTypes.Stats, merry.Error)
 	Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error)
-	TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error)
-	TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error)
+	TagNames(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error)
+	TagValues(ctx context.Context, query string, limit int64) ([]string, *zipperTypes.Stats, merry.Error)
+	FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error)
+	TagDetails(ctx context.Context, tag, filter string) (*zipperTypes.TagDetails, merry.Error)
+	TagSeries(ctx context.Context, paths []string) ([]string, merry.Error)
+	DelSeries(ctx context.Context, paths []string) merry.Error
 	ScaleToCommonStep() bool
 }
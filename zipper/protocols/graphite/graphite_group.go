@@ -60,7 +60,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 
 	httpClient := helper.GetHTTPClient(logger, config)
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB).WithCompression(config.Compression).WithRetry(config.Retry)
 
 	c := &GraphiteGroup{
 		groupName:            config.GroupName,
@@ -371,12 +371,30 @@ func (c *GraphiteGroup) doTagQuery(ctx context.Context, isTagName bool, query st
 	return r, nil
 }
 
-func (c *GraphiteGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, true, query, limit)
+func (c *GraphiteGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, true, query, limit)
+	return res, types.TagStats(err), err
 }
 
-func (c *GraphiteGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, false, query, limit)
+func (c *GraphiteGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, false, query, limit)
+	return res, types.TagStats(err), err
+}
+
+func (c *GraphiteGroup) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return helper.FindSeries(ctx, c.logger, c.httpQuery, "", exprs)
+}
+
+func (c *GraphiteGroup) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	return helper.TagDetails(ctx, c.logger, c.httpQuery, "", tag, filter)
+}
+
+func (c *GraphiteGroup) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return helper.TagSeries(ctx, c.logger, c.httpQuery, "", paths)
+}
+
+func (c *GraphiteGroup) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return helper.DelSeries(ctx, c.logger, c.httpQuery, "", paths)
 }
 
 func (c *GraphiteGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
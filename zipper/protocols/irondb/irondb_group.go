@@ -664,12 +664,30 @@ func (c *IronDBGroup) doTagQuery(ctx context.Context, isTagName bool, query stri
 
 }
 
-func (c *IronDBGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, true, query, limit)
+func (c *IronDBGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, true, query, limit)
+	return res, types.TagStats(err), err
 }
 
-func (c *IronDBGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, false, query, limit)
+func (c *IronDBGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, false, query, limit)
+	return res, types.TagStats(err), err
+}
+
+func (c *IronDBGroup) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *IronDBGroup) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *IronDBGroup) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *IronDBGroup) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return types.ErrNotSupportedByBackend
 }
 
 func (c *IronDBGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
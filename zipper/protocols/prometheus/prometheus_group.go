@@ -170,7 +170,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 		}
 	}
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB).WithCompression(config.Compression).WithRetry(config.Retry)
 
 	return NewWithEverythingInitialized(logger, config, tldCacheDisabled, requireSuccessAll, limiter, step, maxPointsPerQuery, forceMinStepInterval, delay, httpQuery, httpClient)
 }
@@ -681,12 +681,30 @@ func (c *PrometheusGroup) doTagQuery(ctx context.Context, isTagName bool, query
 	return c.doComplexTagQuery(ctx, isTagName, params, limit)
 }
 
-func (c *PrometheusGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, true, query, limit)
+func (c *PrometheusGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, true, query, limit)
+	return res, types.TagStats(err), err
 }
 
-func (c *PrometheusGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, false, query, limit)
+func (c *PrometheusGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, false, query, limit)
+	return res, types.TagStats(err), err
+}
+
+func (c *PrometheusGroup) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *PrometheusGroup) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *PrometheusGroup) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *PrometheusGroup) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return types.ErrNotSupportedByBackend
 }
 
 func (c *PrometheusGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
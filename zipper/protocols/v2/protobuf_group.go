@@ -64,7 +64,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 	httpClient := helper.GetHTTPClient(logger, config)
 
 	httpLimiter := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB).WithCompression(config.Compression).WithRetry(config.Retry)
 
 	c := &ClientProtoV2Group{
 		groupName:            config.GroupName,
@@ -380,12 +380,30 @@ func (c *ClientProtoV2Group) doTagQuery(ctx context.Context, isTagName bool, que
 	return r, nil
 }
 
-func (c *ClientProtoV2Group) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, true, query, limit)
+func (c *ClientProtoV2Group) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, true, query, limit)
+	return res, types.TagStats(err), err
 }
 
-func (c *ClientProtoV2Group) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, false, query, limit)
+func (c *ClientProtoV2Group) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, false, query, limit)
+	return res, types.TagStats(err), err
+}
+
+func (c *ClientProtoV2Group) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientProtoV2Group) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientProtoV2Group) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientProtoV2Group) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return types.ErrNotSupportedByBackend
 }
 
 func (c *ClientProtoV2Group) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
@@ -69,7 +69,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 
 	httpClient := helper.GetHTTPClient(logger, config)
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, l, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, l, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB).WithCompression(config.Compression).WithRetry(config.Retry)
 
 	c := &ClientProtoV3Group{
 		groupName:            config.GroupName,
@@ -260,12 +260,30 @@ func (c *ClientProtoV3Group) doTagQuery(ctx context.Context, isTagName bool, que
 	return r, nil
 }
 
-func (c *ClientProtoV3Group) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, true, query, limit)
+func (c *ClientProtoV3Group) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, true, query, limit)
+	return res, types.TagStats(err), err
 }
 
-func (c *ClientProtoV3Group) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	return c.doTagQuery(ctx, false, query, limit)
+func (c *ClientProtoV3Group) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	res, err := c.doTagQuery(ctx, false, query, limit)
+	return res, types.TagStats(err), err
+}
+
+func (c *ClientProtoV3Group) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientProtoV3Group) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientProtoV3Group) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientProtoV3Group) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return types.ErrNotSupportedByBackend
 }
 
 func (c *ClientProtoV3Group) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
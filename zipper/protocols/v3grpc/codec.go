@@ -0,0 +1,41 @@
+package v3grpc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec marshals gRPC messages. Messages of carbonapi_v3_pb and carbonapi_v3_grpc are generated by gogoproto and are
+// marshaled by their own methods, others (e.x. google.protobuf.Empty) by protobuf.
+type Codec struct{}
+
+type gogoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case gogoMessage:
+		return m.Marshal()
+	case proto.Message:
+		return proto.Marshal(m)
+	}
+	return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case gogoMessage:
+		return m.Unmarshal(data)
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+	}
+	return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+}
+
+// Name is the content subtype of the codec, it's the same as of the default one
+func (Codec) Name() string {
+	return "proto"
+}
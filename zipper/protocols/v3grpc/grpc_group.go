@@ -0,0 +1,411 @@
+package v3grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/go-graphite/carbonapi/internal/dns"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/tlsconfig"
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// MaxMessageSize is a limit of the received gRPC message size
+const MaxMessageSize = 256 << 20
+
+var ErrUnsupportedScheme = merry.New("gRPC server should be http:// (plain text HTTP/2) or https:// url")
+
+func init() {
+	aliases := []string{"carbonapi_v3_grpc"}
+	metadata.Metadata.Lock()
+	for _, name := range aliases {
+		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.ProtocolInits[name] = New
+		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
+	}
+	defer metadata.Metadata.Unlock()
+}
+
+// ClientGRPCGroup is used to connect to backends with carbonapi_v3_grpc.CarbonV1 service, implements BackendServer interface
+type ClientGRPCGroup struct {
+	groupName string
+	servers   []string
+
+	clients map[string]carbonapi_v3_grpc.CarbonV1Client
+
+	limiter              limiter.ServerLimiter
+	logger               *zap.Logger
+	timeout              types.Timeouts
+	maxTries             int
+	maxMetricsPerRequest int
+
+	counter uint64
+}
+
+func (c *ClientGRPCGroup) Children() []types.BackendServer {
+	return []types.BackendServer{c}
+}
+
+func New(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool) (types.BackendServer, merry.Error) {
+	if config.ConcurrencyLimit == nil {
+		return nil, types.ErrConcurrencyLimitNotSet
+	}
+	if len(config.Servers) == 0 {
+		return nil, types.ErrNoServersSpecified
+	}
+	l := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
+
+	return NewWithLimiter(logger, config, tldCacheDisabled, requireSuccessAll, l)
+}
+
+func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled, requireSuccessAll bool, l limiter.ServerLimiter) (types.BackendServer, merry.Error) {
+	logger = logger.With(zap.String("type", "grpcGroup"), zap.String("name", config.GroupName))
+
+	tlsConfig := &tls.Config{}
+	if config.TLSClientConfig != nil {
+		var warns []string
+		var err error
+		tlsConfig, warns, err = tlsconfig.ParseClientTLSConfig(config.TLSClientConfig)
+		if err != nil {
+			return nil, merry.Prepend(err, "failed to initialize client for group "+config.GroupName)
+		}
+		if len(warns) > 0 {
+			logger.Warn("insecure options detected, while parsing gRPC Client TLS Config for backed",
+				zap.Strings("warnings", warns),
+			)
+		}
+	}
+
+	dial := dns.GetDialContextWithTimeout(config.Timeouts.Connect, *config.KeepAliveInterval)
+	clients := make(map[string]carbonapi_v3_grpc.CarbonV1Client, len(config.Servers))
+	for _, server := range config.Servers {
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, merry.Prepend(err, "invalid server "+server)
+		}
+		var creds credentials.TransportCredentials
+		switch u.Scheme {
+		case "http":
+			creds = insecure.NewCredentials()
+		case "https":
+			creds = credentials.NewTLS(tlsConfig)
+		default:
+			return nil, ErrUnsupportedScheme.WithValue("server", server)
+		}
+
+		conn, err := grpc.NewClient(u.Host,
+			grpc.WithTransportCredentials(creds),
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return dial(ctx, "tcp", addr)
+			}),
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec{}), grpc.MaxCallRecvMsgSize(MaxMessageSize)),
+		)
+		if err != nil {
+			return nil, merry.Prepend(err, "failed to initialize client for server "+server)
+		}
+		clients[server] = carbonapi_v3_grpc.NewCarbonV1Client(conn)
+	}
+
+	c := &ClientGRPCGroup{
+		groupName:            config.GroupName,
+		servers:              config.Servers,
+		timeout:              *config.Timeouts,
+		maxTries:             *config.MaxTries,
+		maxMetricsPerRequest: *config.MaxBatchSize,
+
+		clients: clients,
+		limiter: l,
+		logger:  logger,
+	}
+	return c, nil
+}
+
+func (c *ClientGRPCGroup) MaxMetricsPerRequest() int {
+	return c.maxMetricsPerRequest
+}
+
+func (c *ClientGRPCGroup) Name() string {
+	return c.groupName
+}
+
+func (c *ClientGRPCGroup) Backends() []string {
+	return c.servers
+}
+
+func (c *ClientGRPCGroup) pickServer() string {
+	if len(c.servers) == 1 {
+		return c.servers[0]
+	}
+	counter := atomic.AddUint64(&c.counter, 1)
+	return c.servers[counter%uint64(len(c.servers))]
+}
+
+// outgoingContext passes request ids and headers of the context to the backend in metadata of the call, as they are
+// passed in headers of HTTP requests
+func outgoingContext(ctx context.Context) context.Context {
+	md := grpcMetadata.MD{}
+	for name, value := range util.GetPassHeaders(ctx) {
+		md.Append(name, value)
+	}
+	uuid := util.GetUUID(ctx)
+	md.Set(util.HeaderUUIDZipper, uuid)
+	md.Set(util.HeaderUUIDAPI, uuid)
+	return grpcMetadata.NewOutgoingContext(ctx, md)
+}
+
+// call sends the request to the servers round-robin, until it succeeds or tries are exhausted. Calls, which are
+// answered with NotFound status, are successful, as a backend with no metrics is not an error.
+func (c *ClientGRPCGroup) call(ctx context.Context, logger *zap.Logger, do func(ctx context.Context, client carbonapi_v3_grpc.CarbonV1Client) error) (notFound bool, err merry.Error) {
+	maxTries := c.maxTries
+	if len(c.servers) > maxTries {
+		maxTries = len(c.servers)
+	}
+
+	ctx = outgoingContext(ctx)
+	e := types.ErrFailedToFetch.WithValue("group", c.groupName)
+	for try := 0; try < maxTries; try++ {
+		server := c.pickServer()
+		if err := c.limiter.Enter(ctx, server); err != nil {
+			logger.Debug("timeout waiting for a slot")
+			return false, merry.Here(err).WithValue("server", server)
+		}
+		callErr := do(ctx, c.clients[server])
+		c.limiter.Leave(ctx, server)
+
+		if callErr == nil {
+			return false, nil
+		}
+		err := statusError(callErr, server)
+		if err == nil {
+			return true, nil
+		}
+		logger.Debug("have errors",
+			zap.String("error", err.Error()),
+			zap.String("server", server),
+		)
+		if merry.Is(err, types.ErrTimeoutExceeded) || merry.Is(err, types.ErrNotSupportedByBackend) {
+			// there is no time or sense for another try
+			return false, err
+		}
+		e = e.WithCause(err).WithHTTPCode(merry.HTTPCode(err))
+	}
+
+	return false, types.ErrMaxTriesExceeded.WithCause(e).WithHTTPCode(merry.HTTPCode(e))
+}
+
+// statusError converts gRPC status to the zipper error, it returns nil for NotFound status
+func statusError(err error, server string) merry.Error {
+	s := status.Convert(err)
+	switch s.Code() {
+	case codes.OK, codes.NotFound:
+		return nil
+	case codes.DeadlineExceeded, codes.Canceled:
+		return types.ErrTimeoutExceeded.WithValue("server", server).WithCause(err)
+	case codes.Unimplemented:
+		return types.ErrNotSupportedByBackend.WithValue("server", server).WithCause(err)
+	case codes.Unavailable:
+		return types.ErrBackendError.WithValue("server", server).WithCause(err)
+	}
+	return types.ErrFailedToFetch.WithValue("server", server).WithMessage(s.Message()).WithHTTPCode(HTTPStatus(s.Code()))
+}
+
+func (c *ClientGRPCGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
+	stats := &types.Stats{
+		RenderRequests: 1,
+	}
+
+	var r *protov3.MultiFetchResponse
+	notFound, err := c.call(ctx, logger, func(ctx context.Context, client carbonapi_v3_grpc.CarbonV1Client) (err error) {
+		r, err = client.FetchMetrics(ctx, request)
+		return err
+	})
+	if err != nil {
+		stats.RenderErrors = 1
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.RenderTimeouts = 1
+		}
+		logger.Warn("errors occurred while getting results",
+			zap.Any("errors", err),
+		)
+		return nil, stats, err
+	}
+	if notFound {
+		r = &protov3.MultiFetchResponse{}
+	}
+
+	stats.MemoryUsage = int64(r.Size())
+
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "find"), zap.Strings("request", request.Metrics))
+	stats := &types.Stats{
+		FindRequests: 1,
+	}
+
+	var globs *protov3.MultiGlobResponse
+	notFound, err := c.call(ctx, logger, func(ctx context.Context, client carbonapi_v3_grpc.CarbonV1Client) (err error) {
+		globs, err = client.FindMetrics(ctx, request)
+		return err
+	})
+	if err != nil {
+		stats.FindErrors = 1
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.FindTimeouts = 1
+		}
+		return nil, stats, err
+	}
+	if notFound {
+		return nil, stats, types.ErrNotFound
+	}
+
+	return globs, stats, nil
+}
+
+func (c *ClientGRPCGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "info"), zap.String("request", request.String()))
+	stats := &types.Stats{
+		InfoRequests: 1,
+	}
+
+	var infos *protov3.MultiMetricsInfoResponse
+	notFound, err := c.call(ctx, logger, func(ctx context.Context, client carbonapi_v3_grpc.CarbonV1Client) (err error) {
+		infos, err = client.MetricsInfo(ctx, request)
+		return err
+	})
+	if err != nil {
+		stats.InfoErrors = 1
+		if merry.Is(err, types.ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.InfoTimeouts = 1
+		}
+		return nil, stats, err
+	}
+	if notFound {
+		return nil, stats, types.ErrNoResponseFetched
+	}
+
+	stats.MemoryUsage = int64(infos.Size())
+
+	r := &protov3.ZipperInfoResponse{
+		Info: map[string]protov3.MultiMetricsInfoResponse{
+			c.Name(): *infos,
+		},
+	}
+
+	return r, stats, nil
+}
+
+func (c *ClientGRPCGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "list"))
+	stats := &types.Stats{}
+
+	var list *protov3.ListMetricsResponse
+	notFound, err := c.call(ctx, logger, func(ctx context.Context, client carbonapi_v3_grpc.CarbonV1Client) (err error) {
+		list, err = client.ListMetrics(ctx, &empty.Empty{})
+		return err
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+	if notFound {
+		list = &protov3.ListMetricsResponse{}
+	}
+
+	return list, stats, nil
+}
+
+func (c *ClientGRPCGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	logger := c.logger.With(zap.String("type", "stats"))
+	stats := &types.Stats{}
+
+	var details *protov3.MetricDetailsResponse
+	notFound, err := c.call(ctx, logger, func(ctx context.Context, client carbonapi_v3_grpc.CarbonV1Client) (err error) {
+		details, err = client.Stats(ctx, &empty.Empty{})
+		return err
+	})
+	if err != nil {
+		return nil, stats, err
+	}
+	if notFound {
+		details = &protov3.MetricDetailsResponse{}
+	}
+
+	return details, stats, nil
+}
+
+// TagNames isn't a method of carbonapi_v3_grpc.CarbonV1 service
+func (c *ClientGRPCGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	return nil, types.TagStats(types.ErrNotSupportedByBackend), types.ErrNotSupportedByBackend
+}
+
+// TagValues isn't a method of carbonapi_v3_grpc.CarbonV1 service
+func (c *ClientGRPCGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	return nil, types.TagStats(types.ErrNotSupportedByBackend), types.ErrNotSupportedByBackend
+}
+
+func (c *ClientGRPCGroup) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientGRPCGroup) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientGRPCGroup) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	return nil, types.ErrNotSupportedByBackend
+}
+
+func (c *ClientGRPCGroup) DelSeries(ctx context.Context, paths []string) merry.Error {
+	return types.ErrNotSupportedByBackend
+}
+
+func (c *ClientGRPCGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	logger := c.logger.With(zap.String("function", "prober"))
+	req := &protov3.MultiGlobRequest{
+		Metrics: []string{"*"},
+	}
+
+	logger.Debug("doing request",
+		zap.Strings("request", req.Metrics),
+	)
+
+	res, _, err := c.Find(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlds []string
+	for _, m := range res.Metrics {
+		for _, v := range m.Matches {
+			tlds = append(tlds, v.Path)
+		}
+	}
+
+	logger.Debug("will return data",
+		zap.Strings("tlds", tlds),
+	)
+
+	return tlds, nil
+}
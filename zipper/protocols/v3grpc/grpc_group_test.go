@@ -0,0 +1,275 @@
+package v3grpc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/protocol/carbonapi_v3_grpc"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	util "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// standIn is in-process CarbonV1 backend: metrics `a.b` and `a.c` are known to it
+type standIn struct {
+	calls atomic.Int64
+	// err is returned by all calls, if it's set
+	err error
+
+	lock     sync.Mutex
+	metadata grpcMetadata.MD
+}
+
+func (s *standIn) enter(ctx context.Context) error {
+	s.calls.Add(1)
+	s.lock.Lock()
+	s.metadata, _ = grpcMetadata.FromIncomingContext(ctx)
+	s.lock.Unlock()
+	return s.err
+}
+
+func (s *standIn) GetVersion(ctx context.Context, _ *empty.Empty) (*carbonapi_v3_grpc.ProtocolVersionResponse, error) {
+	return &carbonapi_v3_grpc.ProtocolVersionResponse{Version: 3}, s.enter(ctx)
+}
+
+func (s *standIn) FetchMetrics(ctx context.Context, req *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, error) {
+	if err := s.enter(ctx); err != nil {
+		return nil, err
+	}
+	res := &protov3.MultiFetchResponse{}
+	for _, m := range req.Metrics {
+		for _, name := range []string{"a.b", "a.c"} {
+			if m.PathExpression != name && m.PathExpression != "a.*" {
+				continue
+			}
+			res.Metrics = append(res.Metrics, protov3.FetchResponse{
+				Name:           name,
+				PathExpression: m.PathExpression,
+				StartTime:      m.StartTime,
+				StopTime:       m.StartTime + 3,
+				StepTime:       1,
+				Values:         []float64{1, 2, 3},
+			})
+		}
+	}
+	if len(res.Metrics) == 0 {
+		return nil, status.Error(codes.NotFound, "no metrics")
+	}
+	return res, nil
+}
+
+func (s *standIn) FindMetrics(ctx context.Context, req *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, error) {
+	if err := s.enter(ctx); err != nil {
+		return nil, err
+	}
+	if req.Metrics[0] != "a.*" {
+		return nil, status.Error(codes.NotFound, "no metrics")
+	}
+	return &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{
+		Name:    "a.*",
+		Matches: []protov3.GlobMatch{{Path: "a.b", IsLeaf: true}, {Path: "a.c", IsLeaf: true}},
+	}}}, nil
+}
+
+func (s *standIn) MetricsInfo(ctx context.Context, req *protov3.MultiMetricsInfoRequest) (*protov3.MultiMetricsInfoResponse, error) {
+	if err := s.enter(ctx); err != nil {
+		return nil, err
+	}
+	res := &protov3.MultiMetricsInfoResponse{}
+	for _, name := range req.Names {
+		res.Metrics = append(res.Metrics, protov3.MetricsInfoResponse{Name: name, ConsolidationFunc: "average"})
+	}
+	return res, nil
+}
+
+func (s *standIn) ListMetrics(ctx context.Context, _ *empty.Empty) (*protov3.ListMetricsResponse, error) {
+	if err := s.enter(ctx); err != nil {
+		return nil, err
+	}
+	return &protov3.ListMetricsResponse{Metrics: []string{"a.b", "a.c"}}, nil
+}
+
+func (s *standIn) Stats(ctx context.Context, _ *empty.Empty) (*protov3.MetricDetailsResponse, error) {
+	if err := s.enter(ctx); err != nil {
+		return nil, err
+	}
+	return nil, status.Error(codes.Unimplemented, "no stats")
+}
+
+// serve starts gRPC server of the backend and returns its url
+func serve(t *testing.T, backend carbonapi_v3_grpc.CarbonV1Server) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.ForceServerCodec(Codec{}))
+	carbonapi_v3_grpc.RegisterCarbonV1Server(s, backend)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+	return "http://" + lis.Addr().String()
+}
+
+func newGroup(t *testing.T, servers ...string) *ClientGRPCGroup {
+	cfg := types.BackendV2{GroupName: "grpc", Servers: servers}
+	cfg.FillDefaults()
+	limit, tries, batch, keepAlive := 10, 2, 100, time.Second
+	cfg.ConcurrencyLimit, cfg.MaxTries, cfg.MaxBatchSize, cfg.KeepAliveInterval = &limit, &tries, &batch, &keepAlive
+	group, err := New(zap.NewNop(), cfg, true, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return group.(*ClientGRPCGroup)
+}
+
+func TestFetch(t *testing.T) {
+	c := newGroup(t, serve(t, &standIn{}))
+
+	res, stats, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{
+		{Name: "a.*", PathExpression: "a.*", StartTime: 100, StopTime: 103},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != 2 || res.Metrics[0].Name != "a.b" || res.Metrics[1].Name != "a.c" {
+		t.Errorf("unexpected response %+v", res)
+	}
+	if !reflect.DeepEqual(res.Metrics[0].Values, []float64{1, 2, 3}) {
+		t.Errorf("unexpected values %v", res.Metrics[0].Values)
+	}
+	if stats.RenderRequests != 1 || stats.RenderErrors != 0 || stats.MemoryUsage == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	res, _, err = c.Fetch(context.Background(), &protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{
+		{Name: "x", PathExpression: "x", StartTime: 100, StopTime: 103},
+	}})
+	if err != nil || len(res.Metrics) != 0 {
+		t.Errorf("unexpected response %+v or error %v for unknown metric", res, err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	c := newGroup(t, serve(t, &standIn{}))
+
+	res, _, err := c.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{"a.*"}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != 1 || len(res.Metrics[0].Matches) != 2 {
+		t.Errorf("unexpected response %+v", res)
+	}
+
+	tlds, err := c.ProbeTLDs(context.Background())
+	if !merry.Is(err, types.ErrNotFound) {
+		t.Errorf("unexpected tlds %v or error %v", tlds, err)
+	}
+}
+
+func TestInfoList(t *testing.T) {
+	c := newGroup(t, serve(t, &standIn{}))
+
+	info, _, err := c.Info(context.Background(), &protov3.MultiMetricsInfoRequest{Names: []string{"a.b"}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if m := info.Info["grpc"].Metrics; len(m) != 1 || m[0].Name != "a.b" {
+		t.Errorf("unexpected response %+v", info)
+	}
+
+	list, _, err := c.List(context.Background())
+	if err != nil || !reflect.DeepEqual(list.Metrics, []string{"a.b", "a.c"}) {
+		t.Errorf("unexpected response %+v or error %v", list, err)
+	}
+
+	_, _, err = c.Stats(context.Background())
+	if !merry.Is(err, types.ErrNotSupportedByBackend) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	c := newGroup(t, serve(t, &standIn{}))
+
+	// tags aren't supported by CarbonV1 service
+	_, stats, err := c.TagNames(context.Background(), "", -1)
+	if !merry.Is(err, types.ErrNotSupportedByBackend) || stats.TagErrors != 1 {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	backend := &standIn{}
+	c := newGroup(t, serve(t, backend))
+
+	ctx := util.SetUUID(context.Background(), "uuid")
+	ctx = util.SetPassHeaders(ctx, map[string]string{"X-Dashboard": "main"})
+	if _, _, err := c.Find(ctx, &protov3.MultiGlobRequest{Metrics: []string{"a.*"}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if v := backend.metadata.Get("x-dashboard"); !reflect.DeepEqual(v, []string{"main"}) {
+		t.Errorf("header isn't passed: %v", backend.metadata)
+	}
+	if v := backend.metadata.Get(util.HeaderUUIDAPI); !reflect.DeepEqual(v, []string{"uuid"}) {
+		t.Errorf("uuid isn't passed: %v", backend.metadata)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	// server is unavailable
+	unavailable := "http://" + lis.Addr().String()
+	lis.Close()
+	failing := &standIn{err: status.Error(codes.Internal, "storage failed")}
+
+	c := newGroup(t, serve(t, &standIn{}), unavailable, serve(t, failing))
+	for i := 0; i < 6; i++ {
+		if _, _, err := c.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{"a.*"}}); err != nil {
+			t.Fatalf("request isn't retried: %v", err)
+		}
+	}
+	if failing.calls.Load() == 0 {
+		t.Errorf("failing server isn't called")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	backend := &standIn{err: status.Error(codes.DeadlineExceeded, "too slow")}
+	c := newGroup(t, serve(t, backend), serve(t, backend))
+
+	_, stats, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{
+		{Name: "a.*", PathExpression: "a.*", StartTime: 100, StopTime: 103},
+	}})
+	if !merry.Is(err, types.ErrTimeoutExceeded) || stats.RenderTimeouts != 1 {
+		t.Errorf("unexpected error %v or stats %+v", err, stats)
+	}
+	// there is no time for another try
+	if backend.calls.Load() != 1 {
+		t.Errorf("timed out request is retried, calls %d", backend.calls.Load())
+	}
+}
+
+func TestUnsupportedScheme(t *testing.T) {
+	cfg := types.BackendV2{GroupName: "grpc", Servers: []string{"grpc://127.0.0.1:8080"}}
+	cfg.FillDefaults()
+	limit, tries, batch, keepAlive := 10, 2, 100, time.Second
+	cfg.ConcurrencyLimit, cfg.MaxTries, cfg.MaxBatchSize, cfg.KeepAliveInterval = &limit, &tries, &batch, &keepAlive
+	if _, err := New(zap.NewNop(), cfg, true, false); !merry.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -8,6 +8,9 @@ import (
 
 	"github.com/ansel1/merry"
 	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/types"
 )
 
 func (c *VictoriaMetricsGroup) doTagQuery(ctx context.Context, isTagName bool, query string, limit int64, supportedFeatures *vmSupportedFeatures) ([]string, merry.Error) {
@@ -69,20 +72,62 @@ func (c *VictoriaMetricsGroup) doTagQuery(ctx context.Context, isTagName bool, q
 	return r, nil
 }
 
-func (c *VictoriaMetricsGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+func (c *VictoriaMetricsGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
 	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
 	if !supportedFeatures.SupportGraphiteTagsAPI {
 		// VictoriaMetrics < 1.47.0 doesn't support graphite tags api, reverting back to prometheus code-path
 		return c.BackendServer.TagNames(ctx, query, limit)
 	}
-	return c.doTagQuery(ctx, true, query, limit, supportedFeatures)
+	res, err := c.doTagQuery(ctx, true, query, limit, supportedFeatures)
+	return res, types.TagStats(err), err
 }
 
-func (c *VictoriaMetricsGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+func (c *VictoriaMetricsGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
 	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
 	if !supportedFeatures.SupportGraphiteTagsAPI {
 		// VictoriaMetrics < 1.47.0 doesn't support graphite tags api, reverting back to prometheus code-path
 		return c.BackendServer.TagValues(ctx, query, limit)
 	}
-	return c.doTagQuery(ctx, false, query, limit, supportedFeatures)
+	res, err := c.doTagQuery(ctx, false, query, limit, supportedFeatures)
+	return res, types.TagStats(err), err
+}
+
+// tagsAPIPrefix returns prefix of graphite tags API for the VictoriaMetrics cluster component (select, insert or delete)
+func (c *VictoriaMetricsGroup) tagsAPIPrefix(component string) string {
+	if len(c.vmClusterTenantID) > 0 {
+		return "/" + component + "/" + c.vmClusterTenantID + "/graphite"
+	}
+	return ""
+}
+
+func (c *VictoriaMetricsGroup) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
+	if !supportedFeatures.SupportGraphiteTagsAPI {
+		return c.BackendServer.FindSeries(ctx, exprs)
+	}
+	return helper.FindSeries(ctx, c.logger, c.httpQuery, c.tagsAPIPrefix("select"), exprs)
+}
+
+func (c *VictoriaMetricsGroup) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
+	if !supportedFeatures.SupportGraphiteTagsAPI {
+		return c.BackendServer.TagDetails(ctx, tag, filter)
+	}
+	return helper.TagDetails(ctx, c.logger, c.httpQuery, c.tagsAPIPrefix("select"), tag, filter)
+}
+
+func (c *VictoriaMetricsGroup) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
+	if !supportedFeatures.SupportGraphiteTagsAPI {
+		return c.BackendServer.TagSeries(ctx, paths)
+	}
+	return helper.TagSeries(ctx, c.logger, c.httpQuery, c.tagsAPIPrefix("insert"), paths)
+}
+
+func (c *VictoriaMetricsGroup) DelSeries(ctx context.Context, paths []string) merry.Error {
+	supportedFeatures, _ := c.featureSet.Load().(*vmSupportedFeatures)
+	if !supportedFeatures.SupportGraphiteTagsAPI {
+		return c.BackendServer.DelSeries(ctx, paths)
+	}
+	return helper.DelSeries(ctx, c.logger, c.httpQuery, c.tagsAPIPrefix("delete"), paths)
 }
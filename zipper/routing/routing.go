@@ -0,0 +1,274 @@
+package routing
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/pkg/glob"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+var ErrInvalidRule = merry.New("invalid routing rule")
+
+// Route describes backend groups for the request
+type Route struct {
+	// Rules are names of the matched rules
+	Rules    []string
+	Groups   []string
+	Fallback []string
+}
+
+type tagMatcher struct {
+	tag   string
+	not   bool
+	value string
+	re    *regexp.Regexp
+}
+
+func newTagMatcher(s string) (tagMatcher, error) {
+	var (
+		m  tagMatcher
+		op string
+	)
+	n := strings.IndexAny(s, "!=")
+	if n <= 0 {
+		return m, merry.Errorf("invalid tag matcher '%s'", s)
+	}
+	m.tag = strings.TrimSpace(s[:n])
+	for _, o := range []string{"!=~", "=~", "!=", "="} {
+		if strings.HasPrefix(s[n:], o) {
+			op = o
+			break
+		}
+	}
+	if op == "" {
+		return m, merry.Errorf("invalid tag matcher '%s'", s)
+	}
+	if m.tag == "__name__" {
+		m.tag = "name"
+	}
+	m.not = op[0] == '!'
+	m.value = strings.TrimSpace(s[n+len(op):])
+	if strings.HasSuffix(op, "~") {
+		// graphite tag regexps are anchored at the start
+		re, err := regexp.Compile("^(?:" + m.value + ")")
+		if err != nil {
+			return m, merry.Prepend(err, "invalid tag matcher "+s)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// match checks tag value, pinned by the request. Requests, which don't pin the tag, could select any value, so they are not matched.
+func (m *tagMatcher) match(tags map[string]string) bool {
+	v, ok := tags[m.tag]
+	if !ok {
+		return false
+	}
+	var matched bool
+	if m.re != nil {
+		matched = m.re.MatchString(v)
+	} else {
+		matched = v == m.value
+	}
+	return matched != m.not
+}
+
+type rule struct {
+	name     string
+	priority int
+	paths    [][]*regexp.Regexp
+	regexps  []*regexp.Regexp
+	tags     []tagMatcher
+	groups   []string
+	fallback []string
+}
+
+// matchPath checks if the path or glob of the request is under one of the path prefixes of the rule.
+// Glob nodes of the request are matched as is, so request, which could span several rules, doesn't match.
+func (r *rule) matchPath(path string) bool {
+	nodes := strings.Split(path, ".")
+	for _, prefix := range r.paths {
+		if len(nodes) < len(prefix) {
+			continue
+		}
+		matched := true
+		for i, re := range prefix {
+			if !re.MatchString(nodes[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	for _, re := range r.regexps {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) match(request string) bool {
+	if !strings.HasPrefix(request, "seriesByTag(") {
+		return r.matchPath(request)
+	}
+	tags := SeriesByTagTerms(request)
+	if len(r.tags) == 0 {
+		name, ok := tags["name"]
+		return ok && r.matchPath(name)
+	}
+	for i := range r.tags {
+		if !r.tags[i].match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+// Router selects backend groups for the requests by the routing rules
+type Router struct {
+	rules []*rule
+}
+
+// New returns router for the rules, groups are names of the configured backend groups. Returns nil if there are no rules.
+func New(rules []types.RoutingRule, groups []string) (*Router, merry.Error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		known[g] = true
+	}
+
+	router := &Router{rules: make([]*rule, 0, len(rules))}
+	for i, cfg := range rules {
+		r := &rule{
+			name:     cfg.Name,
+			priority: cfg.Priority,
+			groups:   append(append([]string(nil), cfg.Groups...), cfg.AlsoQuery...),
+			fallback: cfg.Fallback,
+		}
+		if r.name == "" {
+			r.name = "rule" + strconv.Itoa(i)
+		}
+		if len(cfg.Groups) == 0 {
+			return nil, ErrInvalidRule.WithMessagef("routing rule %s has no groups", r.name)
+		}
+		if len(cfg.Paths) == 0 && len(cfg.Regexps) == 0 && len(cfg.Tags) == 0 {
+			return nil, ErrInvalidRule.WithMessagef("routing rule %s has no paths, regexps or tags", r.name)
+		}
+		for _, g := range append(append([]string(nil), r.groups...), r.fallback...) {
+			if !known[g] {
+				return nil, ErrInvalidRule.WithMessagef("routing rule %s refers to unknown backend group '%s'", r.name, g)
+			}
+		}
+		for _, p := range cfg.Paths {
+			nodes, err := glob.NodeMatchers(p)
+			if err != nil {
+				return nil, ErrInvalidRule.WithMessagef("routing rule %s has invalid path '%s': %v", r.name, p, err)
+			}
+			r.paths = append(r.paths, nodes)
+		}
+		for _, s := range cfg.Regexps {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, ErrInvalidRule.WithMessagef("routing rule %s has invalid regexp '%s': %v", r.name, s, err)
+			}
+			r.regexps = append(r.regexps, re)
+		}
+		for _, s := range cfg.Tags {
+			m, err := newTagMatcher(s)
+			if err != nil {
+				return nil, ErrInvalidRule.WithMessagef("routing rule %s: %v", r.name, err)
+			}
+			r.tags = append(r.tags, m)
+		}
+		router.rules = append(router.rules, r)
+	}
+	sort.SliceStable(router.rules, func(i, j int) bool {
+		return router.rules[i].priority > router.rules[j].priority
+	})
+
+	return router, nil
+}
+
+// Route returns backend groups for the requests, nil if some request doesn't match any rule.
+// Every request is routed by the first matched rule, groups of the requests are merged.
+func (r *Router) Route(requests []string) *Route {
+	if r == nil || len(requests) == 0 {
+		return nil
+	}
+	route := &Route{}
+	for _, request := range requests {
+		var matched *rule
+		for _, rule := range r.rules {
+			if rule.match(request) {
+				matched = rule
+				break
+			}
+		}
+		if matched == nil {
+			return nil
+		}
+		route.Rules = appendUnique(route.Rules, matched.name)
+		route.Groups = appendUnique(route.Groups, matched.groups...)
+		route.Fallback = appendUnique(route.Fallback, matched.fallback...)
+	}
+	return route
+}
+
+func appendUnique(s []string, values ...string) []string {
+LOOP:
+	for _, v := range values {
+		for _, e := range s {
+			if e == v {
+				continue LOOP
+			}
+		}
+		s = append(s, v)
+	}
+	return s
+}
+
+// SeriesByTagTerms returns tags with values pinned by equality terms of seriesByTag expression
+func SeriesByTagTerms(expr string) map[string]string {
+	expr = strings.TrimPrefix(expr, "seriesByTag(")
+	expr = strings.TrimSuffix(expr, ")")
+
+	tags := make(map[string]string)
+	for len(expr) > 0 {
+		expr = strings.TrimLeft(expr, " ,")
+		if expr == "" {
+			break
+		}
+		quote := expr[0]
+		if quote != '\'' && quote != '"' {
+			break
+		}
+		n := strings.IndexByte(expr[1:], quote)
+		if n < 0 {
+			break
+		}
+		term := expr[1 : n+1]
+		expr = expr[n+2:]
+
+		n = strings.Index(term, "=")
+		if n <= 0 || term[n-1] == '!' || strings.HasPrefix(term[n:], "=~") {
+			continue
+		}
+		tag := strings.TrimSpace(term[:n])
+		if tag == "__name__" {
+			tag = "name"
+		}
+		tags[tag] = strings.TrimSpace(term[n+1:])
+	}
+	return tags
+}
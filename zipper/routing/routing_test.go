@@ -0,0 +1,74 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+func TestRoute(t *testing.T) {
+	router, err := New([]types.RoutingRule{
+		{Name: "db", Paths: []string{"*.prod.db"}, Groups: []string{"db"}, Fallback: []string{"archive"}},
+		{Name: "prod", Paths: []string{"*.prod"}, Groups: []string{"prod"}, AlsoQuery: []string{"archive"}},
+		{Name: "regexp", Regexps: []string{`^legacy\.`}, Groups: []string{"archive"}},
+		{Name: "tags", Tags: []string{"env=prod", "dc=~eu-"}, Groups: []string{"prod"}},
+		{Name: "stage", Tags: []string{"env!=prod"}, Groups: []string{"stage"}, Priority: -1},
+		{Name: "override", Paths: []string{"app.prod.db.{slow,debug}"}, Groups: []string{"archive"}, Priority: 10},
+	}, []string{"db", "prod", "stage", "archive"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		requests []string
+		route    *Route
+	}{
+		{"second node", []string{"app.prod.cpu"}, &Route{Rules: []string{"prod"}, Groups: []string{"prod", "archive"}}},
+		{"third node", []string{"app.prod.db.cpu"}, &Route{Rules: []string{"db"}, Groups: []string{"db"}, Fallback: []string{"archive"}}},
+		{"priority", []string{"app.prod.db.slow.count"}, &Route{Rules: []string{"override"}, Groups: []string{"archive"}}},
+		{"glob in routed node", []string{"app.prod.*.cpu"}, &Route{Rules: []string{"prod"}, Groups: []string{"prod", "archive"}}},
+		{"glob spans rules", []string{"app.*.db.cpu"}, nil},
+		{"prefix only", []string{"app"}, nil},
+		{"regexp", []string{"legacy.app.cpu"}, &Route{Rules: []string{"regexp"}, Groups: []string{"archive"}}},
+		{"several requests", []string{"app.prod.cpu", "legacy.cpu"}, &Route{Rules: []string{"prod", "regexp"}, Groups: []string{"prod", "archive"}}},
+		{"unmatched request", []string{"app.prod.cpu", "app.dev.cpu"}, nil},
+		{"tags", []string{"seriesByTag('name=cpu', 'env=prod', 'dc=eu-west')"}, &Route{Rules: []string{"tags"}, Groups: []string{"prod"}}},
+		{"tags mismatch", []string{"seriesByTag('name=cpu', 'env=prod', 'dc=us-east')"}, nil},
+		{"tags not pinned", []string{"seriesByTag('name=cpu', 'env=~prod', 'dc=eu-west')"}, nil},
+		{"tags negative", []string{`seriesByTag("name=cpu", "env=dev")`}, &Route{Rules: []string{"stage"}, Groups: []string{"stage"}}},
+		{"tagged name", []string{"seriesByTag('__name__=app.prod.db.cpu')"}, &Route{Rules: []string{"db"}, Groups: []string{"db"}, Fallback: []string{"archive"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.route, router.Route(tt.requests))
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	router, err := New(nil, []string{"a"})
+	require.NoError(t, err)
+	assert.Nil(t, router)
+	assert.Nil(t, router.Route([]string{"a.b"}))
+
+	tests := []struct {
+		name string
+		rule types.RoutingRule
+	}{
+		{"no groups", types.RoutingRule{Paths: []string{"a"}}},
+		{"no matchers", types.RoutingRule{Groups: []string{"a"}}},
+		{"unknown group", types.RoutingRule{Paths: []string{"a"}, Groups: []string{"b"}}},
+		{"unknown fallback", types.RoutingRule{Paths: []string{"a"}, Groups: []string{"a"}, Fallback: []string{"b"}}},
+		{"invalid regexp", types.RoutingRule{Regexps: []string{"("}, Groups: []string{"a"}}},
+		{"invalid tag", types.RoutingRule{Tags: []string{"env"}, Groups: []string{"a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New([]types.RoutingRule{tt.rule}, []string{"a"})
+			assert.True(t, merry.Is(err, ErrInvalidRule), err)
+		})
+	}
+}
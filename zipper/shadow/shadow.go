@@ -0,0 +1,354 @@
+// Package shadow mirrors sample of requests to shadow backend groups and compares their responses with the primary ones.
+// Shadow groups never affect responses to the clients, they are used to validate new storage before migration.
+package shadow
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+// defaultTolerance is used, when no tolerance is configured, same as in tests/compare
+const defaultTolerance = 0.0000000001
+
+// maxLoggedDiffs limits count of series diffs in the single log message
+const maxLoggedDiffs = 10
+
+// Shadow is a shadow group with its config
+type Shadow struct {
+	Backend  types.BackendServer
+	Config   types.ShadowConfig
+	Timeouts types.Timeouts
+}
+
+type shadow struct {
+	Shadow
+	slots chan struct{}
+}
+
+// Mirror is a backend group, which mirrors fetch and find requests of the primary group to shadow groups
+type Mirror struct {
+	types.BackendServer
+
+	shadows   []*shadow
+	sendStats func(*types.Stats)
+	logger    *zap.Logger
+
+	// random returns number in [0, 1) for sampling
+	random func() float64
+	wg     sync.WaitGroup
+}
+
+// New returns primary group, which mirrors requests to shadows
+func New(logger *zap.Logger, primary types.BackendServer, shadows []Shadow, sendStats func(*types.Stats)) *Mirror {
+	m := &Mirror{
+		BackendServer: primary,
+		sendStats:     sendStats,
+		logger:        logger.With(zap.String("type", "shadow")),
+		random:        rand.Float64,
+	}
+	for _, s := range shadows {
+		sh := &shadow{Shadow: s}
+		if s.Config.MaxConcurrency > 0 {
+			sh.slots = make(chan struct{}, s.Config.MaxConcurrency)
+		}
+		m.shadows = append(m.shadows, sh)
+	}
+	return m
+}
+
+// sample returns the shadows, which sampled the request and have a free slot for it. Slots are released by mirror.
+func (m *Mirror) sample() []*shadow {
+	var sampled []*shadow
+	for _, s := range m.shadows {
+		if s.Config.SampleRate <= 0 || m.random() >= s.Config.SampleRate {
+			continue
+		}
+		if s.slots != nil {
+			select {
+			case s.slots <- struct{}{}:
+			default:
+				m.send(&types.Stats{ShadowDropped: 1})
+				continue
+			}
+		}
+		sampled = append(sampled, s)
+	}
+	return sampled
+}
+
+// mirror runs do for the sampled shadows in background
+func (m *Mirror) mirror(kind string, sampled []*shadow, do func(ctx context.Context, s *shadow, stats *types.Stats, logger *zap.Logger)) {
+	for _, s := range sampled {
+		m.wg.Add(1)
+		go func(s *shadow) {
+			defer m.wg.Done()
+			if s.slots != nil {
+				defer func() { <-s.slots }()
+			}
+			timeout := s.Timeouts.Render
+			if kind == "find" {
+				timeout = s.Timeouts.Find
+			}
+			// mirrored request doesn't depend on the client request, which is already answered
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			stats := &types.Stats{ShadowRequests: 1}
+			do(ctx, s, stats, m.logger.With(zap.String("shadow_group", s.Backend.Name()), zap.String("request_type", kind)))
+			m.send(stats)
+		}(s)
+	}
+}
+
+func (m *Mirror) send(stats *types.Stats) {
+	if m.sendStats != nil {
+		m.sendStats(stats)
+	}
+}
+
+// Wait waits for the mirrored requests in flight
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
+
+func (m *Mirror) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	res, stats, err := m.BackendServer.Fetch(ctx, request)
+	if err != nil && !merry.Is(err, types.ErrNonFatalErrors) && !merry.Is(err, types.ErrNotFound) {
+		return res, stats, err
+	}
+
+	// response is copied only for sampled requests, it could be changed by the caller, when it's compared
+	sampled := m.sample()
+	if len(sampled) == 0 {
+		return res, stats, err
+	}
+	primary := copyFetchResponse(res)
+	m.mirror("fetch", sampled, func(ctx context.Context, s *shadow, stats *types.Stats, logger *zap.Logger) {
+		shadowRes, _, err := s.Backend.Fetch(ctx, request)
+		if err != nil && !merry.Is(err, types.ErrNonFatalErrors) && !merry.Is(err, types.ErrNotFound) {
+			stats.ShadowErrors = 1
+			logger.Debug("shadow request failed", zap.Error(err))
+			return
+		}
+		d := compareFetch(primary, shadowRes, &s.Config)
+		m.report(d, s, stats, logger)
+	})
+
+	return res, stats, err
+}
+
+func (m *Mirror) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	res, stats, err := m.BackendServer.Find(ctx, request)
+	if err != nil && !merry.Is(err, types.ErrNonFatalErrors) && !merry.Is(err, types.ErrNotFound) {
+		return res, stats, err
+	}
+
+	sampled := m.sample()
+	if len(sampled) == 0 {
+		return res, stats, err
+	}
+	primary := findMatches(res)
+	m.mirror("find", sampled, func(ctx context.Context, s *shadow, stats *types.Stats, logger *zap.Logger) {
+		shadowRes, _, err := s.Backend.Find(ctx, request)
+		if err != nil && !merry.Is(err, types.ErrNonFatalErrors) && !merry.Is(err, types.ErrNotFound) {
+			stats.ShadowErrors = 1
+			logger.Debug("shadow request failed", zap.Error(err))
+			return
+		}
+		d := compareFind(primary, findMatches(shadowRes))
+		m.report(d, s, stats, logger)
+	})
+
+	return res, stats, err
+}
+
+func (m *Mirror) report(d *diff, s *shadow, stats *types.Stats, logger *zap.Logger) {
+	if d.empty() {
+		return
+	}
+	stats.ShadowMismatches = 1
+	if s.Config.DiffLogSampleRate <= 0 || m.random() >= s.Config.DiffLogSampleRate {
+		return
+	}
+	logger.Warn("shadow response mismatch",
+		zap.Strings("missing", limit(d.missing)),
+		zap.Int("missing_count", len(d.missing)),
+		zap.Strings("extra", limit(d.extra)),
+		zap.Int("extra_count", len(d.extra)),
+		zap.Strings("mismatched", limit(d.mismatched)),
+		zap.Int("mismatched_count", len(d.mismatched)),
+	)
+}
+
+func limit(s []string) []string {
+	if len(s) > maxLoggedDiffs {
+		return s[:maxLoggedDiffs]
+	}
+	return s
+}
+
+// diff is a difference of the shadow response from the primary one
+type diff struct {
+	// missing are series (or paths), which are absent in the shadow response
+	missing []string
+	// extra are series (or paths), which are absent in the primary response
+	extra []string
+	// mismatched are descriptions of different series
+	mismatched []string
+}
+
+func (d *diff) empty() bool {
+	return len(d.missing) == 0 && len(d.extra) == 0 && len(d.mismatched) == 0
+}
+
+type seriesKey struct {
+	name  string
+	from  int64
+	until int64
+}
+
+func copyFetchResponse(res *protov3.MultiFetchResponse) []protov3.FetchResponse {
+	if res == nil {
+		return nil
+	}
+	metrics := make([]protov3.FetchResponse, len(res.Metrics))
+	for i, m := range res.Metrics {
+		metrics[i] = m
+		metrics[i].Values = append([]float64(nil), m.Values...)
+	}
+	return metrics
+}
+
+func compareFetch(primary []protov3.FetchResponse, shadowRes *protov3.MultiFetchResponse, cfg *types.ShadowConfig) *diff {
+	d := &diff{}
+	shadowSeries := make(map[seriesKey]*protov3.FetchResponse)
+	if shadowRes != nil {
+		for i := range shadowRes.Metrics {
+			m := &shadowRes.Metrics[i]
+			shadowSeries[seriesKey{m.Name, m.RequestStartTime, m.RequestStopTime}] = m
+		}
+	}
+
+	seen := make(map[seriesKey]bool)
+	for i := range primary {
+		p := &primary[i]
+		key := seriesKey{p.Name, p.RequestStartTime, p.RequestStopTime}
+		seen[key] = true
+		s, ok := shadowSeries[key]
+		if !ok {
+			d.missing = append(d.missing, p.Name)
+			continue
+		}
+		if reason := compareSeries(p, s, cfg); reason != "" {
+			d.mismatched = append(d.mismatched, p.Name+": "+reason)
+		}
+	}
+	for key := range shadowSeries {
+		if !seen[key] {
+			d.extra = append(d.extra, key.name)
+		}
+	}
+	sort.Strings(d.extra)
+	return d
+}
+
+// compareSeries returns description of the first difference of the series, empty string if they are equal
+func compareSeries(p, s *protov3.FetchResponse, cfg *types.ShadowConfig) string {
+	if p.StepTime != s.StepTime {
+		return fmt.Sprintf("step %d != %d", p.StepTime, s.StepTime)
+	}
+	if p.StartTime != s.StartTime {
+		return fmt.Sprintf("start %d != %d", p.StartTime, s.StartTime)
+	}
+	if len(p.Values) != len(s.Values) {
+		return fmt.Sprintf("length %d != %d", len(p.Values), len(s.Values))
+	}
+	different := 0
+	first := -1
+	for i := range p.Values {
+		if !equal(p.Values[i], s.Values[i], cfg) {
+			different++
+			if first < 0 {
+				first = i
+			}
+		}
+	}
+	if different == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d points differ, first at %d: %s != %s", different, p.StartTime+int64(first)*p.StepTime,
+		strconv.FormatFloat(p.Values[first], 'g', -1, 64), strconv.FormatFloat(s.Values[first], 'g', -1, 64))
+}
+
+// equal compares values like tests/compare: NaNs and infinities of the same sign are equal, others should be close
+func equal(a, b float64, cfg *types.ShadowConfig) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return a == b
+	}
+	d := math.Abs(a - b)
+	absolute := cfg.AbsoluteTolerance
+	if absolute == 0 && cfg.RelativeTolerance == 0 {
+		absolute = defaultTolerance
+	}
+	return d <= absolute || d <= cfg.RelativeTolerance*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// findMatches returns matches of the find response by glob
+func findMatches(res *protov3.MultiGlobResponse) map[string]map[string]bool {
+	matches := make(map[string]map[string]bool)
+	if res == nil {
+		return matches
+	}
+	for _, m := range res.Metrics {
+		paths := matches[m.Name]
+		if paths == nil {
+			paths = make(map[string]bool)
+			matches[m.Name] = paths
+		}
+		for _, match := range m.Matches {
+			paths[match.Path] = paths[match.Path] || match.IsLeaf
+		}
+	}
+	return matches
+}
+
+func compareFind(primary, shadow map[string]map[string]bool) *diff {
+	d := &diff{}
+	for glob, paths := range primary {
+		shadowPaths := shadow[glob]
+		for path, isLeaf := range paths {
+			leaf, ok := shadowPaths[path]
+			if !ok {
+				d.missing = append(d.missing, path)
+			} else if leaf != isLeaf {
+				d.mismatched = append(d.mismatched, fmt.Sprintf("%s: leaf %t != %t", path, isLeaf, leaf))
+			}
+		}
+	}
+	for glob, paths := range shadow {
+		primaryPaths := primary[glob]
+		for path := range paths {
+			if _, ok := primaryPaths[path]; !ok {
+				d.extra = append(d.extra, path)
+			}
+		}
+	}
+	sort.Strings(d.missing)
+	sort.Strings(d.extra)
+	sort.Strings(d.mismatched)
+	return d
+}
@@ -0,0 +1,235 @@
+package shadow
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+var timeouts = types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second}
+
+type statsCollector struct {
+	sync.Mutex
+	stats types.Stats
+}
+
+func (c *statsCollector) send(stats *types.Stats) {
+	c.Lock()
+	c.stats.Merge(stats)
+	c.Unlock()
+}
+
+func fetchRequest() *protov3.MultiFetchRequest {
+	return &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", PathExpression: "foo", StartTime: 100, StopTime: 160}},
+	}
+}
+
+func fetchResponse(name string, values ...float64) *protov3.MultiFetchResponse {
+	return &protov3.MultiFetchResponse{
+		Metrics: []protov3.FetchResponse{{
+			Name: name, PathExpression: "foo", StartTime: 100, StepTime: 10, StopTime: 100 + 10*int64(len(values)),
+			RequestStartTime: 100, RequestStopTime: 160, Values: values,
+		}},
+	}
+}
+
+func TestFetch(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name       string
+		config     types.ShadowConfig
+		shadow     *protov3.MultiFetchResponse
+		expected   types.Stats
+		shadowWait time.Duration
+	}{
+		{
+			name:     "equal",
+			config:   types.ShadowConfig{SampleRate: 1},
+			shadow:   fetchResponse("foo", 1, nan, 3),
+			expected: types.Stats{ShadowRequests: 1},
+		},
+		{
+			name:     "different values",
+			config:   types.ShadowConfig{SampleRate: 1, DiffLogSampleRate: 1},
+			shadow:   fetchResponse("foo", 1, 2, 3),
+			expected: types.Stats{ShadowRequests: 1, ShadowMismatches: 1},
+		},
+		{
+			name:     "values within tolerance",
+			config:   types.ShadowConfig{SampleRate: 1, RelativeTolerance: 0.01},
+			shadow:   fetchResponse("foo", 1.001, nan, 2.99),
+			expected: types.Stats{ShadowRequests: 1},
+		},
+		{
+			name:     "different series",
+			config:   types.ShadowConfig{SampleRate: 1},
+			shadow:   fetchResponse("bar", 1, nan, 3),
+			expected: types.Stats{ShadowRequests: 1, ShadowMismatches: 1},
+		},
+		{
+			name:     "not sampled",
+			config:   types.ShadowConfig{SampleRate: 0},
+			shadow:   fetchResponse("bar", 1, nan, 3),
+			expected: types.Stats{},
+		},
+		{
+			name:       "error",
+			config:     types.ShadowConfig{SampleRate: 1},
+			shadowWait: 10 * time.Millisecond,
+			expected:   types.Stats{ShadowRequests: 1, ShadowErrors: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := dummy.NewDummyClient("primary", []string{"primary1"}, 0)
+			primary.AddFetchResponse(fetchRequest(), fetchResponse("foo", 1, nan, 3), nil, nil)
+
+			var backend *dummy.DummyClient
+			if tt.shadowWait > 0 {
+				backend = dummy.NewDummyClientWithTimeout("shadow", []string{"shadow1"}, 0, tt.shadowWait)
+			} else {
+				backend = dummy.NewDummyClient("shadow", []string{"shadow1"}, 0)
+				backend.AddFetchResponse(fetchRequest(), tt.shadow, nil, nil)
+			}
+
+			collector := &statsCollector{}
+			m := New(zap.NewNop(), primary, []Shadow{{Backend: backend, Config: tt.config, Timeouts: timeouts}}, collector.send)
+
+			res, _, err := m.Fetch(context.Background(), fetchRequest())
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != 1 || res.Metrics[0].Name != "foo" {
+				t.Errorf("primary response is changed: %+v", res)
+			}
+
+			m.Wait()
+			if !reflect.DeepEqual(collector.stats, tt.expected) {
+				t.Errorf("unexpected stats %+v, expected %+v", collector.stats, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchDropped(t *testing.T) {
+	primary := dummy.NewDummyClient("primary", []string{"primary1"}, 0)
+	primary.AddFetchResponse(fetchRequest(), fetchResponse("foo", 1, 2, 3), nil, nil)
+	backend := dummy.NewDummyClientWithTimeout("shadow", []string{"shadow1"}, 0, 50*time.Millisecond)
+
+	collector := &statsCollector{}
+	m := New(zap.NewNop(), primary, []Shadow{{
+		Backend:  backend,
+		Config:   types.ShadowConfig{SampleRate: 1, MaxConcurrency: 1},
+		Timeouts: timeouts,
+	}}, collector.send)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := m.Fetch(context.Background(), fetchRequest()); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	m.Wait()
+
+	expected := types.Stats{ShadowRequests: 1, ShadowErrors: 1, ShadowDropped: 1}
+	if !reflect.DeepEqual(collector.stats, expected) {
+		t.Errorf("unexpected stats %+v, expected %+v", collector.stats, expected)
+	}
+}
+
+func TestFetchNotSampled(t *testing.T) {
+	primary := dummy.NewDummyClient("primary", []string{"primary1"}, 0)
+	primary.AddFetchResponse(fetchRequest(), fetchResponse("foo", 1, 2, 3), nil, nil)
+	backend := dummy.NewDummyClient("shadow", []string{"shadow1"}, 0)
+
+	collector := &statsCollector{}
+	m := New(zap.NewNop(), primary, []Shadow{{
+		Backend:  backend,
+		Config:   types.ShadowConfig{SampleRate: 0.5, MaxConcurrency: 1},
+		Timeouts: timeouts,
+	}}, collector.send)
+	m.random = func() float64 { return 0.9 }
+
+	// response isn't copied, if no shadow sampled the request
+	request := fetchRequest()
+	direct := testing.AllocsPerRun(10, func() { _, _, _ = primary.Fetch(context.Background(), request) })
+	mirrored := testing.AllocsPerRun(10, func() { _, _, _ = m.Fetch(context.Background(), request) })
+	if mirrored > direct {
+		t.Errorf("not sampled request allocates %v times, primary one %v times", mirrored, direct)
+	}
+
+	m.Wait()
+	if !reflect.DeepEqual(collector.stats, types.Stats{}) {
+		t.Errorf("unexpected stats %+v", collector.stats)
+	}
+	if len(m.shadows[0].slots) != 0 {
+		t.Errorf("slot of not sampled request isn't released")
+	}
+}
+
+func TestFind(t *testing.T) {
+	request := &protov3.MultiGlobRequest{Metrics: []string{"foo.*"}}
+	findResponse := func(paths ...string) *protov3.MultiGlobResponse {
+		res := &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{Name: "foo.*"}}}
+		for _, p := range paths {
+			res.Metrics[0].Matches = append(res.Metrics[0].Matches, protov3.GlobMatch{Path: p, IsLeaf: true})
+		}
+		return res
+	}
+
+	primary := dummy.NewDummyClient("primary", []string{"primary1"}, 0)
+	primary.AddFindResponse(request, findResponse("foo.bar", "foo.baz"), nil, nil)
+	same := dummy.NewDummyClient("same", []string{"same1"}, 0)
+	same.AddFindResponse(request, findResponse("foo.baz", "foo.bar"), nil, nil)
+	different := dummy.NewDummyClient("different", []string{"different1"}, 0)
+	different.AddFindResponse(request, findResponse("foo.bar", "foo.qux"), nil, nil)
+
+	collector := &statsCollector{}
+	m := New(zap.NewNop(), primary, []Shadow{
+		{Backend: same, Config: types.ShadowConfig{SampleRate: 1}, Timeouts: timeouts},
+		{Backend: different, Config: types.ShadowConfig{SampleRate: 1}, Timeouts: timeouts},
+	}, collector.send)
+
+	if _, _, err := m.Find(context.Background(), request); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	m.Wait()
+
+	expected := types.Stats{ShadowRequests: 2, ShadowMismatches: 1}
+	if !reflect.DeepEqual(collector.stats, expected) {
+		t.Errorf("unexpected stats %+v, expected %+v", collector.stats, expected)
+	}
+}
+
+func TestCompareFetch(t *testing.T) {
+	primary := copyFetchResponse(&protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{
+		fetchResponse("a", 1, 2, 3).Metrics[0],
+		fetchResponse("b", 1, 2, 3).Metrics[0],
+		fetchResponse("c", 1, math.Inf(1), 3).Metrics[0],
+	}})
+	shadow := &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{
+		fetchResponse("a", 1, 2).Metrics[0],
+		fetchResponse("c", 1, math.Inf(-1), 4).Metrics[0],
+		fetchResponse("d", 1, 2, 3).Metrics[0],
+	}}
+
+	d := compareFetch(primary, shadow, &types.ShadowConfig{})
+	expected := &diff{
+		missing:    []string{"b"},
+		extra:      []string{"d"},
+		mismatched: []string{"a: length 3 != 2", "c: 2 points differ, first at 110: +Inf != -Inf"},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("unexpected diff %+v, expected %+v", d, expected)
+	}
+}
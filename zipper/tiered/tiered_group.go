@@ -0,0 +1,352 @@
+// Package tiered implements backend group, which children store different time ranges of the same metrics,
+// e.x. the last days in the fast cluster and older data in the archive one.
+package tiered
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+var ErrNoTiers = merry.New("no tiers specified")
+var ErrInfiniteRetention = merry.New("only the last tier could have infinite retention")
+
+// Tier is a backend group with retention
+type Tier struct {
+	Backend types.BackendServer
+	// Retention is how long data is kept by the tier, 0 is infinite
+	Retention time.Duration
+}
+
+// TieredGroup sends fetch requests to the tiers, which own the requested time range, and stitches their responses.
+// Tier owns data from its retention till the retention of the previous (faster) tier, the first tier owns the newest data.
+type TieredGroup struct {
+	groupName string
+	tiers     []Tier
+	servers   []string
+	logger    *zap.Logger
+
+	now func() time.Time
+}
+
+// New creates tiered group. Tiers are sorted by retention, the tier with infinite retention should be the only one.
+func New(logger *zap.Logger, groupName string, tiers []Tier) (*TieredGroup, merry.Error) {
+	if len(tiers) == 0 {
+		return nil, ErrNoTiers.WithMessagef("tiered group '%s' has no tiers", groupName)
+	}
+
+	tiers = append([]Tier(nil), tiers...)
+	sort.SliceStable(tiers, func(i, j int) bool {
+		if tiers[j].Retention == 0 {
+			return tiers[i].Retention != 0
+		}
+		return tiers[i].Retention != 0 && tiers[i].Retention < tiers[j].Retention
+	})
+	for i := range tiers[:len(tiers)-1] {
+		if tiers[i].Retention == 0 {
+			return nil, ErrInfiniteRetention.WithMessagef("tiered group '%s' has several tiers with infinite retention", groupName)
+		}
+	}
+
+	var servers []string
+	for _, t := range tiers {
+		servers = append(servers, t.Backend.Backends()...)
+	}
+
+	return &TieredGroup{
+		groupName: groupName,
+		tiers:     tiers,
+		servers:   servers,
+		logger:    logger.With(zap.String("type", "tieredGroup"), zap.String("groupName", groupName)),
+		now:       time.Now,
+	}, nil
+}
+
+func (tg *TieredGroup) Name() string {
+	return tg.groupName
+}
+
+func (tg *TieredGroup) Backends() []string {
+	return tg.servers
+}
+
+// MaxMetricsPerRequest returns 0, requests are split by the tiers
+func (tg *TieredGroup) MaxMetricsPerRequest() int {
+	return 0
+}
+
+func (tg *TieredGroup) Children() []types.BackendServer {
+	children := make([]types.BackendServer, 0, len(tg.tiers))
+	for _, t := range tg.tiers {
+		children = append(children, t.Backend)
+	}
+	return children
+}
+
+// newest returns the tier, which owns the newest data
+func (tg *TieredGroup) newest() types.BackendServer {
+	return tg.tiers[0].Backend
+}
+
+// window returns time range [from, until) owned by the tier i
+func (tg *TieredGroup) window(now int64, i int) (int64, int64) {
+	from, until := int64(math.MinInt64), int64(math.MaxInt64)
+	if r := tg.tiers[i].Retention; r != 0 {
+		from = now - int64(r.Seconds())
+	}
+	if i > 0 {
+		until = now - int64(tg.tiers[i-1].Retention.Seconds())
+	}
+	return from, until
+}
+
+// tierRequest is a request to the tier with indexes of the original requests by sub-request
+type tierRequest struct {
+	request *protov3.MultiFetchRequest
+	origins []int
+}
+
+// split returns requests to the tiers, nil if the tier doesn't own any requested range.
+// Requests are clipped by the windows of the tiers, unless only one tier is requested.
+func (tg *TieredGroup) split(request *protov3.MultiFetchRequest) []*tierRequest {
+	now := tg.now().Unix()
+	requests := make([]*tierRequest, len(tg.tiers))
+	n := 0
+	for j, m := range request.Metrics {
+		for i := range tg.tiers {
+			from, until := tg.window(now, i)
+			start, stop := max(m.StartTime, from), min(m.StopTime, until)
+			if start >= stop {
+				continue
+			}
+			if requests[i] == nil {
+				requests[i] = &tierRequest{request: &protov3.MultiFetchRequest{}}
+				n++
+			}
+			r := m
+			r.StartTime, r.StopTime = start, stop
+			requests[i].request.Metrics = append(requests[i].request.Metrics, r)
+			requests[i].origins = append(requests[i].origins, j)
+		}
+	}
+
+	if n == 1 {
+		// the only tier gets the request as is
+		for i := range requests {
+			if requests[i] != nil {
+				requests[i].request = request
+			}
+		}
+	}
+	return requests
+}
+
+type tierResponse struct {
+	tier     int
+	request  *tierRequest
+	response *protov3.MultiFetchResponse
+	stats    *types.Stats
+	err      merry.Error
+}
+
+type stitchKey struct {
+	request int
+	name    string
+}
+
+func (tg *TieredGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
+	requests := tg.split(request)
+
+	resCh := make(chan tierResponse, len(requests))
+	sent := 0
+	for i, r := range requests {
+		if r == nil {
+			continue
+		}
+		sent++
+		go func(i int, r *tierRequest) {
+			res := tierResponse{tier: i, request: r}
+			res.response, res.stats, res.err = tg.tiers[i].Backend.Fetch(ctx, r.request)
+			resCh <- res
+		}(i, r)
+	}
+
+	stats := new(types.Stats)
+	var errs []merry.Error
+	responses := make([]tierResponse, 0, sent)
+	for ; sent > 0; sent-- {
+		res := <-resCh
+		if res.stats != nil {
+			stats.Merge(res.stats)
+		}
+		if res.err != nil {
+			tg.logger.Debug("tier returned errors",
+				zap.String("tier", tg.tiers[res.tier].Backend.Name()),
+				zap.Error(res.err),
+			)
+			errs = append(errs, res.err)
+		}
+		if res.response != nil && len(res.response.Metrics) > 0 {
+			responses = append(responses, res)
+		}
+	}
+
+	if len(responses) == 0 {
+		if len(errs) == 0 {
+			return nil, stats, types.ErrNotFound.WithHTTPCode(404)
+		}
+		code, messages := helper.MergeHttpErrors(errs)
+		return nil, stats, types.ErrFailedToFetch.WithHTTPCode(code).WithMessage(strings.Join(messages, "\n"))
+	}
+
+	var err merry.Error
+	if len(errs) > 0 {
+		err = types.ErrNonFatalErrors
+		for _, e := range errs {
+			err = err.WithCause(e)
+		}
+	}
+
+	if len(responses) == 1 && responses[0].request.request == request {
+		return responses[0].response, stats, err
+	}
+	return tg.stitch(request, responses), stats, err
+}
+
+// stitch concatenates series from the tiers, that answered the same request, resampling them to a common step
+func (tg *TieredGroup) stitch(request *protov3.MultiFetchRequest, responses []tierResponse) *protov3.MultiFetchResponse {
+	// older tiers go first
+	sort.Slice(responses, func(i, j int) bool { return responses[i].tier > responses[j].tier })
+
+	pieces := make(map[stitchKey][]protov3.FetchResponse)
+	var keys []stitchKey
+	for _, res := range responses {
+		for _, m := range res.response.Metrics {
+			key := stitchKey{request: res.request.origin(&m), name: m.Name}
+			if _, ok := pieces[key]; !ok {
+				keys = append(keys, key)
+			}
+			pieces[key] = append(pieces[key], m)
+		}
+	}
+
+	result := &protov3.MultiFetchResponse{Metrics: make([]protov3.FetchResponse, 0, len(keys))}
+	for _, key := range keys {
+		m := types.MergeSeries(types.MergeConsolidate, -1, pieces[key])
+		if key.request >= 0 {
+			// series answers the original request
+			m.RequestStartTime = request.Metrics[key.request].StartTime
+			m.RequestStopTime = request.Metrics[key.request].StopTime
+		}
+		result.Metrics = append(result.Metrics, m)
+	}
+	return result
+}
+
+// origin returns index of the original request, which is answered by the series, -1 if it's not found
+func (r *tierRequest) origin(m *protov3.FetchResponse) int {
+	found := -1
+	for i := range r.request.Metrics {
+		req := &r.request.Metrics[i]
+		if req.PathExpression != m.PathExpression {
+			continue
+		}
+		// same path could be requested for several time ranges
+		if found < 0 || (req.StartTime == m.RequestStartTime && req.StopTime == m.RequestStopTime) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return -1
+	}
+	return r.origins[found]
+}
+
+// Find is sent to the tier, which owns the newest data
+func (tg *TieredGroup) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	return tg.newest().Find(ctx, request)
+}
+
+func (tg *TieredGroup) Info(ctx context.Context, request *protov3.MultiMetricsInfoRequest) (*protov3.ZipperInfoResponse, *types.Stats, merry.Error) {
+	return tg.newest().Info(ctx, request)
+}
+
+func (tg *TieredGroup) List(ctx context.Context) (*protov3.ListMetricsResponse, *types.Stats, merry.Error) {
+	return tg.newest().List(ctx)
+}
+
+func (tg *TieredGroup) Stats(ctx context.Context) (*protov3.MetricDetailsResponse, *types.Stats, merry.Error) {
+	return tg.newest().Stats(ctx)
+}
+
+// ProbeTLDs returns top-level domains of all tiers
+func (tg *TieredGroup) ProbeTLDs(ctx context.Context) ([]string, merry.Error) {
+	seen := make(map[string]struct{})
+	var tlds []string
+	var err merry.Error
+	for _, t := range tg.tiers {
+		res, e := t.Backend.ProbeTLDs(ctx)
+		if e != nil {
+			err = e
+			continue
+		}
+		for _, tld := range res {
+			if _, ok := seen[tld]; !ok {
+				seen[tld] = struct{}{}
+				tlds = append(tlds, tld)
+			}
+		}
+	}
+	if len(tlds) > 0 {
+		err = nil
+	}
+	return tlds, err
+}
+
+func (tg *TieredGroup) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	return tg.newest().TagNames(ctx, query, limit)
+}
+
+func (tg *TieredGroup) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	return tg.newest().TagValues(ctx, query, limit)
+}
+
+func (tg *TieredGroup) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	return tg.newest().FindSeries(ctx, exprs)
+}
+
+func (tg *TieredGroup) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	return tg.newest().TagDetails(ctx, tag, filter)
+}
+
+// TagSeries registers series in all tiers, result of the newest tier is returned
+func (tg *TieredGroup) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	var res []string
+	var err merry.Error
+	for i := len(tg.tiers) - 1; i >= 0; i-- {
+		res, err = tg.tiers[i].Backend.TagSeries(ctx, paths)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// DelSeries deletes series from all tiers
+func (tg *TieredGroup) DelSeries(ctx context.Context, paths []string) merry.Error {
+	for _, t := range tg.tiers {
+		if err := t.Backend.DelSeries(ctx, paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
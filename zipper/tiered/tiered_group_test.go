@@ -0,0 +1,130 @@
+package tiered
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+)
+
+const day = int64(24 * 3600)
+
+func fetchRequest(start, stop int64) *protov3.MultiFetchRequest {
+	return &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo", PathExpression: "foo", StartTime: start, StopTime: stop}},
+	}
+}
+
+func fetchResponse(start, stop, step int64, values ...float64) *protov3.MultiFetchResponse {
+	return &protov3.MultiFetchResponse{
+		Metrics: []protov3.FetchResponse{{
+			Name: "foo", PathExpression: "foo", ConsolidationFunc: "average",
+			StartTime: start, StepTime: step, StopTime: start + int64(len(values))*step, Values: values,
+			RequestStartTime: start, RequestStopTime: stop,
+		}},
+	}
+}
+
+func TestNew(t *testing.T) {
+	hot := dummy.NewDummyClient("hot", []string{"hot1"}, 0)
+	archive := dummy.NewDummyClient("archive", []string{"archive1"}, 0)
+
+	tg, err := New(zap.NewNop(), "tiered", []Tier{{Backend: archive}, {Backend: hot, Retention: 14 * 24 * time.Hour}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if tg.newest() != hot {
+		t.Errorf("newest tier is %s, expected hot", tg.newest().Name())
+	}
+	if !reflect.DeepEqual(tg.Backends(), []string{"hot1", "archive1"}) {
+		t.Errorf("unexpected backends %v", tg.Backends())
+	}
+
+	if _, err := New(zap.NewNop(), "tiered", []Tier{{Backend: archive}, {Backend: hot}}); err == nil {
+		t.Error("expected error for several tiers with infinite retention")
+	}
+	if _, err := New(zap.NewNop(), "tiered", nil); err == nil {
+		t.Error("expected error for no tiers")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	now := 100 * day
+	boundary := now - 14*day
+
+	hot := dummy.NewDummyClient("hot", []string{"hot1"}, 0)
+	archive := dummy.NewDummyClient("archive", []string{"archive1"}, 0)
+
+	// recent data is only in the hot tier
+	hot.AddFetchResponse(fetchRequest(now-3600, now), fetchResponse(now-3600, now, 1800, 1, 2), &types.Stats{}, nil)
+	// old data is only in the archive
+	archive.AddFetchResponse(fetchRequest(now-30*day, now-20*day), fetchResponse(now-30*day, now-20*day, 5*day, 3, 4), &types.Stats{}, nil)
+	// request crossing the boundary is split
+	hot.AddFetchResponse(fetchRequest(boundary, boundary+2*day), fetchResponse(boundary, boundary+2*day, day/2, 5, 6, 7, math.NaN()), &types.Stats{}, nil)
+	archive.AddFetchResponse(fetchRequest(boundary-2*day, boundary), fetchResponse(boundary-2*day, boundary, day, 8, 9), &types.Stats{}, nil)
+
+	tg, err := New(zap.NewNop(), "tiered", []Tier{{Backend: hot, Retention: 14 * 24 * time.Hour}, {Backend: archive}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	tg.now = func() time.Time { return time.Unix(now, 0) }
+
+	tests := []struct {
+		name     string
+		request  *protov3.MultiFetchRequest
+		start    int64
+		step     int64
+		expected []float64
+	}{
+		{"hot", fetchRequest(now-3600, now), now - 3600, 1800, []float64{1, 2}},
+		{"archive", fetchRequest(now-30*day, now-20*day), now - 30*day, 5 * day, []float64{3, 4}},
+		{"both", fetchRequest(boundary-2*day, boundary+2*day), boundary - 2*day, day, []float64{8, 9, 5.5, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _, err := tg.Fetch(context.Background(), tt.request)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(res.Metrics) != 1 {
+				t.Fatalf("unexpected metrics %v", res.Metrics)
+			}
+			m := res.Metrics[0]
+			if m.StartTime != tt.start || m.StepTime != tt.step || !reflect.DeepEqual(m.Values, tt.expected) {
+				t.Errorf("got start %d step %d values %v, expected start %d step %d values %v",
+					m.StartTime, m.StepTime, m.Values, tt.start, tt.step, tt.expected)
+			}
+			if m.RequestStartTime != tt.request.Metrics[0].StartTime || m.RequestStopTime != tt.request.Metrics[0].StopTime {
+				t.Errorf("got request range %d-%d, expected %d-%d", m.RequestStartTime, m.RequestStopTime,
+					tt.request.Metrics[0].StartTime, tt.request.Metrics[0].StopTime)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	hot := dummy.NewDummyClient("hot", []string{"hot1"}, 0)
+	archive := dummy.NewDummyClient("archive", []string{"archive1"}, 0)
+	request := &protov3.MultiGlobRequest{Metrics: []string{"foo.*"}}
+	hot.AddFindResponse(request, &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{Name: "foo.*", Matches: []protov3.GlobMatch{{Path: "foo.new", IsLeaf: true}}}}}, &types.Stats{}, nil)
+	archive.AddFindResponse(request, &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{Name: "foo.*", Matches: []protov3.GlobMatch{{Path: "foo.old", IsLeaf: true}}}}}, &types.Stats{}, nil)
+
+	tg, err := New(zap.NewNop(), "tiered", []Tier{{Backend: archive}, {Backend: hot, Retention: time.Hour}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	res, _, err := tg.Find(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(res.Metrics) != 1 || len(res.Metrics[0].Matches) != 1 || res.Metrics[0].Matches[0].Path != "foo.new" {
+		t.Errorf("unexpected find response %v", res)
+	}
+}
@@ -14,6 +14,45 @@ type BackendsV2 struct {
 	KeepAliveInterval         time.Duration `mapstructure:"keepAliveInterval"`
 	MaxTries                  int           `mapstructure:"maxTries"`
 	MaxBatchSize              *int          `mapstructure:"maxBatchSize"`
+	Routing                   []RoutingRule `mapstructure:"routing"`
+	// MergeStrategy is used to merge series with the same name from different backend groups
+	MergeStrategy MergeStrategy `mapstructure:"mergeStrategy"`
+	// PrimaryGroup is the name of the group, which values are preferred by prefer-primary-group merge strategy
+	PrimaryGroup string `mapstructure:"primaryGroup"`
+	// Tiered are groups, which join backend groups with different retentions of the same metrics
+	Tiered []TieredGroup `mapstructure:"tiered"`
+}
+
+// TieredGroup joins backend groups, which store different time ranges of the same metrics. It's queried instead of them.
+type TieredGroup struct {
+	GroupName string `mapstructure:"groupName"`
+	Tiers     []Tier `mapstructure:"tiers"`
+}
+
+// Tier is a backend group of the tiered group with retention of its data
+type Tier struct {
+	Group string `mapstructure:"group"`
+	// Retention is how long data is kept by the group, 0 is infinite
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// RoutingRule sends requests, which match it, to the listed backend groups
+type RoutingRule struct {
+	Name string `mapstructure:"name"`
+	// Paths are glob prefixes of metric names, e.x. "*.prod.db" matches "app.prod.db.cpu"
+	Paths []string `mapstructure:"paths"`
+	// Regexps are matched against metric names
+	Regexps []string `mapstructure:"regexps"`
+	// Tags are matchers of seriesByTag requests, e.x. "env=prod", "env!=dev", "dc=~eu-.*"
+	Tags []string `mapstructure:"tags"`
+	// Priority orders the rules, rules with higher priority are checked first. Rules with same priority are checked in the config order.
+	Priority int `mapstructure:"priority"`
+	// Groups are names of backend groups, which are queried for matched requests
+	Groups []string `mapstructure:"groups"`
+	// AlsoQuery are additional groups, which are queried along with Groups
+	AlsoQuery []string `mapstructure:"alsoQuery"`
+	// Fallback are groups, which are queried if Groups returned nothing or failed
+	Fallback []string `mapstructure:"fallback"`
 }
 
 type BackendV2 struct {
@@ -32,6 +71,30 @@ type BackendV2 struct {
 	DoMultipleRequestsIfSplit bool                   `mapstructure:"doMultipleRequestsIfSplit"`
 	IdleConnectionTimeout     *time.Duration         `mapstructure:"idleConnectionTimeout"`
 	TLSClientConfig           *tlsconfig.TLSConfig   `mapstructure:"tlsClientConfig"`
+	// MergeStrategy is used to merge series with the same name from servers of the broadcast group, the first server is primary
+	MergeStrategy MergeStrategy `mapstructure:"mergeStrategy"`
+	// Shadow makes the group a shadow one: it's not queried for responses, sample of requests is mirrored to it
+	Shadow *ShadowConfig `mapstructure:"shadow"`
+	// Compression negotiates compressed responses and compresses request bodies, it's used by HTTP based protocols
+	Compression *CompressionConfig `mapstructure:"compression"`
+	// AdaptiveSplit sizes fetch sub-requests by estimated points and observed latency instead of MaxBatchSize only
+	AdaptiveSplit *AdaptiveSplitConfig `mapstructure:"adaptiveSplit"`
+	// Retry classifies failed requests and retries them with backoff, it's used by HTTP based protocols. Every failed
+	// request is retried up to MaxTries without backoff if it's not set.
+	Retry *RetryConfig `mapstructure:"retry"`
+}
+
+// ShadowConfig defines which requests are mirrored to the shadow group and how its responses are compared
+type ShadowConfig struct {
+	// SampleRate is a share of fetch and find requests, which are mirrored, from 0 to 1
+	SampleRate float64 `mapstructure:"sampleRate"`
+	// AbsoluteTolerance and RelativeTolerance are allowed differences of the values
+	AbsoluteTolerance float64 `mapstructure:"absoluteTolerance"`
+	RelativeTolerance float64 `mapstructure:"relativeTolerance"`
+	// DiffLogSampleRate is a share of mismatched responses, which diffs are logged, from 0 to 1
+	DiffLogSampleRate float64 `mapstructure:"diffLogSampleRate"`
+	// MaxConcurrency limits mirrored requests in flight, other requests are not mirrored
+	MaxConcurrency int `mapstructure:"maxConcurrency"`
 }
 
 func (b *BackendV2) FillDefaults() {
@@ -0,0 +1,102 @@
+package types
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Completeness describes whether a response contains data of all queried backend groups
+type Completeness struct {
+	Complete        bool     `json:"complete"`
+	FailedGroups    []string `json:"failedGroups,omitempty"`
+	TimedOutServers []string `json:"timedOutServers,omitempty"`
+	FailedServers   []string `json:"failedServers,omitempty"`
+	// SeriesFraction estimates the fraction of expected series in the response by the share of queried backend groups
+	// and their servers, which answered
+	SeriesFraction float64 `json:"seriesFraction"`
+}
+
+// CompletenessCollector accumulates stats of the zipper requests made while serving a single request
+type CompletenessCollector struct {
+	lock   sync.Mutex
+	stats  Stats
+	parent *CompletenessCollector
+}
+
+type completenessKey struct{}
+
+// WithCompletenessCollector returns context, which collects completeness stats of the zipper requests made with it.
+// Stats are also added to the collector of the parent context, if any, e.x. stats of a query of the batch request
+// are collected for the whole batch too.
+func WithCompletenessCollector(ctx context.Context) (context.Context, *CompletenessCollector) {
+	parent, _ := ctx.Value(completenessKey{}).(*CompletenessCollector)
+	c := &CompletenessCollector{parent: parent}
+	return context.WithValue(ctx, completenessKey{}, c), c
+}
+
+// CollectCompleteness adds completeness stats of the zipper request to the collector of the context, if any
+func CollectCompleteness(ctx context.Context, stats *Stats) {
+	if stats == nil {
+		return
+	}
+	c, _ := ctx.Value(completenessKey{}).(*CompletenessCollector)
+	for ; c != nil; c = c.parent {
+		c.add(stats)
+	}
+}
+
+func (c *CompletenessCollector) add(stats *Stats) {
+	c.lock.Lock()
+	c.stats.QueriedGroups += stats.QueriedGroups
+	c.stats.FailedGroups = append(c.stats.FailedGroups, stats.FailedGroups...)
+	c.stats.TimedOutServers = append(c.stats.TimedOutServers, stats.TimedOutServers...)
+	c.stats.FailedServers = append(c.stats.FailedServers, stats.FailedServers...)
+	c.stats.PartialGroups += stats.PartialGroups
+	c.lock.Unlock()
+}
+
+// Completeness returns completeness of the response by the collected stats. Nil collector reports complete response.
+func (c *CompletenessCollector) Completeness() Completeness {
+	if c == nil {
+		return Completeness{Complete: true, SeriesFraction: 1}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stats.Completeness()
+}
+
+// Completeness returns completeness of the response, which has the stats
+func (s *Stats) Completeness() Completeness {
+	res := Completeness{
+		FailedGroups:    uniqueStrings(s.FailedGroups),
+		TimedOutServers: uniqueStrings(s.TimedOutServers),
+		FailedServers:   uniqueStrings(s.FailedServers),
+		SeriesFraction:  1,
+	}
+	res.Complete = len(res.FailedGroups) == 0 && len(res.TimedOutServers) == 0 && len(res.FailedServers) == 0
+	if s.QueriedGroups > 0 {
+		lost := float64(len(res.FailedGroups)) + s.PartialGroups
+		if lost > float64(s.QueriedGroups) {
+			lost = float64(s.QueriedGroups)
+		}
+		res.SeriesFraction = (float64(s.QueriedGroups) - lost) / float64(s.QueriedGroups)
+	}
+	return res
+}
+
+func uniqueStrings(list []string) []string {
+	if len(list) == 0 {
+		return nil
+	}
+	res := make([]string, 0, len(list))
+	seen := make(map[string]struct{}, len(list))
+	for _, s := range list {
+		if _, ok := seen[s]; !ok {
+			seen[s] = struct{}{}
+			res = append(res, s)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,58 @@
+package types
+
+import "fmt"
+
+// Content encodings of requests to backends and their responses
+const (
+	EncodingZstd   = "zstd"
+	EncodingSnappy = "snappy"
+	EncodingGzip   = "gzip"
+)
+
+// DefaultMaxDecodedSize is a default limit of decompressed response bodies
+const DefaultMaxDecodedSize = 256 << 20
+
+var (
+	supportedAcceptEncodings  = []string{EncodingZstd, EncodingSnappy, EncodingGzip}
+	supportedRequestEncodings = []string{EncodingSnappy, EncodingGzip}
+)
+
+// CompressionConfig defines compression of requests to servers of the group and negotiation of compressed responses
+type CompressionConfig struct {
+	// AcceptEncoding lists encodings of responses in order of preference, they are sent in Accept-Encoding header
+	AcceptEncoding []string `mapstructure:"acceptEncoding"`
+	// RequestEncoding compresses bodies of requests, which are not shorter than RequestMinSize. Requests are not
+	// compressed if it's empty.
+	RequestEncoding string `mapstructure:"requestEncoding"`
+	RequestMinSize  int    `mapstructure:"requestMinSize"`
+	// MaxDecodedSize limits size of decompressed response bodies, DefaultMaxDecodedSize is used if it's 0
+	MaxDecodedSize int `mapstructure:"maxDecodedSize"`
+}
+
+// Validate returns error if encodings are unknown
+func (c *CompressionConfig) Validate() error {
+	for _, e := range c.AcceptEncoding {
+		if !contains(supportedAcceptEncodings, e) {
+			return fmt.Errorf("unknown accept encoding: '%v', supported: %v", e, supportedAcceptEncodings)
+		}
+	}
+	if c.RequestEncoding != "" && !contains(supportedRequestEncodings, c.RequestEncoding) {
+		return fmt.Errorf("unknown request encoding: '%v', supported: %v", c.RequestEncoding, supportedRequestEncodings)
+	}
+	if c.RequestMinSize < 0 {
+		return fmt.Errorf("requestMinSize can't be negative")
+	}
+	if c.MaxDecodedSize < 0 {
+		return fmt.Errorf("maxDecodedSize can't be negative")
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
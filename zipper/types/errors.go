@@ -15,7 +15,7 @@ var ErrResponseLengthMismatch = merry.New("response length mismatch")
 var ErrResponseStartTimeMismatch = merry.New("response start time mismatch")
 var ErrResponseStepTimeMismatch = merry.New("response step time mismatch")
 var ErrNotImplementedYet = merry.New("this feature is not implemented yet")
-var ErrNotSupportedByBackend = merry.New("this feature is not supported by backend")
+var ErrNotSupportedByBackend = merry.New("this feature is not supported by backend").WithHTTPCode(http.StatusNotImplemented)
 var ErrForbidden = merry.New("forbidden").WithHTTPCode(http.StatusForbidden)
 var ErrTimeoutExceeded = merry.New("timeout while fetching Response").WithHTTPCode(http.StatusGatewayTimeout)
 var ErrNonFatalErrors = merry.New("response contains non-fatal errors")
@@ -0,0 +1,18 @@
+package types
+
+import "time"
+
+// IndexConfig defines in-process index of metric names, which answers find and tag autocomplete requests
+type IndexConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// RefreshInterval is an interval of full crawls of the backends
+	RefreshInterval time.Duration `mapstructure:"refreshInterval"`
+	// MaxStaleness is an age of the index, after which requests are sent to the backends
+	MaxStaleness time.Duration `mapstructure:"maxStaleness"`
+	// MaxDepth limits depth of the metric tree crawled by find requests
+	MaxDepth int `mapstructure:"maxDepth"`
+	// Tags enables crawl of tag names and values for tag autocomplete
+	Tags bool `mapstructure:"tags"`
+	// SnapshotPath is a file, where the index is saved after refresh and loaded from on start, empty disables snapshots
+	SnapshotPath string `mapstructure:"snapshotPath"`
+}
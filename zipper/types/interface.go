@@ -26,8 +26,12 @@ type BackendServer interface {
 
 	ProbeTLDs(ctx context.Context) ([]string, merry.Error)
 
-	TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error)
-	TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error)
+	TagNames(ctx context.Context, query string, limit int64) ([]string, *Stats, merry.Error)
+	TagValues(ctx context.Context, query string, limit int64) ([]string, *Stats, merry.Error)
+	FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error)
+	TagDetails(ctx context.Context, tag, filter string) (*TagDetails, merry.Error)
+	TagSeries(ctx context.Context, paths []string) ([]string, merry.Error)
+	DelSeries(ctx context.Context, paths []string) merry.Error
 
 	Children() []BackendServer
 }
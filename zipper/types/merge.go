@@ -0,0 +1,358 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+var ErrUnknownMergeStrategyFmt = "unknown merge strategy: '%v', supported: %v"
+
+// MergeStrategy defines how series with the same name and time range, returned by different servers or groups, are merged
+type MergeStrategy string
+
+const (
+	// MergeFillGaps takes values of the first series (the finest, then the longest one) and fills its gaps from others
+	MergeFillGaps MergeStrategy = "fill-gaps"
+	// MergePreferPrimary takes values of the primary group and fills its gaps from others
+	MergePreferPrimary MergeStrategy = "prefer-primary-group"
+	// MergePreferNewest takes values of the series with the most recent point and fills its gaps from others
+	MergePreferNewest MergeStrategy = "prefer-newest-write"
+	// MergeAverage takes average of the values
+	MergeAverage MergeStrategy = "average"
+	// MergeMax takes maximum of the values
+	MergeMax MergeStrategy = "max"
+	// MergeConsolidate consolidates series to the coarsest step and fills gaps like MergeFillGaps
+	MergeConsolidate MergeStrategy = "consolidate-to-coarser-step"
+)
+
+var supportedMergeStrategies = []MergeStrategy{
+	MergeFillGaps,
+	MergePreferPrimary,
+	MergePreferNewest,
+	MergeAverage,
+	MergeMax,
+	MergeConsolidate,
+}
+
+// Validate returns error if strategy is unknown. Empty strategy is fill-gaps.
+func (s MergeStrategy) Validate() error {
+	if s == "" {
+		return nil
+	}
+	for _, strategy := range supportedMergeStrategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf(ErrUnknownMergeStrategyFmt, string(s), supportedMergeStrategies)
+}
+
+// MergePolicy is a merge strategy with the name of the primary server or group for MergePreferPrimary
+type MergePolicy struct {
+	Strategy MergeStrategy
+	Primary  string
+}
+
+// MergeSeries merges series with the same name and time range. Series with different start times or steps are
+// aligned to the common grid: step of the finest series (or the coarsest one for MergeConsolidate) and time range of
+// series with that step. Finer series are consolidated with their consolidation function, coarser are resampled.
+// primary is an index of the primary series for MergePreferPrimary, -1 if there is no such series.
+func MergeSeries(strategy MergeStrategy, primary int, series []protov3.FetchResponse) protov3.FetchResponse {
+	if len(series) == 0 {
+		return protov3.FetchResponse{}
+	}
+	if len(series) == 1 {
+		return series[0]
+	}
+
+	ref := referenceSeries(strategy, series)
+	result := series[ref]
+
+	var values [][]float64
+	if sameGrid(series) || !validSteps(series) {
+		n := 0
+		for i := range series {
+			if len(series[i].Values) > n {
+				n = len(series[i].Values)
+			}
+		}
+		values = make([][]float64, len(series))
+		for i := range series {
+			values[i] = series[i].Values
+		}
+		result.Values = make([]float64, n)
+	} else {
+		step := result.StepTime
+		var start, stop int64
+		if strategy == MergeConsolidate {
+			for i := range series {
+				step = lcm(step, series[i].StepTime)
+			}
+			start, stop = series[0].StartTime, seriesStop(&series[0])
+			for i := range series {
+				start = min(start, series[i].StartTime)
+				stop = max(stop, seriesStop(&series[i]))
+			}
+			start -= mod(start, step)
+		} else {
+			start, stop = result.StartTime, seriesStop(&result)
+			for i := range series {
+				if series[i].StepTime != step {
+					continue
+				}
+				// align start of the series to the grid of the reference series
+				s := series[i].StartTime - mod(series[i].StartTime-result.StartTime, step)
+				start = min(start, s)
+				stop = max(stop, s+int64(len(series[i].Values))*step)
+			}
+		}
+		n := int((stop - start + step - 1) / step)
+
+		values = make([][]float64, len(series))
+		for i := range series {
+			values[i] = resample(&series[i], start, step, n)
+		}
+		result.StartTime = start
+		result.StepTime = step
+		result.StopTime = start + int64(n)*step
+		result.Values = make([]float64, n)
+	}
+
+	switch strategy {
+	case MergeAverage:
+		for j := range result.Values {
+			sum, cnt := 0.0, 0
+			for i := range values {
+				if j < len(values[i]) && !math.IsNaN(values[i][j]) {
+					sum += values[i][j]
+					cnt++
+				}
+			}
+			if cnt == 0 {
+				result.Values[j] = math.NaN()
+			} else {
+				result.Values[j] = sum / float64(cnt)
+			}
+		}
+	case MergeMax:
+		for j := range result.Values {
+			v := math.NaN()
+			for i := range values {
+				if j < len(values[i]) && !math.IsNaN(values[i][j]) && (math.IsNaN(v) || values[i][j] > v) {
+					v = values[i][j]
+				}
+			}
+			result.Values[j] = v
+		}
+	default:
+		order := mergeOrder(strategy, ref, primary, series)
+		for j := range result.Values {
+			v := math.NaN()
+			for _, i := range order {
+				if j < len(values[i]) && !math.IsNaN(values[i][j]) {
+					v = values[i][j]
+					break
+				}
+			}
+			result.Values[j] = v
+		}
+	}
+
+	return result
+}
+
+// referenceSeries returns index of the series, which metadata and time range are used for the result
+func referenceSeries(strategy MergeStrategy, series []protov3.FetchResponse) int {
+	ref := 0
+	for i := 1; i < len(series); i++ {
+		s, r := &series[i], &series[ref]
+		if strategy == MergeConsolidate {
+			if s.StepTime > r.StepTime || (s.StepTime == r.StepTime && len(s.Values) > len(r.Values)) {
+				ref = i
+			}
+		} else if s.StepTime < r.StepTime || (s.StepTime == r.StepTime && len(s.Values) > len(r.Values)) {
+			ref = i
+		}
+	}
+	return ref
+}
+
+// mergeOrder returns indexes of the series in order of preference
+func mergeOrder(strategy MergeStrategy, ref, primary int, series []protov3.FetchResponse) []int {
+	order := make([]int, 0, len(series))
+	first := ref
+	if strategy == MergePreferPrimary && primary >= 0 {
+		first = primary
+	}
+	order = append(order, first)
+	for i := range series {
+		if i != first {
+			order = append(order, i)
+		}
+	}
+
+	if strategy == MergePreferNewest {
+		newest := make([]int64, len(series))
+		for i := range series {
+			newest[i] = math.MinInt64
+			for j := len(series[i].Values) - 1; j >= 0; j-- {
+				if !math.IsNaN(series[i].Values[j]) {
+					newest[i] = series[i].StartTime + int64(j)*series[i].StepTime
+					break
+				}
+			}
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return newest[order[a]] > newest[order[b]]
+		})
+	}
+	return order
+}
+
+func sameGrid(series []protov3.FetchResponse) bool {
+	for i := 1; i < len(series); i++ {
+		if series[i].StartTime != series[0].StartTime || series[i].StepTime != series[0].StepTime {
+			return false
+		}
+	}
+	return true
+}
+
+func validSteps(series []protov3.FetchResponse) bool {
+	for i := range series {
+		if series[i].StepTime <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func seriesStop(s *protov3.FetchResponse) int64 {
+	return s.StartTime + int64(len(s.Values))*s.StepTime
+}
+
+// resample returns values of the series on the grid of n points with the step, starting at start.
+// Finer series are consolidated by their consolidation function, coarser ones are repeated (or divided for sums).
+func resample(s *protov3.FetchResponse, start, step int64, n int) []float64 {
+	values := make([]float64, n)
+	for j := range values {
+		values[j] = math.NaN()
+	}
+	if s.StepTime == step && mod(s.StartTime-start, step) == 0 {
+		offset := int((s.StartTime - start) / step)
+		for i, v := range s.Values {
+			if j := offset + i; j >= 0 && j < n {
+				values[j] = v
+			}
+		}
+		return values
+	}
+
+	if s.StepTime > step {
+		ratio := 1.0
+		if isSum(s.ConsolidationFunc) {
+			ratio = float64(s.StepTime) / float64(step)
+		}
+		for j := range values {
+			ts := start + int64(j)*step
+			if ts < s.StartTime {
+				continue
+			}
+			i := int((ts - s.StartTime) / s.StepTime)
+			if i < len(s.Values) {
+				values[j] = s.Values[i] / ratio
+			}
+		}
+		return values
+	}
+
+	// points of finer or unaligned series are put to buckets by their timestamps
+	buckets := make([][]float64, n)
+	for i, v := range s.Values {
+		if math.IsNaN(v) {
+			continue
+		}
+		ts := s.StartTime + int64(i)*s.StepTime
+		if ts < start {
+			continue
+		}
+		j := int((ts - start) / step)
+		if j < n {
+			buckets[j] = append(buckets[j], v)
+		}
+	}
+	for j, b := range buckets {
+		if len(b) > 0 {
+			values[j] = consolidate(s.ConsolidationFunc, b)
+		}
+	}
+	return values
+}
+
+func isSum(consolidationFunc string) bool {
+	switch strings.ToLower(consolidationFunc) {
+	case "sum", "total":
+		return true
+	}
+	return false
+}
+
+// consolidate aggregates non-empty list of values, unknown functions are treated as average
+func consolidate(consolidationFunc string, values []float64) float64 {
+	switch strings.ToLower(consolidationFunc) {
+	case "sum", "total":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case "min":
+		m := values[0]
+		for _, v := range values[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	case "max":
+		m := values[0]
+		for _, v := range values[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	case "first":
+		return values[0]
+	case "last":
+		return values[len(values)-1]
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// mod returns non-negative remainder of a/b
+func mod(a, b int64) int64 {
+	r := a % b
+	if r < 0 {
+		r += b
+	}
+	return r
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func lcm(a, b int64) int64 {
+	if a <= 0 || b <= 0 {
+		return max(a, b)
+	}
+	return a / gcd(a, b) * b
+}
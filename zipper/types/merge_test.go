@@ -0,0 +1,135 @@
+package types
+
+import (
+	"math"
+	"testing"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+func series(start, step int64, consolidationFunc string, values ...float64) protov3.FetchResponse {
+	return protov3.FetchResponse{
+		Name:              "foo",
+		ConsolidationFunc: consolidationFunc,
+		StartTime:         start,
+		StepTime:          step,
+		StopTime:          start + int64(len(values))*step,
+		Values:            values,
+	}
+}
+
+func TestMergeSeries(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		primary  int
+		series   []protov3.FetchResponse
+		expected protov3.FetchResponse
+	}{
+		{
+			name:     "fill gaps",
+			strategy: MergeFillGaps,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(60, 60, "average", 1, nan, 3), series(60, 60, "average", 10, 2, 30)},
+			expected: series(60, 60, "average", 1, 2, 3),
+		},
+		{
+			name:     "fill gaps with start time mismatch",
+			strategy: MergeFillGaps,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(60, 60, "average", 1, nan), series(120, 60, "average", 2, 3)},
+			expected: series(60, 60, "average", 1, 2, 3),
+		},
+		{
+			name:     "fill gaps with unaligned start time",
+			strategy: MergeFillGaps,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(60, 60, "average", 1, nan), series(130, 60, "average", 2, 3)},
+			expected: series(60, 60, "average", 1, 2, 3),
+		},
+		{
+			name:     "fill gaps of finer series from coarser",
+			strategy: MergeFillGaps,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(0, 120, "average", 5, 7), series(0, 60, "average", 1, nan, 3, nan)},
+			expected: series(0, 60, "average", 1, 5, 3, 7),
+		},
+		{
+			name:     "sum is divided when upsampled",
+			strategy: MergeFillGaps,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(0, 60, "sum", 1, nan), series(0, 120, "sum", 8)},
+			expected: series(0, 60, "sum", 1, 4),
+		},
+		{
+			name:     "prefer primary",
+			strategy: MergePreferPrimary,
+			primary:  1,
+			series:   []protov3.FetchResponse{series(0, 60, "average", 1, 2, 3), series(0, 60, "average", 10, nan, 30)},
+			expected: series(0, 60, "average", 10, 2, 30),
+		},
+		{
+			name:     "prefer newest",
+			strategy: MergePreferNewest,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(0, 60, "average", 1, 2, nan), series(0, 60, "average", 10, nan, 30)},
+			expected: series(0, 60, "average", 10, 2, 30),
+		},
+		{
+			name:     "average",
+			strategy: MergeAverage,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(0, 60, "average", 1, nan, 3), series(0, 60, "average", 3, 2, nan), series(0, 60, "average", 5, nan, nan)},
+			expected: series(0, 60, "average", 3, 2, 3),
+		},
+		{
+			name:     "max",
+			strategy: MergeMax,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(0, 60, "average", 1, nan, 3), series(0, 60, "average", 3, 2, -1)},
+			expected: series(0, 60, "average", 3, 2, 3),
+		},
+		{
+			name:     "consolidate to coarser step",
+			strategy: MergeConsolidate,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(60, 60, "max", 1, 2, 3, 4, 5), series(0, 120, "average", 10, nan, nan)},
+			expected: series(0, 120, "average", 10, 3, 5),
+		},
+		{
+			name:     "consolidate to least common multiple",
+			strategy: MergeConsolidate,
+			primary:  -1,
+			series:   []protov3.FetchResponse{series(0, 60, "sum", 1, 1, 1, 1, 1, 1), series(0, 90, "average", nan, nan, nan, nan)},
+			expected: series(0, 180, "average", 3, 3),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeSeries(tt.strategy, tt.primary, tt.series)
+			if got.StartTime != tt.expected.StartTime || got.StepTime != tt.expected.StepTime || got.StopTime != tt.expected.StopTime {
+				t.Errorf("unexpected time range: got start %d step %d stop %d, expected start %d step %d stop %d",
+					got.StartTime, got.StepTime, got.StopTime, tt.expected.StartTime, tt.expected.StepTime, tt.expected.StopTime)
+			}
+			if got.ConsolidationFunc != tt.expected.ConsolidationFunc {
+				t.Errorf("unexpected consolidation function %q, expected %q", got.ConsolidationFunc, tt.expected.ConsolidationFunc)
+			}
+			if !cmpFloat64Arrays(got.Values, tt.expected.Values, 0.00001) {
+				t.Errorf("unexpected values %v, expected %v", got.Values, tt.expected.Values)
+			}
+		})
+	}
+}
+
+func TestMergeStrategyValidate(t *testing.T) {
+	for _, s := range []MergeStrategy{"", MergeFillGaps, MergeConsolidate} {
+		if err := s.Validate(); err != nil {
+			t.Errorf("unexpected error for %q: %v", s, err)
+		}
+	}
+	if err := MergeStrategy("min").Validate(); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
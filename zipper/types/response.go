@@ -2,7 +2,6 @@ package types
 
 import (
 	"context"
-	"math"
 
 	"github.com/ansel1/merry"
 
@@ -70,12 +69,14 @@ GATHER:
 type ServerTagResponse struct {
 	Server   string
 	Response []string
+	Stats    *Stats
 	Err      []merry.Error
 }
 
 func NewServerTagResponse() *ServerTagResponse {
 	return &ServerTagResponse{
 		Response: []string{},
+		Stats:    new(Stats),
 	}
 }
 
@@ -122,6 +123,13 @@ func (first *ServerTagResponse) Merge(second *ServerTagResponse) merry.Error {
 		}
 	}
 
+	if second.Stats != nil {
+		if first.Stats == nil {
+			first.Stats = new(Stats)
+		}
+		first.Stats.Merge(second.Stats)
+	}
+
 	if second.Response == nil {
 		return nil
 	}
@@ -141,6 +149,85 @@ func (first *ServerTagResponse) Merge(second *ServerTagResponse) merry.Error {
 	return nil
 }
 
+// ServerTagSeriesResponse contains paths of registered series, n-th path is the path of n-th requested series or
+// empty string, if the series isn't registered
+type ServerTagSeriesResponse struct {
+	Server   string
+	Response []string
+	Stats    *Stats
+	Err      []merry.Error
+}
+
+func NewServerTagSeriesResponse() *ServerTagSeriesResponse {
+	return &ServerTagSeriesResponse{
+		Stats: new(Stats),
+	}
+}
+
+func (s *ServerTagSeriesResponse) Self() interface{} {
+	return s
+}
+
+func (s ServerTagSeriesResponse) GetServer() string {
+	return s.Server
+}
+
+func (first *ServerTagSeriesResponse) MergeI(second ServerFetcherResponse) merry.Error {
+	secondSelf := second.Self()
+	s, ok := secondSelf.(*ServerTagSeriesResponse)
+	if !ok {
+		return ErrResponseTypeMismatch.Here().WithMessagef("got '%T', expected '%T'", secondSelf, first)
+	}
+	return first.Merge(s)
+}
+
+func (s *ServerTagSeriesResponse) AddError(err merry.Error) {
+	if err == nil {
+		return
+	}
+	if s.Err == nil {
+		s.Err = []merry.Error{err}
+	} else {
+		s.Err = append(s.Err, err)
+	}
+}
+
+func (first *ServerTagSeriesResponse) Errors() []merry.Error {
+	return first.Err
+}
+
+// Merge keeps positions of the paths: n-th path is the first non-empty n-th path of the responses
+func (first *ServerTagSeriesResponse) Merge(second *ServerTagSeriesResponse) merry.Error {
+	if first.Err == nil {
+		if second.Err != nil {
+			first.Err = second.Err
+		}
+	} else {
+		if second.Err != nil {
+			first.Err = append(first.Err, second.Err...)
+		}
+	}
+
+	if second.Stats != nil {
+		if first.Stats == nil {
+			first.Stats = new(Stats)
+		}
+		first.Stats.Merge(second.Stats)
+	}
+
+	for i, v := range second.Response {
+		if i >= len(first.Response) {
+			first.Response = append(first.Response, second.Response[i:]...)
+			break
+		}
+		if first.Response[i] == "" {
+			first.Response[i] = v
+		}
+	}
+
+	return nil
+}
+
 type ServerInfoResponse struct {
 	Server   string
 	Response *protov3.ZipperInfoResponse
@@ -323,6 +410,21 @@ type ServerFetchResponse struct {
 	Response *protov3.MultiFetchResponse
 	Stats    *Stats
 	Err      []merry.Error
+
+	// MergePolicy is a policy of merging series with the same name and time range from different servers.
+	// If it's set, such series are collected and merged by MergeSeries, otherwise they are merged as they come.
+	MergePolicy *MergePolicy
+	// origins are servers of the series by their index in Response.Metrics
+	origins map[int]string
+	// duplicates are series with the same coordinates, that are merged by MergeSeries
+	duplicates map[int][]mergeSource
+	// index is a position of the series in Response.Metrics by its coordinates
+	index map[fetchResponseCoordinates]int
+}
+
+type mergeSource struct {
+	server string
+	series protov3.FetchResponse
 }
 
 func NewServerFetchResponse() *ServerFetchResponse {
@@ -359,23 +461,69 @@ func (first *ServerFetchResponse) Merge(second *ServerFetchResponse) merry.Error
 		return nil
 	}
 
-	metrics := make(map[fetchResponseCoordinates]int)
-	for i := range first.Response.Metrics {
-		metrics[coordinates(&first.Response.Metrics[i])] = i
+	for i := range second.Response.Metrics {
+		first.AddSeries(second.Server, &second.Response.Metrics[i])
+	}
+	return nil
+}
+
+// AddSeries merges series, received from the server, into the response
+func (first *ServerFetchResponse) AddSeries(server string, series *protov3.FetchResponse) {
+	if first.Response == nil {
+		first.Response = new(protov3.MultiFetchResponse)
+	}
+	if first.index == nil || len(first.index) != len(first.Response.Metrics) {
+		// Response was changed outside, e.x. replaced by the fetched one
+		first.index = make(map[fetchResponseCoordinates]int, len(first.Response.Metrics))
+		for i := range first.Response.Metrics {
+			first.index[coordinates(&first.Response.Metrics[i])] = i
+		}
 	}
 
-	for i := range second.Response.Metrics {
-		if j, ok := metrics[coordinates(&second.Response.Metrics[i])]; ok {
-			err := MergeFetchResponses(&first.Response.Metrics[j], &second.Response.Metrics[i])
-			if err != nil {
-				// TODO: Normal merry.Error handling
-				continue
+	if j, ok := first.index[coordinates(series)]; ok {
+		if first.MergePolicy != nil {
+			if first.duplicates == nil {
+				first.duplicates = make(map[int][]mergeSource)
 			}
-		} else {
-			first.Response.Metrics = append(first.Response.Metrics, second.Response.Metrics[i])
+			first.duplicates[j] = append(first.duplicates[j], mergeSource{server: server, series: *series})
+			return
+		}
+		// TODO: Normal merry.Error handling
+		_ = MergeFetchResponses(&first.Response.Metrics[j], series)
+		return
+	}
+	if first.MergePolicy != nil {
+		if first.origins == nil {
+			first.origins = make(map[int]string)
 		}
+		first.origins[len(first.Response.Metrics)] = server
 	}
-	return nil
+	first.index[coordinates(series)] = len(first.Response.Metrics)
+	first.Response.Metrics = append(first.Response.Metrics, *series)
+}
+
+// MergeDuplicates merges collected series with the same name and time range by MergePolicy
+func (first *ServerFetchResponse) MergeDuplicates() {
+	if first.MergePolicy == nil {
+		return
+	}
+	for j, duplicates := range first.duplicates {
+		primary := -1
+		if first.MergePolicy.Primary != "" && first.origins[j] == first.MergePolicy.Primary {
+			primary = 0
+		}
+		series := make([]protov3.FetchResponse, 0, len(duplicates)+1)
+		series = append(series, first.Response.Metrics[j])
+		for _, d := range duplicates {
+			if primary < 0 && first.MergePolicy.Primary != "" && d.server == first.MergePolicy.Primary {
+				primary = len(series)
+			}
+			series = append(series, d.series)
+		}
+		first.Response.Metrics[j] = MergeSeries(first.MergePolicy.Strategy, primary, series)
+	}
+	first.duplicates = nil
+	first.origins = nil
 }
 
 func (first *ServerFetchResponse) MergeI(second ServerFetcherResponse) merry.Error {
@@ -407,79 +555,21 @@ func (s *ServerFetchResponse) NonFatalError(err merry.Error) *ServerFetchRespons
 	return s
 }
 
-func swapFetchResponses(m1, m2 *protov3.FetchResponse) {
-	m1.Name, m2.Name = m2.Name, m1.Name
-	m1.StartTime, m2.StartTime = m2.StartTime, m1.StartTime
-	m1.StepTime, m2.StepTime = m2.StepTime, m1.StepTime
-	m1.ConsolidationFunc, m2.ConsolidationFunc = m2.ConsolidationFunc, m1.ConsolidationFunc
-	m1.XFilesFactor, m2.XFilesFactor = m2.XFilesFactor, m1.XFilesFactor
-	m1.Values, m2.Values = m2.Values, m1.Values
-	m1.AppliedFunctions, m2.AppliedFunctions = m2.AppliedFunctions, m1.AppliedFunctions
-	m1.StopTime, m2.StopTime = m2.StopTime, m1.StopTime
-}
-
-func mergeFetchResponsesWithEqualStepTimes(m1, m2 *protov3.FetchResponse) merry.Error {
-	if m1.StartTime != m2.StartTime {
-		return ErrResponseStartTimeMismatch
-	}
-
-	if len(m1.Values) < len(m2.Values) {
-		swapFetchResponses(m1, m2)
-	}
-
-	for i := 0; i < len(m2.Values); i++ {
-		if math.IsNaN(m1.Values[i]) {
-			m1.Values[i] = m2.Values[i]
-		}
-	}
-
-	return nil
-}
-
-func mergeFetchResponsesWithUnequalStepTimes(m1, m2 *protov3.FetchResponse) merry.Error {
-	if m1.StepTime > m2.StepTime {
-		swapFetchResponses(m1, m2)
-	}
-
-	zapwriter.Logger("zipper").Warn("Fetch responses had different step times",
-		zap.Int64("m1_request_start_time", m1.RequestStartTime),
-		zap.Int64("m1_start_time", m1.StartTime),
-		zap.Int64("m1_stop_time", m1.StopTime),
-		zap.Int64("m1_step_time", m1.StepTime),
-		zap.Int64("m2_request_start_time", m2.RequestStartTime),
-		zap.Int64("m2_start_time", m2.StartTime),
-		zap.Int64("m2_stop_time", m2.StopTime),
-		zap.Int64("m2_step_time", m2.StepTime),
-	)
-
-	return nil
-}
-
+// MergeFetchResponses merges m2 into m1 by MergeFillGaps strategy
 func MergeFetchResponses(m1, m2 *protov3.FetchResponse) merry.Error {
-	var err merry.Error
-	if m1.RequestStartTime != m2.RequestStartTime {
-		err = ErrResponseStartTimeMismatch
-	} else if m1.StepTime == m2.StepTime {
-		err = mergeFetchResponsesWithEqualStepTimes(m1, m2)
-	} else {
-		err = mergeFetchResponsesWithUnequalStepTimes(m1, m2)
-	}
-
-	if err != nil {
-		zapwriter.Logger("zipper").Error("Unable to merge fetch responses",
-			zap.Error(err),
-			zap.Int64("m1_request_start_time", m1.RequestStartTime),
+	if m1.StepTime != m2.StepTime || m1.StartTime != m2.StartTime {
+		zapwriter.Logger("zipper").Debug("aligning fetch responses",
+			zap.String("name", m1.Name),
 			zap.Int64("m1_start_time", m1.StartTime),
 			zap.Int64("m1_stop_time", m1.StopTime),
 			zap.Int64("m1_step_time", m1.StepTime),
-			zap.Int64("m2_request_start_time", m2.RequestStartTime),
 			zap.Int64("m2_start_time", m2.StartTime),
 			zap.Int64("m2_stop_time", m2.StopTime),
 			zap.Int64("m2_step_time", m2.StepTime),
 		)
 	}
-
-	return err
+	*m1 = MergeSeries(MergeFillGaps, -1, []protov3.FetchResponse{*m1, *m2})
+	return nil
 }
 
 type fetchResponseCoordinates struct {
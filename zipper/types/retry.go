@@ -0,0 +1,107 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors of requests to servers, which could be retried, they are also reasons of retries in metrics
+const (
+	// RetryTimeout is a request, which timed out, while the query still has time for another try
+	RetryTimeout = "timeout"
+	// RetryConnection is a failure to connect or to send the request, e.x. connection refused or reset
+	RetryConnection = "connection"
+	// RetryBody is a failure to read the response, e.x. connection reset in the middle of the body
+	RetryBody = "body"
+	// RetryStatus is a response with retryable status code
+	RetryStatus = "status"
+)
+
+var (
+	supportedRetryErrors   = []string{RetryTimeout, RetryConnection, RetryBody}
+	defaultRetryableStatus = []string{"5xx", "429"}
+)
+
+// RetryConfig defines which failed requests to servers of the group are retried and how
+type RetryConfig struct {
+	// RetryableStatus lists status codes, e.x. "503", or their classes, e.x. "5xx", of responses, which are retried
+	RetryableStatus []string `mapstructure:"retryableStatus"`
+	// RetryableErrors lists errors, which are retried: timeout, connection and body
+	RetryableErrors []string `mapstructure:"retryableErrors"`
+	// InitialBackoff is a delay before the first retry, it's multiplied by Multiplier for every next one up to
+	// MaxBackoff
+	InitialBackoff time.Duration `mapstructure:"initialBackoff"`
+	MaxBackoff     time.Duration `mapstructure:"maxBackoff"`
+	Multiplier     float64       `mapstructure:"multiplier"`
+	// Jitter randomizes every delay by up to its share in both directions, from 0 to 1
+	Jitter float64 `mapstructure:"jitter"`
+	// Budget limits retries of all requests to the group, which are made for one request of carbonapi. 0 is unlimited.
+	Budget int `mapstructure:"budget"`
+	// RetryPost allows to retry POST requests, which were sent to the server. They are not idempotent, so they are
+	// retried only if the server wasn't connected by default.
+	RetryPost bool `mapstructure:"retryPost"`
+}
+
+// FillDefaults sets defaults of unset options
+func (c *RetryConfig) FillDefaults() {
+	if c.RetryableStatus == nil {
+		c.RetryableStatus = defaultRetryableStatus
+	}
+	if c.RetryableErrors == nil {
+		c.RetryableErrors = supportedRetryErrors
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = 50 * time.Millisecond
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = time.Second
+	}
+	if c.Multiplier == 0 {
+		c.Multiplier = 2
+	}
+}
+
+// Validate returns error if options are invalid
+func (c *RetryConfig) Validate() error {
+	for _, s := range c.RetryableStatus {
+		if _, _, err := ParseStatusClass(s); err != nil {
+			return err
+		}
+	}
+	for _, e := range c.RetryableErrors {
+		if !contains(supportedRetryErrors, e) {
+			return fmt.Errorf("unknown retryable error: '%v', supported: %v", e, supportedRetryErrors)
+		}
+	}
+	if c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("backoff can't be negative")
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("maxBackoff can't be less than initialBackoff")
+	}
+	if c.Multiplier < 1 {
+		return fmt.Errorf("multiplier can't be less than 1")
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("jitter should be from 0 to 1")
+	}
+	if c.Budget < 0 {
+		return fmt.Errorf("budget can't be negative")
+	}
+	return nil
+}
+
+// ParseStatusClass parses status code, e.x. "503", or class of them, e.x. "5xx", to the range of codes
+func ParseStatusClass(s string) (from, to int, err error) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") && s[0] >= '1' && s[0] <= '5' {
+		from = int(s[0]-'0') * 100
+		return from, from + 99, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("invalid retryable status: '%v', should be code, e.x. 503, or class, e.x. 5xx", s)
+	}
+	return code, code, nil
+}
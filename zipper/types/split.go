@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+// AdaptiveSplitConfig defines how fetch requests to the servers of the group are split into sub-requests. Sub-requests
+// are sized by estimated number of points (series found by glob, time range and step of the server) and by observed
+// latency of the server.
+type AdaptiveSplitConfig struct {
+	// MaxPointsPerRequest limits estimated number of points per sub-request, a series with more points is fetched alone
+	MaxPointsPerRequest int64 `mapstructure:"maxPointsPerRequest"`
+	// TargetLatency shrinks sub-requests, so they are expected to be answered in it according to observed latency per
+	// point. 0 disables it.
+	TargetLatency time.Duration `mapstructure:"targetLatency"`
+	// DefaultStep estimates points until step of the server is observed in its responses
+	DefaultStep time.Duration `mapstructure:"defaultStep"`
+	// Parallelism limits sub-requests of the fetch, which are sent to a server concurrently
+	Parallelism int `mapstructure:"parallelism"`
+}
+
+// FillDefaults sets defaults of unset options
+func (c *AdaptiveSplitConfig) FillDefaults() {
+	if c.MaxPointsPerRequest <= 0 {
+		c.MaxPointsPerRequest = 1000000
+	}
+	if c.DefaultStep <= 0 {
+		c.DefaultStep = time.Minute
+	}
+	if c.Parallelism <= 0 {
+		c.Parallelism = 4
+	}
+}
@@ -1,5 +1,7 @@
 package types
 
+import "github.com/ansel1/merry"
+
 // Stats provides zipper-related statistics
 type Stats struct {
 	Timeouts          uint64
@@ -12,6 +14,9 @@ type Stats struct {
 	InfoRequests      uint64
 	InfoErrors        uint64
 	InfoTimeouts      uint64
+	TagRequests       uint64
+	TagErrors         uint64
+	TagTimeouts       uint64
 	SearchRequests    uint64
 	SearchCacheHits   uint64
 	SearchCacheMisses uint64
@@ -23,6 +28,25 @@ type Stats struct {
 	CacheMisses uint64
 	CacheHits   uint64
 
+	// Shadow* are stats of requests mirrored to shadow groups
+	ShadowRequests   uint64
+	ShadowErrors     uint64
+	ShadowMismatches uint64
+	ShadowDropped    uint64
+
+	// Index* are requests answered by the index of metric names and passed to the backends
+	IndexHits   uint64
+	IndexMisses uint64
+
+	// QueriedGroups counts backend groups, which were queried by the root group. FailedGroups are the groups, which
+	// returned errors without data or didn't answer in time. TimedOutServers are servers and groups, which didn't
+	// answer in time. PartialGroups is the share of queried groups lost by failed servers of the groups, which
+	// returned data.
+	QueriedGroups   uint64
+	FailedGroups    []string
+	TimedOutServers []string
+	PartialGroups   float64
+
 	Servers       []string
 	FailedServers []string
 }
@@ -38,13 +62,40 @@ func (s *Stats) Merge(stats *Stats) {
 	s.InfoRequests += stats.InfoRequests
 	s.InfoTimeouts += stats.InfoTimeouts
 	s.InfoErrors += stats.InfoErrors
+	s.TagRequests += stats.TagRequests
+	s.TagTimeouts += stats.TagTimeouts
+	s.TagErrors += stats.TagErrors
 	s.SearchRequests += stats.SearchRequests
 	s.SearchCacheHits += stats.SearchCacheHits
 	s.SearchCacheMisses += stats.SearchCacheMisses
 	s.MemoryUsage += stats.MemoryUsage
 	s.CacheMisses += stats.CacheMisses
 	s.CacheHits += stats.CacheHits
+	s.ShadowRequests += stats.ShadowRequests
+	s.ShadowErrors += stats.ShadowErrors
+	s.ShadowMismatches += stats.ShadowMismatches
+	s.ShadowDropped += stats.ShadowDropped
+	s.IndexHits += stats.IndexHits
+	s.IndexMisses += stats.IndexMisses
+	s.QueriedGroups += stats.QueriedGroups
+	s.PartialGroups += stats.PartialGroups
+
+	s.FailedGroups = append(s.FailedGroups, stats.FailedGroups...)
+	s.TimedOutServers = append(s.TimedOutServers, stats.TimedOutServers...)
 
 	s.Servers = append(s.Servers, stats.Servers...)
 	s.FailedServers = append(s.FailedServers, stats.FailedServers...)
 }
+
+// TagStats returns stats of the single tag autocomplete request, finished with err
+func TagStats(err merry.Error) *Stats {
+	stats := &Stats{TagRequests: 1}
+	if err != nil {
+		stats.TagErrors = 1
+		if merry.Is(err, ErrTimeoutExceeded) {
+			stats.Timeouts = 1
+			stats.TagTimeouts = 1
+		}
+	}
+	return stats
+}
@@ -0,0 +1,116 @@
+package types
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/ansel1/merry"
+)
+
+// TagValue is a value of the tag with amount of series that have it
+type TagValue struct {
+	Count int64  `json:"count"`
+	Value string `json:"value"`
+}
+
+// TagDetails describes values of the tag, as returned by graphite-web /tags/<tag> API
+type TagDetails struct {
+	Tag    string     `json:"tag"`
+	Values []TagValue `json:"values"`
+}
+
+// Merge adds values from the second TagDetails. Counts of the same values are summed up, as backends are expected to be shards.
+func (first *TagDetails) Merge(second *TagDetails) {
+	if second == nil {
+		return
+	}
+	if first.Tag == "" {
+		first.Tag = second.Tag
+	}
+
+	idx := make(map[string]int, len(first.Values))
+	for i, v := range first.Values {
+		idx[v.Value] = i
+	}
+	for _, v := range second.Values {
+		if i, ok := idx[v.Value]; ok {
+			first.Values[i].Count += v.Count
+		} else {
+			idx[v.Value] = len(first.Values)
+			first.Values = append(first.Values, v)
+		}
+	}
+
+	sort.Slice(first.Values, func(i, j int) bool { return first.Values[i].Value < first.Values[j].Value })
+}
+
+// MethodRequest is implemented by requests that must be sent with HTTP method other than GET
+type MethodRequest interface {
+	Request
+	Method() string
+	ContentType() string
+}
+
+// FormRequest is a form-urlencoded POST request, used by graphite-web tags API for writes
+type FormRequest struct {
+	url.Values
+}
+
+func (request FormRequest) Marshal() ([]byte, merry.Error) {
+	return []byte(request.Encode()), nil
+}
+
+func (request FormRequest) LogInfo() interface{} {
+	return request.Values
+}
+
+func (request FormRequest) Method() string {
+	return http.MethodPost
+}
+
+func (request FormRequest) ContentType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+type ServerTagDetailsResponse struct {
+	Server   string
+	Response *TagDetails
+	Err      []merry.Error
+}
+
+func NewServerTagDetailsResponse() *ServerTagDetailsResponse {
+	return &ServerTagDetailsResponse{
+		Response: &TagDetails{Values: []TagValue{}},
+	}
+}
+
+func (s *ServerTagDetailsResponse) Self() interface{} {
+	return s
+}
+
+func (s ServerTagDetailsResponse) GetServer() string {
+	return s.Server
+}
+
+func (first *ServerTagDetailsResponse) MergeI(second ServerFetcherResponse) merry.Error {
+	secondSelf := second.Self()
+	s, ok := secondSelf.(*ServerTagDetailsResponse)
+	if !ok {
+		return ErrResponseTypeMismatch.Here().WithMessagef("got '%T', expected '%T'", secondSelf, first)
+	}
+	first.Err = append(first.Err, s.Err...)
+	first.Response.Merge(s.Response)
+	return nil
+}
+
+func (s *ServerTagDetailsResponse) AddError(err merry.Error) {
+	if err == nil {
+		return
+	}
+	s.Err = append(s.Err, err)
+}
+
+func (first *ServerTagDetailsResponse) Errors() []merry.Error {
+	return first.Err
+}
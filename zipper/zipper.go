@@ -13,7 +13,11 @@ import (
 	"github.com/go-graphite/carbonapi/zipper/broadcast"
 	"github.com/go-graphite/carbonapi/zipper/config"
 	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/index"
 	"github.com/go-graphite/carbonapi/zipper/metadata"
+	"github.com/go-graphite/carbonapi/zipper/routing"
+	"github.com/go-graphite/carbonapi/zipper/shadow"
+	"github.com/go-graphite/carbonapi/zipper/tiered"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/auto"
@@ -22,6 +26,7 @@ import (
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/prometheus"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v2"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3"
+	_ "github.com/go-graphite/carbonapi/zipper/protocols/v3grpc"
 	_ "github.com/go-graphite/carbonapi/zipper/protocols/victoriametrics"
 )
 
@@ -101,6 +106,33 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 			return nil, merry.Errorf("unknown backend protocol '%v'", backend.Protocol)
 		}
 
+		if err := backend.MergeStrategy.Validate(); err != nil {
+			logger.Error("invalid merge strategy",
+				zap.String("group", backend.GroupName),
+				zap.Error(err),
+			)
+			return nil, merry.Wrap(err)
+		}
+		if backend.Compression != nil {
+			if err := backend.Compression.Validate(); err != nil {
+				logger.Error("invalid compression",
+					zap.String("group", backend.GroupName),
+					zap.Error(err),
+				)
+				return nil, merry.Wrap(err)
+			}
+		}
+		if backend.Retry != nil {
+			backend.Retry.FillDefaults()
+			if err := backend.Retry.Validate(); err != nil {
+				logger.Error("invalid retry policy",
+					zap.String("group", backend.GroupName),
+					zap.Error(err),
+				)
+				return nil, merry.Wrap(err)
+			}
+		}
+
 		var lbMethod types.LBMethod
 		err := lbMethod.FromString(backend.LBMethod)
 		if err != nil {
@@ -114,6 +146,17 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 			if e != nil {
 				return nil, e
 			}
+			if backend.AdaptiveSplit != nil {
+				// requests are split by broadcast group, so the client group is wrapped by one
+				group, err := broadcast.NewBroadcastGroup(logger, backend.GroupName, backend.DoMultipleRequestsIfSplit, []types.BackendServer{backendServer},
+					expireDelaySec, *backend.ConcurrencyLimit, *backend.MaxBatchSize, timeouts, tldCacheDisabled, requireSuccessAll,
+				)
+				if err != nil {
+					return nil, merry.Wrap(err)
+				}
+				group.SetAdaptiveSplit(backend.AdaptiveSplit)
+				backendServer = group
+			}
 		} else {
 			config := backend
 
@@ -128,18 +171,90 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 				backendServers = append(backendServers, backendServer)
 			}
 
-			backendServer, err = broadcast.NewBroadcastGroup(logger, backend.GroupName, backend.DoMultipleRequestsIfSplit, backendServers,
+			group, err := broadcast.NewBroadcastGroup(logger, backend.GroupName, backend.DoMultipleRequestsIfSplit, backendServers,
 				expireDelaySec, *backend.ConcurrencyLimit, *backend.MaxBatchSize, timeouts, tldCacheDisabled, requireSuccessAll,
 			)
 			if err != nil {
 				return nil, merry.Wrap(err)
 			}
+			group.SetMergePolicy(backend.MergeStrategy, backend.Servers[0])
+			group.SetAdaptiveSplit(backend.AdaptiveSplit)
+			backendServer = group
 		}
 		backendServers = append(backendServers, backendServer)
 	}
 	return backendServers, nil
 }
 
+// createTieredGroups replaces backend groups, which are tiers of tiered groups, by these groups
+func createTieredGroups(logger *zap.Logger, tieredGroups []types.TieredGroup, backends []types.BackendServer) ([]types.BackendServer, merry.Error) {
+	if len(tieredGroups) == 0 {
+		return backends, nil
+	}
+
+	byName := make(map[string]types.BackendServer, len(backends))
+	for _, b := range backends {
+		byName[b.Name()] = b
+	}
+
+	used := make(map[string]bool)
+	result := make([]types.BackendServer, 0, len(backends))
+	for _, tg := range tieredGroups {
+		tiers := make([]tiered.Tier, 0, len(tg.Tiers))
+		for _, t := range tg.Tiers {
+			b, ok := byName[t.Group]
+			if !ok {
+				return nil, merry.Errorf("tiered group '%s' refers to unknown backend group '%s'", tg.GroupName, t.Group)
+			}
+			if used[t.Group] {
+				return nil, merry.Errorf("backend group '%s' is a tier of several tiered groups", t.Group)
+			}
+			used[t.Group] = true
+			tiers = append(tiers, tiered.Tier{Backend: b, Retention: t.Retention})
+		}
+
+		logger.Debug("creating tiered group",
+			zap.String("name", tg.GroupName),
+			zap.Any("tiers", tg.Tiers),
+		)
+		group, err := tiered.New(logger, tg.GroupName, tiers)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, group)
+	}
+
+	for _, b := range backends {
+		if !used[b.Name()] {
+			result = append(result, b)
+		}
+	}
+	return result, nil
+}
+
+// splitShadowGroups separates shadow groups from the backend groups, backends are in the same order as in config
+func splitShadowGroups(backendsV2 types.BackendsV2, backends []types.BackendServer) ([]types.BackendServer, []shadow.Shadow) {
+	var shadows []shadow.Shadow
+	result := make([]types.BackendServer, 0, len(backends))
+	for i, b := range backends {
+		cfg := backendsV2.Backends[i]
+		if cfg.Shadow == nil {
+			result = append(result, b)
+			continue
+		}
+		timeouts := backendsV2.Timeouts
+		if cfg.Timeouts != nil {
+			timeouts = *cfg.Timeouts
+		}
+		shadows = append(shadows, shadow.Shadow{
+			Backend:  b,
+			Config:   *cfg.Shadow,
+			Timeouts: timeouts,
+		})
+	}
+	return result, shadows
+}
+
 // NewZipper allows to create new Zipper
 func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger) (*Zipper, merry.Error) {
 	if !cfg.IsSanitized() {
@@ -153,9 +268,60 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 		)
 	}
 
+	backends, shadows := splitShadowGroups(cfg.BackendsV2, backends)
+	if len(backends) == 0 {
+		logger.Fatal("all backend groups are shadow ones")
+	}
+
+	backends, err = createTieredGroups(logger, cfg.BackendsV2.Tiered, backends)
+	if err != nil {
+		logger.Fatal("errors while initialing tiered groups",
+			zap.Any("error", err),
+		)
+	}
+
+	groups := make([]string, 0, len(backends))
+	for _, b := range backends {
+		groups = append(groups, b.Name())
+	}
+	router, err := routing.New(cfg.BackendsV2.Routing, groups)
+	if err != nil {
+		logger.Fatal("errors while initialing routing rules",
+			zap.Any("error", err),
+		)
+	}
+
+	if err := cfg.BackendsV2.MergeStrategy.Validate(); err != nil {
+		logger.Fatal("invalid merge strategy",
+			zap.Error(err),
+		)
+	}
+	primaryFound := false
+	for _, g := range groups {
+		primaryFound = primaryFound || g == cfg.BackendsV2.PrimaryGroup
+	}
+	if cfg.BackendsV2.MergeStrategy == types.MergePreferPrimary && !primaryFound {
+		logger.Fatal("primary group of prefer-primary-group merge strategy is not found",
+			zap.String("primary_group", cfg.BackendsV2.PrimaryGroup),
+			zap.Strings("groups", groups),
+		)
+	}
+
 	logger.Error("DEBUG ERROR LOGGGGG", zap.Any("cfg", cfg))
-	broadcastGroup, err := broadcast.NewBroadcastGroup(logger, "root", cfg.DoMultipleRequestsIfSplit, backends,
-		int32(cfg.InternalRoutingCache.Seconds()), cfg.ConcurrencyLimitPerServer, *cfg.MaxBatchSize, cfg.Timeouts, cfg.TLDCacheDisabled, cfg.RequireSuccessAll,
+	broadcastGroup, err := broadcast.New(
+		broadcast.WithLogger(logger),
+		broadcast.WithGroupName("root"),
+		broadcast.WithSplitMultipleRequests(cfg.DoMultipleRequestsIfSplit),
+		broadcast.WithBackends(backends),
+		broadcast.WithPathCache(int32(cfg.InternalRoutingCache.Seconds())),
+		broadcast.WithLimiter(cfg.ConcurrencyLimitPerServer),
+		broadcast.WithMaxMetricsPerRequest(*cfg.MaxBatchSize),
+		broadcast.WithTimeouts(cfg.Timeouts),
+		broadcast.WithTLDCache(!cfg.TLDCacheDisabled),
+		broadcast.WithSuccess(cfg.RequireSuccessAll),
+		broadcast.WithRouter(router),
+		broadcast.WithMergePolicy(cfg.BackendsV2.MergeStrategy, cfg.BackendsV2.PrimaryGroup),
+		broadcast.WithCompletenessStats(true),
 	)
 	if err != nil {
 		logger.Fatal("error while initialing zipper store backend",
@@ -163,6 +329,16 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 		)
 	}
 
+	var backend types.BackendServer = broadcastGroup
+	if cfg.Index.Enabled {
+		idx := index.New(logger, backend, cfg.Index, cfg.Timeouts.Find)
+		idx.Start()
+		backend = idx
+	}
+	if len(shadows) > 0 {
+		backend = shadow.New(logger, backend, shadows, sender)
+	}
+
 	z := &Zipper{
 		ProbeQuit:  make(chan struct{}),
 		ProbeForce: make(chan int),
@@ -170,7 +346,7 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 		ScaleToCommonStep: cfg.ScaleToCommonStep,
 		sendStats:         sender,
 
-		backend:                   broadcastGroup,
+		backend:                   backend,
 		concurrencyLimitPerServer: cfg.ConcurrencyLimitPerServer,
 		keepAliveInterval:         cfg.KeepAliveInterval,
 		timeout:                   cfg.Timeouts.Render,
@@ -351,9 +527,35 @@ func (z Zipper) StatsProtoV3(ctx context.Context) (*protov3.MetricDetailsRespons
 
 // Tags
 
-func (z Zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
+func (z Zipper) TagNames(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
 	logger := z.logger.With(zap.String("function", "TagNames"), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
-	data, err := z.backend.TagNames(ctx, query, limit)
+	data, stats, err := z.backend.TagNames(ctx, query, limit)
+	if err != nil {
+		logger.Debug("had errors while fetching result",
+			zap.Any("errors", err),
+		)
+		return data, stats, err
+	}
+
+	return data, stats, nil
+}
+
+func (z Zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, *types.Stats, merry.Error) {
+	logger := z.logger.With(zap.String("function", "TagValues"), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
+	data, stats, err := z.backend.TagValues(ctx, query, limit)
+	if err != nil {
+		logger.Debug("had errors while fetching result",
+			zap.Any("errors", err),
+		)
+		return data, stats, err
+	}
+
+	return data, stats, nil
+}
+
+func (z Zipper) FindSeries(ctx context.Context, exprs []string) ([]string, merry.Error) {
+	logger := z.logger.With(zap.String("function", "FindSeries"), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
+	data, err := z.backend.FindSeries(ctx, exprs)
 	if err != nil {
 		logger.Debug("had errors while fetching result",
 			zap.Any("errors", err),
@@ -364,9 +566,9 @@ func (z Zipper) TagNames(ctx context.Context, query string, limit int64) ([]stri
 	return data, nil
 }
 
-func (z Zipper) TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error) {
-	logger := z.logger.With(zap.String("function", "TagValues"), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
-	data, err := z.backend.TagValues(ctx, query, limit)
+func (z Zipper) TagDetails(ctx context.Context, tag, filter string) (*types.TagDetails, merry.Error) {
+	logger := z.logger.With(zap.String("function", "TagDetails"), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
+	data, err := z.backend.TagDetails(ctx, tag, filter)
 	if err != nil {
 		logger.Debug("had errors while fetching result",
 			zap.Any("errors", err),
@@ -376,3 +578,28 @@ func (z Zipper) TagValues(ctx context.Context, query string, limit int64) ([]str
 
 	return data, nil
 }
+
+func (z Zipper) TagSeries(ctx context.Context, paths []string) ([]string, merry.Error) {
+	logger := z.logger.With(zap.String("function", "TagSeries"), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
+	data, err := z.backend.TagSeries(ctx, paths)
+	if err != nil {
+		logger.Debug("had errors while tagging series",
+			zap.Any("errors", err),
+		)
+		return data, err
+	}
+
+	return data, nil
+}
+
+func (z Zipper) DelSeries(ctx context.Context, paths []string) merry.Error {
+	logger := z.logger.With(zap.String("function", "DelSeries"), zap.String("carbonapi_uuid", utilctx.GetUUID(ctx)))
+	err := z.backend.DelSeries(ctx, paths)
+	if err != nil {
+		logger.Debug("had errors while deleting series",
+			zap.Any("errors", err),
+		)
+	}
+
+	return err
+}